@@ -0,0 +1,143 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"fmt"
+)
+
+// Processor specific e_flags that decide whether objects can share a process,
+// on top of those in multiarch.go
+const (
+	efARMEABIMask  = 0xff000000
+	efARMFloatMask = efARMABIFloatSoft | efARMABIFloatHard
+	efMIPSABIMask  = 0x0000f000 // O32, O64, EABI32 or EABI64
+	efMIPSNaN2008  = 0x00000400
+	efRISCVFloat   = 0x00000006
+	efRISCVRVE     = 0x00000008
+)
+
+// glibcABIMax is one past the highest EI_ABIVERSION glibc's ld.so accepts for
+// ELFOSABI_GNU objects, those using unique symbols, IFUNCs or absolute
+// symbols. Anything else must be version 0.
+const glibcABIMax = 4
+
+// abiMismatch explains why an object built for have can't be loaded into a
+// process built for want, even though the machine and class match, or
+// returns an empty string if it can. Only objects read from an ELF header
+// have their e_flags (and Data) known, so those from a symbol database are
+// always taken to be compatible.
+func abiMismatch(want, have Arch) string {
+	if have.Data == elf.ELFDATANONE {
+		return ""
+	}
+	if osBrand(have.OSABI) == "" && !validABIVersion(have) {
+		return fmt.Sprintf("EI_ABIVERSION %d, which ld.so refuses", have.ABIVersion)
+	}
+	if want.Machine != have.Machine || want.Data == elf.ELFDATANONE {
+		return ""
+	}
+	switch want.Machine {
+	case elf.EM_ARM:
+		w, h := want.Flags&efARMEABIMask, have.Flags&efARMEABIMask
+		if w != 0 && h != 0 && w != h {
+			return fmt.Sprintf("EABI version %d, need %d", h>>24, w>>24)
+		}
+		w, h = want.Flags&efARMFloatMask, have.Flags&efARMFloatMask
+		if w != 0 && h != 0 && w != h {
+			return fmt.Sprintf("%s ABI, need %s", armFloatABI(h), armFloatABI(w))
+		}
+	case elf.EM_MIPS:
+		if want.Class == elf.ELFCLASS32 && want.Flags&efMIPSABI2 != have.Flags&efMIPSABI2 {
+			return fmt.Sprintf("%s ABI, need %s", mipsABI(have), mipsABI(want))
+		}
+		w, h := want.Flags&efMIPSABIMask, have.Flags&efMIPSABIMask
+		if w != 0 && h != 0 && w != h {
+			return fmt.Sprintf("%s ABI, need %s", mipsABI(have), mipsABI(want))
+		}
+		if want.Flags&efMIPSNaN2008 != have.Flags&efMIPSNaN2008 {
+			return fmt.Sprintf("%s NaN encoding, need %s", mipsNaN(have), mipsNaN(want))
+		}
+	case elf.EM_RISCV:
+		w, h := want.Flags&efRISCVFloat, have.Flags&efRISCVFloat
+		if w != h {
+			return fmt.Sprintf("%s ABI, need %s", riscvFloatABI(h), riscvFloatABI(w))
+		}
+		if want.Flags&efRISCVRVE != have.Flags&efRISCVRVE {
+			return "RV32E and RV32I ABIs differ"
+		}
+	}
+	return ""
+}
+
+// validABIVersion determines whether glibc's ld.so will load a Linux object
+// with the ABI version, as in VALID_ELF_ABIVERSION
+func validABIVersion(arch Arch) bool {
+	if arch.OSABI == elf.ELFOSABI_LINUX {
+		return arch.ABIVersion < glibcABIMax
+	}
+	return arch.ABIVersion == 0
+}
+
+// armFloatABI names the float ABI of the EF_ARM_ABI_FLOAT_* flag
+func armFloatABI(flags uint32) string {
+	if flags&efARMABIFloatHard != 0 {
+		return "hard-float"
+	}
+	return "soft-float"
+}
+
+// mipsABI names the MIPS ABI of the object
+func mipsABI(arch Arch) string {
+	if arch.Flags&efMIPSABI2 != 0 {
+		return "n32"
+	}
+	switch arch.Flags & efMIPSABIMask {
+	case 0x2000:
+		return "o64"
+	case 0x3000:
+		return "eabi32"
+	case 0x4000:
+		return "eabi64"
+	}
+	if arch.Class == elf.ELFCLASS64 {
+		return "n64"
+	}
+	return "o32"
+}
+
+// mipsNaN names the NaN encoding of the object
+func mipsNaN(arch Arch) string {
+	if arch.Flags&efMIPSNaN2008 != 0 {
+		return "IEEE 754-2008"
+	}
+	return "legacy"
+}
+
+// riscvFloatABI names the float ABI of the EF_RISCV_FLOAT_ABI field
+func riscvFloatABI(flags uint32) string {
+	switch flags & efRISCVFloat {
+	case 0x2:
+		return "single-float"
+	case 0x4:
+		return "double-float"
+	case 0x6:
+		return "quad-float"
+	}
+	return "soft-float"
+}
@@ -0,0 +1,119 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ABIReportReporter writes the symbols and used_libs report files of
+// abireport, which Clear Linux and Solus packaging already knows how to
+// consume, into a directory.
+//
+// symbols lists each "soname:symbol" exported by the libraries checked, and
+// used_libs each soname they depend on that they don't provide themselves.
+// 32-bit objects are reported separately in symbols32 and used_libs32.
+type ABIReportReporter struct {
+	progress
+	dir    string
+	prefix string // Prepended to each file name, i.e. abi_
+}
+
+// NewABIReportReporter returns an ABIReportReporter writing its files into
+// dir, and progress to the progress writer, which may be nil
+func NewABIReportReporter(dir, prefix string, progressOut io.Writer) *ABIReportReporter {
+	return &ABIReportReporter{
+		progress: progress{w: progressOut},
+		dir:      dir,
+		prefix:   prefix,
+	}
+}
+
+// abiReport is the content of one set of report files
+type abiReport struct {
+	symbols  map[string]bool
+	provides map[string]bool
+	used     map[string]bool
+}
+
+// Complete writes the report files
+func (a *ABIReportReporter) Complete(results []*Result) error {
+	reports := make(map[string]*abiReport)
+	report := func(class string) *abiReport {
+		suffix := ""
+		if class == elf.ELFCLASS32.String() {
+			suffix = "32"
+		}
+		r, ok := reports[suffix]
+		if !ok {
+			r = &abiReport{
+				symbols:  make(map[string]bool),
+				provides: make(map[string]bool),
+				used:     make(map[string]bool),
+			}
+			reports[suffix] = r
+		}
+		return r
+	}
+	// The native report is always written, even when empty
+	report("")
+
+	for _, obj := range objectsOf(results) {
+		if !obj.Target {
+			continue
+		}
+		r := report(obj.Class)
+		if obj.Soname != "" {
+			r.provides[obj.Soname] = true
+			for _, sym := range obj.Exports {
+				r.symbols[obj.Soname+":"+sym] = true
+			}
+		}
+		for _, lib := range obj.Libraries {
+			r.used[lib.Name] = true
+		}
+	}
+
+	for suffix, r := range reports {
+		for name := range r.provides {
+			delete(r.used, name)
+		}
+		if err := a.write("symbols"+suffix, r.symbols); err != nil {
+			return err
+		}
+		if err := a.write("used_libs"+suffix, r.used); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write stores the sorted lines as the named report file
+func (a *ABIReportReporter) write(name string, lines map[string]bool) error {
+	var sorted []string
+	for line := range lines {
+		sorted = append(sorted, line+"\n")
+	}
+	sort.Strings(sorted)
+	path := filepath.Join(a.dir, a.prefix+name)
+	return os.WriteFile(path, []byte(strings.Join(sorted, "")), 0644)
+}
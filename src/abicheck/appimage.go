@@ -0,0 +1,238 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultHostLibraries are the libraries an AppImage is expected to take
+// from the host rather than bundle: glibc itself, and the GL libraries that
+// have to match the host's drivers.
+var DefaultHostLibraries = []string{
+	"ld-linux*.so.*",
+	"libc.so.6",
+	"libm.so.6",
+	"libmvec.so.1",
+	"libdl.so.2",
+	"libpthread.so.0",
+	"librt.so.1",
+	"libresolv.so.2",
+	"libutil.so.1",
+	"libanl.so.1",
+	"libnsl.so.1",
+	"libGL.so.1",
+	"libGLX.so.0",
+	"libGLdispatch.so.0",
+	"libOpenGL.so.0",
+	"libEGL.so.1",
+	"libGLESv2.so.2",
+}
+
+// appRunLibraryDirs are the directories the AppImageKit AppRun puts on
+// LD_LIBRARY_PATH, relative to the AppDir
+var appRunLibraryDirs = []string{
+	"usr/lib",
+	"usr/lib/i386-linux-gnu",
+	"usr/lib/x86_64-linux-gnu",
+	"usr/lib32",
+	"usr/lib64",
+	"lib",
+	"lib/i386-linux-gnu",
+	"lib/x86_64-linux-gnu",
+	"lib32",
+	"lib64",
+}
+
+// AppImage is the filesystem of an AppImage, extracted into a temporary
+// directory, or an AppDir that was already extracted
+type AppImage struct {
+	Root      string // The AppDir
+	extracted bool
+}
+
+// OpenAppImage will extract the squashfs filesystem appended to the AppImage
+// runtime using unsquashfs. A directory is taken to be an extracted AppDir
+// and used as is. Close must be called to remove the extracted files.
+func OpenAppImage(file string) (*AppImage, error) {
+	st, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		root, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		return &AppImage{Root: root}, nil
+	}
+
+	offset, err := appImageOffset(file)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir("", "abicheck-appimage-")
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Join(dir, "squashfs-root")
+	cmd := exec.Command("unsquashfs", "-no-progress", "-offset", strconv.FormatInt(offset, 10), "-dest", root, file)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("unsquashfs %s failed: %v", file, err)
+	}
+	return &AppImage{Root: root, extracted: true}, nil
+}
+
+// appImageOffset returns where the squashfs filesystem starts, which is
+// straight after the runtime's ELF section headers
+func appImageOffset(file string) (int64, error) {
+	fi, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer fi.Close()
+
+	ident := make([]byte, elf.EI_NIDENT)
+	if _, err := fi.ReadAt(ident, 0); err != nil {
+		return 0, fmt.Errorf("%s is not an AppImage: %v", file, err)
+	}
+	if ident[8] != 'A' || ident[9] != 'I' {
+		return 0, fmt.Errorf("%s is not an AppImage", file)
+	}
+	if ident[10] != 2 {
+		return 0, fmt.Errorf("%s is a type %d AppImage, only type 2 is supported", file, ident[10])
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if elf.Data(ident[elf.EI_DATA]) == elf.ELFDATA2MSB {
+		order = binary.BigEndian
+	}
+	r := io.NewSectionReader(fi, 0, 64)
+	var shoff int64
+	var shentsize, shnum int
+	if elf.Class(ident[elf.EI_CLASS]) == elf.ELFCLASS64 {
+		var hdr elf.Header64
+		if err := binary.Read(r, order, &hdr); err != nil {
+			return 0, fmt.Errorf("failed to read AppImage runtime of %s: %v", file, err)
+		}
+		shoff, shentsize, shnum = int64(hdr.Shoff), int(hdr.Shentsize), int(hdr.Shnum)
+	} else {
+		var hdr elf.Header32
+		if err := binary.Read(r, order, &hdr); err != nil {
+			return 0, fmt.Errorf("failed to read AppImage runtime of %s: %v", file, err)
+		}
+		shoff, shentsize, shnum = int64(hdr.Shoff), int(hdr.Shentsize), int(hdr.Shnum)
+	}
+	return shoff + int64(shentsize*shnum), nil
+}
+
+// Close will remove the extracted files, if they were extracted
+func (a *AppImage) Close() error {
+	if !a.extracted {
+		return nil
+	}
+	return os.RemoveAll(filepath.Dir(a.Root))
+}
+
+// LibraryDirs returns the bundled library directories AppRun would search
+func (a *AppImage) LibraryDirs() []string {
+	var ret []string
+	for _, dir := range appRunLibraryDirs {
+		if st, err := os.Stat(filepath.Join(a.Root, dir)); err == nil && st.IsDir() {
+			ret = append(ret, filepath.Join(a.Root, dir))
+		}
+	}
+	return ret
+}
+
+// Rebase will rewrite the bundled paths within the results relative to
+// $APPDIR, so they aren't mistaken for paths on the host
+func (a *AppImage) Rebase(results []*Result) {
+	rebaseResults(results, func(p string) string {
+		if rel, err := filepath.Rel(a.Root, p); err == nil && !strings.HasPrefix(rel, "..") {
+			return path.Join("$APPDIR", rel)
+		}
+		return p
+	})
+}
+
+// SetSelfContained will check that the objects within root only use libraries
+// bundled within it, besides those matching the allowed glob patterns such
+// as DefaultHostLibraries. Any other library found outside it is reported
+// as a host library, as it only works because the host happens to have it.
+// An empty root turns this off.
+func (s *SymbolStore) SetSelfContained(root string, allowed []string) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	if root != "" {
+		root = filepath.Clean(root)
+	}
+	s.bundle = root
+	s.hostLibraries = allowed
+}
+
+// inBundle determines whether the path is within the self-contained bundle
+func (s *SymbolStore) inBundle(path string) bool {
+	return path == s.bundle || strings.HasPrefix(path, s.bundle+"/")
+}
+
+// hostAllowed determines whether the library is expected from the host
+func (s *SymbolStore) hostAllowed(lib LibraryResult) bool {
+	for _, pattern := range s.hostLibraries {
+		if ok, _ := path.Match(pattern, lib.Name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, filepath.Base(lib.Path)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkContained will record every library a bundled entry takes from the
+// host without being allowed to. Host libraries are left to themselves.
+func (s *SymbolStore) checkContained(entry *scopeEntry) {
+	result := entry.result
+	if s.bundle == "" || !s.inBundle(result.Path) {
+		return
+	}
+	for _, libs := range [][]LibraryResult{result.Filtees, result.Libraries} {
+		for _, lib := range libs {
+			if lib.Path == "" || lib.Path == vdsoPath || s.inBundle(s.realPath(lib.Path)) || s.hostAllowed(lib) {
+				continue
+			}
+			err := &HostLibraryError{Importer: result.Path, Library: lib.Name, Path: lib.Path}
+			if s.ignored(err) {
+				continue
+			}
+			result.Host = append(result.Host, lib)
+			s.addFailure(result, err)
+		}
+	}
+}
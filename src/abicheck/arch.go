@@ -0,0 +1,205 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// Arch describes the ABI an object was built for. Unlike elf.FileHeader this
+// also carries the processor specific e_flags, which debug/elf discards.
+type Arch struct {
+	Machine    elf.Machine
+	Class      elf.Class
+	Data       elf.Data
+	OSABI      elf.OSABI
+	ABIVersion uint8 // EI_ABIVERSION, meaning depends on OSABI
+	Flags      uint32
+}
+
+// ReadArch will read the ABI details from the ELF header in r
+func ReadArch(r io.ReaderAt) (Arch, error) {
+	var ident [elf.EI_NIDENT]byte
+	if _, err := r.ReadAt(ident[:], 0); err != nil {
+		return Arch{}, err
+	}
+
+	arch := Arch{
+		Class:      elf.Class(ident[elf.EI_CLASS]),
+		Data:       elf.Data(ident[elf.EI_DATA]),
+		OSABI:      elf.OSABI(ident[elf.EI_OSABI]),
+		ABIVersion: ident[elf.EI_ABIVERSION],
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if arch.Data == elf.ELFDATA2MSB {
+		order = binary.BigEndian
+	}
+
+	// e_machine always follows e_type directly after the ident, but
+	// e_flags moves depending on the size of the address fields.
+	flagsOffset := int64(0x24)
+	if arch.Class == elf.ELFCLASS64 {
+		flagsOffset = 0x30
+	}
+
+	var buf [4]byte
+	if _, err := r.ReadAt(buf[:2], elf.EI_NIDENT+2); err != nil {
+		return Arch{}, err
+	}
+	arch.Machine = elf.Machine(order.Uint16(buf[:2]))
+
+	if _, err := r.ReadAt(buf[:], flagsOffset); err != nil {
+		return Arch{}, err
+	}
+	arch.Flags = order.Uint32(buf[:])
+	return arch, nil
+}
+
+// Is64 determines whether this is a 64-bit ABI
+func (a Arch) Is64() bool {
+	return a.Class == elf.ELFCLASS64
+}
+
+// LittleEndian determines whether this is a little endian ABI
+func (a Arch) LittleEndian() bool {
+	return a.Data == elf.ELFDATA2LSB
+}
+
+// elfObject is an opened ELF file along with the ABI details debug/elf
+// doesn't expose.
+type elfObject struct {
+	*elf.File
+	arch   Arch
+	closer io.Closer
+
+	// virtual is set when the object didn't come from a file on disk
+	virtual bool
+}
+
+// errNotObject is reported for a target that was never ELF, such as an empty
+// or text file
+var errNotObject = errors.New("not an ELF executable or shared library")
+
+// malformedError is returned for a file with the ELF magic that still can't
+// be parsed, as opposed to one that was never ELF to begin with
+type malformedError struct {
+	err error
+}
+
+func (e *malformedError) Error() string {
+	if errors.Is(e.err, io.EOF) || errors.Is(e.err, io.ErrUnexpectedEOF) {
+		return "truncated ELF file"
+	}
+	return e.err.Error()
+}
+
+func (e *malformedError) Unwrap() error { return e.err }
+
+// malformed will wrap err as a *malformedError when r does hold ELF
+func malformed(r io.ReaderAt, err error) error {
+	magic := make([]byte, len(elf.ELFMAG))
+	if _, rerr := r.ReadAt(magic, 0); rerr != nil || !bytes.Equal(magic, []byte(elf.ELFMAG)) {
+		return err
+	}
+	return &malformedError{err: err}
+}
+
+// newObject will parse an ELF object from r
+func newObject(r io.ReaderAt) (*elfObject, error) {
+	file, err := elf.NewFile(r)
+	if err != nil {
+		return nil, malformed(r, err)
+	}
+	arch, err := ReadArch(r)
+	if err != nil {
+		return nil, malformed(r, err)
+	}
+	return &elfObject{
+		File: file,
+		arch: arch,
+	}, nil
+}
+
+// openObject will open the ELF object found at path
+func openObject(path string) (*elfObject, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := newObject(fi)
+	if err != nil {
+		fi.Close()
+		return nil, err
+	}
+	obj.closer = fi
+	return obj, nil
+}
+
+// Close will release the underlying file, if we opened it
+func (o *elfObject) Close() error {
+	if o.closer == nil {
+		return nil
+	}
+	return o.closer.Close()
+}
+
+// isSharedLibrary determines whether the object is a shared library rather
+// than an executable. PIE executables are ET_DYN too, but always request
+// an interpreter.
+func (o *elfObject) isSharedLibrary() bool {
+	return o.FileHeader.Type == elf.ET_DYN && !hasInterp(o.File)
+}
+
+// providesSymbols determines whether the object is loaded as a library.
+// Some, like libc.so.6, can be run directly too and so request an
+// interpreter, but still have a soname.
+func (o *elfObject) providesSymbols() bool {
+	return o.isSharedLibrary() || (o.FileHeader.Type == elf.ET_DYN && soname(o) != "")
+}
+
+// hasInterp determines whether the file requests a program interpreter
+func hasInterp(file *elf.File) bool {
+	for _, prog := range file.Progs {
+		if prog.Type == elf.PT_INTERP {
+			return true
+		}
+	}
+	return false
+}
+
+// interpreter returns the PT_INTERP path of the file, such as
+// /lib64/ld-linux-x86-64.so.2, or an empty string if there isn't one
+func interpreter(file *elf.File) (string, error) {
+	for _, prog := range file.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		data, err := io.ReadAll(prog.Open())
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\x00"), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,375 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Thin archives only reference their members, arMagic is for the rest
+const (
+	arThinMagic  = "!<thin>\n"
+	arHeaderSize = 60
+)
+
+// linkerDefinedSymbols are provided by the linker itself, so are never
+// dragged in from a library
+var linkerDefinedSymbols = map[string]bool{
+	"_GLOBAL_OFFSET_TABLE_": true,
+	"_DYNAMIC":              true,
+	"__ehdr_start":          true,
+	"__executable_start":    true,
+	"__bss_start":           true,
+	"_edata":                true,
+	"_end":                  true,
+	"__init_array_start":    true,
+	"__init_array_end":      true,
+	"__fini_array_start":    true,
+	"__fini_array_end":      true,
+	"__preinit_array_start": true,
+	"__preinit_array_end":   true,
+	"__dso_handle":          true,
+	"__TMC_END__":           true,
+}
+
+// ArchiveMember is a single relocatable object within a static archive
+type ArchiveMember struct {
+	Name      string   `json:"name"`
+	Machine   string   `json:"machine"`
+	Class     string   `json:"class"`
+	Defined   []string `json:"defined,omitempty"`
+	Undefined []string `json:"undefined,omitempty"`
+	Weak      []string `json:"weak,omitempty"` // Undefined, but weak
+}
+
+// Archive is a static library (ar archive) of relocatable objects. Members
+// that aren't ELF objects, such as LLVM bitcode, are skipped.
+type Archive struct {
+	Path    string          `json:"path"`
+	Members []ArchiveMember `json:"members"`
+}
+
+// ArchiveSymbol is a symbol an archive needs from outside itself
+type ArchiveSymbol struct {
+	Name  string   `json:"name"`
+	Weak  bool     `json:"weak,omitempty"`  // Only ever referenced weakly
+	Users []string `json:"users,omitempty"` // Members referencing it
+}
+
+// IsArchive determines whether the file at path is an ar archive
+func IsArchive(path string) bool {
+	fi, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer fi.Close()
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(fi, magic); err != nil {
+		return false
+	}
+	return string(magic) == arMagic || string(magic) == arThinMagic
+}
+
+// ReadArchive will read the symbols of every object within the archive.
+// Thin archives have their members read from beside the archive, and a
+// linker script (such as glibc's libm.a) has the archives it names read.
+func ReadArchive(path string) (*Archive, error) {
+	return readArchive(path, 0)
+}
+
+// readArchive does the work of ReadArchive, depth being how many linker
+// scripts led to it
+func readArchive(path string, depth int) (*Archive, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	thin := bytes.HasPrefix(data, []byte(arThinMagic))
+	if !thin && !bytes.HasPrefix(data, []byte(arMagic)) {
+		if isLinkerScript(data) && depth < maxScriptDepth {
+			return readArchiveScript(path, data, depth)
+		}
+		// ld takes a lone object too, as glibc's libmcheck.a is
+		if bytes.HasPrefix(data, []byte(elf.ELFMAG)) {
+			member, err := readArchiveMember(filepath.Base(path), data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			return &Archive{Path: path, Members: []ArchiveMember{*member}}, nil
+		}
+		return nil, fmt.Errorf("%s is not an ar archive", path)
+	}
+
+	ret := &Archive{Path: path}
+	var names []byte
+	for off := len(arMagic); off+arHeaderSize <= len(data); {
+		hdr := data[off : off+arHeaderSize]
+		off += arHeaderSize
+		if string(hdr[58:60]) != "`\n" {
+			return nil, fmt.Errorf("%s: bad member header at %d", path, off-arHeaderSize)
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("%s: bad member size at %d", path, off-arHeaderSize)
+		}
+		name := strings.TrimRight(string(hdr[:16]), " ")
+
+		// Only the symbol and name tables are within thin archives
+		special := name == "/" || name == "//" || name == "/SYM64/"
+		end := off
+		if !thin || special {
+			end = off + int(size)
+			if end > len(data) {
+				return nil, fmt.Errorf("%s: member %s is truncated", path, name)
+			}
+		}
+		body := data[off:end]
+		// Members are padded to an even offset
+		off = end + end%2
+
+		switch {
+		case name == "//":
+			names = body
+			continue
+		case special, strings.HasPrefix(name, "__.SYMDEF"):
+			continue
+		case strings.HasPrefix(name, "#1/"):
+			// BSD puts long names at the start of the data
+			n, err := strconv.Atoi(name[3:])
+			if err != nil || n > len(body) {
+				return nil, fmt.Errorf("%s: bad member name %s", path, name)
+			}
+			name = string(bytes.TrimRight(body[:n], "\x00"))
+			body = body[n:]
+		case strings.HasPrefix(name, "/"):
+			// GNU long names are offsets into the // table
+			n, err := strconv.Atoi(name[1:])
+			if err != nil || n > len(names) {
+				return nil, fmt.Errorf("%s: bad member name %s", path, name)
+			}
+			name = string(names[n:])
+			if idx := strings.Index(name, "\n"); idx >= 0 {
+				name = name[:idx]
+			}
+			name = strings.TrimSuffix(name, "/")
+		default:
+			name = strings.TrimSuffix(name, "/")
+		}
+
+		if thin {
+			member := name
+			if !filepath.IsAbs(member) {
+				member = filepath.Join(filepath.Dir(path), member)
+			}
+			if body, err = os.ReadFile(member); err != nil {
+				return nil, err
+			}
+		}
+		if !bytes.HasPrefix(body, []byte(elf.ELFMAG)) {
+			continue
+		}
+		member, err := readArchiveMember(name, body)
+		if err != nil {
+			return nil, fmt.Errorf("%s(%s): %v", path, name, err)
+		}
+		ret.Members = append(ret.Members, *member)
+	}
+	return ret, nil
+}
+
+// readArchiveScript will merge the archives named by the linker script, with
+// each of their members named as archive(member)
+func readArchiveScript(path string, data []byte, depth int) (*Archive, error) {
+	inputs, err := ParseLinkerScript(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	ret := &Archive{Path: path}
+	for _, input := range inputs {
+		name := input.Name
+		if !strings.HasSuffix(name, ".a") {
+			continue
+		}
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(path), name)
+		}
+		arc, err := readArchive(name, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range arc.Members {
+			member.Name = fmt.Sprintf("%s(%s)", filepath.Base(name), member.Name)
+			ret.Members = append(ret.Members, member)
+		}
+	}
+	return ret, nil
+}
+
+// readArchiveMember reads the global symbols of a relocatable object
+func readArchiveMember(name string, data []byte) (*ArchiveMember, error) {
+	e, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer e.Close()
+	if e.Type != elf.ET_REL {
+		return nil, fmt.Errorf("not a relocatable object")
+	}
+	syms, err := e.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+
+	ret := &ArchiveMember{
+		Name:    name,
+		Machine: e.Machine.String(),
+		Class:   e.Class.String(),
+	}
+	for _, sym := range syms {
+		bind := elf.ST_BIND(sym.Info)
+		if sym.Name == "" || (bind != elf.STB_GLOBAL && bind != elf.STB_WEAK && bind != stbGNUUnique) {
+			continue
+		}
+		switch {
+		case sym.Section != elf.SHN_UNDEF:
+			ret.Defined = append(ret.Defined, sym.Name)
+		case linkerDefinedSymbols[sym.Name], strings.HasPrefix(sym.Name, "__start_"), strings.HasPrefix(sym.Name, "__stop_"):
+			continue
+		case bind == elf.STB_WEAK:
+			ret.Weak = append(ret.Weak, sym.Name)
+		default:
+			ret.Undefined = append(ret.Undefined, sym.Name)
+		}
+	}
+	return ret, nil
+}
+
+// External returns every symbol the members need that none of them define,
+// sorted by name. These are what pulling the archive into a link needs from
+// elsewhere, presuming every member is used.
+func (a *Archive) External() []ArchiveSymbol {
+	defined := make(map[string]bool)
+	for _, member := range a.Members {
+		for _, name := range member.Defined {
+			defined[name] = true
+		}
+	}
+
+	needed := make(map[string]*ArchiveSymbol)
+	add := func(name, member string, weak bool) {
+		if defined[name] {
+			return
+		}
+		sym := needed[name]
+		if sym == nil {
+			sym = &ArchiveSymbol{Name: name, Weak: true}
+			needed[name] = sym
+		}
+		sym.Weak = sym.Weak && weak
+		if len(sym.Users) == 0 || sym.Users[len(sym.Users)-1] != member {
+			sym.Users = append(sym.Users, member)
+		}
+	}
+	for _, member := range a.Members {
+		for _, name := range member.Undefined {
+			add(name, member.Name, false)
+		}
+		for _, name := range member.Weak {
+			add(name, member.Name, true)
+		}
+	}
+
+	ret := make([]ArchiveSymbol, 0, len(needed))
+	for _, sym := range needed {
+		ret = append(ret, *sym)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// ArchiveLibrary is a shared library an archive drags into the link
+type ArchiveLibrary struct {
+	Library string   `json:"library"`
+	Path    string   `json:"path"`
+	Package string   `json:"package,omitempty"`
+	Symbols []string `json:"symbols"`
+}
+
+// ArchiveRequirements is what linking against an archive needs
+type ArchiveRequirements struct {
+	Path       string           `json:"path"`
+	Libraries  []ArchiveLibrary `json:"libraries"`
+	Unresolved []ArchiveSymbol  `json:"unresolved,omitempty"`
+}
+
+// Requirements will find the libraries within the index providing each of
+// the archive's external symbols, sorted by library. Only libraries of the
+// same machine as the members are used. When more than one exports a
+// symbol, versioned definitions win over the unversioned ones interposers
+// like libasan provide, and then the first by path. Weak references that
+// nothing provides are left out, as the link doesn't need them.
+func (a *Archive) Requirements(db SymbolDatabase) (*ArchiveRequirements, error) {
+	ret := &ArchiveRequirements{Path: a.Path}
+	machine := ""
+	if len(a.Members) > 0 {
+		machine = a.Members[0].Machine
+	}
+
+	libs := make(map[string]*ArchiveLibrary)
+	for _, sym := range a.External() {
+		providers, err := db.Providers(sym.Name, "")
+		if err != nil {
+			return nil, err
+		}
+		var provider *Provider
+		for _, p := range providers {
+			if p.Machine != machine {
+				continue
+			}
+			if provider == nil || (provider.Version == "" && p.Version != "") {
+				p := p
+				provider = &p
+			}
+		}
+		if provider == nil {
+			if !sym.Weak {
+				ret.Unresolved = append(ret.Unresolved, sym)
+			}
+			continue
+		}
+		lib := libs[provider.Library]
+		if lib == nil {
+			lib = &ArchiveLibrary{Library: provider.Library, Path: provider.Path, Package: provider.Package}
+			libs[provider.Library] = lib
+		}
+		lib.Symbols = append(lib.Symbols, sym.Name)
+	}
+
+	for _, lib := range libs {
+		ret.Libraries = append(ret.Libraries, *lib)
+	}
+	sort.Slice(ret.Libraries, func(i, j int) bool { return ret.Libraries[i].Library < ret.Libraries[j].Library })
+	return ret, nil
+}
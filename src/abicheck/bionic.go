@@ -0,0 +1,94 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// bionicLinkers are the interpreters of Android programs
+var bionicLinkers = []string{"/system/bin/linker64", "/system/bin/linker"}
+
+// bionicPartitions hold the libraries of the default namespace, in the
+// order Android's linker searches them
+var bionicPartitions = []string{"/system", "/odm", "/vendor"}
+
+// bionicRuntime is the APEX module holding bionic itself, libc.so, libm.so
+// and libdl.so, which the copies in /system are links to
+const bionicRuntime = "/apex/com.android.runtime"
+
+// isBionicInterp determines whether the interpreter is Android's linker
+func isBionicInterp(interp string) bool {
+	for _, linker := range bionicLinkers {
+		if interp == linker {
+			return true
+		}
+	}
+	return false
+}
+
+// loadBionicConfig will find the APEX modules of the sysroot. Each module
+// is mounted twice on a device, once with its version in the name, so only
+// the unversioned one is kept.
+func (s *SymbolStore) loadBionicConfig() error {
+	s.apexModules = nil
+	matches, err := filepath.Glob(s.rooted("/apex/*"))
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		name := filepath.Base(match)
+		if strings.Contains(name, "@") {
+			continue
+		}
+		if st, err := os.Stat(match); err != nil || !st.IsDir() {
+			continue
+		}
+		s.apexModules = append(s.apexModules, "/apex/"+name)
+	}
+	sort.Strings(s.apexModules)
+	return nil
+}
+
+// bionicLibDir returns the name of the library directories for the ABI
+func bionicLibDir(arch Arch) string {
+	if arch.Class == elf.ELFCLASS64 {
+		return "lib64"
+	}
+	return "lib"
+}
+
+// bionicSearchPaths returns the directories Android's linker searches for
+// the libraries an object needs
+func (s *SymbolStore) bionicSearchPaths(arch Arch, runpaths []string) []string {
+	lib := bionicLibDir(arch)
+	var ret []string
+	ret = append(ret, s.libraryPath...)
+	ret = append(ret, runpaths...)
+	for _, dir := range bionicPartitions {
+		ret = append(ret, s.rooted(filepath.Join(dir, lib)))
+	}
+	ret = append(ret, s.rooted(filepath.Join(bionicRuntime, lib, "bionic")))
+	for _, dir := range s.apexModules {
+		ret = append(ret, s.rooted(filepath.Join(dir, lib)))
+	}
+	return ret
+}
@@ -0,0 +1,260 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FreeBSDHintsPath is where ldconfig saves the library directories of
+	// FreeBSD systems, with FreeBSDHints32Path for the 32-bit compat ones
+	FreeBSDHintsPath   = "/var/run/ld-elf.so.hints"
+	FreeBSDHints32Path = "/var/run/ld-elf32.so.hints"
+
+	// OpenBSDHintsPath is the same for OpenBSD
+	OpenBSDHintsPath = "/var/run/ld.so.hints"
+)
+
+const (
+	// elfHintsMagic starts FreeBSD hints files, "Ehnt"
+	elfHintsMagic = 0x746e6845
+
+	// openbsdHintsMagic starts OpenBSD ones, as a long
+	openbsdHintsMagic = 011421044151
+)
+
+// The interpreters of each BSD
+var (
+	freebsdLinkers = []string{"/libexec/ld-elf.so.1", "/libexec/ld-elf32.so.1"}
+	openbsdLinker  = "/usr/libexec/ld.so"
+)
+
+// bsdDefaultPath is searched after the hints, for FreeBSD
+var bsdDefaultPath = []string{"/lib", "/usr/lib"}
+
+// errHintsBounds is returned when the directory list of a hints file lies
+// outside of it
+var errHintsBounds = errors.New("hints directory list out of bounds")
+
+// ParseElfHints will return the directories listed in a FreeBSD
+// ld-elf.so.hints file, in search order
+func ParseElfHints(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 24 {
+		return nil, errors.New("truncated hints header")
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if order.Uint32(data) != elfHintsMagic {
+		order = binary.BigEndian
+		if order.Uint32(data) != elfHintsMagic {
+			return nil, errors.New("not an ld-elf.so.hints file")
+		}
+	}
+	if version := order.Uint32(data[4:]); version != 1 {
+		return nil, fmt.Errorf("unsupported hints version %d", version)
+	}
+	strtab := uint64(order.Uint32(data[8:]))
+	dirlist := uint64(order.Uint32(data[16:]))
+	dirlen := uint64(order.Uint32(data[20:]))
+	return hintsDirs(data, strtab+dirlist, dirlen)
+}
+
+// ParseOpenBSDHints will return the directories listed in an OpenBSD
+// ld.so.hints file. Its header is made of longs, so the size and byte
+// order of the machine writing it are worked out from the magic.
+func ParseOpenBSDHints(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for _, size := range []int{8, 4} {
+			if len(data) < size*8 {
+				continue
+			}
+			field := func(i int) uint64 {
+				if size == 8 {
+					return order.Uint64(data[i*8:])
+				}
+				return uint64(order.Uint32(data[i*4:]))
+			}
+			if field(0) != openbsdHintsMagic {
+				continue
+			}
+			// hh_strtab, and hh_dirlist within it. Longs are 64 bits
+			// wide at most, so the sum can wrap.
+			strtab, dirlist := field(4), field(7)
+			offset := strtab + dirlist
+			if offset < strtab || offset > uint64(len(data)) {
+				return nil, errHintsBounds
+			}
+			end := bytes.IndexByte(data[offset:], 0)
+			if end < 0 {
+				return nil, errors.New("unterminated hints directory list")
+			}
+			return hintsDirs(data, offset, uint64(end))
+		}
+	}
+	return nil, errors.New("not an ld.so.hints file")
+}
+
+// hintsDirs splits the colon separated directory list at offset
+func hintsDirs(data []byte, offset, length uint64) ([]string, error) {
+	if offset > uint64(len(data)) || length > uint64(len(data))-offset {
+		return nil, errHintsBounds
+	}
+	var ret []string
+	for _, dir := range strings.Split(string(data[offset:offset+length]), ":") {
+		if dir != "" {
+			ret = append(ret, dir)
+		}
+	}
+	return ret, nil
+}
+
+// loadBSDConfig will read the hints files of the sysroot, returning which
+// BSD it is, if any
+func (s *SymbolStore) loadBSDConfig() (string, error) {
+	s.hints = make(map[string][]string)
+	for path, parse := range map[string]func(string) ([]string, error){
+		FreeBSDHintsPath:   ParseElfHints,
+		FreeBSDHints32Path: ParseElfHints,
+		OpenBSDHintsPath:   ParseOpenBSDHints,
+	} {
+		dirs, err := parse(s.rooted(path))
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to parse %s: %v", s.rooted(path), err)
+		}
+		s.hints[path] = dirs
+	}
+	if _, err := os.Stat(s.rooted(freebsdLinkers[0])); err == nil {
+		return LibcFreeBSD, nil
+	}
+	if _, err := os.Stat(s.rooted(openbsdLinker)); err == nil {
+		return LibcOpenBSD, nil
+	}
+	return "", nil
+}
+
+// isFreeBSDInterp determines whether the interpreter is FreeBSD's rtld
+func isFreeBSDInterp(interp string) bool {
+	for _, linker := range freebsdLinkers {
+		if interp == linker {
+			return true
+		}
+	}
+	return false
+}
+
+// osBrand returns the operating system an object is branded for by its
+// OSABI, or an empty string when it isn't (Linux objects are mostly
+// ELFOSABI_NONE, or ELFOSABI_LINUX when using GNU extensions). OpenBSD
+// brands with a note instead, so can't be told apart here.
+func osBrand(osabi elf.OSABI) string {
+	switch osabi {
+	case elf.ELFOSABI_NONE, elf.ELFOSABI_LINUX:
+		return ""
+	default:
+		return osabi.String()
+	}
+}
+
+// otherBrand determines whether a library already loaded is branded for
+// another OS than the importer. Those from a symbol database aren't
+// branded at all, so are never turned down.
+func otherBrand(want, have Arch) bool {
+	return have.Data != elf.ELFDATANONE && osBrand(have.OSABI) != osBrand(want.OSABI)
+}
+
+// freebsdSearchPaths returns the directories FreeBSD's rtld searches for
+// the libraries an object needs: DT_RPATH (without a DT_RUNPATH), then
+// LD_LIBRARY_PATH, DT_RUNPATH, the hints and finally /lib:/usr/lib, or
+// /usr/lib32 for 32-bit programs on a 64-bit system
+func (s *SymbolStore) freebsdSearchPaths(arch Arch, rpaths, runpaths []string) []string {
+	var ret []string
+	ret = append(ret, rpaths...)
+	ret = append(ret, s.libraryPath...)
+	ret = append(ret, runpaths...)
+	hints, defaults := s.hints[FreeBSDHintsPath], bsdDefaultPath
+	if arch.Class == elf.ELFCLASS32 && s.hints[FreeBSDHints32Path] != nil {
+		hints, defaults = s.hints[FreeBSDHints32Path], []string{"/usr/lib32"}
+	}
+	for _, dir := range append(append([]string(nil), hints...), defaults...) {
+		ret = append(ret, s.rooted(dir))
+	}
+	return ret
+}
+
+// openbsdSearchPaths returns the directories OpenBSD's ld.so searches:
+// LD_LIBRARY_PATH, DT_RUNPATH or DT_RPATH, the hints and then /usr/lib
+func (s *SymbolStore) openbsdSearchPaths(rpaths, runpaths []string) []string {
+	var ret []string
+	ret = append(ret, s.libraryPath...)
+	ret = append(ret, runpaths...)
+	ret = append(ret, rpaths...)
+	for _, dir := range append(append([]string(nil), s.hints[OpenBSDHintsPath]...), "/usr/lib") {
+		ret = append(ret, s.rooted(dir))
+	}
+	return ret
+}
+
+// openbsdVersions splits an OpenBSD library name such as libc.so.97.1 into
+// the name up to the major version, and the minor version
+func openbsdVersions(library string) (string, int, bool) {
+	idx := strings.LastIndexByte(library, '.')
+	if idx < 0 || !strings.Contains(library[:idx], ".so.") {
+		return "", 0, false
+	}
+	minor, err := strconv.Atoi(library[idx+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return library[:idx+1], minor, true
+}
+
+// openbsdCandidate returns the library in dir that OpenBSD's ld.so would
+// use for the name. Any with the same major version and at least the same
+// minor version will do, and the newest is picked.
+func (s *SymbolStore) openbsdCandidate(dir, library string) string {
+	prefix, wanted, ok := openbsdVersions(library)
+	if !ok {
+		return ""
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, prefix+"*"))
+	best, bestMinor := "", -1
+	for _, match := range matches {
+		_, minor, ok := openbsdVersions(filepath.Base(match))
+		if !ok || minor < wanted || minor <= bestMinor || s.appendIfRegular(nil, match) == nil {
+			continue
+		}
+		best, bestMinor = match, minor
+	}
+	return best
+}
@@ -0,0 +1,164 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// elfHints returns a FreeBSD hints file listing the directories, with the
+// string table after the 128 byte header
+func elfHints(order binary.ByteOrder, dirs string) []byte {
+	data := make([]byte, 128)
+	order.PutUint32(data, elfHintsMagic)
+	order.PutUint32(data[4:], 1)
+	order.PutUint32(data[8:], 128)
+	order.PutUint32(data[12:], uint32(len(dirs)+1))
+	order.PutUint32(data[16:], 0)
+	order.PutUint32(data[20:], uint32(len(dirs)))
+	return append(append(data, dirs...), 0)
+}
+
+// openbsdHints returns an OpenBSD hints file with longs of the given size,
+// with an empty hash table and the directories at the start of the strings
+func openbsdHints(order binary.ByteOrder, size int, dirs string) []byte {
+	data := make([]byte, 8*size)
+	put := func(i int, v uint64) {
+		if size == 8 {
+			order.PutUint64(data[i*8:], v)
+		} else {
+			order.PutUint32(data[i*4:], uint32(v))
+		}
+	}
+	put(0, openbsdHintsMagic)
+	put(1, 2)
+	put(4, uint64(len(data)))
+	put(5, uint64(len(dirs)+1))
+	put(7, 0)
+	return append(append(data, dirs...), 0)
+}
+
+// withField returns a copy of the data with a 32 or 64-bit field replaced
+func withField(data []byte, order binary.ByteOrder, offset, size int, v uint64) []byte {
+	ret := append([]byte(nil), data...)
+	if size == 8 {
+		order.PutUint64(ret[offset:], v)
+	} else {
+		order.PutUint32(ret[offset:], uint32(v))
+	}
+	return ret
+}
+
+func TestParseElfHints(t *testing.T) {
+	le, be := binary.LittleEndian, binary.BigEndian
+	valid := elfHints(le, "/lib:/usr/lib")
+	tests := []struct {
+		name string
+		data []byte
+		want []string
+		err  string
+	}{
+		{name: "little endian", data: valid, want: []string{"/lib", "/usr/lib"}},
+		{name: "big endian", data: elfHints(be, "/lib:/usr/local/lib"), want: []string{"/lib", "/usr/local/lib"}},
+		{name: "empty entries", data: elfHints(le, ":/lib::/usr/lib:"), want: []string{"/lib", "/usr/lib"}},
+		{name: "no directories", data: elfHints(le, ""), want: nil},
+		{name: "empty", data: nil, err: "truncated hints header"},
+		{name: "truncated header", data: valid[:23], err: "truncated hints header"},
+		{name: "bad magic", data: withField(valid, le, 0, 4, 0x11111111), err: "not an ld-elf.so.hints file"},
+		{name: "other version", data: withField(valid, le, 4, 4, 2), err: "unsupported hints version 2"},
+		{name: "string table past the end", data: withField(valid, le, 8, 4, 0xffffffff), err: errHintsBounds.Error()},
+		{name: "list past the end", data: withField(valid, le, 16, 4, 0xffffffff), err: errHintsBounds.Error()},
+		{name: "list too long", data: withField(valid, le, 20, 4, 0xffffffff), err: errHintsBounds.Error()},
+		{name: "truncated list", data: valid[:len(valid)-5], err: errHintsBounds.Error()},
+	}
+	for _, test := range tests {
+		got, err := ParseElfHints(testFile(t, "ld-elf.so.hints", test.data))
+		switch {
+		case test.err != "":
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: got %v, want %s", test.name, err, test.err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseOpenBSDHints(t *testing.T) {
+	le, be := binary.LittleEndian, binary.BigEndian
+	valid := openbsdHints(le, 8, "/usr/lib:/usr/local/lib")
+	tests := []struct {
+		name string
+		data []byte
+		want []string
+		err  string
+	}{
+		{name: "64-bit little endian", data: valid, want: []string{"/usr/lib", "/usr/local/lib"}},
+		{name: "64-bit big endian", data: openbsdHints(be, 8, "/usr/lib"), want: []string{"/usr/lib"}},
+		{name: "32-bit little endian", data: openbsdHints(le, 4, "/usr/lib:/usr/X11R6/lib"), want: []string{"/usr/lib", "/usr/X11R6/lib"}},
+		{name: "32-bit big endian", data: openbsdHints(be, 4, "/usr/lib"), want: []string{"/usr/lib"}},
+		{name: "no directories", data: openbsdHints(le, 8, ""), want: nil},
+		{name: "empty", data: nil, err: "not an ld.so.hints file"},
+		{name: "truncated header", data: valid[:31], err: "not an ld.so.hints file"},
+		{name: "bad magic", data: withField(valid, le, 0, 8, 1), err: "not an ld.so.hints file"},
+		{name: "unterminated", data: valid[:len(valid)-1], err: "unterminated hints directory list"},
+		{name: "strings past the end", data: withField(valid, le, 4*8, 8, 1<<40), err: errHintsBounds.Error()},
+		{name: "list at the end", data: withField(valid, le, 7*8, 8, uint64(len(valid)-64)), err: "unterminated hints directory list"},
+		{name: "list far past the end", data: withField(valid, le, 7*8, 8, 1<<40), err: errHintsBounds.Error()},
+		// Offsets that wrap around back into the file
+		{name: "wrapping list", data: withField(valid, le, 7*8, 8, ^uint64(0)-63), err: errHintsBounds.Error()},
+	}
+	for _, test := range tests {
+		got, err := ParseOpenBSDHints(testFile(t, "ld.so.hints", test.data))
+		switch {
+		case test.err != "":
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: got %v, want %s", test.name, err, test.err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOpenBSDVersions(t *testing.T) {
+	tests := []struct {
+		library string
+		prefix  string
+		minor   int
+		ok      bool
+	}{
+		{"libc.so.97.1", "libc.so.97.", 1, true},
+		{"libc.so.97.10", "libc.so.97.", 10, true},
+		{"libc.so.97", "", 0, false},
+		{"libc.so", "", 0, false},
+		{"libc.so.97.x", "", 0, false},
+		{"libfoo.a", "", 0, false},
+	}
+	for _, test := range tests {
+		prefix, minor, ok := openbsdVersions(test.library)
+		if prefix != test.prefix || minor != test.minor || ok != test.ok {
+			t.Errorf("%s: got %q, %d, %v", test.library, prefix, minor, ok)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Unresolved describes a single symbol reference that couldn't be bound to
+// any provider within the process space.
+type Unresolved struct {
+	Importer string // Object containing the reference
+	Name     string
+	Version  string
+	Weak     bool
+}
+
+// String returns the conventional name@version form of the symbol
+func (u *Unresolved) String() string {
+	return symbolString(u.Name, u.Version)
+}
+
+// Result is the outcome of checking a single target object
+type Result struct {
+	Path string // The target that was checked
+
+	// Objects holds the target and each library that was newly loaded on
+	// its behalf. Libraries already loaded by a previous check in the
+	// same store are not repeated.
+	Objects []*ObjectResult
+
+	// Unresolved contains every symbol reference that failed to bind,
+	// including those from the libraries loaded for the target.
+	Unresolved []Unresolved
+}
+
+// NumFailures returns the total number of failures within the result
+func (r *Result) NumFailures() int {
+	n := 0
+	for _, obj := range r.Objects {
+		n += len(obj.Failures)
+	}
+	return n
+}
+
+// OK determines whether the target resolved completely
+func (r *Result) OK() bool {
+	return r.NumFailures() == 0
+}
+
+// Checker is the main entry point for embedding ABI checks. It wraps a
+// SymbolStore which is reused between checks, so that libraries common to
+// many targets are only ever loaded once.
+type Checker struct {
+	Store *SymbolStore
+}
+
+// NewChecker will return a Checker using a newly created SymbolStore
+func NewChecker() *Checker {
+	return &Checker{
+		Store: NewSymbolStore(),
+	}
+}
+
+// Fork returns a Checker using a fork of this one's store, see
+// SymbolStore.Fork
+func (c *Checker) Fork() *Checker {
+	return &Checker{
+		Store: c.Store.Fork(),
+	}
+}
+
+// Check will scan the target at path and return the result of resolving
+// it and all of its dependencies.
+func (c *Checker) Check(path string) (*Result, error) {
+	return c.CheckContext(context.Background(), path)
+}
+
+// CheckContext is Check, giving up with the context's error once it is done
+func (c *Checker) CheckContext(ctx context.Context, path string) (*Result, error) {
+	result, err := c.check(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	c.complete(result)
+	return result, nil
+}
+
+// complete emits the ScanCompleteEvent for the result
+func (c *Checker) complete(result *Result) {
+	c.Store.config.RLock()
+	defer c.Store.config.RUnlock()
+	c.Store.emit(&ScanCompleteEvent{Result: result})
+}
+
+// check is CheckContext, leaving the caller to complete the result once it
+// has added anything else to it
+func (c *Checker) check(ctx context.Context, path string) (*Result, error) {
+	c.Store.config.RLock()
+	defer c.Store.config.RUnlock()
+	objects, err := c.Store.scanPath(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Path:    path,
+		Objects: objects,
+	}
+	for _, obj := range result.Objects {
+		for _, sym := range obj.Unresolved() {
+			if sym.Weak && !c.Store.strictWeak {
+				continue
+			}
+			result.Unresolved = append(result.Unresolved, Unresolved{
+				Importer: obj.Path,
+				Name:     sym.Name,
+				Version:  sym.Version,
+				Weak:     sym.Weak,
+			})
+		}
+	}
+	return result, nil
+}
+
+// CheckTree will walk the directory tree at root and check every ELF
+// executable and shared library found within it.
+func (c *Checker) CheckTree(root string, jobs int) ([]*Result, error) {
+	return c.CheckTreeContext(context.Background(), root, jobs)
+}
+
+// CheckTreeContext is CheckTree, giving up with the context's error once it
+// is done
+func (c *Checker) CheckTreeContext(ctx context.Context, root string, jobs int) ([]*Result, error) {
+	var paths []string
+	err := WalkELF(root, func(path string) error {
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.CheckAllContext(ctx, paths, jobs)
+}
+
+// CheckPackage will check every ELF object within the package file at path,
+// resolving against the package's own contents before the system (or
+// sysroot) libraries. The package is read into memory, not installed.
+func (c *Checker) CheckPackage(path string, jobs int) ([]*Result, error) {
+	overlay, err := ReadPackage(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.CheckAll(c.Store.AddOverlay(overlay), jobs)
+}
+
+// CheckReader will check the ELF object read from r as though it were
+// installed at name, without it ever being written to disk, such as one
+// streamed out of a tarball or a network response. It's added to the
+// store's overlay (see Overlay.AddReader), so later objects may resolve
+// against it too.
+func (c *Checker) CheckReader(name string, r io.ReaderAt) (*Result, error) {
+	return c.CheckReaderContext(context.Background(), name, r)
+}
+
+// CheckReaderContext is CheckReader, giving up with the context's error once
+// it is done
+func (c *Checker) CheckReaderContext(ctx context.Context, name string, r io.ReaderAt) (*Result, error) {
+	overlay := NewOverlay()
+	overlay.AddReader(name, r)
+	paths := c.Store.AddOverlay(overlay)
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s is not an ELF executable or shared library", name)
+	}
+	return c.CheckContext(ctx, paths[0])
+}
+
+// CheckAll will check every path using a pool of jobs workers, sharing the
+// one SymbolStore between them. Results are returned in the same order as
+// the input paths. The first error encountered is returned.
+//
+// As the paths are taken to make up the whole process space, executables
+// among them are used as providers for any plugins that are also present,
+// unless disabled with SetExecutableExports.
+func (c *Checker) CheckAll(paths []string, jobs int) ([]*Result, error) {
+	return c.CheckAllContext(context.Background(), paths, jobs)
+}
+
+// CheckAllContext is CheckAll, giving up with the context's error once it
+// is done. Checks already under way stop at the next object they load.
+func (c *Checker) CheckAllContext(ctx context.Context, paths []string, jobs int) ([]*Result, error) {
+	c.Store.config.RLock()
+	if c.Store.executableExports {
+		hosts := make([]*Library, len(paths))
+		parallel(len(paths), jobs, func(idx int) {
+			hosts[idx] = c.Store.hostExecutable(paths[idx])
+		})
+		c.Store.addHosts(hosts)
+	}
+	c.Store.config.RUnlock()
+
+	results := make([]*Result, len(paths))
+	errs := make([]error, len(paths))
+	parallel(len(paths), jobs, func(idx int) {
+		results[idx], errs[idx] = c.CheckContext(ctx, paths[idx])
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// parallel will call fn for every index up to n, using a pool of jobs
+// workers, and wait for them all to complete
+func parallel(n, jobs int, fn func(idx int)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				fn(idx)
+			}
+		}()
+	}
+	for idx := 0; idx < n; idx++ {
+		queue <- idx
+	}
+	close(queue)
+	wg.Wait()
+}
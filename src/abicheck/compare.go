@@ -0,0 +1,192 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// Regression is an object that resolves against the libraries of its own
+// tree, but would not against those of another
+type Regression struct {
+	Path      string   `json:"path"`
+	Package   string   `json:"package,omitempty"`
+	Libraries []string `json:"libraries,omitempty"` // DT_NEEDED no longer found
+	Symbols   []string `json:"symbols,omitempty"`   // Imports no longer provided
+}
+
+// indexScope resolves the dependencies of indexed objects from the libraries
+// of one index, much as ld.so would within the tree indexed
+type indexScope struct {
+	objects []IndexedObject
+	names   map[string][]int        // Soname and file name to objects
+	exports map[int]map[string]bool // Lazily built, see provides
+}
+
+// newIndexScope returns the scope of the libraries within the index
+func newIndexScope(ix *Index) *indexScope {
+	s := &indexScope{
+		objects: ix.Objects,
+		names:   make(map[string][]int),
+		exports: make(map[int]map[string]bool),
+	}
+	for i := range ix.Objects {
+		obj := &ix.Objects[i]
+		base := filepath.Base(obj.Path)
+		s.names[base] = append(s.names[base], i)
+		if obj.Soname != "" && obj.Soname != base {
+			s.names[obj.Soname] = append(s.names[obj.Soname], i)
+		}
+	}
+	return s
+}
+
+// find returns the object the importer would load for the DT_NEEDED name,
+// preferring its own rpath and runpath, or -1 when there is none
+func (s *indexScope) find(importer *IndexedObject, name string) int {
+	if filepath.Base(name) != name {
+		for i := range s.objects {
+			if s.objects[i].Path == name && compatible(importer, &s.objects[i]) {
+				return i
+			}
+		}
+		return -1
+	}
+	dirs := originDirs(importer.Runpaths, importer.Path)
+	if len(importer.Runpaths) == 0 {
+		dirs = originDirs(importer.Rpaths, importer.Path)
+	}
+	found := -1
+	for _, i := range s.names[name] {
+		obj := &s.objects[i]
+		if !compatible(importer, obj) {
+			continue
+		}
+		for _, dir := range dirs {
+			if filepath.Clean(dir) == filepath.Dir(obj.Path) {
+				return i
+			}
+		}
+		if found < 0 {
+			found = i
+		}
+	}
+	return found
+}
+
+// compatible determines whether the library could be loaded by the importer
+func compatible(importer, lib *IndexedObject) bool {
+	return importer.Machine == lib.Machine && importer.Class == lib.Class
+}
+
+// provides determines whether the object would satisfy the reference
+func (s *indexScope) provides(i int, sym IndexedSymbol) bool {
+	set, ok := s.exports[i]
+	if !ok {
+		set = make(map[string]bool)
+		for _, exp := range s.objects[i].Exports {
+			set[exp.String()] = true
+			if !exp.Hidden {
+				set[exp.Name] = true
+			}
+		}
+		s.exports[i] = set
+	}
+	return set[sym.String()]
+}
+
+// unresolved returns the DT_NEEDED entries and imports of the object that
+// cannot be satisfied from the scope. Weak references are never missed.
+func (s *indexScope) unresolved(obj *IndexedObject) (libs, syms map[string]bool) {
+	libs = make(map[string]bool)
+	syms = make(map[string]bool)
+
+	type pending struct {
+		importer *IndexedObject
+		name     string
+	}
+	var queue []pending
+	for _, n := range obj.Needed {
+		queue = append(queue, pending{obj, n})
+	}
+	var loaded []int
+	seen := make(map[int]bool)
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		i := s.find(next.importer, next.name)
+		if i < 0 {
+			libs[next.name] = true
+			continue
+		}
+		if seen[i] {
+			continue
+		}
+		seen[i] = true
+		loaded = append(loaded, i)
+		for _, n := range s.objects[i].Needed {
+			queue = append(queue, pending{&s.objects[i], n})
+		}
+	}
+
+	for _, imp := range obj.Imports {
+		if imp.Weak {
+			continue
+		}
+		found := false
+		for _, i := range loaded {
+			if s.provides(i, imp) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			syms[imp.String()] = true
+		}
+	}
+	return libs, syms
+}
+
+// Compare returns every object of the index that would fail to resolve if run
+// against the libraries of the other index, where it doesn't against its own,
+// sorted by path. Anything already broken within this index is not reported.
+func (ix *Index) Compare(other *Index) []Regression {
+	own, theirs := newIndexScope(ix), newIndexScope(other)
+	var ret []Regression
+	for i := range ix.Objects {
+		obj := &ix.Objects[i]
+		libsA, symsA := own.unresolved(obj)
+		libsB, symsB := theirs.unresolved(obj)
+		reg := Regression{Path: obj.Path, Package: obj.Package}
+		for _, lib := range sortedKeys(libsB) {
+			if !libsA[lib] {
+				reg.Libraries = append(reg.Libraries, lib)
+			}
+		}
+		for _, sym := range sortedKeys(symsB) {
+			if !symsA[sym] {
+				reg.Symbols = append(reg.Symbols, sym)
+			}
+		}
+		if len(reg.Libraries) > 0 || len(reg.Symbols) > 0 {
+			ret = append(ret, reg)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return ret
+}
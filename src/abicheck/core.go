@@ -0,0 +1,254 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Note types of core files, named CORE
+const (
+	ntCoreAuxv = 6
+	ntCoreFile = 0x46494c45 // "FILE"
+)
+
+// atEntry is the auxv entry holding the executable's entry point
+const atEntry = 9
+
+// coreMapping is a single entry of the NT_FILE note
+type coreMapping struct {
+	start, end, offset uint64
+	path               string
+}
+
+// ReadCore will reconstruct the objects a process had mapped when it dumped
+// core, from the NT_FILE note of the core file. Objects that have changed
+// since are marked as Replaced, by comparing build-ids with the headers the
+// kernel dumps (see core(5), bit 4 of coredump_filter). Objects already
+// deleted when the core was dumped are marked as Deleted.
+func ReadCore(path string) (*Process, error) {
+	file, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if file.Type != elf.ET_CORE {
+		return nil, fmt.Errorf("%s: not a core file", path)
+	}
+
+	word := 4
+	if file.Class == elf.ELFCLASS64 {
+		word = 8
+	}
+	var mappings []coreMapping
+	var entry uint64
+	for _, note := range readNotes(file) {
+		if note.Name != "CORE" {
+			continue
+		}
+		switch note.Type {
+		case ntCoreFile:
+			if mappings, err = parseFileNote(note.Desc, word, file.ByteOrder); err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+		case ntCoreAuxv:
+			entry = auxvEntry(note.Desc, word, file.ByteOrder)
+		}
+	}
+	if mappings == nil {
+		return nil, fmt.Errorf("%s: no NT_FILE note, the kernel was too old to write one", path)
+	}
+
+	proc := &Process{}
+	seen := make(map[string]bool)
+	for _, m := range mappings {
+		if entry >= m.start && entry < m.end {
+			proc.Exe = strings.TrimSuffix(m.path, deletedSuffix)
+		}
+		if seen[m.path] {
+			continue
+		}
+		seen[m.path] = true
+
+		obj := MappedObject{Path: strings.TrimSuffix(m.path, deletedSuffix)}
+		obj.Deleted = obj.Path != m.path
+		header := dumpedHeader(file, m)
+		if header != nil {
+			if !bytes.HasPrefix(header, []byte(elf.ELFMAG)) {
+				continue
+			}
+			obj.BuildID = headerBuildID(header)
+		} else if !likelyELF(&obj) {
+			continue
+		}
+		if obj.BuildID != "" && !obj.Deleted {
+			if disk, err := elf.Open(obj.Path); err == nil {
+				obj.Replaced = BuildID(disk) != obj.BuildID
+				disk.Close()
+			}
+		}
+		proc.Objects = append(proc.Objects, obj)
+	}
+	if proc.Exe == "" && len(proc.Objects) > 0 {
+		proc.Exe = proc.Objects[0].Path
+	}
+	for i, obj := range proc.Objects {
+		if obj.Path == proc.Exe {
+			copy(proc.Objects[1:i+1], proc.Objects[:i])
+			proc.Objects[0] = obj
+			break
+		}
+	}
+	return proc, nil
+}
+
+// parseFileNote splits the NT_FILE note into its mappings. It holds the
+// count and page size, count (start, end, page offset) triples and then
+// count file names.
+func parseFileNote(desc []byte, word int, order binary.ByteOrder) ([]coreMapping, error) {
+	get := func(idx int) uint64 {
+		if word == 8 {
+			return order.Uint64(desc[idx*8:])
+		}
+		return uint64(order.Uint32(desc[idx*4:]))
+	}
+	if len(desc) < 2*word {
+		return nil, fmt.Errorf("truncated NT_FILE note")
+	}
+	count, pageSize := get(0), get(1)
+	if count > uint64(len(desc)/(3*word)) {
+		return nil, fmt.Errorf("truncated NT_FILE note")
+	}
+	names := bytes.Split(desc[(2+3*int(count))*word:], []byte{0})
+	if uint64(len(names)) < count {
+		return nil, fmt.Errorf("truncated NT_FILE note")
+	}
+
+	ret := make([]coreMapping, count)
+	for i := range ret {
+		base := 2 + 3*i
+		ret[i] = coreMapping{
+			start:  get(base),
+			end:    get(base + 1),
+			offset: get(base+2) * pageSize,
+			path:   string(names[i]),
+		}
+	}
+	return ret, nil
+}
+
+// auxvEntry returns AT_ENTRY from the NT_AUXV note, or zero
+func auxvEntry(desc []byte, word int, order binary.ByteOrder) uint64 {
+	for i := 0; i+2*word <= len(desc); i += 2 * word {
+		var typ, val uint64
+		if word == 8 {
+			typ, val = order.Uint64(desc[i:]), order.Uint64(desc[i+8:])
+		} else {
+			typ, val = uint64(order.Uint32(desc[i:])), uint64(order.Uint32(desc[i+4:]))
+		}
+		if typ == atEntry {
+			return val
+		}
+	}
+	return 0
+}
+
+// dumpedHeader returns the start of the mapped file if the core holds it,
+// which the kernel does for the first page of each ELF object by default
+func dumpedHeader(file *elf.File, m coreMapping) []byte {
+	if m.offset != 0 {
+		return nil
+	}
+	for _, prog := range file.Progs {
+		if prog.Type != elf.PT_LOAD || m.start < prog.Vaddr || m.start >= prog.Vaddr+prog.Filesz {
+			continue
+		}
+		data := make([]byte, prog.Vaddr+prog.Filesz-m.start)
+		if _, err := prog.ReadAt(data, int64(m.start-prog.Vaddr)); err != nil {
+			return nil
+		}
+		return data
+	}
+	return nil
+}
+
+// headerBuildID returns the build-id of an ELF object given only its start,
+// as debug/elf insists on the section headers being there too
+func headerBuildID(header []byte) string {
+	if len(header) < elf.EI_NIDENT {
+		return ""
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if elf.Data(header[elf.EI_DATA]) == elf.ELFDATA2MSB {
+		order = binary.BigEndian
+	}
+
+	type phdr struct{ typ, offset, size, align uint64 }
+	var progs []phdr
+	r := bytes.NewReader(header)
+	switch elf.Class(header[elf.EI_CLASS]) {
+	case elf.ELFCLASS64:
+		var hdr elf.Header64
+		if binary.Read(r, order, &hdr) != nil {
+			return ""
+		}
+		for i := 0; i < int(hdr.Phnum); i++ {
+			var p elf.Prog64
+			off := int64(hdr.Phoff) + int64(i)*int64(hdr.Phentsize)
+			if off < 0 || off >= int64(len(header)) || binary.Read(bytes.NewReader(header[off:]), order, &p) != nil {
+				return ""
+			}
+			progs = append(progs, phdr{uint64(p.Type), p.Off, p.Filesz, p.Align})
+		}
+	case elf.ELFCLASS32:
+		var hdr elf.Header32
+		if binary.Read(r, order, &hdr) != nil {
+			return ""
+		}
+		for i := 0; i < int(hdr.Phnum); i++ {
+			var p elf.Prog32
+			off := int64(hdr.Phoff) + int64(i)*int64(hdr.Phentsize)
+			if off < 0 || off >= int64(len(header)) || binary.Read(bytes.NewReader(header[off:]), order, &p) != nil {
+				return ""
+			}
+			progs = append(progs, phdr{uint64(p.Type), uint64(p.Off), uint64(p.Filesz), uint64(p.Align)})
+		}
+	default:
+		return ""
+	}
+
+	for _, p := range progs {
+		if elf.ProgType(p.typ) != elf.PT_NOTE || p.offset+p.size > uint64(len(header)) {
+			continue
+		}
+		align := 4
+		if p.align == 8 {
+			align = 8
+		}
+		for _, note := range parseNotes(header[p.offset:p.offset+p.size], order, align) {
+			if note.Name == "GNU" && note.Type == ntGNUBuildID {
+				return hex.EncodeToString(note.Desc)
+			}
+		}
+	}
+	return ""
+}
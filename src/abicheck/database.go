@@ -0,0 +1,343 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// libraryDatabase holds the libraries of a system known only from its
+// symbol database, standing in for its filesystem. Libraries are created
+// from the database as they're first looked up.
+type libraryDatabase struct {
+	db SymbolDatabase
+
+	mu    sync.Mutex
+	named map[string][]*Library // By path, soname and file name
+}
+
+// SetDatabase will check against the shared libraries of the index (see
+// BuildIndex) in place of the system ones, as SetSymbolDatabase does
+func (s *SymbolStore) SetDatabase(ix *Index) error {
+	for i := range ix.Objects {
+		obj := &ix.Objects[i]
+		if !obj.library() {
+			continue
+		}
+		if _, ok := machineNamed(obj.Machine); !ok {
+			return fmt.Errorf("%s: unknown machine %s", obj.Path, obj.Machine)
+		}
+	}
+	s.SetSymbolDatabase(ix.Database())
+	return nil
+}
+
+// SetSymbolDatabase will check against the shared libraries of the database
+// in place of the system ones, so that binaries can be checked for a
+// distribution that isn't installed. Only DT_RPATH, DT_RUNPATH and the
+// library path are still searched on disk, for the libraries a binary
+// bundles. The linker configuration of the host is ignored. The database
+// must stay open for as long as the store is used.
+func (s *SymbolStore) SetSymbolDatabase(db SymbolDatabase) {
+	s.config.Lock()
+	defer s.config.Unlock()
+
+	s.configLibraries = nil
+	s.ldCache = nil
+	s.configErr = nil
+	s.database = &libraryDatabase{db: db, named: make(map[string][]*Library)}
+	s.resolver = &databaseResolver{store: s}
+}
+
+// libraries returns the libraries of the database known by the name, in
+// database order, adding any new to the store
+func (d *libraryDatabase) libraries(s *SymbolStore, name string) ([]*Library, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if libs, ok := d.named[name]; ok {
+		return libs, nil
+	}
+
+	objs, err := d.db.Named(name)
+	if err != nil {
+		return nil, err
+	}
+	var libs []*Library
+	for i := range objs {
+		obj := &objs[i]
+		lib, err := d.library(s, obj)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", obj.Path, err)
+		}
+		libs = append(libs, lib)
+	}
+	d.named[name] = libs
+	return libs, nil
+}
+
+// library returns the library created for the object, creating it for the
+// first name it's looked up by
+func (d *libraryDatabase) library(s *SymbolStore, obj *IndexedObject) (*Library, error) {
+	if libs, ok := d.named[obj.Path]; ok && len(libs) > 0 {
+		return libs[0], nil
+	}
+	lib, err := s.databaseLibrary(obj)
+	if err != nil {
+		return nil, err
+	}
+	d.named[obj.Path] = []*Library{lib}
+
+	s.mu.Lock()
+	bucket := s.objectBucket(lib.arch.Machine)
+	if _, ok := bucket[s.realPath(lib.Path)]; !ok {
+		bucket[s.realPath(lib.Path)] = lib
+	}
+	s.mu.Unlock()
+	return lib, nil
+}
+
+// has determines whether the database holds a library at the path
+func (d *libraryDatabase) has(s *SymbolStore, path string) (bool, error) {
+	libs, err := d.libraries(s, path)
+	return len(libs) > 0, err
+}
+
+// databaseLibrary returns the ready library described by the index entry.
+// Like the vDSO it is only ever a provider, never checked itself.
+func (s *SymbolStore) databaseLibrary(obj *IndexedObject) (*Library, error) {
+	machine, ok := machineNamed(obj.Machine)
+	if !ok {
+		return nil, fmt.Errorf("unknown machine %s", obj.Machine)
+	}
+	class := elf.ELFCLASS32
+	if obj.Class == elf.ELFCLASS64.String() {
+		class = elf.ELFCLASS64
+	}
+
+	name := obj.Soname
+	if name == "" {
+		name = filepath.Base(obj.Path)
+	}
+	lib := NewLibrary(name, obj.Path)
+	lib.Soname = obj.Soname
+	lib.arch = Arch{Machine: machine, Class: class}
+	lib.needed = obj.Needed
+	lib.shared = true
+	lib.indexed = true
+	lib.reported = true
+	lib.runpaths = originDirs(obj.Runpaths, obj.Path)
+	if len(lib.runpaths) == 0 {
+		lib.rpaths = originDirs(obj.Rpaths, obj.Path)
+	}
+
+	tables := &SymbolTables{Versions: obj.Versions}
+	for _, exp := range obj.Exports {
+		tables.Exports = append(tables.Exports, ExportedSymbol{Name: exp.Name, Version: exp.Version, Hidden: exp.Hidden})
+	}
+	s.names.internTables(tables)
+	lib.tables = tables
+	for _, v := range tables.Versions {
+		lib.AddVersion(v)
+	}
+	for _, exp := range tables.Exports {
+		lib.AddSymbol(exp.Name, exp.Version, exp.Hidden)
+	}
+	lib.markReady()
+	return lib, nil
+}
+
+// originDirs expands $ORIGIN within the search directories of the object at
+// path. The other tokens depend on the running system, so are left alone.
+func originDirs(dirs []string, path string) []string {
+	var ret []string
+	origin := filepath.Dir(path)
+	for _, dir := range dirs {
+		dir = strings.ReplaceAll(dir, "${ORIGIN}", origin)
+		ret = append(ret, strings.ReplaceAll(dir, "$ORIGIN", origin))
+	}
+	return ret
+}
+
+// machineNamed returns the machine with the given name, i.e. EM_X86_64
+func machineNamed(name string) (elf.Machine, bool) {
+	for m := elf.Machine(0); m < 0x400; m++ {
+		if m.String() == name {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
+// lookup returns the libraries of the database for the machine known by the
+// name, those in the trusted directories of the ABI first
+func (d *libraryDatabase) lookup(s *SymbolStore, name string, arch Arch) ([]string, error) {
+	named, err := d.libraries(s, name)
+	if err != nil {
+		return nil, err
+	}
+	dirs := s.defaultLibraries(arch)
+	rank := func(lib *Library) int {
+		for i, dir := range dirs {
+			if filepath.Dir(lib.Path) == dir {
+				return i
+			}
+		}
+		return len(dirs)
+	}
+
+	var libs []*Library
+	for _, lib := range named {
+		if lib.arch.Machine == arch.Machine && lib.arch.Class == arch.Class {
+			libs = append(libs, lib)
+		}
+	}
+	sort.SliceStable(libs, func(i, j int) bool { return rank(libs[i]) < rank(libs[j]) })
+
+	ret := make([]string, 0, len(libs))
+	for _, lib := range libs {
+		ret = append(ret, lib.Path)
+	}
+	return ret, nil
+}
+
+// databaseResolver finds libraries within the database, after any bundled
+// with the object on disk
+type databaseResolver struct {
+	store *SymbolStore
+}
+
+// Resolve returns the candidates for the library, as ld.so would see them on
+// the system the database describes
+func (r *databaseResolver) Resolve(name string, ctx *ResolveContext) ([]Candidate, error) {
+	s := r.store
+	db := s.database
+	if strings.Contains(name, "/") {
+		if ok, err := db.has(s, name); err != nil {
+			return nil, err
+		} else if ok {
+			return pathCandidates([]string{name}), nil
+		}
+		return pathCandidates(s.appendIfRegular(nil, name)), nil
+	}
+
+	var ret []string
+	var dirs []string
+	dirs = append(dirs, ctx.Rpaths...)
+	dirs = append(dirs, s.libraryPath...)
+	dirs = append(dirs, ctx.Runpaths...)
+	for _, dir := range dirs {
+		p := filepath.Join(dir, name)
+		if ok, err := db.has(s, p); err != nil {
+			return nil, err
+		} else if ok {
+			ret = append(ret, p)
+			continue
+		}
+		ret = s.appendIfRegular(ret, p)
+	}
+	libs, err := db.lookup(s, name, ctx.Arch)
+	if err != nil {
+		return nil, err
+	}
+	return pathCandidates(append(ret, libs...)), nil
+}
+
+// interpreterPaths returns where the interpreter may be found, within the
+// database first if there is one
+func (s *SymbolStore) interpreterPaths(name string, arch Arch) []string {
+	if s.database == nil {
+		return s.appendIfRegular(nil, s.rooted(name))
+	}
+	ok, err := s.database.has(s, name)
+	if ok {
+		return []string{name}
+	}
+	var ret []string
+	if err == nil {
+		// Merged /usr systems only have the real file under /usr/lib
+		ret, err = s.database.lookup(s, filepath.Base(name), arch)
+	}
+	if err != nil {
+		s.emit(&ErrorEvent{Err: err})
+	}
+	return ret
+}
+
+// systemLibraryDirs are searched for every ABI besides the ld.so.conf ones
+var systemLibraryDirs = []string{"/lib", "/lib64", "/lib32", "/libx32", "/usr/lib", "/usr/lib64", "/usr/lib32", "/usr/libx32"}
+
+// SystemLibraries returns every shared library within the system library
+// directories of the sysroot (ld.so.conf, multiarch and the usual defaults),
+// each only once, so that the system can be saved as a database with
+// BuildIndex.
+func (s *SymbolStore) SystemLibraries() ([]string, error) {
+	s.config.RLock()
+	dirs := append([]string{}, s.configLibraries...)
+	dirs = append(dirs, s.muslPathDirs()...)
+	for _, path := range []string{FreeBSDHintsPath, FreeBSDHints32Path, OpenBSDHintsPath} {
+		dirs = append(dirs, s.hints[path]...)
+	}
+	root := s.rooted("/")
+	s.config.RUnlock()
+
+	for _, pattern := range []string{"/lib/*-linux-gnu*", "/usr/lib/*-linux-gnu*"} {
+		matches, err := filepath.Glob(filepath.Join(root, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if rel, err := filepath.Rel(root, m); err == nil {
+				dirs = append(dirs, "/"+rel)
+			}
+		}
+	}
+	dirs = append(dirs, systemLibraryDirs...)
+
+	var ret []string
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(filepath.Join(root, dir))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !strings.Contains(entry.Name(), ".so") {
+				continue
+			}
+			path := filepath.Join(root, dir, entry.Name())
+			real := s.realPath(path)
+			if seen[real] {
+				continue
+			}
+			if st, err := os.Stat(real); err != nil || !st.Mode().IsRegular() || !IsDynamicELF(real) {
+				continue
+			}
+			seen[real] = true
+			ret = append(ret, real)
+		}
+	}
+	return ret, nil
+}
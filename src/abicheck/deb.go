@@ -0,0 +1,106 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// arMagic begins every ar(1) archive, which .deb files are
+const arMagic = "!<arch>\n"
+
+// readDeb will read data.tar.* from the Debian package at path
+func readDeb(path string) (*Overlay, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	br := bufio.NewReader(fi)
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != arMagic {
+		return nil, errors.New("not an ar archive")
+	}
+
+	header := make([]byte, 60)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("no data.tar member found")
+			}
+			return nil, err
+		}
+		name := strings.TrimRight(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid ar member size for %s", name)
+		}
+
+		member := io.LimitReader(br, size)
+		if strings.HasPrefix(name, "data.tar") {
+			overlay := NewOverlay()
+			if err := readTar(overlay, member); err != nil {
+				return nil, err
+			}
+			return overlay, nil
+		}
+
+		// Members are padded to an even offset
+		if _, err := io.CopyN(io.Discard, br, size+size%2); err == io.EOF {
+			return nil, fmt.Errorf("truncated ar member %s", name)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ReadDpkgOwners will read the file lists of every package installed within
+// root by dpkg, returning the package owning each path as listed, relative to
+// root. A root without a dpkg database has no owners known.
+func ReadDpkgOwners(root string) (map[string]string, error) {
+	lists, err := filepath.Glob(filepath.Join(root, "var/lib/dpkg/info/*.list"))
+	if err != nil {
+		return nil, err
+	}
+	owners := make(map[string]string)
+	for _, list := range lists {
+		// Multi-arch packages are listed as name:arch
+		pkg, _, _ := strings.Cut(strings.TrimSuffix(filepath.Base(list), ".list"), ":")
+		fi, err := os.Open(list)
+		if err != nil {
+			return nil, err
+		}
+		sc := bufio.NewScanner(fi)
+		for sc.Scan() {
+			owners[sc.Text()] = pkg
+		}
+		err = sc.Err()
+		fi.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", list, err)
+		}
+	}
+	return owners, nil
+}
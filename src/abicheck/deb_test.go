@@ -0,0 +1,129 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testArMember is a member of the test ar archives
+type testArMember struct {
+	name string
+	data []byte
+	size string // Replaces the real size when set
+}
+
+// arArchive returns an ar archive of the members, padded as ar does
+func arArchive(members []testArMember) []byte {
+	b := bytes.NewBufferString(arMagic)
+	for _, m := range members {
+		size := m.size
+		if size == "" {
+			size = fmt.Sprint(len(m.data))
+		}
+		fmt.Fprintf(b, "%-16s%-12s%-6s%-6s%-8s%-10s`\n", m.name, "0", "0", "0", "100644", size)
+		b.Write(m.data)
+		if len(m.data)%2 != 0 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
+
+// testTar returns a tarball with a library, symlink and hard link to it,
+// and a file that isn't an object
+func testTar() []byte {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for _, hdr := range []*tar.Header{
+		{Name: "./usr/lib/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./usr/lib/libfoo.so.1", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(testELF))},
+		{Name: "./usr/lib/libfoo.so", Typeflag: tar.TypeSymlink, Linkname: "libfoo.so.1"},
+		{Name: "./usr/lib/libfoo-hard.so.1", Typeflag: tar.TypeLink, Linkname: "./usr/lib/libfoo.so.1"},
+		{Name: "./usr/share/doc/README", Typeflag: tar.TypeReg, Mode: 0644, Size: 5},
+	} {
+		tw.WriteHeader(hdr)
+		switch hdr.Size {
+		case int64(len(testELF)):
+			tw.Write([]byte(testELF))
+		case 5:
+			tw.Write([]byte("hello"))
+		}
+	}
+	tw.Close()
+	return b.Bytes()
+}
+
+func TestReadDeb(t *testing.T) {
+	data := testTar()
+	control := testArMember{name: "control.tar.gz", data: gzipped([]byte("odd"))}
+	tests := []struct {
+		name    string
+		members []testArMember
+	}{
+		{"gzip", []testArMember{{name: "debian-binary", data: []byte("2.0\n")}, control, {name: "data.tar.gz", data: gzipped(data)}}},
+		{"uncompressed", []testArMember{{name: "debian-binary", data: []byte("2.0\n")}, {name: "data.tar", data: data}}},
+		// GNU ar ends names with a slash
+		{"gnu names", []testArMember{{name: "debian-binary/", data: []byte("2.0\n")}, {name: "data.tar.gz/", data: gzipped(data)}}},
+		// Odd sized members are padded
+		{"padded", []testArMember{{name: "debian-binary", data: []byte("2.0\n\n\n\n")}, control, {name: "data.tar.gz", data: gzipped(data)}}},
+	}
+	wantFiles := []string{"/usr/lib/libfoo.so.1"}
+	wantLinks := map[string]string{"/usr/lib/libfoo.so": "libfoo.so.1", "/usr/lib/libfoo-hard.so.1": "/usr/lib/libfoo.so.1"}
+	for _, test := range tests {
+		overlay, err := readDeb(testFile(t, "foo_1.0_amd64.deb", arArchive(test.members)))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		files, links := overlayContents(overlay)
+		if !reflect.DeepEqual(files, wantFiles) || !reflect.DeepEqual(links, wantLinks) {
+			t.Errorf("%s: got files %v, links %v", test.name, files, links)
+		}
+	}
+}
+
+func TestReadDebInvalid(t *testing.T) {
+	binary := testArMember{name: "debian-binary", data: []byte("2.0\n")}
+	valid := arArchive([]testArMember{binary, {name: "data.tar.gz", data: gzipped(testTar())}})
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "not an ar archive"},
+		{"not an archive", []byte("<!DOCTYPE html>\n"), "not an ar archive"},
+		{"no members", []byte(arMagic), "no data.tar member found"},
+		{"no data member", arArchive([]testArMember{binary}), "no data.tar member found"},
+		{"truncated member header", valid[:len(arMagic)+30], "unexpected EOF"},
+		{"truncated member", valid[:len(arMagic)+60+2], "truncated ar member debian-binary"},
+		{"truncated data", valid[:len(valid)-30], "unexpected EOF"},
+		{"bad size", arArchive([]testArMember{{name: "debian-binary", data: []byte("2.0\n"), size: "four"}}), "invalid ar member size for debian-binary"},
+		{"negative size", arArchive([]testArMember{{name: "debian-binary", data: []byte("2.0\n"), size: "-4"}}), "invalid ar member size for debian-binary"},
+		{"size past the end", arArchive([]testArMember{{name: "debian-binary", data: []byte("2.0\n"), size: "9999999999"}}), "truncated ar member debian-binary"},
+		{"data not a tarball", arArchive([]testArMember{{name: "data.tar", data: bytes.Repeat([]byte("x"), 1024)}}), "archive/tar: invalid tar header"},
+	}
+	for _, test := range tests {
+		if _, err := readDeb(testFile(t, "foo.deb", test.data)); err == nil || err.Error() != test.err {
+			t.Errorf("%s: got %v, want %s", test.name, err, test.err)
+		}
+	}
+}
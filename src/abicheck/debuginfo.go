@@ -0,0 +1,325 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DebugDir is where distributions install separate debug files, either by
+// build-id or mirroring the path of the object
+const DebugDir = "/usr/lib/debug"
+
+// SymbolSource is where an unresolved symbol came from, according to the
+// importer's debug info
+type SymbolSource struct {
+	Declared string   `json:"declared,omitempty"` // file:line of the declaration
+	Units    []string `json:"units,omitempty"`    // Compilation units referencing it
+}
+
+// String returns a short description of the source
+func (s *SymbolSource) String() string {
+	var parts []string
+	if s.Declared != "" {
+		parts = append(parts, "declared at "+s.Declared)
+	}
+	if len(s.Units) > 0 {
+		parts = append(parts, "used in "+strings.Join(s.Units, ", "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// DefaultDebuginfodCacheDir returns the cache shared with the elfutils
+// debuginfod client, so that gdb and friends reuse what was downloaded
+func DefaultDebuginfodCacheDir() (string, error) {
+	if dir := os.Getenv("DEBUGINFOD_CACHE_PATH"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "debuginfod_client"), nil
+}
+
+// DebuginfodServers returns the servers listed in $DEBUGINFOD_URLS
+func DebuginfodServers() []string {
+	return strings.Fields(os.Getenv("DEBUGINFOD_URLS"))
+}
+
+// SetDebugInfo will have objects with unresolved symbols looked up in their
+// debug info, to tell where each symbol was declared and which source files
+// use it. The object's own DWARF is used if it has any, otherwise separate
+// debug files are found by build-id or .gnu_debuglink under DebugDir, and
+// lastly downloaded from the debuginfod servers into cacheDir.
+func (s *SymbolStore) SetDebugInfo(enabled bool, servers []string, cacheDir string) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.debugInfo = enabled
+	s.debuginfod = servers
+	s.debuginfodCache = cacheDir
+}
+
+// addSourceContext will attach the source of each unresolved symbol of the
+// entry, when debug info is enabled and can be found for it
+func (s *SymbolStore) addSourceContext(result *ObjectResult) {
+	if !s.debugInfo || s.inOverlay(result.Path) {
+		return
+	}
+	failures := make(map[string][]*UnresolvedSymbolError)
+	for _, err := range result.Failures {
+		if e, ok := err.(*UnresolvedSymbolError); ok {
+			failures[e.Symbol] = append(failures[e.Symbol], e)
+		}
+	}
+	if len(failures) == 0 {
+		return
+	}
+
+	path := s.findDebugFile(s.realPath(result.Path))
+	if path == "" {
+		return
+	}
+	s.emit(&DebugInfoEvent{Path: result.Path, Debug: path})
+	sources, err := readSymbolSources(path, failures)
+	if err != nil {
+		s.emit(&ErrorEvent{Err: fmt.Errorf("failed to read debug info of %s: %v", result.Path, err)})
+		return
+	}
+	for name, errs := range failures {
+		for _, e := range errs {
+			e.Source = sources[name]
+		}
+	}
+	for idx := range result.Symbols {
+		if sym := &result.Symbols[idx]; sym.Provider == "" {
+			sym.Source = sources[sym.Name]
+		}
+	}
+}
+
+// hasDWARF determines whether the object carries its own debug info
+func hasDWARF(file *elf.File) bool {
+	sect := debugSection(file, ".debug_info")
+	return sect != nil && sect.Type != elf.SHT_NOBITS && sect.Size > 0
+}
+
+// findDebugFile returns the file holding the debug info of the object at
+// path, or an empty string when there isn't one to be found
+func (s *SymbolStore) findDebugFile(path string) string {
+	file, err := elf.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	if hasDWARF(file) {
+		return path
+	}
+
+	id := BuildID(file)
+	if len(id) > 2 {
+		candidate := s.rooted(filepath.Join(DebugDir, ".build-id", id[:2], id[2:]+".debug"))
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	if name, crc, ok := debugLink(file); ok {
+		dir := filepath.Dir(path)
+		rel := dir
+		if s.sysroot != "" {
+			if r, err := filepath.Rel(s.sysroot, dir); err == nil {
+				rel = "/" + r
+			}
+		}
+		for _, candidate := range []string{
+			filepath.Join(dir, name),
+			filepath.Join(dir, ".debug", name),
+			s.rooted(filepath.Join(DebugDir, rel, name)),
+		} {
+			if candidate != path && fileCRC(candidate) == crc {
+				return candidate
+			}
+		}
+	}
+	if id != "" {
+		for _, server := range s.debuginfod {
+			if found, err := fetchDebuginfo(server, id, s.debuginfodCache); err == nil {
+				return found
+			}
+		}
+	}
+	return ""
+}
+
+// debugLink returns the file name and CRC within .gnu_debuglink
+func debugLink(file *elf.File) (string, uint32, bool) {
+	sect := file.Section(".gnu_debuglink")
+	if sect == nil {
+		return "", 0, false
+	}
+	data, err := sectionData(sect)
+	if err != nil {
+		return "", 0, false
+	}
+	end := bytes.IndexByte(data, 0)
+	if end <= 0 {
+		return "", 0, false
+	}
+	// The CRC follows the name, aligned to 4 bytes
+	off := (end + 4) &^ 3
+	if off+4 > len(data) {
+		return "", 0, false
+	}
+	return string(data[:end]), file.ByteOrder.Uint32(data[off:]), true
+}
+
+// fileCRC returns the CRC32 of the whole file, as .gnu_debuglink uses
+func fileCRC(path string) uint32 {
+	fi, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer fi.Close()
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, fi); err != nil {
+		return 0
+	}
+	return h.Sum32()
+}
+
+// fetchDebuginfo will download the debug file with the build-id from the
+// debuginfod server, unless it is already cached. Build-ids never change,
+// so a cached copy is always good.
+func fetchDebuginfo(server, id, cacheDir string) (string, error) {
+	if cacheDir == "" {
+		return "", fmt.Errorf("no debuginfod cache directory")
+	}
+	dir := filepath.Join(cacheDir, id)
+	path := filepath.Join(dir, "debuginfo")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	url := strings.TrimSuffix(server, "/") + "/buildid/" + id + "/debuginfo"
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	if err := os.MkdirAll(dir, 00755); err != nil {
+		return "", err
+	}
+	// Only add to the cache once the download is complete
+	tmp, err := os.CreateTemp(dir, ".fetch-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("%s: %v", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// readSymbolSources will find the declaration of each of the symbols
+// within the DWARF of the debug file, and the units declaring them
+func readSymbolSources(path string, names map[string][]*UnresolvedSymbolError) (map[string]*SymbolSource, error) {
+	file, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := file.DWARF()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]*SymbolSource)
+	r := data.Reader()
+	var unit string
+	var files []*dwarf.LineFile
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		switch entry.Tag {
+		case dwarf.TagCompileUnit, dwarf.TagPartialUnit:
+			unit, _ = entry.Val(dwarf.AttrName).(string)
+			files = nil
+			if lr, err := data.LineReader(entry); err == nil && lr != nil {
+				files = lr.Files()
+			}
+			continue
+		case dwarf.TagSubprogram, dwarf.TagVariable:
+		default:
+			continue
+		}
+
+		name, _ := entry.Val(dwarf.AttrLinkageName).(string)
+		if name == "" {
+			name, _ = entry.Val(dwarf.AttrName).(string)
+		}
+		if _, ok := names[name]; !ok {
+			continue
+		}
+		src := ret[name]
+		if src == nil {
+			src = &SymbolSource{}
+			ret[name] = src
+		}
+		if src.Declared == "" && entry.AttrField(dwarf.AttrDeclFile) != nil {
+			// DWARF 5 counts files from 0, earlier versions leave it nil
+			idx, _ := entry.Val(dwarf.AttrDeclFile).(int64)
+			line, _ := entry.Val(dwarf.AttrDeclLine).(int64)
+			if idx >= 0 && int(idx) < len(files) && files[idx] != nil && line > 0 {
+				src.Declared = fmt.Sprintf("%s:%d", files[idx].Name, line)
+			}
+		}
+		if unit != "" && (len(src.Units) == 0 || src.Units[len(src.Units)-1] != unit) {
+			src.Units = append(src.Units, unit)
+		}
+	}
+	for _, src := range ret {
+		sort.Strings(src.Units)
+	}
+	return ret, nil
+}
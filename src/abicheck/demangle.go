@@ -0,0 +1,86 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// mangledName matches an Itanium C++ ABI symbol name within a message,
+// leaving off any @version
+var mangledName = regexp.MustCompile(`_Z[A-Za-z0-9_$.]+`)
+
+// Demangle returns the C++ form of each mangled name, by way of c++filt from
+// binutils. Names it couldn't demangle are left out, as is everything when
+// c++filt isn't installed.
+func Demangle(names []string) map[string]string {
+	var mangled []string
+	for _, name := range names {
+		if strings.HasPrefix(name, "_Z") {
+			mangled = append(mangled, name)
+		}
+	}
+	if len(mangled) == 0 {
+		return nil
+	}
+	cmd := exec.Command("c++filt")
+	cmd.Stdin = strings.NewReader(strings.Join(mangled, "\n") + "\n")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(lines) != len(mangled) {
+		return nil
+	}
+	ret := make(map[string]string)
+	for i, name := range mangled {
+		if lines[i] != name {
+			ret[name] = lines[i]
+		}
+	}
+	return ret
+}
+
+// demangleMessages will replace every mangled name within the messages with
+// its C++ form, in place
+func demangleMessages(messages []string) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, msg := range messages {
+		for _, name := range mangledName.FindAllString(msg, -1) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	demangled := Demangle(names)
+	if len(demangled) == 0 {
+		return
+	}
+	for i, msg := range messages {
+		messages[i] = mangledName.ReplaceAllStringFunc(msg, func(name string) string {
+			if d, ok := demangled[name]; ok {
+				return d
+			}
+			return name
+		})
+	}
+}
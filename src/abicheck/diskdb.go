@@ -0,0 +1,438 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// databaseMagic starts every file written by a DatabaseWriter
+const databaseMagic = "ABICHKDB"
+
+// databaseFormat is bumped whenever the database file changes incompatibly
+const databaseFormat = 1
+
+// The tables of a database, each mapping a name to the objects it's found in
+const (
+	tableExports = iota // Names of the symbols defined
+	tableImports        // Names of the symbols referenced
+	tableNeeded         // DT_NEEDED entries, and their file names
+	tableNames          // Path, soname and file name of each object
+	numTables
+)
+
+// databaseFooter is the size of the footer ending the file: the number of
+// objects, where their offsets are and then where each table is
+const databaseFooter = 8 * (2 + numTables)
+
+// DatabaseWriter writes a database file that DiskDatabase can query without
+// reading it all into memory. The file holds each indexed object as JSON,
+// followed by the offset of each and then tables of sorted names pointing at
+// the objects, which are searched in place.
+type DatabaseWriter struct {
+	w       *bufio.Writer
+	off     int64
+	objects []int64
+	tables  [numTables]map[string][]uint32
+}
+
+// NewDatabaseWriter will start a database written to w, which is complete
+// once Close is called
+func NewDatabaseWriter(w io.Writer) (*DatabaseWriter, error) {
+	d := &DatabaseWriter{w: bufio.NewWriter(w)}
+	for i := range d.tables {
+		d.tables[i] = make(map[string][]uint32)
+	}
+	header := binary.LittleEndian.AppendUint32([]byte(databaseMagic), databaseFormat)
+	if err := d.write(header); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// write will append the data to the file
+func (d *DatabaseWriter) write(data []byte) error {
+	n, err := d.w.Write(data)
+	d.off += int64(n)
+	return err
+}
+
+// key will point the name within the table at the object, once
+func (d *DatabaseWriter) key(table int, name string, id uint32) {
+	ids := d.tables[table][name]
+	if len(ids) == 0 || ids[len(ids)-1] != id {
+		d.tables[table][name] = append(ids, id)
+	}
+}
+
+// Add will write the object to the database
+func (d *DatabaseWriter) Add(obj *IndexedObject) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	id := uint32(len(d.objects))
+	d.objects = append(d.objects, d.off)
+	if err := d.write(binary.LittleEndian.AppendUint32(nil, uint32(len(data)))); err != nil {
+		return err
+	}
+	if err := d.write(data); err != nil {
+		return err
+	}
+
+	for _, exp := range obj.Exports {
+		d.key(tableExports, exp.Name, id)
+	}
+	for _, imp := range obj.Imports {
+		d.key(tableImports, imp.Name, id)
+	}
+	for _, name := range obj.Needed {
+		d.key(tableNeeded, name, id)
+		d.key(tableNeeded, filepath.Base(name), id)
+	}
+	for _, name := range obj.knownAs() {
+		d.key(tableNames, name, id)
+	}
+	return nil
+}
+
+// Close will write the tables and footer, completing the database. The
+// underlying writer is left open.
+func (d *DatabaseWriter) Close() error {
+	var footer []byte
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(len(d.objects)))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(d.off))
+	var buf []byte
+	for _, off := range d.objects {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(off))
+	}
+	if err := d.write(buf); err != nil {
+		return err
+	}
+
+	for _, table := range d.tables {
+		footer = binary.LittleEndian.AppendUint64(footer, uint64(d.off))
+		keys := make([]string, 0, len(table))
+		for key := range table {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		// Each entry is found through the fixed size offsets before them
+		buf = binary.LittleEndian.AppendUint32(buf[:0], uint32(len(keys)))
+		off := d.off + 4 + 8*int64(len(keys))
+		var entries []byte
+		for _, key := range keys {
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(off+int64(len(entries))))
+			entries = binary.LittleEndian.AppendUint32(entries, uint32(len(key)))
+			entries = append(entries, key...)
+			entries = binary.LittleEndian.AppendUint32(entries, uint32(len(table[key])))
+			for _, id := range table[key] {
+				entries = binary.LittleEndian.AppendUint32(entries, id)
+			}
+		}
+		if err := d.write(buf); err != nil {
+			return err
+		}
+		if err := d.write(entries); err != nil {
+			return err
+		}
+	}
+	if err := d.write(footer); err != nil {
+		return err
+	}
+	return d.w.Flush()
+}
+
+// DiskDatabase is a SymbolDatabase written by a DatabaseWriter, which is
+// searched on disk so that only the objects each query finds are read
+type DiskDatabase struct {
+	f       *os.File
+	path    string
+	size    int64
+	count   uint64
+	objects int64 // Where the offset of each object is
+	tables  [numTables]int64
+}
+
+// OpenDatabase will open the database file at path
+func OpenDatabase(path string) (*DiskDatabase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &DiskDatabase{f: f, path: path}
+	if err := d.readFooter(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// readFooter will check the header and find the tables of the database
+func (d *DiskDatabase) readFooter() error {
+	st, err := d.f.Stat()
+	if err != nil {
+		return err
+	}
+	d.size = st.Size()
+	header, err := d.read(0, len(databaseMagic)+4)
+	if err != nil || string(header[:len(databaseMagic)]) != databaseMagic {
+		return fmt.Errorf("%s: not a symbol database", d.path)
+	}
+	if format := binary.LittleEndian.Uint32(header[len(databaseMagic):]); format != databaseFormat {
+		return fmt.Errorf("%s: unsupported database format: %d", d.path, format)
+	}
+	footer, err := d.read(d.size-databaseFooter, databaseFooter)
+	if err != nil {
+		return err
+	}
+	d.count = binary.LittleEndian.Uint64(footer)
+	d.objects = int64(binary.LittleEndian.Uint64(footer[8:]))
+	for i := range d.tables {
+		d.tables[i] = int64(binary.LittleEndian.Uint64(footer[16+8*i:]))
+	}
+	if d.count > uint64(d.size) || d.objects+8*int64(d.count) > d.size {
+		return d.corrupt()
+	}
+	return nil
+}
+
+// corrupt returns the error for a database that can't be read
+func (d *DiskDatabase) corrupt() error {
+	return fmt.Errorf("%s: corrupt symbol database", d.path)
+}
+
+// read returns the n bytes of the file at off, which must lie within it so
+// that a corrupt length can't ask for more memory than the file's size
+func (d *DiskDatabase) read(off int64, n int) ([]byte, error) {
+	if off < 0 || n < 0 || off+int64(n) > d.size {
+		return nil, d.corrupt()
+	}
+	buf := make([]byte, n)
+	if _, err := d.f.ReadAt(buf, off); err != nil {
+		if err == io.EOF {
+			return nil, d.corrupt()
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// entry returns the name of the i'th entry of the table at pos, along with
+// where its objects are listed
+func (d *DiskDatabase) entry(pos int64, i int) (string, int64, error) {
+	buf, err := d.read(pos+4+8*int64(i), 8)
+	if err != nil {
+		return "", 0, err
+	}
+	off := int64(binary.LittleEndian.Uint64(buf))
+	if buf, err = d.read(off, 4); err != nil {
+		return "", 0, err
+	}
+	n := int(binary.LittleEndian.Uint32(buf))
+	if buf, err = d.read(off+4, n); err != nil {
+		return "", 0, err
+	}
+	return string(buf), off + 4 + int64(n), nil
+}
+
+// lookup returns each object the name maps to in the table
+func (d *DiskDatabase) lookup(table int, name string) ([]*IndexedObject, error) {
+	pos := d.tables[table]
+	buf, err := d.read(pos, 4)
+	if err != nil {
+		return nil, err
+	}
+	count := int(binary.LittleEndian.Uint32(buf))
+
+	var searchErr error
+	i := sort.Search(count, func(i int) bool {
+		key, _, err := d.entry(pos, i)
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return key >= name
+	})
+	if searchErr != nil {
+		return nil, searchErr
+	}
+	if i == count {
+		return nil, nil
+	}
+	key, off, err := d.entry(pos, i)
+	if err != nil || key != name {
+		return nil, err
+	}
+
+	if buf, err = d.read(off, 4); err != nil {
+		return nil, err
+	}
+	n := int(binary.LittleEndian.Uint32(buf))
+	if buf, err = d.read(off+4, 4*n); err != nil {
+		return nil, err
+	}
+	ret := make([]*IndexedObject, 0, n)
+	for j := 0; j < n; j++ {
+		obj, err := d.object(binary.LittleEndian.Uint32(buf[4*j:]))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, obj)
+	}
+	return ret, nil
+}
+
+// object reads the object with the given number
+func (d *DiskDatabase) object(id uint32) (*IndexedObject, error) {
+	if uint64(id) >= d.count {
+		return nil, d.corrupt()
+	}
+	buf, err := d.read(d.objects+8*int64(id), 8)
+	if err != nil {
+		return nil, err
+	}
+	off := int64(binary.LittleEndian.Uint64(buf))
+	if buf, err = d.read(off, 4); err != nil {
+		return nil, err
+	}
+	if buf, err = d.read(off+4, int(binary.LittleEndian.Uint32(buf))); err != nil {
+		return nil, err
+	}
+	obj := &IndexedObject{}
+	if err := json.Unmarshal(buf, obj); err != nil {
+		return nil, fmt.Errorf("%s: %v", d.path, err)
+	}
+	return obj, nil
+}
+
+// Providers returns every library exporting the symbol, sorted by path. An
+// empty version matches definitions of any version.
+func (d *DiskDatabase) Providers(symbol, version string) ([]Provider, error) {
+	objs, err := d.lookup(tableExports, symbol)
+	if err != nil {
+		return nil, err
+	}
+	var ret []Provider
+	for _, obj := range objs {
+		ret = obj.appendProviders(ret, symbol, version)
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return ret, nil
+}
+
+// UsersOf returns the paths of every object importing the symbol, sorted. An
+// empty version matches references to any version of the symbol.
+func (d *DiskDatabase) UsersOf(symbol, version string) ([]string, error) {
+	objs, err := d.lookup(tableImports, symbol)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, obj := range objs {
+		if obj.imports(symbol, version) {
+			seen[obj.Path] = true
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+// NeededBy returns the paths of every object needing the library, sorted, as
+// Index.NeededBy does
+func (d *DiskDatabase) NeededBy(library string, transitive bool) ([]string, error) {
+	seen := make(map[string]bool)
+	names := []string{library}
+	done := map[string]bool{library: true}
+
+	for len(names) > 0 {
+		name := names[0]
+		names = names[1:]
+		objs, err := d.lookup(tableNeeded, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			if seen[obj.Path] || !obj.needs(name) {
+				continue
+			}
+			seen[obj.Path] = true
+			if !transitive {
+				continue
+			}
+			for _, n := range []string{obj.Soname, filepath.Base(obj.Path)} {
+				if n != "" && !done[n] {
+					done[n] = true
+					names = append(names, n)
+				}
+			}
+		}
+	}
+	// A cycle back to the library isn't the library needing itself
+	objs, err := d.lookup(tableNames, library)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		if obj.Soname == library || filepath.Base(obj.Path) == library {
+			delete(seen, obj.Path)
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+// Named returns the shared libraries known by the soname or file name, in
+// the order they were added, or the one at the path when name has a '/'
+func (d *DiskDatabase) Named(name string) ([]IndexedObject, error) {
+	objs, err := d.lookup(tableNames, name)
+	if err != nil {
+		return nil, err
+	}
+	var ret []IndexedObject
+	for _, obj := range objs {
+		if obj.library() {
+			ret = append(ret, *obj)
+		}
+	}
+	return ret, nil
+}
+
+// Close will close the database file
+func (d *DiskDatabase) Close() error {
+	return d.f.Close()
+}
+
+// WriteDatabase will store the index as a database file, see DatabaseWriter
+func (ix *Index) WriteDatabase(w io.Writer) error {
+	d, err := NewDatabaseWriter(w)
+	if err != nil {
+		return err
+	}
+	for i := range ix.Objects {
+		if err := d.Add(&ix.Objects[i]); err != nil {
+			return err
+		}
+	}
+	return d.Close()
+}
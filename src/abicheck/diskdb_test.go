@@ -0,0 +1,158 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testIndex has a small system: libc, a library needing it under two names,
+// an executable needing that, and a plugin with no soname
+func testIndex() *Index {
+	return &Index{Objects: []IndexedObject{
+		{
+			Path:    "/usr/lib/libc.so.6",
+			Soname:  "libc.so.6",
+			Machine: "EM_X86_64",
+			Class:   "ELFCLASS64",
+			Exports: []IndexedSymbol{{Name: "malloc", Version: "GLIBC_2.2.5"}, {Name: "old", Version: "GLIBC_2.0", Hidden: true}, {Name: "old", Version: "GLIBC_2.1"}},
+		},
+		{
+			Path:    "/usr/lib/libz.so.1.2",
+			Soname:  "libz.so.1",
+			Machine: "EM_X86_64",
+			Class:   "ELFCLASS64",
+			Needed:  []string{"libc.so.6"},
+			Imports: []IndexedSymbol{{Name: "malloc", Version: "GLIBC_2.2.5"}},
+			Exports: []IndexedSymbol{{Name: "inflate"}},
+		},
+		{
+			Path:    "/usr/bin/gzip",
+			Machine: "EM_X86_64",
+			Class:   "ELFCLASS64",
+			Needed:  []string{"/usr/lib/libz.so.1.2", "libc.so.6"},
+			Imports: []IndexedSymbol{{Name: "inflate"}, {Name: "old", Version: "GLIBC_2.1"}},
+		},
+		{
+			Path:    "/usr/lib/plugins/plugin.so",
+			Machine: "EM_X86_64",
+			Class:   "ELFCLASS64",
+			Needed:  []string{"libz.so.1"},
+			Exports: []IndexedSymbol{{Name: "malloc"}},
+		},
+	}}
+}
+
+func TestDiskDatabase(t *testing.T) {
+	ix := testIndex()
+	path := filepath.Join(t.TempDir(), "test.db")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.WriteDatabase(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	db, err := OpenSymbolDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, ok := db.(*DiskDatabase); !ok {
+		t.Fatalf("opened %T, want a DiskDatabase", db)
+	}
+	mem := ix.Database()
+
+	// Every answer has to match that of the index in memory
+	for _, q := range [][2]string{{"malloc", ""}, {"malloc", "GLIBC_2.2.5"}, {"old", ""}, {"old", "GLIBC_2.0"}, {"inflate", ""}, {"missing", ""}, {"", ""}} {
+		want, _ := mem.Providers(q[0], q[1])
+		got, err := db.Providers(q[0], q[1])
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Providers(%q, %q) = %v, %v; want %v", q[0], q[1], got, err, want)
+		}
+		wantUsers, _ := mem.UsersOf(q[0], q[1])
+		gotUsers, err := db.UsersOf(q[0], q[1])
+		if err != nil || !reflect.DeepEqual(gotUsers, wantUsers) {
+			t.Errorf("UsersOf(%q, %q) = %v, %v; want %v", q[0], q[1], gotUsers, err, wantUsers)
+		}
+	}
+	for _, name := range []string{"libc.so.6", "libz.so.1", "libz.so.1.2", "gzip", "missing"} {
+		for _, transitive := range []bool{false, true} {
+			want, _ := mem.NeededBy(name, transitive)
+			got, err := db.NeededBy(name, transitive)
+			if err != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("NeededBy(%q, %v) = %v, %v; want %v", name, transitive, got, err, want)
+			}
+		}
+	}
+	for _, name := range []string{"libc.so.6", "libz.so.1", "libz.so.1.2", "/usr/lib/libz.so.1.2", "plugin.so", "gzip", "/usr/bin/gzip", "missing"} {
+		want, _ := mem.Named(name)
+		got, err := db.Named(name)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Named(%q) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+
+	// Spot check the index itself, so the comparison means something
+	if got, _ := mem.NeededBy("libc.so.6", true); !reflect.DeepEqual(got, []string{"/usr/bin/gzip", "/usr/lib/libz.so.1.2", "/usr/lib/plugins/plugin.so"}) {
+		t.Errorf("NeededBy(libc.so.6, true) = %v", got)
+	}
+	if got, _ := mem.Named("gzip"); len(got) != 0 {
+		t.Errorf("Named(gzip) = %v, want no libraries", got)
+	}
+}
+
+func TestDiskDatabaseCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.db")
+	f, err := os.Create(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testIndex().WriteDatabase(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	data, err := os.ReadFile(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"magic":     []byte("not a database at all, but long enough for a footer........"),
+		"truncated": data[:len(data)/2],
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		db, err := OpenDatabase(path)
+		if err != nil {
+			continue
+		}
+		// A bad footer may only show once it's searched
+		if _, err := db.Providers("malloc", ""); err == nil {
+			t.Errorf("%s: no error opening or searching", name)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,199 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+)
+
+// DlopenManifest lists the libraries objects are expected to dlopen, so that
+// they can be checked along with those in DT_NEEDED. Each entry is keyed by
+// a pattern as in path.Match, matched against the object's path or file
+// name.
+type DlopenManifest struct {
+	entries []dlopenEntry
+}
+
+// dlopenEntry is a single line of the manifest
+type dlopenEntry struct {
+	pattern   string
+	libraries []string
+}
+
+// LoadDlopenManifest will read the manifest in the file at path, using the
+// same format as LoadIgnoreList with each key naming objects:
+//
+//	"/usr/bin/foo" = ["libfoo-plugin.so", "/usr/lib/foo/libbar.so"]
+//	"libgtk-3.so.*" = ["libcanberra-gtk3-module.so"]
+func LoadDlopenManifest(path string) (*DlopenManifest, error) {
+	ret := &DlopenManifest{}
+	if err := readArrays(path, ret.add); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// add will append the libraries expected of the objects matching pattern
+func (m *DlopenManifest) add(pattern string, libraries []string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	m.entries = append(m.entries, dlopenEntry{pattern: pattern, libraries: libraries})
+	return nil
+}
+
+// Libraries returns every library the object at path is expected to dlopen
+func (m *DlopenManifest) Libraries(path string) []string {
+	var ret []string
+	for _, entry := range m.entries {
+		if matchAny([]string{entry.pattern}, path) {
+			ret = append(ret, entry.libraries...)
+		}
+	}
+	return ret
+}
+
+// libraryNamePattern matches the names passed to dlopen, i.e. libfoo.so.1 or
+// /usr/lib/foo/plugin.so
+var libraryNamePattern = regexp.MustCompile(`^[A-Za-z0-9_./+-]*[A-Za-z0-9_+-]\.so(\.[0-9]+)*$`)
+
+// maxLibraryName skips anything too long to be a library name
+const maxLibraryName = 256
+
+// rodataLibraryNames returns each string within the read-only data of the
+// object that looks like a library name, in the order they appear. These are
+// only a guess at what the object may dlopen.
+func rodataLibraryNames(file *elfObject) []string {
+	sect := file.Section(".rodata")
+	if sect == nil {
+		return nil
+	}
+	data, err := sectionData(sect)
+	if err != nil {
+		return nil
+	}
+	var ret []string
+	seen := make(map[string]bool)
+	for _, str := range bytes.Split(data, []byte{0}) {
+		if len(str) < len("a.so") || len(str) > maxLibraryName {
+			continue
+		}
+		name := string(str)
+		if seen[name] || !libraryNamePattern.MatchString(name) {
+			continue
+		}
+		seen[name] = true
+		ret = append(ret, name)
+	}
+	return ret
+}
+
+// DynamicLoading describes how an object loads others at runtime, beyond
+// those in its DT_NEEDED
+type DynamicLoading struct {
+	Functions []string `json:"functions"` // Those of dlopen and co. it imports
+
+	// Candidates are the library names found within its read-only data,
+	// the likely arguments to dlopen
+	Candidates []string `json:"candidates,omitempty"`
+}
+
+// dynamicLoadingFunctions are the libdl functions to load objects or look
+// up their symbols by name
+var dynamicLoadingFunctions = map[string]bool{
+	"dlopen":  true,
+	"dlmopen": true,
+	"dlsym":   true,
+	"dlvsym":  true,
+}
+
+// dynamicLoading returns how the library loads objects at runtime, or nil if
+// it imports none of the functions to do so
+func dynamicLoading(lib *Library, file *elfObject) *DynamicLoading {
+	var functions []string
+	seen := make(map[string]bool)
+	for _, imp := range lib.loadedTables().Imports {
+		if dynamicLoadingFunctions[imp.Name] && !seen[imp.Name] {
+			seen[imp.Name] = true
+			functions = append(functions, imp.Name)
+		}
+	}
+	if functions == nil {
+		return nil
+	}
+	sort.Strings(functions)
+	return &DynamicLoading{Functions: functions, Candidates: rodataLibraryNames(file)}
+}
+
+// SetDlopenManifest will check the libraries the manifest lists for each
+// target, as though they were dlopened once it had started, replacing any
+// previous manifest. A nil manifest stops checking them.
+func (s *SymbolStore) SetDlopenManifest(manifest *DlopenManifest) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.dlopenManifest = manifest
+}
+
+// SetDlopenStrings will also check every library named by a string in the
+// read-only data of each target, the likely arguments to dlopen. Those can
+// include names that are only tried, so expect some to be missing.
+func (s *SymbolStore) SetDlopenStrings(enabled bool) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.dlopenStrings = enabled
+}
+
+// dlopenNames returns what the target at path is expected to dlopen, from
+// the manifest and then its own strings if enabled
+func (s *SymbolStore) dlopenNames(path string, file *elfObject) []string {
+	var ret []string
+	if s.dlopenManifest != nil {
+		ret = append(ret, s.dlopenManifest.Libraries(path)...)
+	}
+	if s.dlopenStrings {
+		ret = append(ret, rodataLibraryNames(file)...)
+	}
+	return ret
+}
+
+// loadDlopened will add each library the target is expected to dlopen to
+// the end of the scope. ld.so gives them a local scope of their own, after
+// the global one, so binding them last gets the same result for them. The
+// target itself may bind against them though, where ld.so wouldn't.
+func (s *SymbolStore) loadDlopened(scope *processScope, root *scopeEntry, names []string) error {
+	for _, name := range names {
+		dep, found, err := s.satisfy(scope, root, name, 0)
+		if !found {
+			if root.result != nil {
+				root.result.Dlopened = append(root.result.Dlopened, LibraryResult{Name: name})
+				s.addMissing(root.result, err, "dlopen target")
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if root.result != nil {
+			root.result.Dlopened = append(root.result.Dlopened, LibraryResult{Name: name, Path: dep.path})
+		}
+	}
+	return nil
+}
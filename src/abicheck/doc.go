@@ -0,0 +1,27 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package abicheck provides runtime ABI checking of ELF objects.
+//
+// It models the search and binding behaviour of the dynamic linker so that
+// the libraries an object needs, and every symbol it imports, can be
+// verified to resolve without ever executing the object.
+//
+// Every failure recorded in a result is one of the Classified error types,
+// such as *MissingLibraryError or *UnresolvedSymbolError, so callers can type
+// switch on them. Progress and issues may also be streamed as they happen
+// by setting an EventHandler on the SymbolStore.
+package abicheck
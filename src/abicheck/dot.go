@@ -0,0 +1,78 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+)
+
+// WriteDot will write the dependency graph of the objects in Graphviz DOT
+// format. Each edge goes from an object to one of its DT_NEEDED entries and
+// is labelled with the number of symbols bound against that library.
+func WriteDot(w io.Writer, objects []*ObjectResult) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph dependencies {")
+	fmt.Fprintln(bw, "    node [shape=ellipse];")
+
+	declared := make(map[string]bool)
+	declare := func(id, label, attrs string) {
+		if declared[id] {
+			return
+		}
+		declared[id] = true
+		fmt.Fprintf(bw, "    %s [label=%s%s];\n", strconv.Quote(id), strconv.Quote(label), attrs)
+	}
+
+	for _, obj := range objects {
+		attrs := ""
+		if obj.Target {
+			attrs = ", shape=box"
+		}
+		declare(obj.Path, filepath.Base(obj.Path), attrs)
+	}
+
+	for _, obj := range objects {
+		counts := make(map[string]int)
+		for _, sym := range obj.Symbols {
+			if sym.ProviderPath != "" {
+				counts[sym.ProviderPath]++
+			}
+		}
+		for _, lib := range obj.Libraries {
+			id := lib.Path
+			if id == "" {
+				// Never found, so there's nothing to link the name against
+				id = lib.Name
+				declare(id, lib.Name, ", color=red, style=dashed")
+			} else {
+				declare(id, filepath.Base(id), "")
+			}
+			attrs := ""
+			if lib.Unused {
+				attrs = ", style=dotted"
+			}
+			fmt.Fprintf(bw, "    %s -> %s [label=\"%d\"%s];\n", strconv.Quote(obj.Path), strconv.Quote(id), counts[lib.Path], attrs)
+		}
+	}
+
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
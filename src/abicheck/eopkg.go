@@ -0,0 +1,51 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"archive/zip"
+)
+
+// eopkgPayload is the tarball within an .eopkg holding the installed files
+const eopkgPayload = "install.tar.xz"
+
+// readEopkg will read install.tar.xz from the Solus package at path
+func readEopkg(path string) (*Overlay, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.Name != eopkgPayload {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		overlay := NewOverlay()
+		if err := readTar(overlay, r); err != nil {
+			return nil, err
+		}
+		return overlay, nil
+	}
+	return nil, ErrUnknownPackage
+}
@@ -0,0 +1,561 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"fmt"
+	"strings"
+)
+
+// Classified is implemented by every issue recorded against an object, so
+// that policies can decide how seriously to take it. Each of the issue types
+// in this file is also an Event, and is streamed to the store's handler as
+// soon as it's found.
+type Classified interface {
+	error
+	Event
+	Class() IssueClass
+}
+
+// MissingLibraryError is recorded when a DT_NEEDED entry, DT_FILTER filtee
+// or program interpreter can't be found anywhere for the right machine.
+type MissingLibraryError struct {
+	Importer string // Object needing the library
+	Library  string
+	Kind     string // "filtee", "interpreter", "preload" and so on, empty for DT_NEEDED
+
+	// Machine and ELFClass are what the importer needed, and Rejected
+	// lists the candidates skipped for being built for anything else
+	Machine  string
+	ELFClass string
+	Rejected []IncompatibleLibrary
+}
+
+// Error returns a human readable description of the failure
+func (e *MissingLibraryError) Error() string {
+	var msg string
+	switch e.Kind {
+	case "":
+		msg = fmt.Sprintf("failed to locate: %s", e.Library)
+	case "interpreter":
+		msg = fmt.Sprintf("failed to locate interpreter: %s", e.Library)
+	default:
+		msg = fmt.Sprintf("failed to locate %s: %s", e.Kind, e.Library)
+	}
+	if len(e.Rejected) == 0 {
+		return msg
+	}
+	var found []string
+	for _, lib := range e.Rejected {
+		name := archName(lib.Machine, lib.Class, e.ELFClass)
+		if lib.OS != "" {
+			name += " for " + lib.OS
+		}
+		if lib.ABI != "" {
+			name += " (" + lib.ABI + ")"
+		}
+		found = append(found, fmt.Sprintf("%s at %s", name, lib.Path))
+	}
+	return fmt.Sprintf("%s (only found for %s, need %s)", msg, strings.Join(found, ", "), archName(e.Machine, e.ELFClass, ""))
+}
+
+// archName describes the machine, only mentioning the class when it's the
+// difference, i.e. EM_386 but EM_X86_64/ELFCLASS32 for x32 when 64-bit
+// was wanted
+func archName(machine, class, wanted string) string {
+	if class != "" && class != wanted && wanted != "" {
+		return machine + "/" + class
+	}
+	return machine
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *MissingLibraryError) String() string { return e.Error() }
+
+// Class returns IssueMissingLibrary
+func (e *MissingLibraryError) Class() IssueClass { return IssueMissingLibrary }
+
+// UnresolvedSymbolError is recorded for a reference that no object in the
+// process scope defines.
+type UnresolvedSymbolError struct {
+	Symbol   string
+	Version  string
+	Binding  elf.SymBind
+	Importer string
+	Source   *SymbolSource // Only with debug info, see SetDebugInfo
+}
+
+// Error returns a human readable description of the failure
+func (e *UnresolvedSymbolError) Error() string {
+	if e.Source != nil {
+		return fmt.Sprintf("failed to resolve symbol: %s (%s)", symbolString(e.Symbol, e.Version), e.Source)
+	}
+	return fmt.Sprintf("failed to resolve symbol: %s", symbolString(e.Symbol, e.Version))
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *UnresolvedSymbolError) String() string { return e.Error() }
+
+// Class returns IssueUnresolvedSymbol
+func (e *UnresolvedSymbolError) Class() IssueClass { return IssueUnresolvedSymbol }
+
+// MissingVersionError is recorded when a dependency doesn't define a version
+// the object was linked against, which ld.so refuses to start with.
+type MissingVersionError struct {
+	Version  string
+	Library  string
+	Importer string
+}
+
+// Error returns a human readable description of the failure
+func (e *MissingVersionError) Error() string {
+	return fmt.Sprintf("version '%s' not found in %s", e.Version, e.Library)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *MissingVersionError) String() string { return e.Error() }
+
+// Class returns IssueMissingVersion
+func (e *MissingVersionError) Class() IssueClass { return IssueMissingVersion }
+
+// ArchMismatchWarning is raised for a candidate library that was skipped as
+// it was built for another machine.
+type ArchMismatchWarning struct {
+	Importer string
+	Library  string // Name being looked for
+	Path     string // Candidate that was skipped
+	Machine  string
+}
+
+// Error returns a human readable description of the issue
+func (e *ArchMismatchWarning) Error() string {
+	return fmt.Sprintf("skipped incompatible library %s (%s)", e.Path, e.Machine)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *ArchMismatchWarning) String() string { return e.Error() }
+
+// Class returns IssueArchMismatch
+func (e *ArchMismatchWarning) Class() IssueClass { return IssueArchMismatch }
+
+// UnusedLibraryWarning is raised for a DT_NEEDED entry that none of the
+// object's references are bound to.
+type UnusedLibraryWarning struct {
+	Importer string
+	Library  string
+}
+
+// Error returns a human readable description of the issue
+func (e *UnusedLibraryWarning) Error() string {
+	return fmt.Sprintf("unused library: %s", e.Library)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *UnusedLibraryWarning) String() string { return e.Error() }
+
+// Class returns IssueUnusedLibrary
+func (e *UnusedLibraryWarning) Class() IssueClass { return IssueUnusedLibrary }
+
+// UnderlinkedSymbolWarning is raised for a symbol that a shared library only
+// resolved through some other object's DT_NEEDED entries.
+type UnderlinkedSymbolWarning struct {
+	Importer string
+	Symbol   string
+	Version  string
+	Provider string
+}
+
+// Error returns a human readable description of the issue
+func (e *UnderlinkedSymbolWarning) Error() string {
+	return fmt.Sprintf("underlinked symbol: %s (from %s)", symbolString(e.Symbol, e.Version), e.Provider)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *UnderlinkedSymbolWarning) String() string { return e.Error() }
+
+// Class returns IssueUnderlinkedSymbol
+func (e *UnderlinkedSymbolWarning) Class() IssueClass { return IssueUnderlinkedSymbol }
+
+// DuplicateSymbolWarning is raised for a symbol defined by more than one
+// object within a target's process scope.
+type DuplicateSymbolWarning struct {
+	Importer  string // The target owning the process scope
+	Symbol    string
+	Version   string
+	Providers []string
+}
+
+// Error returns a human readable description of the issue
+func (e *DuplicateSymbolWarning) Error() string {
+	return fmt.Sprintf("duplicate symbol: %s (%s)", symbolString(e.Symbol, e.Version), strings.Join(e.Providers, ", "))
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *DuplicateSymbolWarning) String() string { return e.Error() }
+
+// Class returns IssueDuplicateSymbol
+func (e *DuplicateSymbolWarning) Class() IssueClass { return IssueDuplicateSymbol }
+
+// PrivateSymbolWarning is raised for a symbol bound from a private version,
+// such as GLIBC_PRIVATE, which is free to change with every release.
+type PrivateSymbolWarning struct {
+	Importer string
+	Symbol   string
+	Version  string
+	Provider string
+}
+
+// Error returns a human readable description of the issue
+func (e *PrivateSymbolWarning) Error() string {
+	return fmt.Sprintf("private symbol: %s (from %s)", symbolString(e.Symbol, e.Version), e.Provider)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *PrivateSymbolWarning) String() string { return e.Error() }
+
+// Class returns IssuePrivateSymbol
+func (e *PrivateSymbolWarning) Class() IssueClass { return IssuePrivateSymbol }
+
+// DependencyDepthError is recorded when an object is so many DT_NEEDED links
+// away from the target that its own dependencies are no longer loaded.
+type DependencyDepthError struct {
+	Importer string
+	Limit    int
+}
+
+// Error returns a human readable description of the failure
+func (e *DependencyDepthError) Error() string {
+	return fmt.Sprintf("dependencies nested more than %d deep, not loading any further", e.Limit)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *DependencyDepthError) String() string { return e.Error() }
+
+// Class returns IssueMissingLibrary, as the dependencies never get loaded
+func (e *DependencyDepthError) Class() IssueClass { return IssueMissingLibrary }
+
+// DependencyCycleWarning is raised when an object needs one of the objects
+// that (indirectly) loaded it.
+type DependencyCycleWarning struct {
+	Importer string
+	Cycle    []string // From the first object in the cycle back to itself
+}
+
+// Error returns a human readable description of the issue
+func (e *DependencyCycleWarning) Error() string {
+	return fmt.Sprintf("dependency cycle: %s", strings.Join(e.Cycle, " -> "))
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *DependencyCycleWarning) String() string { return e.Error() }
+
+// Class returns IssueDependencyCycle
+func (e *DependencyCycleWarning) Class() IssueClass { return IssueDependencyCycle }
+
+// StaleLibraryWarning is raised for an object a process has mapped (or had,
+// for a core file) that has since been deleted or replaced on disk, so it
+// isn't what is installed now.
+type StaleLibraryWarning struct {
+	Importer string // The executable of the process
+	Path     string
+	Replaced bool // Something else is now installed at Path
+}
+
+// Error returns a human readable description of the issue
+func (e *StaleLibraryWarning) Error() string {
+	if e.Replaced {
+		return fmt.Sprintf("mapped object since replaced: %s", e.Path)
+	}
+	return fmt.Sprintf("mapped object since deleted: %s", e.Path)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *StaleLibraryWarning) String() string { return e.Error() }
+
+// Class returns IssueStaleLibrary
+func (e *StaleLibraryWarning) Class() IssueClass { return IssueStaleLibrary }
+
+// DynamicLoadingWarning is raised for a target using dlopen and friends, as
+// whatever it loads that way isn't covered by checking its DT_NEEDED.
+type DynamicLoadingWarning struct {
+	Importer string
+	Loading  DynamicLoading
+}
+
+// Error returns a human readable description of the issue
+func (e *DynamicLoadingWarning) Error() string {
+	msg := fmt.Sprintf("loads objects at runtime with %s", strings.Join(e.Loading.Functions, ", "))
+	if len(e.Loading.Candidates) == 0 {
+		return msg
+	}
+	return fmt.Sprintf("%s (may load %s)", msg, strings.Join(e.Loading.Candidates, ", "))
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *DynamicLoadingWarning) String() string { return e.Error() }
+
+// Class returns IssueDynamicLoading
+func (e *DynamicLoadingWarning) Class() IssueClass { return IssueDynamicLoading }
+
+// ImpurePathWarning is raised for an interpreter, search path or library an
+// object uses from outside the pure store, see SetPureStore
+type ImpurePathWarning struct {
+	Importer string
+	Path     string
+	Kind     string // As for ImpurePath
+}
+
+// Error returns a human readable description of the issue
+func (e *ImpurePathWarning) Error() string {
+	return fmt.Sprintf("impure %s outside the store: %s", e.Kind, e.Path)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *ImpurePathWarning) String() string { return e.Error() }
+
+// Class returns IssueImpurePath
+func (e *ImpurePathWarning) Class() IssueClass { return IssueImpurePath }
+
+// HostLibraryError is recorded for a library a bundled object takes from the
+// host without it being expected there, see SetSelfContained. The bundle
+// loads where it was tested but not on a machine lacking the library.
+type HostLibraryError struct {
+	Importer string
+	Library  string
+	Path     string
+}
+
+// Error returns a human readable description of the issue
+func (e *HostLibraryError) Error() string {
+	return fmt.Sprintf("%s is not bundled, using the host's %s", e.Library, e.Path)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *HostLibraryError) String() string { return e.Error() }
+
+// Class returns IssueHostLibrary
+func (e *HostLibraryError) Class() IssueClass { return IssueHostLibrary }
+
+// ModversionMismatchError is recorded when a kernel module was built with a
+// CRC for a symbol that differs from the export, which the kernel refuses to
+// load the module for.
+type ModversionMismatchError struct {
+	Symbol   string
+	Importer string
+	Provider string
+	CRC      uint32 // As recorded in the module
+	Expected uint32 // As exported by the provider
+}
+
+// Error returns a human readable description of the failure
+func (e *ModversionMismatchError) Error() string {
+	return fmt.Sprintf("disagrees about version of symbol %s: 0x%08x, %s has 0x%08x", e.Symbol, e.CRC, e.Provider, e.Expected)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *ModversionMismatchError) String() string { return e.Error() }
+
+// Class returns IssueModversion
+func (e *ModversionMismatchError) Class() IssueClass { return IssueModversion }
+
+// UnreadableObjectWarning is raised when an object has the ELF magic but
+// can't be parsed, such as when truncated or stripped of the section headers
+// holding its dynamic symbols. The object is left out of the process.
+type UnreadableObjectWarning struct {
+	Importer string // Object being checked, or needing the object
+	Path     string
+	Reason   string
+}
+
+// Error returns a human readable description of the issue
+func (e *UnreadableObjectWarning) Error() string {
+	return fmt.Sprintf("failed to read %s: %s", e.Path, e.Reason)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *UnreadableObjectWarning) String() string { return e.Error() }
+
+// Class returns IssueUnreadableObject
+func (e *UnreadableObjectWarning) Class() IssueClass { return IssueUnreadableObject }
+
+// BadSonameWarning is raised when a shared library has no DT_SONAME, or one
+// that isn't the name it's installed under, so that ldconfig would create
+// links to it that nothing needs
+type BadSonameWarning struct {
+	Importer string
+	Soname   string // Empty when there is none
+	Problem  string
+}
+
+// Error returns a human readable description of the issue
+func (e *BadSonameWarning) Error() string {
+	if e.Soname == "" {
+		return fmt.Sprintf("bad soname for %s: %s", e.Importer, e.Problem)
+	}
+	return fmt.Sprintf("bad soname %s for %s: %s", e.Soname, e.Importer, e.Problem)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *BadSonameWarning) String() string { return e.Error() }
+
+// Class returns IssueBadSoname
+func (e *BadSonameWarning) Class() IssueClass { return IssueBadSoname }
+
+// DevSymlinkWarning is raised when a DT_NEEDED entry names the unversioned
+// development symlink of a library rather than its soname, which only
+// resolves while the -dev package is installed
+type DevSymlinkWarning struct {
+	Importer string
+	Library  string // The DT_NEEDED entry, i.e. libfoo.so
+	Soname   string // What it should have been, i.e. libfoo.so.1
+}
+
+// Error returns a human readable description of the issue
+func (e *DevSymlinkWarning) Error() string {
+	return fmt.Sprintf("%s needs the development symlink %s rather than %s", e.Importer, e.Library, e.Soname)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *DevSymlinkWarning) String() string { return e.Error() }
+
+// Class returns IssueDevSymlink
+func (e *DevSymlinkWarning) Class() IssueClass { return IssueDevSymlink }
+
+// ShadowedLibraryWarning is raised when a library is found in more than one
+// directory searched for it, as which copy is used then depends on the
+// search order of the machine it runs on
+type ShadowedLibraryWarning struct {
+	Importer string
+	Library  string
+	Path     string // The copy that wins
+	Shadowed []ShadowedCopy
+}
+
+// Error returns a human readable description of the issue
+func (e *ShadowedLibraryWarning) Error() string {
+	paths := make([]string, 0, len(e.Shadowed))
+	for _, c := range e.Shadowed {
+		if c.Differs {
+			paths = append(paths, c.Path+" (different exports)")
+		} else {
+			paths = append(paths, c.Path)
+		}
+	}
+	return fmt.Sprintf("%s for %s found at %s, shadowing %s", e.Library, e.Importer, e.Path, strings.Join(paths, ", "))
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *ShadowedLibraryWarning) String() string { return e.Error() }
+
+// Class returns IssueShadowedLibrary
+func (e *ShadowedLibraryWarning) Class() IssueClass { return IssueShadowedLibrary }
+
+// CPUFeatureWarning is raised when the objects of a process disagree on the
+// CPU features they're marked with, see FeatureMismatch
+type CPUFeatureWarning struct {
+	Importer string // The target owning the process scope
+	Feature  string
+	Objects  []string
+	CPU      string // The CPU level checked for, only set for ISA levels
+}
+
+// Error returns a human readable description of the issue
+func (e *CPUFeatureWarning) Error() string {
+	if e.CPU != "" {
+		return fmt.Sprintf("%s needs %s, beyond the %s CPU checked for: %s", e.Importer, e.Feature, e.CPU, strings.Join(e.Objects, ", "))
+	}
+	return fmt.Sprintf("%s loses %s, as not everything it loads supports it: %s", e.Importer, e.Feature, strings.Join(e.Objects, ", "))
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *CPUFeatureWarning) String() string { return e.Error() }
+
+// Class returns IssueCPUFeature
+func (e *CPUFeatureWarning) Class() IssueClass { return IssueCPUFeature }
+
+// CopyRelocationError is raised when an executable's copy relocation is sized
+// differently to the definition it copies. The executable reserved space for
+// the data when it was linked, so a library that has since grown the object
+// will have its own code write beyond the copy, with neither side noticing.
+type CopyRelocationError struct {
+	Importer     string
+	Symbol       string
+	Version      string
+	Size         uint64 // Reserved by the executable
+	Provider     string // Path of the library copied from
+	ProviderSize uint64
+}
+
+// Error returns a human readable description of the issue
+func (e *CopyRelocationError) Error() string {
+	return fmt.Sprintf("%s copies %s into %d bytes, but %s defines it with %d", e.Importer, symbolString(e.Symbol, e.Version), e.Size, e.Provider, e.ProviderSize)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *CopyRelocationError) String() string { return e.Error() }
+
+// Class returns IssueCopyRelocation
+func (e *CopyRelocationError) Class() IssueClass { return IssueCopyRelocation }
+
+// TextRelWarning is raised when an object has text relocations, which keep
+// its code from being shared and are refused outright under SELinux
+type TextRelWarning struct {
+	Importer string
+}
+
+// Error returns a human readable description of the issue
+func (e *TextRelWarning) Error() string {
+	return fmt.Sprintf("%s needs its text relocated", e.Importer)
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *TextRelWarning) String() string { return e.Error() }
+
+// Class returns IssueTextRel
+func (e *TextRelWarning) Class() IssueClass { return IssueTextRel }
+
+// SymbolTypeError is raised when a reference is bound to a definition of
+// another kind than it expects, i.e. a function that became a variable
+// between library versions. The reference still binds, but whatever uses it
+// then treats it as the wrong thing.
+type SymbolTypeError struct {
+	Importer     string
+	Symbol       string
+	Version      string
+	Type         string // What the reference expects
+	Provider     string
+	ProviderType string
+}
+
+// Error returns a human readable description of the issue
+func (e *SymbolTypeError) Error() string {
+	return fmt.Sprintf("%s expects %s to be %s, but %s defines it as %s", e.Importer, symbolString(e.Symbol, e.Version), kindPhrases[e.Type], e.Provider, kindPhrases[e.ProviderType])
+}
+
+// kindPhrases describes each kind of symbol named in a SymbolTypeError
+var kindPhrases = map[string]string{
+	"function": "a function",
+	"object":   "data",
+	"tls":      "thread-local data",
+}
+
+// String returns the same as Error, so that the issue is an Event too
+func (e *SymbolTypeError) String() string { return e.Error() }
+
+// Class returns IssueSymbolType
+func (e *SymbolTypeError) Class() IssueClass { return IssueSymbolType }
@@ -0,0 +1,175 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"fmt"
+)
+
+// Event is a single step taken while scanning, passed to the EventHandler
+// of the store. Issues found along the way are events too, see Classified.
+type Event interface {
+	String() string
+}
+
+// EventHandler receives each event as it happens. Scans run concurrently,
+// so it must be safe to call from multiple goroutines. It mustn't change the
+// configuration of the store, which waits for the scan to finish first.
+type EventHandler func(Event)
+
+// LibraryFoundEvent is emitted when a library is located on disk
+type LibraryFoundEvent struct {
+	Name string
+	Path string
+}
+
+// String returns a human readable description of the event
+func (e *LibraryFoundEvent) String() string {
+	return fmt.Sprintf("Found library @ %v", e.Path)
+}
+
+// DebugInfoEvent is emitted when debug info is found for an object with
+// unresolved symbols
+type DebugInfoEvent struct {
+	Path  string
+	Debug string // The object itself when it isn't stripped
+}
+
+// String returns a human readable description of the event
+func (e *DebugInfoEvent) String() string {
+	return fmt.Sprintf("Found debug info for %s @ %s", e.Path, e.Debug)
+}
+
+// LibraryReusedEvent is emitted when a library is already in the process
+// scope, either by the same name or another one (As)
+type LibraryReusedEvent struct {
+	Name string
+	As   string // Name it was already known by, if it differs
+}
+
+// String returns a human readable description of the event
+func (e *LibraryReusedEvent) String() string {
+	if e.As == "" {
+		return fmt.Sprintf("Already loaded: %v", e.Name)
+	}
+	return fmt.Sprintf("Already loaded %v as %v", e.Name, e.As)
+}
+
+// LinkerScriptEvent is emitted when a linker script is followed in place of
+// a real object
+type LinkerScriptEvent struct {
+	Path string
+}
+
+// String returns a human readable description of the event
+func (e *LinkerScriptEvent) String() string {
+	return fmt.Sprintf("Following linker script %s", e.Path)
+}
+
+// MissingAuxiliaryEvent is emitted when an auxiliary filtee can't be found,
+// which is fine as the filter provides the symbols itself
+type MissingAuxiliaryEvent struct {
+	Filter string
+	Filtee string
+}
+
+// String returns a human readable description of the event
+func (e *MissingAuxiliaryEvent) String() string {
+	return fmt.Sprintf("Auxiliary filtee %s of %s not found", e.Filtee, e.Filter)
+}
+
+// SymbolExportedEvent is emitted for each symbol a newly loaded library
+// makes available
+type SymbolExportedEvent struct {
+	Library string
+	Symbol  string
+	Version string
+}
+
+// String returns a human readable description of the event
+func (e *SymbolExportedEvent) String() string {
+	return fmt.Sprintf("%s now provides %s", e.Library, symbolString(e.Symbol, e.Version))
+}
+
+// SymbolResolvedEvent is emitted when a reference is bound to a provider
+type SymbolResolvedEvent struct {
+	Importer string
+	Symbol   string
+	Version  string
+	Provider string
+}
+
+// String returns a human readable description of the event
+func (e *SymbolResolvedEvent) String() string {
+	return fmt.Sprintf("Found symbol '%s' in '%s'", symbolString(e.Symbol, e.Version), e.Provider)
+}
+
+// WeakUnresolvedEvent is emitted for a weak reference left as NULL, which
+// isn't a failure unless strict weak handling was requested
+type WeakUnresolvedEvent struct {
+	Importer string
+	Symbol   string
+	Version  string
+}
+
+// String returns a human readable description of the event
+func (e *WeakUnresolvedEvent) String() string {
+	return fmt.Sprintf("Unresolved weak symbol '%s' in %s", symbolString(e.Symbol, e.Version), e.Importer)
+}
+
+// ErrorEvent is emitted for problems that don't stop the scan, such as
+// failing to write to the symbol cache
+type ErrorEvent struct {
+	Err error
+}
+
+// String returns the error message
+func (e *ErrorEvent) String() string {
+	return e.Err.Error()
+}
+
+// SetEventHandler will cause every event to be passed to fn as the scan goes,
+// replacing any previous handler. A nil handler discards events, which is
+// also the default. If the host linker configuration failed to load when
+// the store was created, that's delivered to fn straight away.
+func (s *SymbolStore) SetEventHandler(fn EventHandler) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.events = fn
+	if s.configErr != nil {
+		s.emit(&ErrorEvent{Err: s.configErr})
+		s.configErr = nil
+	}
+}
+
+// emit will pass the event to the handler, if there is one
+func (s *SymbolStore) emit(ev Event) {
+	if s.events != nil {
+		s.events(ev)
+	}
+}
+
+// ScanCompleteEvent is emitted by the Checker once a target has been fully
+// checked
+type ScanCompleteEvent struct {
+	Result *Result
+}
+
+// String returns a human readable description of the event
+func (e *ScanCompleteEvent) String() string {
+	return fmt.Sprintf("Checked %s (%d failure(s))", e.Result.Path, e.Result.NumFailures())
+}
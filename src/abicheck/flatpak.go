@@ -0,0 +1,299 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Flatpak is an installed Flatpak app along with the runtime and extensions
+// that make up its sandbox. The app files are mounted at /app and the runtime
+// files at /usr, so anything the app needs from the host is simply missing.
+type Flatpak struct {
+	ID           string
+	Arch         string
+	Branch       string
+	Files        string // Deployed app files, seen as /app
+	Runtime      string // Runtime ref, i.e. org.freedesktop.Platform/x86_64/23.08
+	RuntimeFiles string // Deployed runtime files, seen as /usr
+	Extensions   []FlatpakExtension
+}
+
+// FlatpakExtension is an extension of the app or runtime that was found
+// installed and will be mounted within the sandbox.
+type FlatpakExtension struct {
+	ID     string
+	Files  string // Deployed extension files
+	At     string // Mount point within the sandbox
+	LdPath string // Library directory within the sandbox, if any
+}
+
+// flatpakArches maps GOARCH to the arch names used by flatpak
+var flatpakArches = map[string]string{
+	"386":     "i386",
+	"amd64":   "x86_64",
+	"arm":     "arm",
+	"arm64":   "aarch64",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+}
+
+// FlatpakInstallations returns the default installations to search, the
+// per-user one first, like flatpak itself.
+func FlatpakInstallations() []string {
+	var ret []string
+	if dir := os.Getenv("FLATPAK_USER_DIR"); dir != "" {
+		ret = append(ret, dir)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		ret = append(ret, filepath.Join(home, ".local/share/flatpak"))
+	}
+	if dir := os.Getenv("FLATPAK_SYSTEM_DIR"); dir != "" {
+		ret = append(ret, dir)
+	} else {
+		ret = append(ret, "/var/lib/flatpak")
+	}
+	return ret
+}
+
+// FindFlatpak will locate the app within the first installation that has it,
+// along with its runtime and any installed extensions. The ref may be a bare
+// app ID, `id//branch`, `id/arch/branch` or a full `app/id/arch/branch`.
+func FindFlatpak(ref string, installations []string) (*Flatpak, error) {
+	ref = strings.TrimPrefix(ref, "app/")
+	parts := strings.Split(ref, "/")
+	if len(parts) > 3 || parts[0] == "" {
+		return nil, fmt.Errorf("invalid flatpak ref: %s", ref)
+	}
+	app := &Flatpak{ID: parts[0]}
+	if len(parts) > 1 {
+		app.Arch = parts[1]
+	}
+	if len(parts) > 2 {
+		app.Branch = parts[2]
+	}
+	if app.Arch == "" {
+		app.Arch = flatpakArches[runtime.GOARCH]
+	}
+
+	for _, inst := range installations {
+		dir := filepath.Join(inst, "app", app.ID)
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if app.Branch == "" {
+			// current points at arch/branch of the default deploy
+			target, err := os.Readlink(filepath.Join(dir, "current"))
+			if err != nil {
+				return nil, fmt.Errorf("no current branch of %s in %s, give one as %s//<branch>", app.ID, inst, app.ID)
+			}
+			if bits := strings.Split(filepath.ToSlash(target), "/"); len(bits) == 2 && bits[0] == app.Arch {
+				app.Branch = bits[1]
+			}
+		}
+		if err := app.load(inst); err != nil {
+			return nil, err
+		}
+		return app, nil
+	}
+	return nil, fmt.Errorf("flatpak %s is not installed in %s", app.ID, strings.Join(installations, " or "))
+}
+
+// load reads the deployed app from the installation
+func (f *Flatpak) load(inst string) error {
+	deploy := filepath.Join(inst, "app", f.ID, f.Arch, f.Branch, "active")
+	meta, err := parseKeyFile(filepath.Join(deploy, "metadata"))
+	if err != nil {
+		return fmt.Errorf("failed to read metadata of %s: %v", f.ID, err)
+	}
+	f.Files = filepath.Join(deploy, "files")
+	f.Runtime = meta["Application"]["runtime"]
+	if f.Runtime == "" {
+		return fmt.Errorf("%s has no runtime in its metadata", f.ID)
+	}
+
+	rt := strings.Split(f.Runtime, "/")
+	if len(rt) != 3 {
+		return fmt.Errorf("invalid runtime of %s: %s", f.ID, f.Runtime)
+	}
+	rtDeploy := filepath.Join(inst, "runtime", rt[0], rt[1], rt[2], "active")
+	rtMeta, err := parseKeyFile(filepath.Join(rtDeploy, "metadata"))
+	if err != nil {
+		return fmt.Errorf("runtime %s of %s is not installed: %v", f.Runtime, f.ID, err)
+	}
+	f.RuntimeFiles = filepath.Join(rtDeploy, "files")
+
+	f.Extensions = append(findExtensions(meta, inst, f.Arch, f.Branch, "/app"),
+		findExtensions(rtMeta, inst, f.Arch, rt[2], "/usr")...)
+	return nil
+}
+
+// findExtensions will return the installed extensions declared within the
+// metadata, mounted relative to base. Extensions that aren't installed are
+// skipped, as flatpak does.
+func findExtensions(meta map[string]map[string]string, inst, arch, branch, base string) []FlatpakExtension {
+	var groups []string
+	for group := range meta {
+		if strings.HasPrefix(group, "Extension ") {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+
+	var ret []FlatpakExtension
+	for _, group := range groups {
+		keys := meta[group]
+		id := strings.TrimPrefix(group, "Extension ")
+		if keys["directory"] == "" {
+			continue
+		}
+		versions := []string{branch}
+		if v := keys["versions"]; v != "" {
+			versions = strings.Split(strings.TrimSuffix(v, ";"), ";")
+		} else if v := keys["version"]; v != "" {
+			versions = []string{v}
+		}
+		at := filepath.Join(base, keys["directory"])
+
+		ids := []string{id}
+		if keys["subdirectories"] == "true" {
+			// Each id.* extension mounts in its own subdirectory
+			ids = nil
+			matches, _ := filepath.Glob(filepath.Join(inst, "runtime", id+".*"))
+			for _, match := range matches {
+				ids = append(ids, filepath.Base(match))
+			}
+		}
+		for _, ext := range ids {
+			for _, version := range versions {
+				files := filepath.Join(inst, "runtime", ext, arch, version, "active", "files")
+				if _, err := os.Stat(files); err != nil {
+					continue
+				}
+				mount := at
+				if ext != id {
+					mount = filepath.Join(at, strings.TrimPrefix(ext, id+"."))
+				}
+				var ldPath string
+				if p := keys["add-ld-path"]; p != "" {
+					ldPath = filepath.Join(mount, p)
+				}
+				ret = append(ret, FlatpakExtension{ID: ext, Files: files, At: mount, LdPath: ldPath})
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// parseKeyFile is just enough of a GKeyFile parser to read flatpak metadata
+func parseKeyFile(path string) (map[string]map[string]string, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	ret := make(map[string]map[string]string)
+	var group map[string]string
+	sc := bufio.NewScanner(fi)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := line[1 : len(line)-1]
+			if ret[name] == nil {
+				ret[name] = make(map[string]string)
+			}
+			group = ret[name]
+			continue
+		}
+		if kv := strings.SplitN(line, "=", 2); len(kv) == 2 && group != nil {
+			group[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return ret, sc.Err()
+}
+
+// Mounts returns the sandbox layout of the app, runtime and extensions
+func (f *Flatpak) Mounts() []Mount {
+	ret := []Mount{
+		{At: "/usr", Dir: f.RuntimeFiles},
+		{At: "/app", Dir: f.Files},
+	}
+	for _, ext := range f.Extensions {
+		ret = append(ret, Mount{At: ext.At, Dir: ext.Files})
+	}
+	return ret
+}
+
+// Rebase will rewrite the paths within the results as they are seen from
+// inside the sandbox.
+func (f *Flatpak) Rebase(results []*Result) {
+	mounts := f.Mounts()
+	// Deepest directory first so extensions within the app win
+	sort.SliceStable(mounts, func(i, j int) bool {
+		return len(mounts[i].Dir) > len(mounts[j].Dir)
+	})
+	rebaseResults(results, func(p string) string {
+		for _, m := range mounts {
+			if rel, err := filepath.Rel(m.Dir, p); err == nil && !strings.HasPrefix(rel, "..") {
+				return filepath.Join(m.At, rel)
+			}
+		}
+		return p
+	})
+}
+
+// SetFlatpak will resolve everything from within the sandbox of the app, so
+// that only the runtime, the app and their extensions are visible. The app's
+// own libraries and extension library paths are searched before the runtime.
+func (s *SymbolStore) SetFlatpak(app *Flatpak) error {
+	s.config.Lock()
+	defer s.config.Unlock()
+
+	s.sysroot = app.RuntimeFiles
+	if err := s.setMounts(app.Mounts()); err != nil {
+		return err
+	}
+	// Any cache shipped in the runtime can't know about the app
+	s.ldCache = nil
+
+	dirs := []string{"/app/lib"}
+	for _, ext := range app.Extensions {
+		if ext.LdPath != "" {
+			dirs = append(dirs, ext.LdPath)
+		}
+	}
+	dirs = append(dirs, s.configLibraries...)
+	seen := make(map[string]bool)
+	s.configLibraries = nil
+	for _, dir := range dirs {
+		if !seen[dir] {
+			seen[dir] = true
+			s.configLibraries = append(s.configLibraries, dir)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+)
+
+// Hardening is what an object was built with that makes it harder to
+// exploit, as checked by checksec and hardening-check
+type Hardening struct {
+	RELRO          string `json:"relro"` // "none", "partial" or "full"
+	BindNow        bool   `json:"bind_now"`
+	PIE            string `json:"pie"` // "no", "pie", "static-pie" or "dso" for libraries
+	ExecStack      bool   `json:"exec_stack"`
+	TextRel        bool   `json:"textrel"`
+	StackProtector bool   `json:"stack_protector"`
+}
+
+// stackProtectorSymbols are referenced by code built with -fstack-protector
+var stackProtectorSymbols = map[string]bool{
+	"__stack_chk_fail":  true,
+	"__stack_chk_guard": true,
+}
+
+// CheckHardening returns the hardening of the object at path
+func CheckHardening(path string) (*Hardening, error) {
+	file, err := openObject(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return hardeningOf(file), nil
+}
+
+// hasTextRel determines whether the object needs relocations applied to its
+// read-only segments, so that they can't be shared between processes
+func hasTextRel(file *elfObject) bool {
+	if vals, _ := file.DynValue(elf.DT_TEXTREL); len(vals) > 0 {
+		return true
+	}
+	vals, _ := file.DynValue(elf.DT_FLAGS)
+	return len(vals) > 0 && vals[0]&uint64(elf.DF_TEXTREL) != 0
+}
+
+// hardeningOf works out the hardening of the object from its program headers
+// and dynamic section
+func hardeningOf(file *elfObject) *Hardening {
+	ret := &Hardening{RELRO: "none", PIE: "no"}
+
+	var flags, flags1 uint64
+	if vals, _ := file.DynValue(elf.DT_FLAGS); len(vals) > 0 {
+		flags = vals[0]
+	}
+	if vals, _ := file.DynValue(elf.DT_FLAGS_1); len(vals) > 0 {
+		flags1 = vals[0]
+	}
+	bindNow, _ := file.DynValue(elf.DT_BIND_NOW)
+	ret.BindNow = len(bindNow) > 0 || flags&uint64(elf.DF_BIND_NOW) != 0 || flags1&uint64(elf.DF_1_NOW) != 0
+	ret.TextRel = hasTextRel(file)
+
+	// Without PT_GNU_STACK the kernel gives the process an executable stack
+	ret.ExecStack = true
+	for _, prog := range file.Progs {
+		switch prog.Type {
+		case elf.PT_GNU_RELRO:
+			ret.RELRO = "partial"
+		case elf.PT_GNU_STACK:
+			ret.ExecStack = prog.Flags&elf.PF_X != 0
+		}
+	}
+	if ret.RELRO == "partial" && ret.BindNow {
+		ret.RELRO = "full"
+	}
+
+	// Runnable libraries such as libc.so.6 carry PT_INTERP too, so that
+	// is only taken to mean an executable from linkers predating DF_1_PIE
+	// when the object has no soname either
+	if file.Type == elf.ET_DYN {
+		soname, _ := file.DynString(elf.DT_SONAME)
+		switch {
+		case flags1&uint64(elf.DF_1_PIE) != 0 && hasInterp(file.File):
+			ret.PIE = "pie"
+		case flags1&uint64(elf.DF_1_PIE) != 0:
+			ret.PIE = "static-pie"
+		case len(soname) == 0 && hasInterp(file.File):
+			ret.PIE = "pie"
+		default:
+			ret.PIE = "dso"
+		}
+	}
+
+	// Static executables only have their own symbol table to go by
+	var names []string
+	if tables, err := readSymbolTables(file.File); err == nil {
+		for _, imp := range tables.Imports {
+			names = append(names, imp.Name)
+		}
+	}
+	if syms, err := file.Symbols(); err == nil {
+		for _, sym := range syms {
+			names = append(names, sym.Name)
+		}
+	}
+	for _, name := range names {
+		if stackProtectorSymbols[name] {
+			ret.StackProtector = true
+			break
+		}
+	}
+	return ret
+}
@@ -0,0 +1,199 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// HostCPULevel is given to SetHWCaps to use the level of the running CPU
+const HostCPULevel = "host"
+
+// hwcapsDir is the directory glibc 2.33 and later look within each search
+// directory for libraries optimised for newer CPUs
+const hwcapsDir = "glibc-hwcaps"
+
+// hwcapsLevels are the glibc-hwcaps subdirectories known for each machine,
+// in increasing order, each level including those before it
+var hwcapsLevels = map[elf.Machine][]string{
+	elf.EM_X86_64: {"x86-64-v2", "x86-64-v3", "x86-64-v4"},
+	elf.EM_PPC64:  {"power9", "power10"},
+	elf.EM_S390:   {"z13", "z14", "z15", "z16"},
+}
+
+// x86Levels are the /proc/cpuinfo flags needed for each x86-64 level
+var x86Levels = [][]string{
+	{"cx16", "lahf_lm", "popcnt", "sse4_1", "sse4_2", "ssse3"},
+	{"avx", "avx2", "bmi1", "bmi2", "f16c", "fma", "abm", "movbe", "xsave"},
+	{"avx512f", "avx512bw", "avx512cd", "avx512dq", "avx512vl"},
+}
+
+// SetHWCaps will search the glibc-hwcaps subdirectories for the CPU level,
+// such as x86-64-v3, before each library directory, along with the legacy
+// hwcap subdirectories older releases used (tls and the platform name).
+// Lower levels of the same family are searched too, after the level itself.
+// HostCPULevel detects the level of the running CPU, and an empty string
+// (the default) searches no subdirectories at all.
+func (s *SymbolStore) SetHWCaps(level string) {
+	if level == HostCPULevel {
+		level = hostCPULevel()
+	}
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.hwcaps = level
+}
+
+// hostCPULevel returns the x86-64 level the running CPU supports, or an
+// empty string for anything else
+func hostCPULevel() string {
+	data, err := ioutil.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	flags := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(key) == "flags" {
+			for _, flag := range strings.Fields(value) {
+				flags[flag] = true
+			}
+			break
+		}
+	}
+	level := ""
+	for i, needed := range x86Levels {
+		for _, flag := range needed {
+			if !flags[flag] {
+				return level
+			}
+		}
+		level = hwcapsLevels[elf.EM_X86_64][i]
+	}
+	return level
+}
+
+// hwcapsSubdirs returns the subdirectories searched within each library
+// directory for the ABI, most preferred first
+func (s *SymbolStore) hwcapsSubdirs(arch Arch) []string {
+	if s.hwcaps == "" {
+		return nil
+	}
+	var ret []string
+	levels := hwcapsLevels[arch.Machine]
+	idx := -1
+	for i, level := range levels {
+		if level == s.hwcaps {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		// Not a level of this machine, which may be one we don't know
+		if !knownHWCaps(s.hwcaps) {
+			ret = append(ret, path.Join(hwcapsDir, s.hwcaps))
+		}
+	} else {
+		for i := idx; i >= 0; i-- {
+			ret = append(ret, path.Join(hwcapsDir, levels[i]))
+		}
+	}
+
+	// Before glibc 2.37, tls and the platform were searched too
+	if platform := legacyPlatform(arch); platform != "" {
+		ret = append(ret, "tls/"+platform, "tls", platform)
+	} else {
+		ret = append(ret, "tls")
+	}
+	return ret
+}
+
+// knownHWCaps determines whether the level belongs to any machine we know
+func knownHWCaps(level string) bool {
+	for _, levels := range hwcapsLevels {
+		for _, l := range levels {
+			if l == level {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// legacyPlatform returns AT_PLATFORM for the ABI, which named a legacy hwcap
+// subdirectory
+func legacyPlatform(arch Arch) string {
+	switch {
+	case arch.Machine == elf.EM_X86_64 && arch.Class == elf.ELFCLASS64:
+		return "x86_64"
+	case arch.Machine == elf.EM_386:
+		return "i686"
+	case arch.Machine == elf.EM_AARCH64:
+		return "aarch64"
+	default:
+		return ""
+	}
+}
+
+// withHWCaps returns the directories with the hwcaps subdirectories of each
+// searched first
+func (s *SymbolStore) withHWCaps(dirs []string, arch Arch) []string {
+	subdirs := s.hwcapsSubdirs(arch)
+	if len(subdirs) == 0 {
+		return dirs
+	}
+	ret := make([]string, 0, len(dirs)*(len(subdirs)+1))
+	for _, dir := range dirs {
+		for _, sub := range subdirs {
+			ret = append(ret, filepath.Join(dir, sub))
+		}
+		ret = append(ret, dir)
+	}
+	return ret
+}
+
+// cachedHWCaps sorts the ld.so.cache paths of a library by hwcaps preference,
+// dropping those in glibc-hwcaps subdirectories of levels not enabled.
+// Without any level set the cache order is kept as is.
+func (s *SymbolStore) cachedHWCaps(paths []string, arch Arch) []string {
+	subdirs := s.hwcapsSubdirs(arch)
+	if len(subdirs) == 0 {
+		return paths
+	}
+	rank := func(p string) int {
+		dir := filepath.Dir(p)
+		for i, sub := range subdirs {
+			if strings.HasSuffix(dir, "/"+sub) {
+				return i
+			}
+		}
+		if strings.Contains(dir, "/"+hwcapsDir+"/") {
+			return -1
+		}
+		return len(subdirs)
+	}
+	var ret []string
+	for rank0 := 0; rank0 <= len(subdirs); rank0++ {
+		for _, p := range paths {
+			if rank(p) == rank0 {
+				ret = append(ret, p)
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,236 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// IgnoreList names the symbols, versions, libraries and objects whose issues
+// should never be reported, such as libraries only ever dlopen'd at runtime
+// or optional plugins. Each entry is a pattern as in path.Match.
+type IgnoreList struct {
+	Libraries []string // Needed libraries, matched against the soname
+	Symbols   []string
+	Versions  []string
+	Objects   []string // Objects whose issues are all ignored, by path or file name
+}
+
+// LoadIgnoreList will read the ignore list in the file at path. This is a
+// small subset of TOML, where each key is assigned an array of strings:
+//
+//	libraries = ["libnvidia-*.so.*"]
+//	symbols = ["__gmon_start__", "_ITM_*"]
+//	versions = ["GLIBC_PRIVATE"]
+//	objects = ["/usr/lib/debug/*"]
+//
+// Arrays may span several lines, and '#' starts a comment.
+func LoadIgnoreList(path string) (*IgnoreList, error) {
+	ret := &IgnoreList{}
+	if err := readArrays(path, ret.set); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// readArrays will call set with each key of the file at path and the array
+// of strings assigned to it, see LoadIgnoreList
+func readArrays(path string, set func(key string, values []string) error) error {
+	settings, err := ReadTOML(path)
+	if err != nil {
+		return err
+	}
+	for _, setting := range settings {
+		if setting.Table != "" {
+			return fmt.Errorf("%s:%d: unexpected table [%s]", path, setting.Line, setting.Table)
+		}
+		if !setting.Array || !setting.Strings {
+			return fmt.Errorf("%s:%d: expected an array of strings for %s", path, setting.Line, setting.Key)
+		}
+		if err := set(setting.Key, setting.Values); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, setting.Line, err)
+		}
+	}
+	return nil
+}
+
+// set will append the values to the list named by key
+func (l *IgnoreList) set(key string, values []string) error {
+	for _, pattern := range values {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	switch key {
+	case "libraries":
+		l.Libraries = append(l.Libraries, values...)
+	case "symbols":
+		l.Symbols = append(l.Symbols, values...)
+	case "versions":
+		l.Versions = append(l.Versions, values...)
+	case "objects":
+		l.Objects = append(l.Objects, values...)
+	default:
+		return fmt.Errorf("unknown key: %s", key)
+	}
+	return nil
+}
+
+// matchAny determines whether the name matches any of the patterns. Names
+// containing a '/' are also tried by their file name, for patterns with none.
+func matchAny(patterns []string, name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(name)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Ignores determines whether the issue is covered by the list
+func (l *IgnoreList) Ignores(err Classified) bool {
+	var importer, library, symbol, version string
+	switch e := err.(type) {
+	case *MissingLibraryError:
+		importer, library = e.Importer, e.Library
+	case *UnresolvedSymbolError:
+		importer, symbol, version = e.Importer, e.Symbol, e.Version
+	case *MissingVersionError:
+		importer, library, version = e.Importer, e.Library, e.Version
+	case *ArchMismatchWarning:
+		importer, library = e.Importer, e.Library
+	case *UnusedLibraryWarning:
+		importer, library = e.Importer, e.Library
+	case *UnderlinkedSymbolWarning:
+		importer, symbol, version = e.Importer, e.Symbol, e.Version
+	case *PrivateSymbolWarning:
+		importer, symbol, version = e.Importer, e.Symbol, e.Version
+	case *DuplicateSymbolWarning:
+		importer, symbol, version = e.Importer, e.Symbol, e.Version
+	case *DependencyDepthError:
+		importer = e.Importer
+	case *StaleLibraryWarning:
+		importer, library = e.Importer, e.Path
+	case *DynamicLoadingWarning:
+		importer = e.Importer
+	case *ImpurePathWarning:
+		importer, library = e.Importer, e.Path
+	case *HostLibraryError:
+		importer, library = e.Importer, e.Library
+	case *ModversionMismatchError:
+		importer, symbol, library = e.Importer, e.Symbol, e.Provider
+	case *UnreadableObjectWarning:
+		importer, library = e.Importer, e.Path
+	case *BadSonameWarning:
+		importer = e.Importer
+	case *DevSymlinkWarning:
+		importer, library = e.Importer, e.Library
+	case *ShadowedLibraryWarning:
+		importer, library = e.Importer, e.Library
+	case *CPUFeatureWarning:
+		importer = e.Importer
+		for _, path := range e.Objects {
+			if matchAny(l.Libraries, path) {
+				return true
+			}
+		}
+	case *CopyRelocationError:
+		importer, symbol, library = e.Importer, e.Symbol, e.Provider
+	case *SymbolTypeError:
+		importer, symbol, library = e.Importer, e.Symbol, e.Provider
+	case *TextRelWarning:
+		importer = e.Importer
+	case *DependencyCycleWarning:
+		importer = e.Importer
+		for _, name := range e.Cycle {
+			if matchAny(l.Libraries, name) {
+				return true
+			}
+		}
+	}
+	return matchAny(l.Objects, importer) ||
+		matchAny(l.Libraries, library) ||
+		matchAny(l.Symbols, symbol) ||
+		matchAny(l.Versions, version)
+}
+
+// SetIgnoreList will drop every issue the list covers from the results,
+// replacing any previous list. A nil list reports everything again.
+func (s *SymbolStore) SetIgnoreList(list *IgnoreList) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.ignore = list
+}
+
+// ignored determines whether the issue is covered by the ignore list
+func (s *SymbolStore) ignored(err Classified) bool {
+	return s.ignore != nil && s.ignore.Ignores(err)
+}
+
+// dropIgnored clears each warning of the result that the ignore list covers.
+// Failures are never recorded in the first place, see addFailure.
+func (s *SymbolStore) dropIgnored(result *ObjectResult) {
+	if s.ignore == nil {
+		return
+	}
+	for i := range result.Libraries {
+		lib := &result.Libraries[i]
+		if lib.Unused && s.ignored(&UnusedLibraryWarning{Importer: result.Path, Library: lib.Name}) {
+			lib.Unused = false
+		}
+	}
+	for i := range result.Symbols {
+		sym := &result.Symbols[i]
+		if sym.Underlinked && s.ignored(&UnderlinkedSymbolWarning{Importer: result.Path, Symbol: sym.Name, Version: sym.Version}) {
+			sym.Underlinked = false
+		}
+		if sym.Private && s.ignored(&PrivateSymbolWarning{Importer: result.Path, Symbol: sym.Name, Version: sym.Version}) {
+			sym.Private = false
+		}
+	}
+	incompatible := result.Incompatible[:0]
+	for _, lib := range result.Incompatible {
+		if !s.ignored(&ArchMismatchWarning{Importer: result.Path, Library: lib.Name}) {
+			incompatible = append(incompatible, lib)
+		}
+	}
+	result.Incompatible = incompatible
+	cycles := result.Cycles[:0]
+	for _, cycle := range result.Cycles {
+		if !s.ignored(&DependencyCycleWarning{Importer: result.Path, Cycle: cycle}) {
+			cycles = append(cycles, cycle)
+		}
+	}
+	result.Cycles = cycles
+	duplicates := result.Duplicates[:0]
+	for _, dup := range result.Duplicates {
+		if !s.ignored(&DuplicateSymbolWarning{Importer: result.Path, Symbol: dup.Name, Version: dup.Version}) {
+			duplicates = append(duplicates, dup)
+		}
+	}
+	result.Duplicates = duplicates
+}
@@ -0,0 +1,463 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Whiteout markers used by OCI and Docker layers
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// Image is a container image whose layers have been unpacked into a
+// temporary root filesystem. Only what matters for resolution is unpacked:
+// ELF objects, symlinks, directories and the ld.so configuration.
+type Image struct {
+	Root string // Unpacked root filesystem, usable as a sysroot
+}
+
+// dockerManifest is an entry of manifest.json within `docker save` output
+type dockerManifest struct {
+	Layers []string `json:"Layers"`
+}
+
+// ociDescriptor references a blob within an OCI image layout
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+}
+
+// ociIndex is the index.json of an OCI image layout
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+// ociManifest is an image manifest within an OCI image layout
+type ociManifest struct {
+	Manifests []ociDescriptor `json:"manifests"` // Set for nested indexes
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// OpenImage will unpack the image found at ref, which may be an OCI image
+// layout directory, a tarball of one, `docker save` output, or the name of
+// an image known to the local docker daemon. Close must be called to remove
+// the unpacked files.
+func OpenImage(ref string) (*Image, error) {
+	bundle, err := ioutil.TempDir("", "abicheck-bundle-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(bundle)
+
+	layout := ref
+	st, err := os.Stat(ref)
+	switch {
+	case err == nil && st.IsDir():
+	case err == nil:
+		if err := extractBundle(ref, bundle); err != nil {
+			return nil, err
+		}
+		layout = bundle
+	case os.IsNotExist(err):
+		// Not a file, so ask docker for it
+		tarball := filepath.Join(bundle, "image.tar")
+		cmd := exec.Command("docker", "save", "-o", tarball, ref)
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("docker save %s failed: %v", ref, err)
+		}
+		layout = filepath.Join(bundle, "layout")
+		if err := extractBundle(tarball, layout); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	layers, err := imageLayers(layout)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := ioutil.TempDir("", "abicheck-image-")
+	if err != nil {
+		return nil, err
+	}
+	img := &Image{Root: root}
+	for _, layer := range layers {
+		if err := img.applyLayer(layer); err != nil {
+			img.Close()
+			return nil, fmt.Errorf("%s: %v", filepath.Base(layer), err)
+		}
+	}
+	return img, nil
+}
+
+// Close will remove the unpacked root filesystem
+func (i *Image) Close() error {
+	return os.RemoveAll(i.Root)
+}
+
+// extractBundle will extract the outer image tarball so the layers within
+// may be read
+func extractBundle(tarball, dir string) error {
+	fi, err := os.Open(tarball)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+
+	tr := tar.NewReader(fi)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := overlayPath(hdr.Name)
+		target := filepath.Join(dir, name)
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+		case tar.TypeSymlink:
+			// Newer docker releases link the legacy layer paths to blobs
+			if err := os.MkdirAll(filepath.Dir(target), 00755); err != nil {
+				return err
+			}
+			if err := os.Symlink(relativeLink(name, hdr.Linkname), target); err != nil {
+				return err
+			}
+			continue
+		default:
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 00755); err != nil {
+			return err
+		}
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// imageLayers returns the path of each layer blob in the image layout, from
+// the bottom layer up
+func imageLayers(layout string) ([]string, error) {
+	// `docker save` output, also present in OCI exports from docker
+	if data, err := ioutil.ReadFile(filepath.Join(layout, "manifest.json")); err == nil {
+		var manifests []dockerManifest
+		if err := json.Unmarshal(data, &manifests); err != nil {
+			return nil, fmt.Errorf("invalid manifest.json: %v", err)
+		}
+		if len(manifests) == 0 {
+			return nil, errors.New("manifest.json lists no images")
+		}
+		var ret []string
+		for _, layer := range manifests[0].Layers {
+			ret = append(ret, filepath.Join(layout, overlayPath(layer)))
+		}
+		return ret, nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(layout, "index.json"))
+	if err != nil {
+		return nil, errors.New("not an OCI image layout or docker archive")
+	}
+	var index ociIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid index.json: %v", err)
+	}
+	if len(index.Manifests) == 0 {
+		return nil, errors.New("index.json lists no manifests")
+	}
+
+	// Follow nested indexes down to the first image manifest
+	desc := index.Manifests[0]
+	for depth := 0; depth < 8; depth++ {
+		data, err := ioutil.ReadFile(blobPath(layout, desc.Digest))
+		if err != nil {
+			return nil, err
+		}
+		var manifest ociManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid manifest %s: %v", desc.Digest, err)
+		}
+		if len(manifest.Manifests) > 0 {
+			desc = manifest.Manifests[0]
+			continue
+		}
+		var ret []string
+		for _, layer := range manifest.Layers {
+			ret = append(ret, blobPath(layout, layer.Digest))
+		}
+		return ret, nil
+	}
+	return nil, errors.New("too many nested image indexes")
+}
+
+// blobPath returns the location of the blob with the given digest
+func blobPath(layout, digest string) string {
+	return filepath.Join(layout, "blobs", strings.Replace(digest, ":", string(filepath.Separator), 1))
+}
+
+// applyLayer will unpack the layer over the root
+func (i *Image) applyLayer(layer string) error {
+	fi, err := os.Open(layer)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+
+	r, err := decompress(fi)
+	if err != nil {
+		return err
+	}
+	return i.applyTar(r)
+}
+
+// applyTar will unpack the (uncompressed) tarball over the root, honouring
+// whiteouts
+func (i *Image) applyTar(r io.Reader) error {
+	// Opaque directories only hide what came from the layers below
+	added := make(map[string]bool)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := overlayPath(hdr.Name)
+		dir, base := path.Split(name)
+		if base == whiteoutOpaque {
+			if err := i.clearDir(dir, added); err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			target, err := i.resolve(path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+			if err != nil {
+				return err
+			}
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+			continue
+		}
+
+		target, err := i.resolve(name)
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeDir {
+			// Whatever was there before is replaced
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 00755); err != nil {
+			return err
+		}
+		added[name] = true
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 00755); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(relativeLink(name, hdr.Linkname), target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			source, err := i.resolve(overlayPath(hdr.Linkname))
+			if err != nil {
+				return err
+			}
+			if err := os.Link(source, target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		case tar.TypeReg:
+			if err := i.writeFile(name, target, hdr.ModTime, tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeFile will unpack the regular file if it's an ELF object or part of
+// the ld.so configuration, preserving the modification time so that
+// ld.so.cache staleness checks still work.
+func (i *Image) writeFile(name, target string, modTime time.Time, r io.Reader) error {
+	var data []byte
+	var err error
+	if strings.HasPrefix(name, "/etc/ld.so.") {
+		data, err = ioutil.ReadAll(r)
+	} else {
+		data, err = readELF(r)
+	}
+	if err != nil || data == nil {
+		return err
+	}
+	if err := ioutil.WriteFile(target, data, 00644); err != nil {
+		return err
+	}
+	return os.Chtimes(target, time.Now(), modTime)
+}
+
+// clearDir will remove everything within dir that wasn't added by the
+// current layer
+func (i *Image) clearDir(dir string, added map[string]bool) error {
+	target, err := i.resolve(dir)
+	if err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(target)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if added[path.Join(dir, entry.Name())] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(target, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve will return the location of name within the root, following any
+// symlinks in the leading components without ever leaving the root. The
+// final component is never followed.
+func (i *Image) resolve(name string) (string, error) {
+	for depth := 0; depth < maxLinkDepth; depth++ {
+		parts := strings.Split(strings.TrimPrefix(path.Clean("/"+name), "/"), "/")
+		cur := "/"
+		restarted := false
+		for idx, part := range parts[:len(parts)-1] {
+			next := path.Join(cur, part)
+			st, err := os.Lstat(filepath.Join(i.Root, next))
+			if err != nil || st.Mode()&os.ModeSymlink == 0 {
+				cur = next
+				continue
+			}
+			link, err := os.Readlink(filepath.Join(i.Root, next))
+			if err != nil {
+				return "", err
+			}
+			if !path.IsAbs(link) {
+				link = path.Join(cur, link)
+			}
+			name = path.Join(append([]string{link}, parts[idx+1:]...)...)
+			restarted = true
+			break
+		}
+		if !restarted {
+			return filepath.Join(i.Root, path.Join(cur, parts[len(parts)-1])), nil
+		}
+	}
+	return "", fmt.Errorf("too many levels of symbolic links: %s", name)
+}
+
+// relativeLink rewrites the target of the symlink at name so that it is
+// relative and can never point outside of the root, even when followed by
+// the host.
+func relativeLink(name, target string) string {
+	dir := path.Dir(name)
+	if !path.IsAbs(target) {
+		target = path.Join(dir, target)
+	}
+	rel, err := filepath.Rel(dir, path.Clean("/"+target))
+	if err != nil {
+		return target
+	}
+	return rel
+}
+
+// Rebase will rewrite the paths within the results to be relative to the
+// image root, as they would be seen from inside a container.
+func (i *Image) Rebase(results []*Result) {
+	rebaseResults(results, func(p string) string {
+		if rel, err := filepath.Rel(i.Root, p); err == nil && !strings.HasPrefix(rel, "..") {
+			return "/" + rel
+		}
+		return p
+	})
+}
+
+// rebaseResults will rewrite every path within the results with strip
+func rebaseResults(results []*Result, strip func(string) string) {
+	seen := make(map[*ObjectResult]bool)
+	for _, result := range results {
+		result.Path = strip(result.Path)
+		for idx := range result.Unresolved {
+			result.Unresolved[idx].Importer = strip(result.Unresolved[idx].Importer)
+		}
+		for _, obj := range result.Objects {
+			if seen[obj] {
+				continue
+			}
+			seen[obj] = true
+			obj.Path = strip(obj.Path)
+			for idx := range obj.SearchPaths {
+				obj.SearchPaths[idx] = strip(obj.SearchPaths[idx])
+			}
+			for _, libs := range [][]LibraryResult{obj.Libraries, obj.Filtees, obj.Dlopened, obj.Preloaded} {
+				for idx := range libs {
+					libs[idx].Path = strip(libs[idx].Path)
+				}
+			}
+			for idx := range obj.Incompatible {
+				obj.Incompatible[idx].Path = strip(obj.Incompatible[idx].Path)
+			}
+			for idx := range obj.Symbols {
+				if obj.Symbols[idx].ProviderPath != "" {
+					obj.Symbols[idx].ProviderPath = strip(obj.Symbols[idx].ProviderPath)
+				}
+			}
+		}
+	}
+}
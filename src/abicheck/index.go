@@ -0,0 +1,449 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// indexFormat is bumped whenever the index file changes incompatibly
+const indexFormat = 2
+
+// Index records what every object within a tree (i.e. a rootfs) or package
+// repository needs and provides, so that reverse dependencies and symbol
+// providers can be found without walking it again.
+type Index struct {
+	Format  int             `json:"format"`
+	Objects []IndexedObject `json:"objects"`
+
+	providers     map[string][]int // Symbol name to the objects exporting it
+	providersOnce sync.Once
+
+	names     map[string][]int // Path, soname and file name to the objects
+	namesOnce sync.Once
+}
+
+// IndexedObject is the dependency information of a single object
+type IndexedObject struct {
+	Path    string          `json:"path"`
+	Package string          `json:"package,omitempty"`
+	Soname  string          `json:"soname,omitempty"`
+	Machine string          `json:"machine"`
+	Class   string          `json:"class"`
+	Needed  []string        `json:"needed,omitempty"`
+	Imports []IndexedSymbol `json:"imports,omitempty"`
+
+	Rpaths   []string `json:"rpaths,omitempty"` // Unexpanded
+	Runpaths []string `json:"runpaths,omitempty"`
+
+	// Shared libraries only, so that they can stand in for the real
+	// thing when checking against the index (see SetDatabase)
+	Exports  []IndexedSymbol `json:"exports,omitempty"`
+	Versions []string        `json:"versions,omitempty"`
+}
+
+// Provider is a library found to export a symbol
+type Provider struct {
+	Library string `json:"library"` // DT_SONAME, or the file name
+	Path    string `json:"path"`
+	Package string `json:"package,omitempty"`
+	Machine string `json:"machine"`
+	Version string `json:"version,omitempty"`
+}
+
+// IndexedSymbol is a symbol reference or definition within the index
+type IndexedSymbol struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Hidden  bool   `json:"hidden,omitempty"` // Definitions only, see ExportedSymbol
+	Weak    bool   `json:"weak,omitempty"`   // References only
+}
+
+// String returns the conventional name@version form of the symbol
+func (s *IndexedSymbol) String() string {
+	return symbolString(s.Name, s.Version)
+}
+
+// IndexObject returns the index entry for the object at path
+func IndexObject(path string) (*IndexedObject, error) {
+	file, err := openObject(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	obj, err := indexFile(file, path)
+	if err != nil {
+		return nil, &malformedError{err: err}
+	}
+	return obj, nil
+}
+
+// indexFile returns the index entry for an opened object
+func indexFile(file *elfObject, path string) (*IndexedObject, error) {
+	if err := checkSections(file.File); err != nil {
+		return nil, err
+	}
+	tables, err := readSymbolTables(file.File)
+	if err != nil {
+		return nil, err
+	}
+	needed, err := file.DynString(elf.DT_NEEDED)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &IndexedObject{
+		Path:    path,
+		Soname:  soname(file),
+		Machine: file.FileHeader.Machine.String(),
+		Class:   file.FileHeader.Class.String(),
+		Needed:  needed,
+	}
+	for _, imp := range tables.Imports {
+		ret.Imports = append(ret.Imports, IndexedSymbol{Name: imp.Name, Version: imp.Version, Weak: imp.Weak()})
+	}
+	if ret.Runpaths, err = searchDirs(file, elf.DT_RUNPATH); err != nil {
+		return nil, err
+	}
+	if ret.Rpaths, err = searchDirs(file, elf.DT_RPATH); err != nil {
+		return nil, err
+	}
+	if !file.providesSymbols() {
+		return ret, nil
+	}
+	for _, exp := range tables.Exports {
+		ret.Exports = append(ret.Exports, IndexedSymbol{Name: exp.Name, Version: exp.Version, Hidden: exp.Hidden})
+	}
+	ret.Versions = tables.Versions
+	return ret, nil
+}
+
+// searchDirs returns each of the directories in the DT_RPATH or DT_RUNPATH
+// entries of the object, with none of the tokens expanded
+func searchDirs(file *elfObject, tag elf.DynTag) ([]string, error) {
+	entries, err := file.DynString(tag)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, entry := range entries {
+		for _, dir := range strings.Split(entry, ":") {
+			if dir != "" {
+				ret = append(ret, dir)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// TrimRoot will make every path within the index relative to root, as the
+// system indexed would see them itself
+func (ix *Index) TrimRoot(root string) {
+	for i := range ix.Objects {
+		obj := &ix.Objects[i]
+		if rel, err := filepath.Rel(root, obj.Path); err == nil && !strings.HasPrefix(rel, "..") {
+			obj.Path = "/" + rel
+		}
+	}
+}
+
+// indexPackage returns the index entries for every object within the
+// package file, named by their path within it
+func indexPackage(path string) ([]IndexedObject, error) {
+	overlay, err := ReadPackage(path)
+	if err != nil {
+		return nil, err
+	}
+	pkg := packageName(path)
+	var ret []IndexedObject
+	for _, name := range overlay.Objects() {
+		file, err := newObject(overlay.files[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, name, err)
+		}
+		obj, err := indexFile(file, name)
+		if err != nil {
+			// Too broken for ld.so to load, so it provides nothing
+			continue
+		}
+		obj.Package = pkg
+		ret = append(ret, *obj)
+	}
+	return ret, nil
+}
+
+// BuildIndex will index every object at the given paths, walking any
+// directories for dynamic ELF files, and every object within any package
+// files (as a repository would be). jobs files are read in parallel.
+func BuildIndex(paths []string, jobs int) (*Index, error) {
+	var files []string
+	for _, path := range paths {
+		st, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !st.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = WalkELF(path, func(p string) error {
+			files = append(files, p)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		// Package repositories are directories full of packages
+		err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() && IsPackage(p) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	objects := make([][]IndexedObject, len(files))
+	errs := make([]error, len(files))
+	parallel(len(files), jobs, func(idx int) {
+		if IsPackage(files[idx]) {
+			objects[idx], errs[idx] = indexPackage(files[idx])
+			return
+		}
+		obj, err := IndexObject(files[idx])
+		if err == nil {
+			objects[idx] = []IndexedObject{*obj}
+		}
+		errs[idx] = err
+	})
+
+	ret := &Index{Format: indexFormat}
+	for i := range objects {
+		// Like those within packages, broken objects provide nothing
+		var bad *malformedError
+		if errors.As(errs[i], &bad) {
+			continue
+		}
+		if errs[i] != nil {
+			return nil, fmt.Errorf("%s: %v", files[i], errs[i])
+		}
+		ret.Objects = append(ret.Objects, objects[i]...)
+	}
+	return ret, nil
+}
+
+// ReadIndex will load an index previously stored with Write
+func ReadIndex(r io.Reader) (*Index, error) {
+	ix := &Index{}
+	if err := json.NewDecoder(r).Decode(ix); err != nil {
+		return nil, err
+	}
+	if ix.Format != indexFormat {
+		return nil, fmt.Errorf("unsupported index format: %d", ix.Format)
+	}
+	return ix, nil
+}
+
+// Write will store the index as JSON
+func (ix *Index) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(ix)
+}
+
+// SetPackages will name the package owning each object within root that
+// isn't already known to come from one, using the mapping of paths (relative
+// to root) to packages from ReadDpkgOwners.
+func (ix *Index) SetPackages(root string, owners map[string]string) {
+	for i := range ix.Objects {
+		obj := &ix.Objects[i]
+		if obj.Package != "" {
+			continue
+		}
+		rel, err := filepath.Rel(root, obj.Path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = "/" + rel
+		if pkg, ok := owners[rel]; ok {
+			obj.Package = pkg
+		} else if rest, ok := strings.CutPrefix(rel, "/usr/"); ok {
+			// Merged /usr systems still list files under /lib etc
+			obj.Package = owners["/"+rest]
+		}
+	}
+}
+
+// needs determines whether the object has a DT_NEEDED entry for the name
+func (o *IndexedObject) needs(name string) bool {
+	for _, n := range o.Needed {
+		if n == name || filepath.Base(n) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// NeededBy returns the paths of every object needing the library, sorted.
+// When transitive is set, objects only needing it through other libraries
+// are included too.
+func (ix *Index) NeededBy(library string, transitive bool) []string {
+	seen := make(map[string]bool)
+	names := []string{library}
+	done := map[string]bool{library: true}
+
+	for len(names) > 0 {
+		name := names[0]
+		names = names[1:]
+		for i := range ix.Objects {
+			obj := &ix.Objects[i]
+			if seen[obj.Path] || !obj.needs(name) {
+				continue
+			}
+			seen[obj.Path] = true
+			if !transitive {
+				continue
+			}
+			// Anything needing this object needs the library too
+			for _, n := range []string{obj.Soname, filepath.Base(obj.Path)} {
+				if n != "" && !done[n] {
+					done[n] = true
+					names = append(names, n)
+				}
+			}
+		}
+	}
+	// A cycle back to the library isn't the library needing itself
+	for i := range ix.Objects {
+		obj := &ix.Objects[i]
+		if obj.Soname == library || filepath.Base(obj.Path) == library {
+			delete(seen, obj.Path)
+		}
+	}
+	return sortedKeys(seen)
+}
+
+// UsersOf returns the paths of every object importing the symbol, sorted. An
+// empty version matches references to any version of the symbol.
+func (ix *Index) UsersOf(symbol, version string) []string {
+	seen := make(map[string]bool)
+	for i := range ix.Objects {
+		if obj := &ix.Objects[i]; obj.imports(symbol, version) {
+			seen[obj.Path] = true
+		}
+	}
+	return sortedKeys(seen)
+}
+
+// Providers returns every library in the index exporting the symbol, sorted
+// by path. An empty version matches definitions of any version. This is
+// safe to call from many goroutines at once.
+func (ix *Index) Providers(symbol, version string) []Provider {
+	ix.providersOnce.Do(func() {
+		ix.providers = make(map[string][]int)
+		for i := range ix.Objects {
+			for _, exp := range ix.Objects[i].Exports {
+				ids := ix.providers[exp.Name]
+				if len(ids) == 0 || ids[len(ids)-1] != i {
+					ix.providers[exp.Name] = append(ids, i)
+				}
+			}
+		}
+	})
+
+	var ret []Provider
+	for _, i := range ix.providers[symbol] {
+		ret = ix.Objects[i].appendProviders(ret, symbol, version)
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return ret
+}
+
+// appendProviders will append the object to ret once for each definition of
+// the symbol it exports, of any version when version is empty
+func (o *IndexedObject) appendProviders(ret []Provider, symbol, version string) []Provider {
+	for _, exp := range o.Exports {
+		if exp.Name != symbol || (version != "" && exp.Version != version) {
+			continue
+		}
+		ret = append(ret, Provider{
+			Library: o.name(),
+			Path:    o.Path,
+			Package: o.Package,
+			Machine: o.Machine,
+			Version: exp.Version,
+		})
+	}
+	return ret
+}
+
+// imports determines whether the object references the symbol, of any
+// version when version is empty
+func (o *IndexedObject) imports(symbol, version string) bool {
+	for _, imp := range o.Imports {
+		if imp.Name == symbol && (version == "" || imp.Version == version) {
+			return true
+		}
+	}
+	return false
+}
+
+// name returns the DT_SONAME of the object, or its file name
+func (o *IndexedObject) name() string {
+	if o.Soname != "" {
+		return o.Soname
+	}
+	return filepath.Base(o.Path)
+}
+
+// library determines whether the object can stand in for a shared library
+// when checking against the index
+func (o *IndexedObject) library() bool {
+	return o.Soname != "" || len(o.Exports) > 0
+}
+
+// knownAs returns each name the object may be looked up by: its path, its
+// soname and its file name
+func (o *IndexedObject) knownAs() []string {
+	ret := []string{o.Path}
+	if o.Soname != "" {
+		ret = append(ret, o.Soname)
+	}
+	if base := filepath.Base(o.Path); base != o.Soname && base != o.Path {
+		ret = append(ret, base)
+	}
+	return ret
+}
+
+// sortedKeys returns the keys of the set in order
+func sortedKeys(set map[string]bool) []string {
+	ret := make([]string, 0, len(set))
+	for k := range set {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,160 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// OpenInitramfs will unpack the initramfs (or initrd) image into a temporary
+// root filesystem, in the same way as OpenImage. Images are a series of cpio
+// archives, each of which may be compressed, such as the uncompressed early
+// microcode archive most distributions put in front of the main one.
+func OpenInitramfs(file string) (*Image, error) {
+	fi, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	root, err := ioutil.TempDir("", "abicheck-initramfs-")
+	if err != nil {
+		return nil, err
+	}
+	img := &Image{Root: root}
+	if err := img.applyInitramfs(bufio.NewReader(fi), true); err != nil {
+		img.Close()
+		return nil, fmt.Errorf("failed to unpack initramfs %s: %v", file, err)
+	}
+	return img, nil
+}
+
+// applyInitramfs will unpack every archive in the stream over the root.
+// Compressed archives may only hold uncompressed ones, and besides gzip run
+// to the end of the stream.
+func (i *Image) applyInitramfs(r *bufio.Reader, outer bool) error {
+	for {
+		// Archives may be padded with NULs in between
+		for {
+			b, err := r.ReadByte()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if b != 0 {
+				r.UnreadByte()
+				break
+			}
+		}
+
+		magic, _ := r.Peek(len(cpioNewcMagic))
+		if string(magic) == cpioNewcMagic || string(magic) == cpioCrcMagic {
+			// Hard links only carry data in the last entry of the set
+			links := make(map[int64][]string)
+			if err := walkCpio(r, func(entry *cpioEntry, data io.Reader) error {
+				return i.applyCpioEntry(entry, data, links)
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+		if !outer {
+			return fmt.Errorf("unknown data within compressed archive")
+		}
+		if magic, _ := r.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+			// gzip knows where it ends, so padding or more archives may follow
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return err
+			}
+			zr.Multistream(false)
+			if err := i.applyInitramfs(bufio.NewReader(zr), false); err != nil {
+				return err
+			}
+			continue
+		}
+		dr, err := decompress(r)
+		if err != nil {
+			return err
+		}
+		// Anything decompress doesn't recognise comes back as it was
+		if _, ok := dr.(*bufio.Reader); ok {
+			return fmt.Errorf("unknown compression, or not an initramfs")
+		}
+		return i.applyInitramfs(bufio.NewReader(dr), false)
+	}
+}
+
+// applyCpioEntry will unpack the member over the root, as applyLayer does
+// for tar entries. Earlier entries of a hard link set are linked once the
+// one carrying the data arrives.
+func (i *Image) applyCpioEntry(entry *cpioEntry, data io.Reader, links map[int64][]string) error {
+	name := overlayPath(entry.name)
+	if name == "/" {
+		return nil
+	}
+	target, err := i.resolve(name)
+	if err != nil {
+		return err
+	}
+	mode := entry.mode & cpioModeType
+	if mode != cpioModeDir {
+		// Whatever was there before is replaced
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 00755); err != nil {
+		return err
+	}
+
+	switch mode {
+	case cpioModeDir:
+		return os.MkdirAll(target, 00755)
+	case cpioModeSymlink:
+		link, err := io.ReadAll(data)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(relativeLink(name, string(link)), target)
+	case cpioModeRegular:
+		if entry.nlink > 1 && entry.size == 0 {
+			links[entry.ino] = append(links[entry.ino], target)
+			return nil
+		}
+		if err := i.writeFile(name, target, time.Unix(entry.mtime, 0), data); err != nil {
+			return err
+		}
+		for _, link := range links[entry.ino] {
+			if err := os.Link(target, link); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		delete(links, entry.ino)
+	}
+	return nil
+}
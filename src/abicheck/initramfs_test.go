@@ -0,0 +1,157 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// initramfsTree returns what each path within the root is: dir, file or
+// the target of a link
+func initramfsTree(t *testing.T, root string) map[string]string {
+	tree := make(map[string]string)
+	err := filepath.Walk(root, func(p string, st os.FileInfo, err error) error {
+		if err != nil || p == root {
+			return err
+		}
+		name := "/" + filepath.ToSlash(strings.TrimPrefix(p, root+"/"))
+		switch {
+		case st.IsDir():
+			tree[name] = "dir"
+		case st.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			tree[name] = "-> " + link
+		default:
+			tree[name] = "file"
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+// hardLinked are two names for one library, the data only in the last
+var hardLinked = []testCpioEntry{
+	{name: "lib/libbar.so.1", mode: cpioModeRegular | 0755, ino: 7, nlink: 2},
+	{name: "lib/libbar-alt.so.1", mode: cpioModeRegular | 0755, ino: 7, nlink: 2, data: testELF},
+}
+
+func TestOpenInitramfs(t *testing.T) {
+	main := cpioArchive(testCpioMembers)
+	early := cpioArchive([]testCpioEntry{{name: "kernel/x86/microcode/GenuineIntel.bin", mode: cpioModeRegular | 0644, data: "ucode"}})
+	base := map[string]string{
+		"/usr":                  "dir",
+		"/usr/lib":              "dir",
+		"/usr/lib/libfoo.so.1":  "file",
+		"/usr/lib/libfoo.so":    "-> libfoo.so.1",
+		"/usr/share":            "dir",
+		"/usr/share/doc":        "dir",
+		"/kernel":               "dir",
+		"/kernel/x86":           "dir",
+		"/kernel/x86/microcode": "dir",
+	}
+	withBar := map[string]string{"/lib": "dir", "/lib/libbar.so.1": "file", "/lib/libbar-alt.so.1": "file"}
+	for name, kind := range base {
+		withBar[name] = kind
+	}
+	padding := make([]byte, 512)
+
+	tests := []struct {
+		name string
+		data []byte
+		want map[string]string
+	}{
+		{"uncompressed", join(early, main), base},
+		{"crc format", join(early, bytes.ReplaceAll(main, []byte(cpioNewcMagic), []byte(cpioCrcMagic))), base},
+		{"early and gzip", join(early, padding, gzipped(main)), base},
+		{"gzip members", join(gzipped(early), padding, gzipped(main), padding), base},
+		{"gzip holding two", gzipped(join(early, padding, main)), base},
+		{"hard links", join(early, main, cpioArchive(hardLinked)), withBar},
+	}
+	for _, test := range tests {
+		img, err := OpenInitramfs(testFile(t, "initrd.img", test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := initramfsTree(t, img.Root); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+		if test.want["/lib"] != "" {
+			a, _ := os.Stat(filepath.Join(img.Root, "lib/libbar.so.1"))
+			b, _ := os.Stat(filepath.Join(img.Root, "lib/libbar-alt.so.1"))
+			if a == nil || b == nil || !os.SameFile(a, b) {
+				t.Errorf("%s: hard links not linked", test.name)
+			}
+		}
+		img.Close()
+	}
+}
+
+func TestOpenInitramfsInvalid(t *testing.T) {
+	main := cpioArchive(testCpioMembers)
+	header := func(field int, value string) []byte {
+		ret := append([]byte(nil), main...)
+		copy(ret[6+field*8:], value)
+		return ret
+	}
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"not an initramfs", []byte("hello world"), "unknown compression, or not an initramfs"},
+		{"truncated header", main[:50], "truncated cpio archive"},
+		{"truncated name", main[:cpioHeaderSize+2], "truncated cpio archive"},
+		{"truncated data", main[:len(main)-cpioHeaderSize-20], "truncated cpio archive"},
+		{"no trailer", main[:len(main)-cpioHeaderSize-12], "truncated cpio archive"},
+		{"name too long", header(11, "00100000"), fmt.Sprintf("cpio member name of %d bytes is too long", 0x100000)},
+		{"size past the end", header(6, "7FFFFFFF"), "truncated cpio archive"},
+		{"bad field", header(1, "zzzzzzzz"), `strconv.ParseInt: parsing "zzzzzzzz": invalid syntax`},
+		// The kernel only unpacks newc archives, with or without checksums
+		{"odc format", append([]byte("070707"), main[6:]...), "unknown compression, or not an initramfs"},
+		{"garbage in gzip", gzipped([]byte("hello world")), "unknown data within compressed archive"},
+		{"truncated gzip", gzipped(main)[:40], "unexpected EOF"},
+	}
+	for _, test := range tests {
+		img, err := OpenInitramfs(testFile(t, "initrd.img", test.data))
+		if err == nil {
+			img.Close()
+			t.Errorf("%s: no error", test.name)
+			continue
+		}
+		if want := ": " + test.err; !strings.HasSuffix(err.Error(), want) {
+			t.Errorf("%s: got %v, want %s", test.name, err, test.err)
+		}
+	}
+}
+
+// join returns the pieces one after another
+func join(pieces ...[]byte) []byte {
+	return bytes.Join(pieces, nil)
+}
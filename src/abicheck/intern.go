@@ -0,0 +1,74 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"sync"
+)
+
+// stringPool interns strings, so that the names shared by many objects are
+// only held once however many times they are read. The same few thousand
+// symbol and version names turn up in nearly every object on a system.
+type stringPool struct {
+	mu      sync.Mutex
+	strings map[string]string
+}
+
+// newStringPool will return an empty pool
+func newStringPool() *stringPool {
+	return &stringPool{strings: make(map[string]string)}
+}
+
+// intern returns the pooled copy of the string
+func (p *stringPool) intern(s string) string {
+	if s == "" {
+		return s
+	}
+	if ret, ok := p.strings[s]; ok {
+		return ret
+	}
+	p.strings[s] = s
+	return s
+}
+
+// internTables will replace every name within the tables with its pooled
+// copy, allowing the originals to be freed
+func (p *stringPool) internTables(tables *SymbolTables) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range tables.Versions {
+		tables.Versions[i] = p.intern(tables.Versions[i])
+	}
+	for i := range tables.VersionNeeds {
+		need := &tables.VersionNeeds[i]
+		need.Library = p.intern(need.Library)
+		for j := range need.Versions {
+			need.Versions[j] = p.intern(need.Versions[j])
+		}
+	}
+	for i := range tables.Exports {
+		exp := &tables.Exports[i]
+		exp.Name = p.intern(exp.Name)
+		exp.Version = p.intern(exp.Version)
+	}
+	for i := range tables.Imports {
+		imp := &tables.Imports[i]
+		imp.Name = p.intern(imp.Name)
+		imp.Version = p.intern(imp.Version)
+		imp.Library = p.intern(imp.Library)
+	}
+}
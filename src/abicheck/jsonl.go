@@ -0,0 +1,85 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// JSONLReporter writes every issue the policy doesn't ignore as a JSON
+// object on its own line, as soon as each target is checked, so that a
+// whole distribution can be piped into other tools without waiting on (or
+// holding) the entire report.
+type JSONLReporter struct {
+	progress
+	out    io.Writer
+	policy Policy
+	mu     sync.Mutex
+}
+
+// jsonlFinding is a single line of the JSONLReporter's output
+type jsonlFinding struct {
+	Target   string     `json:"target"` // The file that was checked
+	Path     string     `json:"path"`   // The object the issue was found in
+	Class    IssueClass `json:"class"`
+	Severity string     `json:"severity"`
+	Message  string     `json:"message"`
+}
+
+// NewJSONLReporter returns a JSONLReporter writing findings to out, and
+// progress to the progress writer, which may be nil
+func NewJSONLReporter(out, progressOut io.Writer, policy Policy) *JSONLReporter {
+	return &JSONLReporter{
+		progress: progress{w: progressOut},
+		out:      out,
+		policy:   policy,
+	}
+}
+
+// Event writes the findings of each target as it completes
+func (r *JSONLReporter) Event(ev Event) {
+	done, ok := ev.(*ScanCompleteEvent)
+	if !ok {
+		r.progress.Event(ev)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	enc := json.NewEncoder(r.out)
+	for _, obj := range done.Result.Objects {
+		for _, issue := range obj.Issues() {
+			severity := r.policy.Severity(issue.Class)
+			if severity == SeverityIgnore {
+				continue
+			}
+			enc.Encode(&jsonlFinding{
+				Target:   done.Result.Path,
+				Path:     obj.Path,
+				Class:    issue.Class,
+				Severity: severity.String(),
+				Message:  issue.Err.Error(),
+			})
+		}
+	}
+}
+
+// Complete does nothing, as every finding was written as it was found
+func (r *JSONLReporter) Complete(results []*Result) error {
+	return nil
+}
@@ -0,0 +1,448 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symbols marking exports and their CRCs within the kernel and modules
+const (
+	ksymtabPrefix = "__ksymtab_"
+	kcrcPrefix    = "__crc_"
+
+	// KernelImage is the name Module.symvers gives the kernel itself
+	KernelImage = "vmlinux"
+)
+
+// moduleSuffixes are the names kernel modules are installed under
+var moduleSuffixes = []string{".ko", ".ko.gz", ".ko.xz", ".ko.zst"}
+
+// KernelSymbol is a symbol exported by the kernel or a module
+type KernelSymbol struct {
+	Name   string
+	Module string // KernelImage for the kernel itself
+	CRC    uint32
+	HasCRC bool // Only with CONFIG_MODVERSIONS
+}
+
+// KernelSymbols holds every symbol available to modules. The first export
+// of a name wins, as the kernel refuses to load a module exporting a symbol
+// that is already exported.
+type KernelSymbols struct {
+	symbols map[string]KernelSymbol
+}
+
+// NewKernelSymbols will return an empty set of kernel symbols
+func NewKernelSymbols() *KernelSymbols {
+	return &KernelSymbols{symbols: make(map[string]KernelSymbol)}
+}
+
+// Add will add the export, unless the name is already exported
+func (k *KernelSymbols) Add(sym KernelSymbol) {
+	if _, ok := k.symbols[sym.Name]; !ok {
+		k.symbols[sym.Name] = sym
+	}
+}
+
+// Lookup returns the export of the symbol, if there is one
+func (k *KernelSymbols) Lookup(name string) (KernelSymbol, bool) {
+	sym, ok := k.symbols[name]
+	return sym, ok
+}
+
+// Load will add the exports found in the file, which may be a Module.symvers,
+// a vmlinux or a module.
+func (k *KernelSymbols) Load(path string) error {
+	data, err := readModuleFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte(elf.ELFMAG)) {
+		return k.loadSymvers(path, data)
+	}
+	mod, err := parseKernelModule(path, data)
+	if err != nil {
+		return err
+	}
+	for _, sym := range mod.Exports {
+		k.Add(sym)
+	}
+	return nil
+}
+
+// loadSymvers parses Module.symvers, where each line is the CRC, symbol,
+// module and export type, then the namespace on newer kernels
+func (k *KernelSymbols) loadSymvers(path string, data []byte) error {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			return fmt.Errorf("%s:%d: expected at least 3 fields", path, n)
+		}
+		crc, err := strconv.ParseUint(fields[0], 0, 32)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid CRC: %s", path, n, fields[0])
+		}
+		module := fields[2]
+		if strings.HasSuffix(module, KernelImage) {
+			module = KernelImage
+		} else {
+			module = moduleName(module)
+		}
+		// Without MODVERSIONS every CRC is written as 0
+		k.Add(KernelSymbol{Name: fields[1], Module: module, CRC: uint32(crc), HasCRC: crc != 0})
+	}
+	return sc.Err()
+}
+
+// moduleName returns the name of the module from its path
+func moduleName(path string) string {
+	name := filepath.Base(path)
+	for _, suffix := range moduleSuffixes {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return name
+}
+
+// IsKernelModule determines whether the path is named as a kernel module
+func IsKernelModule(path string) bool {
+	for _, suffix := range moduleSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// WalkModules will walk the directory tree at root, calling fn for every
+// kernel module found.
+func WalkModules(root string, fn func(path string) error) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || !IsKernelModule(path) {
+			return nil
+		}
+		return fn(path)
+	})
+}
+
+// KernelModule is what a module imports and exports
+type KernelModule struct {
+	Path      string
+	Name      string
+	Machine   elf.Machine
+	Class     elf.Class
+	Undefined []elf.Symbol
+	Exports   []KernelSymbol
+
+	// Versions holds the CRC recorded for each import when the module was
+	// built with MODVERSIONS
+	Versions map[string]uint32
+}
+
+// readModuleFile will read the whole file, decompressing it if needed
+func readModuleFile(path string) ([]byte, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+	r, err := decompress(fi)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// ReadKernelModule will read the imports and exports of the module, which
+// may be compressed.
+func ReadKernelModule(path string) (*KernelModule, error) {
+	data, err := readModuleFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseKernelModule(path, data)
+}
+
+// parseKernelModule reads the module, or the kernel image, from data
+func parseKernelModule(path string, data []byte) (*KernelModule, error) {
+	e, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, &malformedError{err: err})
+	}
+	defer e.Close()
+
+	mod := &KernelModule{
+		Path:     path,
+		Name:     moduleName(path),
+		Machine:  e.Machine,
+		Class:    e.Class,
+		Versions: make(map[string]uint32),
+	}
+	if e.Type == elf.ET_EXEC {
+		mod.Name = KernelImage
+	} else if e.Type != elf.ET_REL {
+		return nil, fmt.Errorf("%s is not a kernel module", path)
+	}
+	if sect := e.Section(".modinfo"); sect != nil {
+		if info, err := sectionData(sect); err == nil {
+			for _, entry := range bytes.Split(info, []byte{0}) {
+				if name := bytes.TrimPrefix(entry, []byte("name=")); len(name) != len(entry) {
+					mod.Name = string(name)
+				}
+			}
+		}
+	}
+
+	syms, err := e.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, fmt.Errorf("failed to read symbols of %s: %w", path, &malformedError{err: err})
+	}
+	crcs := make(map[string]uint32)
+	tables := make(map[elf.SectionIndex]io.ReaderAt)
+	var exports []string
+	for _, sym := range syms {
+		switch {
+		case sym.Name == "":
+			continue
+		case sym.Section == elf.SHN_UNDEF:
+			mod.Undefined = append(mod.Undefined, sym)
+		case strings.HasPrefix(sym.Name, ksymtabPrefix):
+			exports = append(exports, strings.TrimPrefix(sym.Name, ksymtabPrefix))
+		case strings.HasPrefix(sym.Name, kcrcPrefix):
+			if crc, ok := symbolCRC(e, sym, tables); ok {
+				crcs[strings.TrimPrefix(sym.Name, kcrcPrefix)] = crc
+			}
+		}
+	}
+	for _, name := range exports {
+		crc, ok := crcs[name]
+		mod.Exports = append(mod.Exports, KernelSymbol{Name: name, Module: mod.Name, CRC: crc, HasCRC: ok})
+	}
+
+	if err := mod.readVersions(e); err != nil {
+		return nil, fmt.Errorf("failed to read versions of %s: %w", path, &malformedError{err: err})
+	}
+	return mod, nil
+}
+
+// symbolCRC returns the CRC a __crc_ symbol stands for. Older kernels made
+// the CRC the (absolute) value of the symbol, newer ones store it within
+// __kcrctab at the symbol. Readers for the sections are kept in tables, as
+// one that's compressed has to be decompressed in full first.
+func symbolCRC(e *elf.File, sym elf.Symbol, tables map[elf.SectionIndex]io.ReaderAt) (uint32, bool) {
+	if sym.Section == elf.SHN_ABS {
+		return uint32(sym.Value), true
+	}
+	if sym.Section >= elf.SHN_LORESERVE || int(sym.Section) >= len(e.Sections) {
+		return 0, false
+	}
+	sect := e.Sections[sym.Section]
+	r, ok := tables[sym.Section]
+	if !ok {
+		r, _ = sectionReader(sect)
+		tables[sym.Section] = r
+	}
+	if r == nil {
+		return 0, false
+	}
+	off := sym.Value
+	if e.Type != elf.ET_REL {
+		off -= sect.Addr
+	}
+	buf := make([]byte, 4)
+	if _, err := r.ReadAt(buf, int64(off)); err != nil {
+		return 0, false
+	}
+	return e.ByteOrder.Uint32(buf), true
+}
+
+// readVersions reads the CRCs of the imports that the module was built with,
+// from __versions or the split tables of extended modversions
+func (m *KernelModule) readVersions(e *elf.File) error {
+	if sect := e.Section("__versions"); sect != nil {
+		data, err := sectionData(sect)
+		if err != nil {
+			return err
+		}
+		// struct modversion_info is an unsigned long and the rest of 64
+		// bytes for the name
+		word := 4
+		if e.Class == elf.ELFCLASS64 {
+			word = 8
+		}
+		for len(data) >= 64 {
+			entry := data[:64]
+			data = data[64:]
+			var crc uint32
+			if word == 8 {
+				crc = uint32(e.ByteOrder.Uint64(entry))
+			} else {
+				crc = e.ByteOrder.Uint32(entry)
+			}
+			name := string(bytes.TrimRight(entry[word:], "\x00"))
+			m.Versions[name] = crc
+		}
+	}
+
+	names, crcs := e.Section("__version_ext_names"), e.Section("__version_ext_crcs")
+	if names == nil || crcs == nil {
+		return nil
+	}
+	nameData, err := sectionData(names)
+	if err != nil {
+		return err
+	}
+	crcData, err := sectionData(crcs)
+	if err != nil {
+		return err
+	}
+	for idx, name := range bytes.Split(bytes.TrimRight(nameData, "\x00"), []byte{0}) {
+		if (idx+1)*4 > len(crcData) {
+			break
+		}
+		m.Versions[string(name)] = e.ByteOrder.Uint32(crcData[idx*4:])
+	}
+	return nil
+}
+
+// CheckModules will check that every undefined symbol of the modules is
+// exported by the kernel or another of the modules, and that the CRCs the
+// modules were built against match the exports when MODVERSIONS was used.
+// The kernel's exports are taken from symbols, which may be empty to only
+// check the modules against each other.
+func (c *Checker) CheckModules(ctx context.Context, paths []string, symbols *KernelSymbols) ([]*Result, error) {
+	results, err := c.checkModules(ctx, paths, symbols)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		c.complete(result)
+	}
+	return results, nil
+}
+
+// checkModules is CheckModules, leaving the caller to complete each result
+func (c *Checker) checkModules(ctx context.Context, paths []string, symbols *KernelSymbols) ([]*Result, error) {
+	c.Store.config.RLock()
+	defer c.Store.config.RUnlock()
+
+	// A broken module is reported against itself, as the kernel would
+	// refuse just that one
+	results := make([]*Result, len(paths))
+	mods := make([]*KernelModule, len(paths))
+	for i, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		mod, err := ReadKernelModule(path)
+		var bad *malformedError
+		if errors.As(err, &bad) {
+			obj := &ObjectResult{Path: path, Target: true}
+			c.Store.addUnreadable(obj, path, bad)
+			results[i] = &Result{Path: path, Objects: []*ObjectResult{obj}}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		mods[i] = mod
+		for _, sym := range mod.Exports {
+			symbols.Add(sym)
+		}
+	}
+
+	for i, mod := range mods {
+		if mod != nil {
+			results[i] = c.checkModule(mod, symbols)
+		}
+	}
+	return results, nil
+}
+
+// checkModule will resolve a single module against the exports
+func (c *Checker) checkModule(mod *KernelModule, symbols *KernelSymbols) *Result {
+	s := c.Store
+	obj := &ObjectResult{
+		Path:    mod.Path,
+		Target:  true,
+		Machine: mod.Machine.String(),
+		Class:   mod.Class.String(),
+		Soname:  mod.Name,
+	}
+	result := &Result{Path: mod.Path, Objects: []*ObjectResult{obj}}
+
+	for _, sym := range mod.Undefined {
+		weak := elf.ST_BIND(sym.Info) == elf.STB_WEAK
+		export, ok := symbols.Lookup(sym.Name)
+		if !ok {
+			obj.Symbols = append(obj.Symbols, SymbolResult{Name: sym.Name, Weak: weak})
+			if weak && !s.strictWeak {
+				s.emit(&WeakUnresolvedEvent{Importer: obj.Path, Symbol: sym.Name})
+				continue
+			}
+			s.addFailure(obj, &UnresolvedSymbolError{
+				Symbol:   sym.Name,
+				Binding:  elf.ST_BIND(sym.Info),
+				Importer: obj.Path,
+			})
+			result.Unresolved = append(result.Unresolved, Unresolved{Importer: obj.Path, Name: sym.Name, Weak: weak})
+			continue
+		}
+		obj.Symbols = append(obj.Symbols, SymbolResult{Name: sym.Name, Weak: weak, Provider: export.Module})
+		s.emit(&SymbolResolvedEvent{Importer: obj.Path, Symbol: sym.Name, Provider: export.Module})
+	}
+
+	// module_layout and the like are only found in __versions
+	names := make([]string, 0, len(mod.Versions))
+	for name := range mod.Versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		export, ok := symbols.Lookup(name)
+		if !ok || !export.HasCRC || export.CRC == mod.Versions[name] {
+			continue
+		}
+		s.addFailure(obj, &ModversionMismatchError{
+			Symbol:   name,
+			Importer: obj.Path,
+			Provider: export.Module,
+			CRC:      mod.Versions[name],
+			Expected: export.CRC,
+		})
+	}
+	return result
+}
@@ -0,0 +1,301 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSection is a section of the test objects
+type testSection struct {
+	name    string
+	typ     elf.SectionType
+	data    []byte
+	link    uint32
+	entsize uint64
+	offset  uint64 // Replaces the real offset when set
+}
+
+// testSymbol is an entry of the test symbol tables
+type testSymbol struct {
+	name    string
+	bind    elf.SymBind
+	section elf.SectionIndex
+	value   uint64
+}
+
+// elf64 returns a little endian 64-bit x86 object of the type, holding the
+// sections after the null one and followed by .shstrtab
+func elf64(typ elf.Type, sections []testSection) []byte {
+	le := binary.LittleEndian
+	shstrtab := []byte{0}
+	names := make([]uint32, len(sections)+1)
+	for i, sect := range append(sections, testSection{name: ".shstrtab"}) {
+		names[i] = uint32(len(shstrtab))
+		shstrtab = append(append(shstrtab, sect.name...), 0)
+	}
+	sections = append(sections, testSection{name: ".shstrtab", typ: elf.SHT_STRTAB, data: shstrtab})
+
+	data := make([]byte, 64)
+	copy(data, elf.ELFMAG)
+	data[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	data[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	data[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	le.PutUint16(data[16:], uint16(typ))
+	le.PutUint16(data[18:], uint16(elf.EM_X86_64))
+	le.PutUint32(data[20:], uint32(elf.EV_CURRENT))
+	le.PutUint16(data[52:], 64)
+	le.PutUint16(data[58:], 64)
+	le.PutUint16(data[60:], uint16(len(sections)+1))
+	le.PutUint16(data[62:], uint16(len(sections)))
+
+	offsets := make([]uint64, len(sections))
+	for i, sect := range sections {
+		offsets[i] = pick64(sect.offset, uint64(len(data)))
+		data = append(data, sect.data...)
+	}
+	le.PutUint64(data[40:], uint64(len(data)))
+	data = append(data, make([]byte, 64)...) // The null section
+	for i, sect := range sections {
+		hdr := make([]byte, 64)
+		le.PutUint32(hdr, names[i])
+		le.PutUint32(hdr[4:], uint32(sect.typ))
+		le.PutUint64(hdr[24:], offsets[i])
+		le.PutUint64(hdr[32:], uint64(len(sect.data)))
+		le.PutUint32(hdr[40:], sect.link)
+		le.PutUint64(hdr[56:], sect.entsize)
+		data = append(data, hdr...)
+	}
+	return data
+}
+
+// pick64 returns override if set, otherwise value
+func pick64(override, value uint64) uint64 {
+	if override != 0 {
+		return override
+	}
+	return value
+}
+
+// symbolSections returns .strtab and .symtab sections holding the symbols,
+// for placing at index strtab and the one after it
+func symbolSections(strtab uint32, syms []testSymbol) []testSection {
+	le := binary.LittleEndian
+	strs := []byte{0}
+	table := make([]byte, 24) // The null symbol
+	for _, sym := range syms {
+		entry := make([]byte, 24)
+		le.PutUint32(entry, uint32(len(strs)))
+		entry[4] = byte(sym.bind<<4 | elf.SymBind(elf.STT_NOTYPE))
+		le.PutUint16(entry[6:], uint16(sym.section))
+		le.PutUint64(entry[8:], sym.value)
+		table = append(table, entry...)
+		strs = append(append(strs, sym.name...), 0)
+	}
+	return []testSection{
+		{name: ".strtab", typ: elf.SHT_STRTAB, data: strs},
+		{name: ".symtab", typ: elf.SHT_SYMTAB, data: table, link: strtab, entsize: 24},
+	}
+}
+
+// modversions returns __versions entries of the CRCs of each name
+func modversions(entries ...interface{}) []byte {
+	var data []byte
+	for i := 0; i < len(entries); i += 2 {
+		entry := make([]byte, 64)
+		binary.LittleEndian.PutUint64(entry, uint64(entries[i+1].(uint32)))
+		copy(entry[8:], entries[i].(string))
+		data = append(data, entry...)
+	}
+	return data
+}
+
+// u32s returns the values as little endian words
+func u32s(values ...uint32) []byte {
+	var data []byte
+	for _, v := range values {
+		data = binary.LittleEndian.AppendUint32(data, v)
+	}
+	return data
+}
+
+// testModule returns a module exporting three symbols, with a CRC in
+// __kcrctab, an absolute CRC and one out of bounds, and importing two
+// with recorded CRCs in __versions and the extended tables
+func testModule(versions []byte) []byte {
+	// Sections are numbered from 1, after the null one
+	const kcrctab = 1
+	sections := []testSection{
+		{name: "__kcrctab", typ: elf.SHT_PROGBITS, data: u32s(0xaaaa0001)},
+		{name: "__versions", typ: elf.SHT_PROGBITS, data: versions},
+		{name: ".modinfo", typ: elf.SHT_PROGBITS, data: []byte("license=GPL\x00name=realname\x00")},
+		{name: "__version_ext_names", typ: elf.SHT_PROGBITS, data: []byte("a_long_symbol\x00another\x00unpaired\x00\x00\x00")},
+		{name: "__version_ext_crcs", typ: elf.SHT_PROGBITS, data: u32s(0xbbbb0001, 0xbbbb0002)},
+	}
+	return elf64(elf.ET_REL, append(sections, symbolSections(uint32(len(sections)+1), []testSymbol{
+		{name: "__ksymtab_foo", bind: elf.STB_GLOBAL, section: kcrctab},
+		{name: "__crc_foo", bind: elf.STB_GLOBAL, section: kcrctab},
+		{name: "__ksymtab_bar", bind: elf.STB_GLOBAL, section: kcrctab},
+		{name: "__crc_bar", bind: elf.STB_GLOBAL, section: elf.SHN_ABS, value: 0xcccc0001},
+		{name: "__ksymtab_oob", bind: elf.STB_GLOBAL, section: kcrctab},
+		{name: "__crc_oob", bind: elf.STB_GLOBAL, section: kcrctab, value: 1 << 40},
+		{name: "__ksymtab_nocrc", bind: elf.STB_GLOBAL, section: kcrctab},
+		{name: "printk", bind: elf.STB_GLOBAL, section: elf.SHN_UNDEF},
+		{name: "maybe", bind: elf.STB_WEAK, section: elf.SHN_UNDEF},
+		{name: "local_helper", bind: elf.STB_LOCAL, section: kcrctab},
+	})...))
+}
+
+func TestParseKernelModule(t *testing.T) {
+	// The last entry is short, so it's ignored
+	versions := append(modversions("module_layout", uint32(0xdddd0001), "printk", uint32(0xdddd0002)), make([]byte, 10)...)
+	mod, err := parseKernelModule("/lib/modules/6.1/foo.ko", testModule(versions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mod.Name != "realname" || mod.Machine != elf.EM_X86_64 || mod.Class != elf.ELFCLASS64 {
+		t.Errorf("got name %s, machine %v, class %v", mod.Name, mod.Machine, mod.Class)
+	}
+	wantExports := []KernelSymbol{
+		{Name: "foo", Module: "realname", CRC: 0xaaaa0001, HasCRC: true},
+		{Name: "bar", Module: "realname", CRC: 0xcccc0001, HasCRC: true},
+		{Name: "oob", Module: "realname"},
+		{Name: "nocrc", Module: "realname"},
+	}
+	if !reflect.DeepEqual(mod.Exports, wantExports) {
+		t.Errorf("got exports %v, want %v", mod.Exports, wantExports)
+	}
+	var undefined []string
+	for _, sym := range mod.Undefined {
+		undefined = append(undefined, sym.Name)
+	}
+	if want := []string{"printk", "maybe"}; !reflect.DeepEqual(undefined, want) {
+		t.Errorf("got undefined %v, want %v", undefined, want)
+	}
+	wantVersions := map[string]uint32{
+		"module_layout": 0xdddd0001,
+		"printk":        0xdddd0002,
+		"a_long_symbol": 0xbbbb0001,
+		"another":       0xbbbb0002,
+	}
+	if !reflect.DeepEqual(mod.Versions, wantVersions) {
+		t.Errorf("got versions %v, want %v", mod.Versions, wantVersions)
+	}
+
+	// vmlinux is the kernel whatever it's named
+	image, err := parseKernelModule("/boot/vmlinux-6.1", elf64(elf.ET_EXEC, symbolSections(1, []testSymbol{
+		{name: "__ksymtab_printk", bind: elf.STB_GLOBAL, section: elf.SHN_ABS},
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.Name != KernelImage || len(image.Exports) != 1 || image.Exports[0].Module != KernelImage {
+		t.Errorf("got kernel %s exporting %v", image.Name, image.Exports)
+	}
+}
+
+func TestParseKernelModuleInvalid(t *testing.T) {
+	valid := testModule(nil)
+	pastEnd := elf64(elf.ET_REL, []testSection{
+		{name: "__versions", typ: elf.SHT_PROGBITS, data: make([]byte, 64), offset: 1 << 20},
+	})
+	tests := []struct {
+		name      string
+		data      []byte
+		err       string
+		malformed bool
+	}{
+		{"empty", nil, "failed to read foo.ko: cannot read ELF identifier 'EOF' in record at byte 0x0", true},
+		{"truncated header", valid[:40], "failed to read foo.ko: truncated ELF file", true},
+		{"truncated sections", valid[:len(valid)-10], "failed to read foo.ko: truncated ELF file", true},
+		{"shared library", elf64(elf.ET_DYN, nil), "foo.ko is not a kernel module", false},
+		{"versions past the end", pastEnd, "failed to read versions of foo.ko: failed to read section __versions: EOF", true},
+	}
+	for _, test := range tests {
+		_, err := parseKernelModule("foo.ko", test.data)
+		var bad *malformedError
+		if err == nil || err.Error() != test.err || errors.As(err, &bad) != test.malformed {
+			t.Errorf("%s: got %v, want %s", test.name, err, test.err)
+		}
+	}
+}
+
+func TestLoadSymvers(t *testing.T) {
+	symvers := strings.Join([]string{
+		"0x12345678\tprintk\tvmlinux\tEXPORT_SYMBOL\t",
+		"0x00000000\tfoo_register\tdrivers/foo/foo\tEXPORT_SYMBOL_GPL\tFOO",
+		"",
+		"0x9abcdef0\tbar\tbuild/vmlinux\tEXPORT_SYMBOL",
+		// The first export of a name wins
+		"0x11111111\tprintk\tdrivers/other\tEXPORT_SYMBOL",
+	}, "\n")
+	want := map[string]KernelSymbol{
+		"printk":       {Name: "printk", Module: KernelImage, CRC: 0x12345678, HasCRC: true},
+		"foo_register": {Name: "foo_register", Module: "foo"},
+		"bar":          {Name: "bar", Module: KernelImage, CRC: 0x9abcdef0, HasCRC: true},
+	}
+	for name, data := range map[string][]byte{"plain": []byte(symvers), "gzip": gzipped([]byte(symvers))} {
+		k := NewKernelSymbols()
+		if err := k.Load(testFile(t, "Module.symvers", data)); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(k.symbols, want) {
+			t.Errorf("%s: got %v, want %v", name, k.symbols, want)
+		}
+	}
+
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"too few fields", "0x1\tprintk", ":1: expected at least 3 fields"},
+		{"invalid CRC", "0x1\tprintk\tvmlinux\n0xzz\tfoo\tvmlinux", ":2: invalid CRC: 0xzz"},
+		{"CRC too large", "0x100000000\tprintk\tvmlinux", ":1: invalid CRC: 0x100000000"},
+		{"negative CRC", "-1\tprintk\tvmlinux", ":1: invalid CRC: -1"},
+		{"line too long", "0x1\t" + strings.Repeat("x", 1<<17) + "\tvmlinux", "bufio.Scanner: token too long"},
+	}
+	for _, test := range tests {
+		err := NewKernelSymbols().Load(testFile(t, "Module.symvers", []byte(test.data)))
+		if err == nil || !strings.HasSuffix(err.Error(), test.err) {
+			t.Errorf("%s: got %v, want %s", test.name, err, test.err)
+		}
+	}
+}
+
+func TestModuleName(t *testing.T) {
+	for path, want := range map[string]string{
+		"/lib/modules/6.1/kernel/fs/ext4/ext4.ko":    "ext4",
+		"/lib/modules/6.1/kernel/fs/ext4/ext4.ko.xz": "ext4",
+		"/lib/modules/6.1/kernel/net/foo.ko.zst":     "foo",
+		"drivers/foo/foo":                            "foo",
+		"/lib/modules/6.1/kernel/drivers/bar.ko.gz":  "bar",
+	} {
+		if got := moduleName(path); got != want {
+			t.Errorf("%s: got %s, want %s", path, got, want)
+		}
+	}
+	if !IsKernelModule("foo.ko.xz") || IsKernelModule("foo.so") {
+		t.Errorf("IsKernelModule disagrees on the suffixes")
+	}
+}
@@ -0,0 +1,252 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	// LdCachePath is where glibc's ldconfig stores the library cache
+	LdCachePath = "/etc/ld.so.cache"
+
+	ldCacheMagicOld = "ld.so-1.7.0"
+	ldCacheMagicNew = "glibc-ld.so.cache1.1"
+
+	// Fixed size of file headers and entries in each format
+	ldCacheHeaderOld = 16
+	ldCacheEntryOld  = 12
+	ldCacheHeaderNew = 48
+	ldCacheEntryNew  = 24
+)
+
+// Flags used by ldconfig to tag each cache entry with its ABI
+const (
+	ldCacheFlagTypeMask     = 0x00ff
+	ldCacheFlagELFLibc6     = 0x0003
+	ldCacheFlagRequiredMask = 0xff00
+
+	ldCacheFlagSparcLib64   = 0x0100
+	ldCacheFlagX8664Lib64   = 0x0300
+	ldCacheFlagS390Lib64    = 0x0400
+	ldCacheFlagPowerPCLib64 = 0x0500
+	ldCacheFlagX8664LibX32  = 0x0800
+	ldCacheFlagAArch64Lib64 = 0x0a00
+)
+
+// ErrInvalidLdCache is returned when the file isn't in a known ld.so.cache format
+var ErrInvalidLdCache = errors.New("invalid ld.so.cache file")
+
+// ldCacheEntry is a single library mapping within the cache
+type ldCacheEntry struct {
+	flags int32
+	path  string
+}
+
+// LdCache is a parsed representation of the glibc ld.so.cache, allowing
+// libraries to be located without searching every configured directory.
+type LdCache struct {
+	entries map[string][]ldCacheEntry
+}
+
+// ParseLdCache will parse the ld.so.cache file at the given path. Both the
+// new glibc format and the legacy libc5 format are supported.
+func ParseLdCache(path string) (*LdCache, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &LdCache{
+		entries: make(map[string][]ldCacheEntry),
+	}
+
+	if bytes.HasPrefix(data, []byte(ldCacheMagicNew)) {
+		return cache, cache.parseNew(data)
+	}
+
+	if !bytes.HasPrefix(data, []byte(ldCacheMagicOld)) || len(data) < ldCacheHeaderOld {
+		return nil, ErrInvalidLdCache
+	}
+
+	// Compat caches place the new format after the old entries
+	nlibs, ok := cacheEntries(data, binary.LittleEndian.Uint32(data[12:]), ldCacheHeaderOld, ldCacheEntryOld)
+	if !ok {
+		return nil, ErrInvalidLdCache
+	}
+	offset := ldCacheHeaderOld + nlibs*ldCacheEntryOld
+	aligned := (offset + 7) &^ 7
+	if aligned < len(data) && bytes.HasPrefix(data[aligned:], []byte(ldCacheMagicNew)) {
+		return cache, cache.parseNew(data[aligned:])
+	}
+
+	return cache, cache.parseOld(data, nlibs)
+}
+
+// cacheEntries returns the number of entries as an int, if a table of that
+// many fits in the data after the header. Checked before multiplying, so
+// that a huge count can't overflow on 32-bit hosts.
+func cacheEntries(data []byte, count uint32, header, size int) (int, bool) {
+	if uint64(count) > uint64(len(data)-header)/uint64(size) {
+		return 0, false
+	}
+	return int(count), true
+}
+
+// cacheString will read the NUL terminated string at the given offset
+func cacheString(data []byte, offset uint32) (string, bool) {
+	if uint64(offset) >= uint64(len(data)) {
+		return "", false
+	}
+	end := bytes.IndexByte(data[offset:], 0)
+	if end < 0 {
+		return "", false
+	}
+	return string(data[offset : int(offset)+end]), true
+}
+
+// parseNew handles the glibc-ld.so.cache1.1 format, where string offsets are
+// relative to the start of the new header.
+func (c *LdCache) parseNew(data []byte) error {
+	if len(data) < ldCacheHeaderNew {
+		return ErrInvalidLdCache
+	}
+
+	// Flags byte records the endianness, 3 being big endian.
+	var order binary.ByteOrder = binary.LittleEndian
+	if data[28] == 3 {
+		order = binary.BigEndian
+	}
+
+	nlibs, ok := cacheEntries(data, order.Uint32(data[20:]), ldCacheHeaderNew, ldCacheEntryNew)
+	if !ok {
+		return ErrInvalidLdCache
+	}
+
+	for i := 0; i < nlibs; i++ {
+		entry := data[ldCacheHeaderNew+i*ldCacheEntryNew:]
+		key, ok := cacheString(data, order.Uint32(entry[4:]))
+		if !ok {
+			return ErrInvalidLdCache
+		}
+		value, ok := cacheString(data, order.Uint32(entry[8:]))
+		if !ok {
+			return ErrInvalidLdCache
+		}
+		c.add(key, value, int32(order.Uint32(entry)))
+	}
+	return nil
+}
+
+// parseOld handles the legacy ld.so-1.7.0 format, where string offsets are
+// relative to the end of the entry table.
+func (c *LdCache) parseOld(data []byte, nlibs int) error {
+	strtab := data[ldCacheHeaderOld+nlibs*ldCacheEntryOld:]
+	for i := 0; i < nlibs; i++ {
+		entry := data[ldCacheHeaderOld+i*ldCacheEntryOld:]
+		key, ok := cacheString(strtab, binary.LittleEndian.Uint32(entry[4:]))
+		if !ok {
+			return ErrInvalidLdCache
+		}
+		value, ok := cacheString(strtab, binary.LittleEndian.Uint32(entry[8:]))
+		if !ok {
+			return ErrInvalidLdCache
+		}
+		c.add(key, value, int32(binary.LittleEndian.Uint32(entry)))
+	}
+	return nil
+}
+
+// add will store a new soname mapping, preserving the cache order
+func (c *LdCache) add(soname, path string, flags int32) {
+	c.entries[soname] = append(c.entries[soname], ldCacheEntry{
+		flags: flags,
+		path:  path,
+	})
+}
+
+// ldCacheFlags will determine the required cache flags for libraries
+// usable by the given ABI, or -1 if we don't know which flags ldconfig
+// would use.
+func ldCacheFlags(arch Arch) int32 {
+	is64 := arch.Is64()
+	switch arch.Machine {
+	case elf.EM_386:
+		return ldCacheFlagELFLibc6
+	case elf.EM_X86_64:
+		if is64 {
+			return ldCacheFlagELFLibc6 | ldCacheFlagX8664Lib64
+		}
+		return ldCacheFlagELFLibc6 | ldCacheFlagX8664LibX32
+	case elf.EM_AARCH64:
+		return ldCacheFlagELFLibc6 | ldCacheFlagAArch64Lib64
+	case elf.EM_PPC64:
+		return ldCacheFlagELFLibc6 | ldCacheFlagPowerPCLib64
+	case elf.EM_S390:
+		if is64 {
+			return ldCacheFlagELFLibc6 | ldCacheFlagS390Lib64
+		}
+		return ldCacheFlagELFLibc6
+	case elf.EM_SPARCV9:
+		return ldCacheFlagELFLibc6 | ldCacheFlagSparcLib64
+	default:
+		return -1
+	}
+}
+
+// Lookup returns any paths the cache holds for the soname which are usable
+// by the given ABI, in the order ld.so would try them.
+func (c *LdCache) Lookup(soname string, arch Arch) []string {
+	var ret []string
+	want := ldCacheFlags(arch)
+
+	for _, entry := range c.entries[soname] {
+		if entry.flags&ldCacheFlagTypeMask != ldCacheFlagELFLibc6 {
+			continue
+		}
+		// Unknown machine, let the ELF checks reject the candidates
+		if want >= 0 && entry.flags&(ldCacheFlagTypeMask|ldCacheFlagRequiredMask) != want {
+			continue
+		}
+		ret = append(ret, entry.path)
+	}
+	return ret
+}
+
+// ldCacheStale determines whether the cache was generated before the last change
+// to the given ld.so.conf, in which case it can't be trusted.
+func ldCacheStale(cachePath, configPath string) bool {
+	cst, err := os.Stat(cachePath)
+	if err != nil {
+		return true
+	}
+	for _, p := range []string{configPath, configPath + ".d"} {
+		st, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		if st.ModTime().After(cst.ModTime()) {
+			return true
+		}
+	}
+	return false
+}
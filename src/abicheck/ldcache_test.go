@@ -0,0 +1,198 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testCacheEntry is a library mapping for the test caches
+type testCacheEntry struct {
+	flags       int32
+	soname      string
+	path        string
+	keyOffset   int // Replaces the real offsets when set
+	valueOffset int
+}
+
+var (
+	x8664  = Arch{Machine: elf.EM_X86_64, Class: elf.ELFCLASS64}
+	i386   = Arch{Machine: elf.EM_386, Class: elf.ELFCLASS32}
+	x86x32 = Arch{Machine: elf.EM_X86_64, Class: elf.ELFCLASS32}
+)
+
+// testCacheEntries are libc6 entries for 64-bit x86, x32 and i386
+var testCacheEntries = []testCacheEntry{
+	{flags: ldCacheFlagELFLibc6 | ldCacheFlagX8664Lib64, soname: "libc.so.6", path: "/lib64/libc.so.6"},
+	{flags: ldCacheFlagELFLibc6 | ldCacheFlagX8664LibX32, soname: "libc.so.6", path: "/libx32/libc.so.6"},
+	{flags: ldCacheFlagELFLibc6, soname: "libc.so.6", path: "/lib32/libc.so.6"},
+	{flags: 0x0000, soname: "libc.so.5", path: "/lib/libc.so.5"}, // libc5
+}
+
+// ldCacheNew returns a glibc-ld.so.cache1.1 file holding the entries, with
+// string offsets from the start of the file
+func ldCacheNew(order binary.ByteOrder, entries []testCacheEntry) []byte {
+	data := make([]byte, ldCacheHeaderNew+len(entries)*ldCacheEntryNew)
+	copy(data, ldCacheMagicNew)
+	order.PutUint32(data[20:], uint32(len(entries)))
+	data[28] = 2
+	if order == binary.BigEndian {
+		data[28] = 3
+	}
+	var strtab []byte
+	for i, e := range entries {
+		entry := data[ldCacheHeaderNew+i*ldCacheEntryNew:]
+		order.PutUint32(entry, uint32(e.flags))
+		order.PutUint32(entry[4:], uint32(pick(e.keyOffset, len(data)+len(strtab))))
+		strtab = append(append(strtab, e.soname...), 0)
+		order.PutUint32(entry[8:], uint32(pick(e.valueOffset, len(data)+len(strtab))))
+		strtab = append(append(strtab, e.path...), 0)
+	}
+	return append(data, strtab...)
+}
+
+// ldCacheOld returns an ld.so-1.7.0 file holding the entries, with string
+// offsets from the end of the entry table. The strings follow the hidden
+// bytes, if any.
+func ldCacheOld(entries []testCacheEntry, hidden []byte) []byte {
+	data := make([]byte, ldCacheHeaderOld+len(entries)*ldCacheEntryOld)
+	copy(data, ldCacheMagicOld)
+	binary.LittleEndian.PutUint32(data[12:], uint32(len(entries)))
+	strtab := append([]byte(nil), hidden...)
+	for i, e := range entries {
+		entry := data[ldCacheHeaderOld+i*ldCacheEntryOld:]
+		binary.LittleEndian.PutUint32(entry, uint32(e.flags))
+		binary.LittleEndian.PutUint32(entry[4:], uint32(pick(e.keyOffset, len(strtab))))
+		strtab = append(append(strtab, e.soname...), 0)
+		binary.LittleEndian.PutUint32(entry[8:], uint32(pick(e.valueOffset, len(strtab))))
+		strtab = append(append(strtab, e.path...), 0)
+	}
+	return append(data, strtab...)
+}
+
+// ldCacheCompat returns an old format cache with a new one hidden at the
+// start of its string table, aligned as ldconfig -c compat writes it
+func ldCacheCompat(old, new []testCacheEntry) []byte {
+	hidden := make([]byte, 8-(ldCacheHeaderOld+len(old)*ldCacheEntryOld)%8)
+	if len(hidden) == 8 {
+		hidden = nil
+	}
+	return ldCacheOld(old, append(hidden, ldCacheNew(binary.LittleEndian, new)...))
+}
+
+// pick returns override if set, otherwise offset
+func pick(override, offset int) int {
+	if override != 0 {
+		return override
+	}
+	return offset
+}
+
+// parseCacheData will parse the cache from a file holding data
+func parseCacheData(t *testing.T, data []byte) (*LdCache, error) {
+	path := filepath.Join(t.TempDir(), "ld.so.cache")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return ParseLdCache(path)
+}
+
+func TestParseLdCache(t *testing.T) {
+	odd := []testCacheEntry{{flags: ldCacheFlagELFLibc6, soname: "libold.so.1", path: "/old/libold.so.1"}}
+	tests := []struct {
+		name string
+		data []byte
+		want map[Arch][]string // Lookups of libc.so.6
+	}{
+		{"new little endian", ldCacheNew(binary.LittleEndian, testCacheEntries), map[Arch][]string{
+			x8664: {"/lib64/libc.so.6"}, x86x32: {"/libx32/libc.so.6"}, i386: {"/lib32/libc.so.6"},
+		}},
+		{"new big endian", ldCacheNew(binary.BigEndian, testCacheEntries), map[Arch][]string{
+			x8664: {"/lib64/libc.so.6"}, i386: {"/lib32/libc.so.6"},
+		}},
+		{"old", ldCacheOld(testCacheEntries, nil), map[Arch][]string{
+			x8664: {"/lib64/libc.so.6"}, i386: {"/lib32/libc.so.6"},
+		}},
+		// One old entry leaves the new header needing alignment
+		{"compat", ldCacheCompat(odd, testCacheEntries), map[Arch][]string{
+			x8664: {"/lib64/libc.so.6"}, i386: {"/lib32/libc.so.6"},
+		}},
+		{"empty new", ldCacheNew(binary.LittleEndian, nil), map[Arch][]string{x8664: nil}},
+		{"empty old", ldCacheOld(nil, nil), map[Arch][]string{x8664: nil}},
+	}
+	for _, test := range tests {
+		cache, err := parseCacheData(t, test.data)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		for arch, want := range test.want {
+			if got := cache.Lookup("libc.so.6", arch); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %v got %v, want %v", test.name, arch.Machine, got, want)
+			}
+		}
+		if got := cache.Lookup("libc.so.5", x8664); got != nil {
+			t.Errorf("%s: libc5 entry returned %v", test.name, got)
+		}
+	}
+
+	compat := ldCacheCompat(odd, testCacheEntries)
+	if cache, _ := parseCacheData(t, compat); cache.Lookup("libold.so.1", i386) != nil {
+		t.Errorf("compat: old entries used over the new ones")
+	}
+}
+
+func TestParseLdCacheInvalid(t *testing.T) {
+	valid := ldCacheNew(binary.LittleEndian, testCacheEntries)
+	hugeNew := ldCacheNew(binary.LittleEndian, testCacheEntries)
+	binary.LittleEndian.PutUint32(hugeNew[20:], 0xffffffff)
+	overNew := ldCacheNew(binary.LittleEndian, testCacheEntries)
+	binary.LittleEndian.PutUint32(overNew[20:], uint32(len(testCacheEntries)+1))
+	hugeOld := ldCacheOld(testCacheEntries, nil)
+	binary.LittleEndian.PutUint32(hugeOld[12:], 0xffffffff)
+	unterminated := ldCacheNew(binary.LittleEndian, testCacheEntries)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"unknown magic", []byte("not a cache at all, not at all")},
+		{"truncated new header", valid[:ldCacheHeaderNew-1]},
+		{"truncated new entries", valid[:ldCacheHeaderNew+ldCacheEntryNew+4]},
+		{"too many new entries", overNew},
+		{"huge new count", hugeNew},
+		{"new key out of range", ldCacheNew(binary.LittleEndian, []testCacheEntry{{soname: "a", path: "b", keyOffset: 1 << 20}})},
+		{"new value out of range", ldCacheNew(binary.LittleEndian, []testCacheEntry{{soname: "a", path: "b", valueOffset: -1}})},
+		{"new string unterminated", unterminated[:len(unterminated)-1]},
+		{"truncated old header", []byte(ldCacheMagicOld)},
+		{"truncated old entries", ldCacheOld(testCacheEntries, nil)[:ldCacheHeaderOld+ldCacheEntryOld]},
+		{"huge old count", hugeOld},
+		{"old key out of range", ldCacheOld([]testCacheEntry{{soname: "a", path: "b", keyOffset: 1 << 20}}, nil)},
+		{"old value out of range", ldCacheOld([]testCacheEntry{{soname: "a", path: "b", valueOffset: -1}}, nil)},
+	}
+	for _, test := range tests {
+		if _, err := parseCacheData(t, test.data); err != ErrInvalidLdCache {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrInvalidLdCache)
+		}
+	}
+}
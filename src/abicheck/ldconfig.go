@@ -0,0 +1,141 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// LdConfigPath is where glibc systems store the linker configuration
+	LdConfigPath = "/etc/ld.so.conf"
+)
+
+// ldConfigParser keeps track of the files seen while parsing ld.so.conf so
+// that recursive includes don't send us into a loop.
+type ldConfigParser struct {
+	root string
+	seen map[string]bool
+	dirs []string
+}
+
+// ParseLdConfig will parse the given ld.so.conf file, following any include
+// directives, and return the ordered set of library directories it defines.
+//
+// The path, includes and returned directories are all relative to root,
+// which should be empty (or "/") for the host system.
+func ParseLdConfig(root, path string) ([]string, error) {
+	parser := &ldConfigParser{
+		root: root,
+		seen: make(map[string]bool),
+	}
+	if err := parser.parse(path); err != nil {
+		return nil, err
+	}
+	return parser.dirs, nil
+}
+
+// include will expand the glob pattern relative to the including file and
+// parse each match in lexical order, like ldconfig does.
+func (l *ldConfigParser) include(pattern, from string) error {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(from), pattern)
+	}
+	matches, err := filepath.Glob(filepath.Join(l.root, pattern))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+	for _, match := range matches {
+		rel, err := filepath.Rel(filepath.Join("/", l.root), match)
+		if err != nil {
+			return err
+		}
+		if err := l.parse(filepath.Join("/", rel)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parse handles a single configuration file
+func (l *ldConfigParser) parse(path string) error {
+	if l.seen[path] {
+		return nil
+	}
+	l.seen[path] = true
+
+	fi, err := os.Open(filepath.Join("/", l.root, path))
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+
+	sc := bufio.NewScanner(fi)
+	for sc.Scan() {
+		line := sc.Text()
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "include":
+			for _, pattern := range fields[1:] {
+				if err := l.include(pattern, path); err != nil {
+					return err
+				}
+			}
+			continue
+		case "hwcap":
+			// Legacy hwcap lines don't define directories
+			continue
+		}
+
+		// Directories may be separated by whitespace, commas or colons,
+		// and may carry an obsolete "=type" suffix
+		for _, dir := range strings.FieldsFunc(line, isLdConfigSeparator) {
+			if idx := strings.IndexByte(dir, '='); idx >= 0 {
+				dir = dir[:idx]
+			}
+			if dir == "" {
+				continue
+			}
+			l.dirs = append(l.dirs, filepath.Clean(dir))
+		}
+	}
+	return sc.Err()
+}
+
+// isLdConfigSeparator determines if the rune separates directories in
+// an ld.so.conf line
+func isLdConfigSeparator(r rune) bool {
+	switch r {
+	case ' ', '\t', ',', ':':
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,212 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxLinkerScript is the largest file we'll consider to be a linker script.
+// Real ones are a few hundred bytes at most.
+const maxLinkerScript = 64 * 1024
+
+// maxScriptDepth stops scripts including each other from looping forever
+const maxScriptDepth = 8
+
+// LinkerScriptInput is a single file named by a GNU ld script
+type LinkerScriptInput struct {
+	Name     string // As written, which may be a -l reference
+	AsNeeded bool   // Listed within AS_NEEDED
+}
+
+// ParseLinkerScript will return the input files referenced by the GROUP and
+// INPUT commands of a GNU ld script, such as the libc.so found on most
+// glibc systems. Every other command is skipped over.
+func ParseLinkerScript(r io.Reader) ([]LinkerScriptInput, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxLinkerScript+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxLinkerScript || !isLinkerScript(data) {
+		return nil, fmt.Errorf("not a linker script")
+	}
+
+	var ret []LinkerScriptInput
+	var stack []string // The commands we're currently within
+	found := false
+
+	tokens := scriptTokens(string(data))
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case tok == "(":
+			// Bare parens belong to nobody, keep the nesting balanced
+			stack = append(stack, "")
+		case tok == ")":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unbalanced ')' in linker script")
+			}
+			stack = stack[:len(stack)-1]
+		case i+1 < len(tokens) && tokens[i+1] == "(":
+			// A command, the arguments of which we only care about
+			// for GROUP, INPUT and AS_NEEDED
+			if tok == "GROUP" || tok == "INPUT" {
+				found = true
+			}
+			stack = append(stack, tok)
+			i++
+		case inScriptInputs(stack):
+			ret = append(ret, LinkerScriptInput{
+				Name:     strings.Trim(tok, "\""),
+				AsNeeded: stack[len(stack)-1] == "AS_NEEDED",
+			})
+		}
+	}
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("unterminated command in linker script")
+	}
+	if !found {
+		return nil, fmt.Errorf("linker script has no GROUP or INPUT")
+	}
+	return ret, nil
+}
+
+// isLinkerScript makes a cheap guess at whether data is a text linker
+// script rather than an ELF object or some other binary file
+func isLinkerScript(data []byte) bool {
+	if bytes.HasPrefix(data, []byte("\x7fELF")) {
+		return false
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return false
+	}
+	return bytes.Contains(data, []byte("GROUP")) || bytes.Contains(data, []byte("INPUT"))
+}
+
+// inScriptInputs determines whether tokens at this nesting are input files
+func inScriptInputs(stack []string) bool {
+	if len(stack) == 0 {
+		return false
+	}
+	for _, cmd := range stack {
+		if cmd != "GROUP" && cmd != "INPUT" && cmd != "AS_NEEDED" {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptTokens splits a linker script into words and parentheses, dropping
+// comments and the commas ld permits between file names
+func scriptTokens(script string) []string {
+	var ret []string
+	for len(script) > 0 {
+		if strings.HasPrefix(script, "/*") {
+			end := strings.Index(script[2:], "*/")
+			if end < 0 {
+				break
+			}
+			script = script[end+4:]
+			continue
+		}
+		c := script[0]
+		switch {
+		case c == '(' || c == ')':
+			ret = append(ret, string(c))
+			script = script[1:]
+		case c == ',' || c == ';' || c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			script = script[1:]
+		case c == '"':
+			end := strings.IndexByte(script[1:], '"')
+			if end < 0 {
+				ret = append(ret, script)
+				return ret
+			}
+			ret = append(ret, script[:end+2])
+			script = script[end+2:]
+		default:
+			end := strings.IndexAny(script, "(), ;\t\n\r\"")
+			if end < 0 {
+				end = len(script)
+			}
+			if idx := strings.Index(script[:end], "/*"); idx > 0 {
+				end = idx
+			}
+			ret = append(ret, script[:end])
+			script = script[end:]
+		}
+	}
+	return ret
+}
+
+// linkerScript will return the inputs of the linker script at path, or false
+// if it isn't one. Overlay files are always ELF objects.
+func (s *SymbolStore) linkerScript(path string) ([]LinkerScriptInput, bool) {
+	if s.inOverlay(path) {
+		return nil, false
+	}
+	if s.overlay != nil {
+		_, path = s.overlay.lookup(path)
+	}
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer fi.Close()
+	inputs, err := ParseLinkerScript(fi)
+	if err != nil {
+		return nil, false
+	}
+	return inputs, true
+}
+
+// scriptPaths will find the shared objects named by the inputs of the
+// script at path, in the order given. Static archives are of no interest,
+// and names ld itself couldn't find are skipped.
+func (s *SymbolStore) scriptPaths(path string, inputs []LinkerScriptInput, arch Arch) []string {
+	var ret []string
+	for _, input := range inputs {
+		name := input.Name
+		if strings.HasPrefix(name, "-l") {
+			name = "lib" + name[2:] + ".so"
+		}
+		if strings.HasSuffix(name, ".a") {
+			continue
+		}
+		switch {
+		case filepath.IsAbs(name):
+			// ld looks for absolute names within the sysroot
+			ret = s.appendIfRegular(ret, s.rooted(name))
+			continue
+		case strings.Contains(name, "/"):
+			ret = s.appendIfRegular(ret, filepath.Join(filepath.Dir(path), name))
+			continue
+		}
+		// Plain names are tried next to the script, then searched for
+		if found := s.appendIfRegular(nil, filepath.Join(filepath.Dir(path), name)); len(found) > 0 {
+			ret = append(ret, found[0])
+		} else if found := s.locateLibraryPaths(name, arch, nil, nil, LibcGlibc); len(found) > 0 {
+			ret = append(ret, found[0])
+		}
+	}
+	return ret
+}
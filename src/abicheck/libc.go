@@ -0,0 +1,150 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+)
+
+// isLinuxLibc determines whether the libc is one of those for Linux, whose
+// processes have the Linux vDSO
+func isLinuxLibc(libc string) bool {
+	return libc == LibcGlibc || libc == LibcMusl || libc == LibcBionic
+}
+
+// The C libraries SetLibc knows, whose dynamic loaders search for libraries
+// and bind symbols differently
+const (
+	LibcAuto   = "auto"
+	LibcGlibc  = "glibc"
+	LibcMusl   = "musl"
+	LibcBionic = "bionic"
+
+	// The BSDs have their own loaders and libcs too
+	LibcFreeBSD = "freebsd"
+	LibcOpenBSD = "openbsd"
+)
+
+// SetLibc will treat every process as using the given C library, rather
+// than telling musl, Android and BSD programs apart by their interpreter,
+// and deciding on libraries scanned alone from their branding or the
+// sysroot (LibcAuto, the
+// default).
+//
+// Under musl, libraries are searched for in LD_LIBRARY_PATH, then the
+// DT_RPATH or DT_RUNPATH of the importer, then the directories listed in
+// /etc/ld-musl-$(ARCH).path or the built-in /lib:/usr/local/lib:/usr/lib.
+// There's no ld.so.cache, ld.so.preload or glibc-hwcaps, and symbol
+// versions are ignored entirely, references binding to the default
+// definition of the name.
+//
+// Android's linker (bionic) only has LD_LIBRARY_PATH and DT_RUNPATH, DT_RPATH
+// being ignored, before the system, odm and vendor library directories and
+// those of each APEX module. A library checked on its own is taken to be
+// one of an app's native libraries, which are found in the same directory.
+//
+// FreeBSD and OpenBSD search the directories in their ld-elf.so.hints or
+// ld.so.hints, written by ldconfig, and then /lib:/usr/lib or /usr/lib.
+// OpenBSD libraries are named with a major and minor version, and any
+// library with the same major and at least the minor version is used.
+// Libraries branded for another operating system by their OSABI are
+// always skipped, whatever the libc.
+func (s *SymbolStore) SetLibc(libc string) error {
+	switch libc {
+	case "", LibcAuto:
+		libc = ""
+	case LibcGlibc, LibcMusl, LibcBionic, LibcFreeBSD, LibcOpenBSD:
+	default:
+		return fmt.Errorf("unknown libc: %s", libc)
+	}
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.libc = libc
+	return nil
+}
+
+// loadLibcConfig will load the configuration of the loaders besides glibc's
+// from the sysroot, and work out which libc the sysroot itself uses
+func (s *SymbolStore) loadLibcConfig() error {
+	s.systemLibc = LibcGlibc
+	musl, err := s.loadMuslConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load musl configuration: %v", err)
+	}
+	if musl {
+		s.systemLibc = LibcMusl
+	}
+	if err := s.loadBionicConfig(); err != nil {
+		return fmt.Errorf("failed to load Android configuration: %v", err)
+	}
+	for _, linker := range bionicLinkers {
+		if _, err := os.Stat(s.rooted(linker)); err == nil {
+			s.systemLibc = LibcBionic
+			break
+		}
+	}
+	bsd, err := s.loadBSDConfig()
+	if err != nil {
+		return err
+	}
+	if bsd != "" {
+		s.systemLibc = bsd
+	}
+	return nil
+}
+
+// libcOf determines the libc of the process started from the target.
+// Programs say so with their interpreter, whereas libraries are taken to be
+// for the libc of the sysroot unless branded for FreeBSD.
+func (s *SymbolStore) libcOf(target *Library) string {
+	switch {
+	case s.libc != "":
+		return s.libc
+	case isMuslInterp(target.interp):
+		return LibcMusl
+	case isBionicInterp(target.interp):
+		return LibcBionic
+	case isFreeBSDInterp(target.interp), target.arch.OSABI == elf.ELFOSABI_FREEBSD:
+		return LibcFreeBSD
+	case target.interp == openbsdLinker:
+		return LibcOpenBSD
+	case target.interp != "":
+		return LibcGlibc
+	default:
+		return s.systemLibc
+	}
+}
+
+// libcSearchPaths returns the directories searched in order by the loader of
+// the libc for the libraries an object needs, or nil for glibc, which is
+// handled by searchPaths itself
+func (s *SymbolStore) libcSearchPaths(libc string, arch Arch, rpaths, runpaths []string) []string {
+	switch libc {
+	case LibcMusl:
+		return s.muslSearchPaths(arch, rpaths, runpaths)
+	case LibcBionic:
+		return s.bionicSearchPaths(arch, runpaths)
+	case LibcFreeBSD:
+		return s.freebsdSearchPaths(arch, rpaths, runpaths)
+	case LibcOpenBSD:
+		return s.openbsdSearchPaths(rpaths, runpaths)
+	default:
+		return nil
+	}
+}
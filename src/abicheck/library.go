@@ -0,0 +1,182 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"sync"
+)
+
+// Library is a loaded object which provides symbols within the process space
+type Library struct {
+	Name   string // DT_SONAME, or the file name when there isn't one
+	Path   string // Where the library was loaded from
+	Soname string // DT_SONAME of the library, if it has one
+
+	// Details needed to place the library within a process scope, all
+	// of which are set before ready is closed.
+	arch      Arch
+	needed    []string // DT_NEEDED entries, in order
+	filters   []string // DT_FILTER entries, whose definitions take precedence
+	auxiliary []string // DT_AUXILIARY entries, used only when present
+	rpaths    []string // Own DT_RPATH, empty when DT_RUNPATH is present
+	runpaths  []string
+	interp    string // PT_INTERP, for executables
+	shared    bool   // Shared library rather than an executable
+	tables    *SymbolTables
+	features  *CPUFeatures // Nil when not read from the object itself
+	textrel   bool         // Needs its text relocated, see TextRelWarning
+	indexed   bool         // From a symbol database, without symbol sizes
+	err       error        // Set when the library failed to load
+
+	// reported is set once a scan has claimed the library's result, and
+	// is protected by the store's lock
+	reported bool
+
+	// ready is closed once the exports have been fully populated, so
+	// that concurrent scans can safely bind against the library.
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	// versions is the set of version names the library defines (verdef)
+	versions map[string]bool
+
+	// symbols maps a symbol name to each version it is defined with.
+	// Nearly every symbol has just the one, so a slice is far smaller
+	// than another map.
+	symbols map[string][]definedVersion
+
+	// load reads the tables, versions and symbols the first time any are
+	// needed, when the library was loaded lazily (see SetLazy)
+	load     func()
+	loadOnce sync.Once
+}
+
+// definedVersion is a version a symbol is defined with. visible is true
+// when that version is seen by unversioned lookups, i.e. it is the default
+// version (sym@@VER) or unversioned.
+type definedVersion struct {
+	version string
+	visible bool
+	kind    symKind // Unknown for libraries from a database
+}
+
+// NewLibrary will return a new, empty, Library
+func NewLibrary(name, path string) *Library {
+	return &Library{
+		Name:     name,
+		Path:     path,
+		ready:    make(chan struct{}),
+		versions: make(map[string]bool),
+		symbols:  make(map[string][]definedVersion),
+	}
+}
+
+// markReady signals that the library exports are complete
+func (l *Library) markReady() {
+	l.readyOnce.Do(func() {
+		close(l.ready)
+	})
+}
+
+// wait blocks until the library exports are complete
+func (l *Library) wait() {
+	<-l.ready
+}
+
+// loadTables will read the symbol tables of a lazily loaded library, unless
+// that has already been done
+func (l *Library) loadTables() {
+	if l.load != nil {
+		l.loadOnce.Do(l.load)
+	}
+}
+
+// loadedTables returns the symbol tables of the library, reading them first
+// if it was loaded lazily
+func (l *Library) loadedTables() *SymbolTables {
+	l.loadTables()
+	return l.tables
+}
+
+// AddVersion records that the library defines the named version
+func (l *Library) AddVersion(version string) {
+	l.versions[version] = true
+}
+
+// HasVersion determines whether the library defines the named version
+func (l *Library) HasVersion(version string) bool {
+	l.loadTables()
+	return l.versions[version]
+}
+
+// Versioned determines whether the library uses symbol versioning at all
+func (l *Library) Versioned() bool {
+	l.loadTables()
+	return len(l.versions) > 0
+}
+
+// AddSymbol will store the symbol as being provided by this library. An
+// empty version means the symbol is unversioned. Hidden symbols (sym@VER)
+// can only be bound by an exact versioned reference.
+func (l *Library) AddSymbol(name, version string, hidden bool) {
+	l.addSymbol(name, version, hidden, kindUnknown)
+}
+
+// addSymbol is AddSymbol, also recording what kind of symbol it is
+func (l *Library) addSymbol(name, version string, hidden bool, kind symKind) {
+	versions := l.symbols[name]
+	for i := range versions {
+		if versions[i].version == version {
+			versions[i].visible = versions[i].visible || !hidden
+			return
+		}
+	}
+	l.symbols[name] = append(versions, definedVersion{version, !hidden, kind})
+}
+
+// Provides determines whether a reference to the symbol, with the given
+// version requirement, can be satisfied by this library.
+func (l *Library) Provides(name, version string) bool {
+	l.loadTables()
+	versions, ok := l.symbols[name]
+	if !ok {
+		return false
+	}
+
+	// Unversioned references bind to the default definition
+	if version == "" {
+		for _, v := range versions {
+			if v.visible {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Libraries without version definitions satisfy any versioned
+	// reference, ld.so only warns about the missing information.
+	if !l.Versioned() {
+		return true
+	}
+
+	for _, v := range versions {
+		if v.version == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel is how much of a scan's progress is worth logging
+type LogLevel int
+
+// Log levels in increasing verbosity, so a Logger writes every event at or
+// below its own level
+const (
+	LogError LogLevel = iota
+	LogWarn
+	LogInfo
+	LogDebug
+	LogTrace
+)
+
+// logLevelNames are the names of each level, as used on the command line
+var logLevelNames = []string{"error", "warn", "info", "debug", "trace"}
+
+// String returns the name of the level
+func (l LogLevel) String() string {
+	if l < LogError || l > LogTrace {
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+	return logLevelNames[l]
+}
+
+// ParseLogLevel returns the named level
+func ParseLogLevel(name string) (LogLevel, error) {
+	for i, n := range logLevelNames {
+		if n == name {
+			return LogLevel(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level: %s", name)
+}
+
+// EventLevel returns the level an event is logged at. Every symbol bound or
+// exported is a trace, each library located is debug and each target
+// checked is info. Events it doesn't know of are info.
+func EventLevel(ev Event) LogLevel {
+	switch ev.(type) {
+	case *ErrorEvent:
+		return LogError
+	case *SymbolExportedEvent, *SymbolResolvedEvent:
+		return LogTrace
+	case *LibraryFoundEvent, *LibraryReusedEvent, *LinkerScriptEvent, *DebugInfoEvent,
+		*MissingAuxiliaryEvent, *WeakUnresolvedEvent:
+		return LogDebug
+	}
+	return LogInfo
+}
+
+// Logger writes the events of a scan up to its level, either as lines of
+// text or as one JSON object per line for log aggregation. Issues are left
+// out like they are for reporters, as the report covers them. It's safe to
+// use from many goroutines at once.
+type Logger struct {
+	w     io.Writer
+	level LogLevel
+	json  bool
+	mu    sync.Mutex
+}
+
+// logEntry is the JSON form of a logged event
+type logEntry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Event   string    `json:"event"` // i.e. LibraryFound for *LibraryFoundEvent
+	Message string    `json:"message"`
+}
+
+// NewLogger returns a Logger writing events up to level to w, as JSON when
+// asJSON is set
+func NewLogger(w io.Writer, level LogLevel, asJSON bool) *Logger {
+	return &Logger{w: w, level: level, json: asJSON}
+}
+
+// Event logs the event, if it's within the level
+func (l *Logger) Event(ev Event) {
+	if _, ok := ev.(Classified); ok {
+		return
+	}
+	level := EventLevel(ev)
+	if level > l.level {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.json {
+		fmt.Fprintln(l.w, ev)
+		return
+	}
+	name := fmt.Sprintf("%T", ev)
+	name = strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "Event")
+	json.NewEncoder(l.w).Encode(&logEntry{
+		Time:    time.Now().UTC(),
+		Level:   level.String(),
+		Event:   name,
+		Message: ev.String(),
+	})
+}
@@ -0,0 +1,164 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// MarkdownReporter writes a compact table with a row per target, meant to
+// be posted as a pull or merge request comment by release automation
+type MarkdownReporter struct {
+	progress
+	out    io.Writer
+	policy Policy
+}
+
+// NewMarkdownReporter returns a MarkdownReporter writing the table to out,
+// and progress to the progress writer, which may be nil
+func NewMarkdownReporter(out, progressOut io.Writer, policy Policy) *MarkdownReporter {
+	return &MarkdownReporter{
+		progress: progress{w: progressOut},
+		out:      out,
+		policy:   policy,
+	}
+}
+
+// markdownRow is the summary of a single target
+type markdownRow struct {
+	path       string
+	missing    []string
+	unresolved int
+	glibc      string
+	severity   Severity
+	errors     int // Issues counted at each severity
+	warnings   int
+}
+
+// summarise builds the row for the result, counting only the issues the
+// policy doesn't ignore
+func (m *MarkdownReporter) summarise(result *Result) markdownRow {
+	row := markdownRow{path: result.Path, severity: SeverityIgnore}
+	seen := make(map[string]bool)
+	for _, obj := range result.Objects {
+		if obj.Target {
+			row.glibc = newestVersion(obj.Symbols, "GLIBC")
+		}
+		for _, issue := range obj.Issues() {
+			severity := m.policy.Severity(issue.Class)
+			if severity == SeverityIgnore {
+				continue
+			}
+			if severity > row.severity {
+				row.severity = severity
+			}
+			if severity == SeverityError {
+				row.errors++
+			} else {
+				row.warnings++
+			}
+			switch err := issue.Err.(type) {
+			case *UnresolvedSymbolError:
+				row.unresolved++
+			case *MissingLibraryError:
+				if !seen[err.Library] {
+					seen[err.Library] = true
+					row.missing = append(row.missing, err.Library)
+				}
+			}
+		}
+	}
+	sort.Strings(row.missing)
+	return row
+}
+
+// newestVersion returns the newest version of the namespace any of the
+// symbols was bound with, if any
+func newestVersion(symbols []SymbolResult, namespace string) string {
+	var newest string
+	var newestParts []int
+	for _, sym := range symbols {
+		ns, parts, ok := SplitVersion(sym.Version)
+		if !ok || ns != namespace {
+			continue
+		}
+		if newest == "" || compareVersionParts(parts, newestParts) > 0 {
+			newest, newestParts = sym.Version, parts
+		}
+	}
+	return newest
+}
+
+// markdownCode quotes s as inline code within a table cell
+func markdownCode(s string) string {
+	return "`" + strings.ReplaceAll(s, "|", "\\|") + "`"
+}
+
+// Complete writes the table, followed by a line of totals
+func (m *MarkdownReporter) Complete(results []*Result) error {
+	fmt.Fprintln(m.out, "| Binary | Missing libraries | Unresolved symbols | Max glibc | Status |")
+	fmt.Fprintln(m.out, "|---|---|---:|---|---|")
+	errs, warnings, failed := 0, 0, 0
+	for _, result := range results {
+		row := m.summarise(result)
+		errs += row.errors
+		warnings += row.warnings
+		missing := "-"
+		if len(row.missing) > 0 {
+			quoted := make([]string, len(row.missing))
+			for i, lib := range row.missing {
+				quoted[i] = markdownCode(lib)
+			}
+			missing = strings.Join(quoted, ", ")
+		}
+		glibc := "-"
+		if row.glibc != "" {
+			glibc = strings.TrimPrefix(row.glibc, "GLIBC_")
+		}
+		status := "✅ ok"
+		switch row.severity {
+		case SeverityError:
+			status = "❌ error"
+			failed++
+		case SeverityWarn:
+			status = "⚠️ warning"
+			failed++
+		}
+		fmt.Fprintf(m.out, "| %s | %s | %d | %s | %s |\n", markdownCode(row.path), missing, row.unresolved, glibc, status)
+	}
+	fmt.Fprintln(m.out)
+	switch {
+	case errs > 0:
+		fmt.Fprintf(m.out, "%d error(s) and %d warning(s) in %d of %s\n", errs, warnings, failed, binaries(len(results)))
+	case warnings > 0:
+		fmt.Fprintf(m.out, "%d warning(s) in %d of %s\n", warnings, failed, binaries(len(results)))
+	default:
+		fmt.Fprintf(m.out, "%s checked, no issues\n", binaries(len(results)))
+	}
+	return nil
+}
+
+// binaries counts n targets for the totals line
+func binaries(n int) string {
+	if n == 1 {
+		return "1 binary"
+	}
+	return fmt.Sprintf("%d binaries", n)
+}
@@ -0,0 +1,167 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"path/filepath"
+	"strings"
+)
+
+// ARM and MIPS e_flags used to select the right multiarch tuple
+const (
+	efARMABIFloatSoft = 0x00000200
+	efARMABIFloatHard = 0x00000400
+	efMIPSABI2        = 0x00000020
+)
+
+// MultiarchTriplets returns the Debian style multiarch tuples that libraries
+// for the given ABI may be installed under, most likely first. An empty
+// slice is returned for unknown architectures.
+func MultiarchTriplets(arch Arch) []string {
+	switch arch.Machine {
+	case elf.EM_X86_64:
+		if arch.Is64() {
+			return []string{"x86_64-linux-gnu"}
+		}
+		return []string{"x86_64-linux-gnux32"}
+	case elf.EM_386:
+		return []string{"i386-linux-gnu", "i686-linux-gnu"}
+	case elf.EM_AARCH64:
+		if arch.LittleEndian() {
+			return []string{"aarch64-linux-gnu"}
+		}
+		return []string{"aarch64_be-linux-gnu"}
+	case elf.EM_ARM:
+		switch {
+		case arch.Flags&efARMABIFloatHard != 0:
+			return []string{"arm-linux-gnueabihf"}
+		case arch.Flags&efARMABIFloatSoft != 0:
+			return []string{"arm-linux-gnueabi"}
+		default:
+			return []string{"arm-linux-gnueabihf", "arm-linux-gnueabi"}
+		}
+	case elf.EM_RISCV:
+		if arch.Is64() {
+			return []string{"riscv64-linux-gnu"}
+		}
+		return []string{"riscv32-linux-gnu"}
+	case elf.EM_PPC64:
+		if arch.LittleEndian() {
+			return []string{"powerpc64le-linux-gnu"}
+		}
+		return []string{"powerpc64-linux-gnu"}
+	case elf.EM_PPC:
+		return []string{"powerpc-linux-gnu"}
+	case elf.EM_S390:
+		if arch.Is64() {
+			return []string{"s390x-linux-gnu"}
+		}
+		return []string{"s390-linux-gnu"}
+	case elf.EM_MIPS:
+		prefix := "mips"
+		if arch.Is64() {
+			prefix = "mips64"
+		}
+		if arch.LittleEndian() {
+			prefix += "el"
+		}
+		switch {
+		case arch.Is64():
+			return []string{prefix + "-linux-gnuabi64"}
+		case arch.Flags&efMIPSABI2 != 0:
+			return []string{"mips64" + prefix[len("mips"):] + "-linux-gnuabin32"}
+		default:
+			return []string{prefix + "-linux-gnu"}
+		}
+	case elf.EM_SPARCV9:
+		return []string{"sparc64-linux-gnu"}
+	case elf.EM_LOONGARCH:
+		return []string{"loongarch64-linux-gnu"}
+	case elf.EM_ALPHA:
+		return []string{"alpha-linux-gnu"}
+	case elf.EM_IA_64:
+		return []string{"ia64-linux-gnu"}
+	case elf.EM_PARISC:
+		return []string{"hppa-linux-gnu"}
+	case elf.EM_SH:
+		return []string{"sh4-linux-gnu"}
+	case elf.EM_68K:
+		return []string{"m68k-linux-gnu"}
+	default:
+		return nil
+	}
+}
+
+// multiarchDirs returns the multiarch library directories for the ABI
+func multiarchDirs(arch Arch) []string {
+	var ret []string
+	for _, triplet := range MultiarchTriplets(arch) {
+		ret = append(ret, "/lib/"+triplet, "/usr/lib/"+triplet)
+	}
+	return ret
+}
+
+// libDirNames returns the names used for library directories holding the
+// ABI's ELF class, most likely first. Every name is returned when the class
+// isn't known.
+func libDirNames(arch Arch) []string {
+	switch {
+	case arch.Class == elf.ELFCLASS64:
+		return []string{"lib64", "lib"}
+	case arch.Class == elf.ELFCLASS32 && arch.Machine == elf.EM_X86_64:
+		return []string{"libx32", "lib"}
+	case arch.Class == elf.ELFCLASS32:
+		return []string{"lib32", "lib"}
+	default:
+		return []string{"lib64", "lib", "lib32"}
+	}
+}
+
+// wrongABIDir determines whether dir is clearly meant for another ABI, such
+// as /usr/lib32 for a 64-bit object, or the multiarch directory of another
+// architecture.
+func wrongABIDir(dir string, arch Arch) bool {
+	if arch.Class == elf.ELFCLASSNONE {
+		return false
+	}
+	names := libDirNames(arch)
+	triplets := MultiarchTriplets(arch)
+	for _, elem := range strings.Split(filepath.ToSlash(dir), "/") {
+		switch {
+		case elem == "lib64" || elem == "lib32" || elem == "libx32":
+			if !hasString(names, elem) {
+				return true
+			}
+		case strings.Contains(elem, "-linux-gnu") && len(triplets) > 0:
+			if !hasString(triplets, elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasString determines whether the list contains s
+func hasString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// muslDefaultPath is searched by musl's loader when there's no path file
+var muslDefaultPath = []string{"/lib", "/usr/local/lib", "/usr/lib"}
+
+// muslReservedNames are the libraries musl builds into libc itself, which
+// are satisfied by the loader whatever is on disk
+var muslReservedNames = []string{"c", "pthread", "rt", "m", "dl", "util", "xnet"}
+
+// loadMuslConfig will read the musl path file of every architecture in the
+// sysroot, returning whether the sysroot is a musl system at all, which is
+// the case when it has a musl loader or path file but no glibc configuration
+func (s *SymbolStore) loadMuslConfig() (bool, error) {
+	s.muslPaths = nil
+
+	files, err := filepath.Glob(s.rooted("/etc/ld-musl-*.path"))
+	if err != nil {
+		return false, err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return false, err
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "ld-musl-"), ".path")
+		if s.muslPaths == nil {
+			s.muslPaths = make(map[string][]string)
+		}
+		// Entries may be separated by newlines as well as colons
+		s.muslPaths[name] = strings.FieldsFunc(string(data), func(r rune) bool {
+			return r == ':' || r == '\n'
+		})
+	}
+
+	if s.ldCache != nil || s.configLibraries != nil {
+		return false, nil
+	}
+	loaders, err := filepath.Glob(s.rooted("/lib/ld-musl-*.so.1"))
+	if err != nil {
+		return false, err
+	}
+	return len(loaders) > 0 || len(s.muslPaths) > 0, nil
+}
+
+// isMuslInterp determines whether the interpreter is musl's loader
+func isMuslInterp(interp string) bool {
+	return strings.HasPrefix(filepath.Base(interp), "ld-musl-")
+}
+
+// muslArch returns the name musl uses for the ABI in its loader and path
+// file, i.e. x86_64 for /lib/ld-musl-x86_64.so.1
+func muslArch(arch Arch) string {
+	bigEndian := arch.Data == elf.ELFDATA2MSB
+	switch arch.Machine {
+	case elf.EM_X86_64:
+		if arch.Class == elf.ELFCLASS32 {
+			return "x32"
+		}
+		return "x86_64"
+	case elf.EM_386:
+		return "i386"
+	case elf.EM_AARCH64:
+		if bigEndian {
+			return "aarch64_be"
+		}
+		return "aarch64"
+	case elf.EM_ARM:
+		name := "arm"
+		if bigEndian {
+			name += "eb"
+		}
+		// EF_ARM_ABI_FLOAT_HARD
+		if arch.Flags&0x400 != 0 {
+			name += "hf"
+		}
+		return name
+	case elf.EM_RISCV:
+		return "riscv64"
+	case elf.EM_PPC64:
+		if bigEndian {
+			return "powerpc64"
+		}
+		return "powerpc64le"
+	case elf.EM_PPC:
+		return "powerpc"
+	case elf.EM_S390:
+		return "s390x"
+	case elf.EM_MIPS:
+		name := "mips"
+		if arch.Class == elf.ELFCLASS64 {
+			name = "mips64"
+		}
+		if !bigEndian {
+			name += "el"
+		}
+		return name
+	default:
+		return ""
+	}
+}
+
+// muslLoader returns the path of musl's loader for the ABI, which is libc
+// itself
+func muslLoader(arch Arch) string {
+	return "/lib/ld-musl-" + muslArch(arch) + ".so.1"
+}
+
+// muslReserved determines whether the library is one musl provides from
+// libc, such as libpthread.so.0 or libm.so
+func muslReserved(library string) bool {
+	rest, ok := strings.CutPrefix(library, "lib")
+	if !ok {
+		return false
+	}
+	for _, name := range muslReservedNames {
+		if tail, ok := strings.CutPrefix(rest, name); ok && (tail == "" || tail[0] == '.') {
+			return true
+		}
+	}
+	return false
+}
+
+// muslDirs returns the system library directories musl searches for the ABI
+func (s *SymbolStore) muslDirs(arch Arch) []string {
+	dirs, ok := s.muslPaths[muslArch(arch)]
+	if !ok {
+		dirs = muslDefaultPath
+	}
+	ret := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		ret = append(ret, s.rooted(dir))
+	}
+	return ret
+}
+
+// muslPathDirs returns every directory of the musl path files, sorted by
+// architecture
+func (s *SymbolStore) muslPathDirs() []string {
+	var names []string
+	for name := range s.muslPaths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var ret []string
+	for _, name := range names {
+		ret = append(ret, s.muslPaths[name]...)
+	}
+	return ret
+}
+
+// muslSearchPaths returns the directories musl searches for the libraries
+// an object needs, in order. There's no difference between DT_RPATH and
+// DT_RUNPATH, and both come after LD_LIBRARY_PATH.
+func (s *SymbolStore) muslSearchPaths(arch Arch, rpaths, runpaths []string) []string {
+	var ret []string
+	ret = append(ret, s.libraryPath...)
+	ret = append(ret, rpaths...)
+	ret = append(ret, runpaths...)
+	return append(ret, s.muslDirs(arch)...)
+}
@@ -0,0 +1,122 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+)
+
+// Note types we're interested in
+const (
+	ntGNUBuildID  = 3
+	ntGNUProperty = 5
+)
+
+// elfNote is a single entry in an ELF note section or segment
+type elfNote struct {
+	Name string
+	Type uint32
+	Desc []byte
+}
+
+// parseNotes will split the raw contents of a note section into entries.
+// Entries are padded to the given alignment, which is 4 bytes except for
+// 8 byte aligned segments such as .note.gnu.property on 64-bit. Padding is
+// from the start of the entry, so the 12 byte header counts towards it.
+func parseNotes(data []byte, order binary.ByteOrder, align int) []elfNote {
+	var ret []elfNote
+	pad := func(n int) int {
+		return (n + align - 1) &^ (align - 1)
+	}
+	for len(data) >= 12 {
+		namesz := int(order.Uint32(data[0:]))
+		descsz := int(order.Uint32(data[4:]))
+		typ := order.Uint32(data[8:])
+		data = data[12:]
+
+		if namesz < 0 || descsz < 0 || pad(12+namesz)-12 > len(data) {
+			break
+		}
+		name := string(bytes.TrimRight(data[:namesz], "\x00"))
+		data = data[pad(12+namesz)-12:]
+
+		if descsz > len(data) {
+			break
+		}
+		desc := data[:descsz]
+		if pad(descsz) > len(data) {
+			data = nil
+		} else {
+			data = data[pad(descsz):]
+		}
+		ret = append(ret, elfNote{Name: name, Type: typ, Desc: desc})
+	}
+	return ret
+}
+
+// readNotes returns every note within the file, from the PT_NOTE segments
+// if there are any, falling back to SHT_NOTE sections for stripped headers.
+func readNotes(file *elf.File) []elfNote {
+	var ret []elfNote
+	for _, prog := range file.Progs {
+		if prog.Type != elf.PT_NOTE {
+			continue
+		}
+		data, err := io.ReadAll(prog.Open())
+		if err != nil {
+			continue
+		}
+		align := int(prog.Align)
+		if align != 8 {
+			align = 4
+		}
+		ret = append(ret, parseNotes(data, file.ByteOrder, align)...)
+	}
+	if len(ret) > 0 {
+		return ret
+	}
+	for _, sect := range file.Sections {
+		if sect.Type != elf.SHT_NOTE {
+			continue
+		}
+		data, err := sectionData(sect)
+		if err != nil {
+			continue
+		}
+		align := int(sect.Addralign)
+		if align != 8 {
+			align = 4
+		}
+		ret = append(ret, parseNotes(data, file.ByteOrder, align)...)
+	}
+	return ret
+}
+
+// BuildID returns the hex encoded GNU build-id of the file, or an empty
+// string if it doesn't have one.
+func BuildID(file *elf.File) string {
+	for _, note := range readNotes(file) {
+		if note.Name == "GNU" && note.Type == ntGNUBuildID {
+			return hex.EncodeToString(note.Desc)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"debug/elf"
+	"io"
+	"path"
+	"sort"
+)
+
+// maxLinkDepth matches the kernel's limit on nested symlinks
+const maxLinkDepth = 40
+
+// Overlay is an in-memory set of files laid over the filesystem, such as the
+// contents of a package that hasn't been installed yet. Only ELF objects and
+// symlinks are kept, as nothing else matters for resolution.
+type Overlay struct {
+	files map[string]io.ReaderAt
+	links map[string]string
+}
+
+// NewOverlay will return a new, empty Overlay
+func NewOverlay() *Overlay {
+	return &Overlay{
+		files: make(map[string]io.ReaderAt),
+		links: make(map[string]string),
+	}
+}
+
+// overlayPath cleans the path from an archive into absolute form, as
+// archives typically store "./usr/lib/foo"
+func overlayPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+// AddFile will add the file to the overlay if it is an ELF object
+func (o *Overlay) AddFile(name string, data []byte) {
+	o.AddReader(name, bytes.NewReader(data))
+}
+
+// AddReader is AddFile for an object that isn't already in memory, such as
+// one within a larger file or served over the network. Only the parts of
+// it needed are read, whenever they're needed, so r must stay usable for
+// as long as the overlay is and allow parallel calls to ReadAt.
+func (o *Overlay) AddReader(name string, r io.ReaderAt) {
+	magic := make([]byte, len(elf.ELFMAG))
+	if _, err := r.ReadAt(magic, 0); err != nil || !bytes.Equal(magic, []byte(elf.ELFMAG)) {
+		return
+	}
+	o.files[overlayPath(name)] = r
+}
+
+// AddLink will add a symlink to the overlay. Relative targets are resolved
+// from the directory containing the link.
+func (o *Overlay) AddLink(name, target string) {
+	o.links[overlayPath(name)] = target
+}
+
+// Objects returns the path of every dynamic ELF executable and shared
+// library within the overlay, sorted.
+func (o *Overlay) Objects() []string {
+	var ret []string
+	for name, r := range o.files {
+		file, err := elf.NewFile(r)
+		if err != nil {
+			continue
+		}
+		switch file.FileHeader.Type {
+		case elf.ET_EXEC, elf.ET_DYN:
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// merge will copy every entry from other into the overlay, with each path
+// transformed by fn
+func (o *Overlay) merge(other *Overlay, fn func(string) string) {
+	for name, r := range other.files {
+		o.files[fn(name)] = r
+	}
+	for name, target := range other.links {
+		if path.IsAbs(target) {
+			target = fn(target)
+		}
+		o.links[fn(name)] = target
+	}
+}
+
+// lookup will follow symlinks within the overlay, returning the contents of
+// the file that name refers to. When the chain leaves the overlay, r is nil
+// and resolved is the real path that should be used instead.
+func (o *Overlay) lookup(name string) (r io.ReaderAt, resolved string) {
+	name = path.Clean(name)
+	for i := 0; i < maxLinkDepth; i++ {
+		if r, ok := o.files[name]; ok {
+			return r, name
+		}
+		target, ok := o.links[name]
+		if !ok {
+			return nil, name
+		}
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(name), target)
+		}
+		name = path.Clean(target)
+	}
+	return nil, name
+}
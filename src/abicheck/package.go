@@ -0,0 +1,182 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnknownPackage is returned when a file isn't a supported package format
+var ErrUnknownPackage = errors.New("unknown package format")
+
+// packageReaders maps the file extension of each supported package format
+// to the function used to read its contents
+var packageReaders = map[string]func(path string) (*Overlay, error){
+	".deb":   readDeb,
+	".rpm":   readRpm,
+	".eopkg": readEopkg,
+}
+
+// IsPackage determines whether the path looks like a supported package file
+func IsPackage(path string) bool {
+	_, ok := packageReaders[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// ReadPackage will read the ELF objects and symlinks from the package file
+// at path into an Overlay, without installing anything. Debian (.deb),
+// RPM (.rpm) and Solus (.eopkg) packages are supported.
+func ReadPackage(path string) (*Overlay, error) {
+	fn, ok := packageReaders[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, ErrUnknownPackage
+	}
+	overlay, err := fn(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return overlay, nil
+}
+
+// packageSuffixFields is how many dash separated fields follow the name in
+// the file names of each package format, i.e. version-release.arch for RPM
+var packageSuffixFields = map[string]int{
+	".rpm":   2,
+	".eopkg": 4,
+}
+
+// packageName guesses the name of the package from the conventional file
+// name of its format, such as name_version_arch.deb
+func packageName(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if ext == ".deb" {
+		name, _, _ := strings.Cut(base, "_")
+		return name
+	}
+	if ext == ".rpm" {
+		// The architecture follows the release after a dot
+		if i := strings.LastIndexByte(base, '.'); i > 0 {
+			base = base[:i]
+		}
+	}
+	fields := strings.Split(base, "-")
+	if n := len(fields) - packageSuffixFields[ext]; n > 0 {
+		return strings.Join(fields[:n], "-")
+	}
+	return base
+}
+
+// externalDecompressors handle the formats Go doesn't ship a reader for,
+// keyed by their magic.
+var externalDecompressors = []struct {
+	magic []byte
+	cmd   []string
+}{
+	{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, []string{"xz", "-dc"}},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, []string{"zstd", "-dc"}},
+	{[]byte{0x5d, 0x00, 0x00}, []string{"xz", "--format=lzma", "-dc"}},
+}
+
+// decompress will sniff the compression used by the stream and return a
+// reader for the decompressed contents. gzip and bzip2 are handled
+// natively. xz, lzma and zstd need the respective tool installed.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(6)
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(br), nil
+	}
+
+	for _, d := range externalDecompressors {
+		if !bytes.HasPrefix(magic, d.magic) {
+			continue
+		}
+		cmd := exec.Command(d.cmd[0], d.cmd[1:]...)
+		cmd.Stdin = br
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s failed: %v", d.cmd[0], err)
+		}
+		return bytes.NewReader(out), nil
+	}
+
+	// Assume it isn't compressed
+	return br, nil
+}
+
+// readTar will add the contents of the (possibly compressed) tarball to the
+// overlay
+func readTar(overlay *Overlay, r io.Reader) error {
+	r, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			data, err := readELF(tr)
+			if err != nil {
+				return err
+			}
+			if data != nil {
+				overlay.AddFile(hdr.Name, data)
+			}
+		case tar.TypeSymlink:
+			overlay.AddLink(hdr.Name, hdr.Linkname)
+		case tar.TypeLink:
+			// Hard links name another entry within the archive
+			overlay.AddLink(hdr.Name, overlayPath(hdr.Linkname))
+		}
+	}
+}
+
+// readELF will read the whole of r if it begins with the ELF magic, and
+// otherwise discard it, returning nil.
+func readELF(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	if !bytes.Equal(magic, []byte("\x7fELF")) {
+		_, err := io.Copy(io.Discard, br)
+		return nil, err
+	}
+	return io.ReadAll(br)
+}
@@ -0,0 +1,91 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// LdPreloadPath lists the objects ld.so loads into every process on glibc
+// systems, ahead of anything the program needs itself
+const LdPreloadPath = "/etc/ld.so.preload"
+
+// SplitPreload returns the objects named by an LD_PRELOAD style value,
+// which are separated by spaces or colons
+func SplitPreload(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == ':'
+	})
+}
+
+// ParseLdPreload will return the objects listed in the ld.so.preload file
+// at path, leaving out any comments
+func ParseLdPreload(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = line[:idx]
+		}
+		ret = append(ret, SplitPreload(line)...)
+	}
+	return ret, nil
+}
+
+// SetPreload will load the objects into every process scope as though they
+// were set in LD_PRELOAD, straight after the target itself. Their definitions
+// then take priority over those of every library the target needs, as is
+// relied upon by interposers such as jemalloc, sanitizers or fakeroot.
+// Names without a slash are searched for just like DT_NEEDED entries of the
+// target. Those in the sysroot's /etc/ld.so.preload follow these in glibc
+// processes.
+func (s *SymbolStore) SetPreload(names []string) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.preload = names
+}
+
+// loadPreloaded will add the preloaded objects to the scope after the target,
+// before any of its own dependencies are loaded
+func (s *SymbolStore) loadPreloaded(scope *processScope, root *scopeEntry) error {
+	// Only glibc has ld.so.preload
+	names := s.preload
+	if scope.libc == LibcGlibc {
+		names = append(append([]string(nil), s.preload...), s.systemPreload...)
+	}
+	for _, name := range names {
+		dep, found, err := s.satisfy(scope, root, name, 0)
+		if !found {
+			if root.result != nil {
+				root.result.Preloaded = append(root.result.Preloaded, LibraryResult{Name: name})
+				s.addMissing(root.result, err, "preload")
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if root.result != nil {
+			root.result.Preloaded = append(root.result.Preloaded, LibraryResult{Name: name, Path: dep.path})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ProcRoot is where procfs is expected to be mounted
+const ProcRoot = "/proc"
+
+// deletedSuffix is appended by the kernel to the path of unlinked files
+const deletedSuffix = " (deleted)"
+
+// MappedObject is an ELF object mapped into a running process
+type MappedObject struct {
+	Path   string `json:"path"`             // As it was when mapped
+	Device string `json:"device,omitempty"` // major:minor, in hex as in maps
+	Inode  uint64 `json:"inode,omitempty"`
+
+	// BuildID is what the mapped copy had, when known
+	BuildID string `json:"build_id,omitempty"`
+
+	// Deleted is set once the mapped file has been unlinked, and Replaced
+	// when another file is now found at Path, as after an upgrade
+	Deleted  bool `json:"deleted,omitempty"`
+	Replaced bool `json:"replaced,omitempty"`
+}
+
+// Stale determines whether the mapped object is no longer what's on disk
+func (m *MappedObject) Stale() bool {
+	return m.Deleted || m.Replaced
+}
+
+// Process is the set of objects a process has loaded, read from its
+// /proc/<pid> directory while running or from a core file after the fact
+type Process struct {
+	PID int    // Zero for core files
+	Exe string // Path the executable was started from
+
+	// Objects holds every ELF object mapped, the executable first, then
+	// the others in address order
+	Objects []MappedObject
+
+	// LibraryPath is the process's own LD_LIBRARY_PATH, if it could be read
+	LibraryPath []string
+
+	// Preload is the process's own LD_PRELOAD, read along with LibraryPath
+	Preload []string
+}
+
+// ReadProcess will reconstruct the loaded objects of the process from its
+// maps, which needs the same permissions as ptrace
+func ReadProcess(pid int) (*Process, error) {
+	dir := filepath.Join(ProcRoot, strconv.Itoa(pid))
+	exe, err := os.Readlink(filepath.Join(dir, "exe"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no such process: %d", pid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	proc := &Process{
+		PID: pid,
+		Exe: strings.TrimSuffix(exe, deletedSuffix),
+	}
+
+	maps, err := os.Open(filepath.Join(dir, "maps"))
+	if err != nil {
+		return nil, err
+	}
+	defer maps.Close()
+
+	seen := make(map[string]bool)
+	sc := bufio.NewScanner(maps)
+	for sc.Scan() {
+		obj, addr, ok := parseMapping(sc.Text())
+		if !ok || seen[obj.Path] {
+			continue
+		}
+		seen[obj.Path] = true
+		obj.Replaced = replacedOnDisk(&obj)
+		if !mappedELF(dir, addr, &obj) {
+			continue
+		}
+		if obj.Path == proc.Exe {
+			proc.Objects = append([]MappedObject{obj}, proc.Objects...)
+		} else {
+			proc.Objects = append(proc.Objects, obj)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	// Another user's environment is private, so this is best effort
+	if environ, err := ioutil.ReadFile(filepath.Join(dir, "environ")); err == nil {
+		for _, env := range bytes.Split(environ, []byte{0}) {
+			if value, ok := strings.CutPrefix(string(env), "LD_LIBRARY_PATH="); ok {
+				proc.LibraryPath = filepath.SplitList(value)
+			} else if value, ok := strings.CutPrefix(string(env), "LD_PRELOAD="); ok {
+				proc.Preload = SplitPreload(value)
+			}
+		}
+	}
+	return proc, nil
+}
+
+// parseMapping returns the file mapped by a line of /proc/<pid>/maps, along
+// with its address range, i.e.
+//
+//	7f53...-7f53... r--p 00000000 fe:00 320085   /usr/lib/libc.so.6
+//
+// Anonymous mappings and pseudo files like [vdso] are skipped.
+func parseMapping(line string) (MappedObject, string, bool) {
+	var fields [5]string
+	rest := line
+	for i := range fields {
+		rest = strings.TrimLeft(rest, " ")
+		var ok bool
+		if fields[i], rest, ok = strings.Cut(rest, " "); !ok {
+			return MappedObject{}, "", false
+		}
+	}
+	path := strings.TrimLeft(rest, " ")
+	inode, err := strconv.ParseUint(fields[4], 10, 64)
+	if err != nil || inode == 0 || !strings.HasPrefix(path, "/") {
+		return MappedObject{}, "", false
+	}
+	obj := MappedObject{
+		Path:   strings.TrimSuffix(path, deletedSuffix),
+		Device: fields[3],
+		Inode:  inode,
+	}
+	obj.Deleted = obj.Path != path
+	return obj, fields[0], true
+}
+
+// replacedOnDisk determines whether a different file now lives at the path
+// of the mapped object
+func replacedOnDisk(obj *MappedObject) bool {
+	st, err := os.Stat(obj.Path)
+	if err != nil {
+		return false
+	}
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	dev := uint64(sys.Dev)
+	major := (dev>>8)&0xfff | (dev>>32)&^uint64(0xfff)
+	minor := dev&0xff | (dev>>12)&^uint64(0xff)
+	return uint64(sys.Ino) != obj.Inode || fmt.Sprintf("%02x:%02x", major, minor) != obj.Device
+}
+
+// mappedELF determines whether the mapping is of an ELF object. The mapped
+// file itself is only reachable through map_files with CAP_SYS_ADMIN, so
+// failing that whatever is at the path has to do, or for deleted files
+// the name.
+func mappedELF(dir, addr string, obj *MappedObject) bool {
+	if _, err := os.Stat(filepath.Join(dir, "map_files", addr)); err == nil {
+		return IsDynamicELF(filepath.Join(dir, "map_files", addr))
+	}
+	return likelyELF(obj)
+}
+
+// likelyELF guesses whether the mapped object is ELF from what's at its path
+// now, or for deleted files the name
+func likelyELF(obj *MappedObject) bool {
+	if obj.Deleted && !obj.Replaced {
+		return strings.Contains(filepath.Base(obj.Path), ".so")
+	}
+	return IsDynamicELF(obj.Path)
+}
+
+// CheckProcess will check the running process against the libraries now
+// on disk, starting from its executable and then each further library it
+// mapped (i.e. with dlopen), which gets the executable as a provider. Any
+// of its objects deleted or replaced since being mapped are listed in the
+// Stale field of the executable's result.
+//
+// For a running process with a deleted executable, the copy still running
+// is checked instead.
+func (c *Checker) CheckProcess(ctx context.Context, proc *Process) ([]*Result, error) {
+	exe := proc.Exe
+	if proc.PID > 0 && len(proc.Objects) > 0 && proc.Objects[0].Path == proc.Exe && proc.Objects[0].Stale() {
+		exe = filepath.Join(ProcRoot, strconv.Itoa(proc.PID), "exe")
+	}
+	result, err := c.check(ctx, exe)
+	if err != nil {
+		return nil, err
+	}
+	results := []*Result{result}
+
+	if len(result.Objects) > 0 {
+		target := result.Objects[0]
+		c.Store.config.RLock()
+		for _, obj := range proc.Objects {
+			if !obj.Stale() {
+				continue
+			}
+			warning := &StaleLibraryWarning{Importer: target.Path, Path: obj.Path, Replaced: obj.Replaced}
+			if !c.Store.ignored(warning) {
+				target.Stale = append(target.Stale, obj)
+				c.Store.emit(warning)
+			}
+		}
+		c.Store.config.RUnlock()
+	}
+	c.complete(result)
+
+	loaded := make(map[string]bool)
+	for _, obj := range c.Store.Results() {
+		loaded[c.Store.realPath(obj.Path)] = true
+	}
+	c.Store.AddHostExecutable(exe)
+	for _, obj := range proc.Objects {
+		if obj.Path == proc.Exe || (obj.Deleted && !obj.Replaced) || loaded[c.Store.realPath(obj.Path)] {
+			continue
+		}
+		result, err := c.CheckContext(ctx, obj.Path)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+		for _, o := range result.Objects {
+			loaded[c.Store.realPath(o.Path)] = true
+		}
+	}
+	return results, nil
+}
+
+// Stale returns each object the process maps that is no longer on disk as
+// it was when mapped
+func (p *Process) Stale() []MappedObject {
+	var ret []MappedObject
+	for _, obj := range p.Objects {
+		if obj.Stale() {
+			ret = append(ret, obj)
+		}
+	}
+	return ret
+}
+
+// Processes returns the pid of every running process, in ascending order
+func Processes() ([]int, error) {
+	entries, err := ioutil.ReadDir(ProcRoot)
+	if err != nil {
+		return nil, err
+	}
+	var ret []int
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+			ret = append(ret, pid)
+		}
+	}
+	sort.Ints(ret)
+	return ret, nil
+}
+
+// unitSuffixes are the kinds of systemd unit that processes can belong to
+var unitSuffixes = []string{".service", ".scope", ".socket", ".mount", ".swap"}
+
+// SystemdUnit returns the systemd unit the process runs within, such as
+// ssh.service, from its control group. An empty string is returned when it
+// isn't within one, or systemd isn't in use.
+func SystemdUnit(pid int) string {
+	data, err := ioutil.ReadFile(filepath.Join(ProcRoot, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// The unified hierarchy, or systemd's own one under cgroup v1
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 || (fields[0] != "0" && fields[1] != "name=systemd") {
+			continue
+		}
+		elems := strings.Split(fields[2], "/")
+		for i := len(elems) - 1; i >= 0; i-- {
+			for _, suffix := range unitSuffixes {
+				if strings.HasSuffix(elems[i], suffix) {
+					return elems[i]
+				}
+			}
+		}
+	}
+	return ""
+}
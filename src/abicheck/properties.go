@@ -0,0 +1,177 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+)
+
+// GNU property types and the bits of each we care about, as in the x86-64
+// and AArch64 psABIs
+const (
+	gnuPropertyAArch64Feature1And = 0xc0000000
+	gnuPropertyX86Feature1And     = 0xc0000002
+	gnuPropertyX86ISA1Needed      = 0xc0008002
+
+	gnuPropertyAArch64BTI  = 1 << 0
+	gnuPropertyAArch64PAC  = 1 << 1
+	gnuPropertyX86IBT      = 1 << 0
+	gnuPropertyX86SHSTK    = 1 << 1
+	gnuPropertyX86ISAV2    = 1 << 1 // Bit 0 is the baseline
+	gnuPropertyX86ISALevel = 3      // How many levels there are past it
+)
+
+// CPUFeatures are the processor requirements and protections an object is
+// marked with in its .note.gnu.property
+type CPUFeatures struct {
+	ISALevel string `json:"isa_level,omitempty"` // Highest needed, i.e. x86-64-v3
+	IBT      bool   `json:"ibt,omitempty"`
+	SHSTK    bool   `json:"shstk,omitempty"`
+	BTI      bool   `json:"bti,omitempty"`
+	PAC      bool   `json:"pac,omitempty"`
+}
+
+// FeatureMismatch is a protection the target is built with that the rest of
+// its process scope lets down, or an ISA level it needs beyond the CPU
+// being checked for
+type FeatureMismatch struct {
+	Feature string   `json:"feature"` // IBT, SHSTK, BTI or an ISA level
+	Objects []string `json:"objects"` // Those lacking it, or needing it
+	CPU     string   `json:"cpu,omitempty"`
+}
+
+// readCPUFeatures returns the features the object is marked with. Property
+// arrays are padded to 8 bytes on 64-bit, unlike the notes holding them.
+func readCPUFeatures(file *elfObject) *CPUFeatures {
+	ret := &CPUFeatures{}
+	align := 4
+	if file.Class == elf.ELFCLASS64 {
+		align = 8
+	}
+	for _, note := range readNotes(file.File) {
+		if note.Name != "GNU" || note.Type != ntGNUProperty {
+			continue
+		}
+		data := note.Desc
+		for len(data) >= 8 {
+			typ := file.ByteOrder.Uint32(data[0:])
+			size := int(file.ByteOrder.Uint32(data[4:]))
+			data = data[8:]
+			if size < 0 || size > len(data) {
+				break
+			}
+			value := uint32(0)
+			if size >= 4 {
+				value = file.ByteOrder.Uint32(data)
+			}
+			ret.apply(file.Machine, typ, value)
+			size = (size + align - 1) &^ (align - 1)
+			if size > len(data) {
+				break
+			}
+			data = data[size:]
+		}
+	}
+	return ret
+}
+
+// apply will set the features given by a single property
+func (f *CPUFeatures) apply(machine elf.Machine, typ, value uint32) {
+	switch {
+	case machine == elf.EM_X86_64 && typ == gnuPropertyX86Feature1And:
+		f.IBT = value&gnuPropertyX86IBT != 0
+		f.SHSTK = value&gnuPropertyX86SHSTK != 0
+	case machine == elf.EM_X86_64 && typ == gnuPropertyX86ISA1Needed:
+		for i := gnuPropertyX86ISALevel - 1; i >= 0; i-- {
+			if value&(gnuPropertyX86ISAV2<<i) != 0 {
+				f.ISALevel = hwcapsLevels[elf.EM_X86_64][i]
+				break
+			}
+		}
+	case machine == elf.EM_AARCH64 && typ == gnuPropertyAArch64Feature1And:
+		f.BTI = value&gnuPropertyAArch64BTI != 0
+		f.PAC = value&gnuPropertyAArch64PAC != 0
+	}
+}
+
+// SetReportFeatures controls whether each result lists the CPU features its
+// object is marked with, and each target the features its process scope
+// disagrees on (see FeatureMismatch). ISA levels are only checked against a
+// CPU level given to SetHWCaps. This is off by default.
+func (s *SymbolStore) SetReportFeatures(report bool) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.reportFeatures = report
+}
+
+// featureMismatches returns where the objects of the scope let the target
+// down. A process only gets IBT, shadow stacks or BTI when everything
+// in it is marked, and ld.so refuses anything needing a higher ISA level
+// than the CPU has. Objects whose features aren't known are left out.
+func (s *SymbolStore) featureMismatches(scope *processScope) []FeatureMismatch {
+	root := scope.entries[0].lib
+	if root.features == nil {
+		return nil
+	}
+	lacking := func(feature string, has func(f *CPUFeatures) bool) []FeatureMismatch {
+		if !has(root.features) {
+			return nil
+		}
+		var objects []string
+		for _, entry := range scope.entries[1:] {
+			if f := entry.lib.features; f != nil && !has(f) {
+				objects = append(objects, entry.path)
+			}
+		}
+		if len(objects) == 0 {
+			return nil
+		}
+		return []FeatureMismatch{{Feature: feature, Objects: objects}}
+	}
+
+	var ret []FeatureMismatch
+	switch root.arch.Machine {
+	case elf.EM_X86_64:
+		ret = append(ret, lacking("IBT", func(f *CPUFeatures) bool { return f.IBT })...)
+		ret = append(ret, lacking("SHSTK", func(f *CPUFeatures) bool { return f.SHSTK })...)
+	case elf.EM_AARCH64:
+		ret = append(ret, lacking("BTI", func(f *CPUFeatures) bool { return f.BTI })...)
+	}
+
+	levels := hwcapsLevels[elf.EM_X86_64]
+	cpu := -1
+	for i, level := range levels {
+		if level == s.hwcaps {
+			cpu = i
+		}
+	}
+	if root.arch.Machine != elf.EM_X86_64 || cpu < 0 {
+		return ret
+	}
+	for i := cpu + 1; i < len(levels); i++ {
+		var objects []string
+		for _, entry := range scope.entries {
+			if f := entry.lib.features; f != nil && f.ISALevel == levels[i] {
+				objects = append(objects, entry.path)
+			}
+		}
+		if len(objects) > 0 {
+			ret = append(ret, FeatureMismatch{Feature: levels[i], Objects: objects, CPU: s.hwcaps})
+		}
+	}
+	return ret
+}
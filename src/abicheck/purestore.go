@@ -0,0 +1,102 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// The stores of Nix and Guix, where every package lives in its own directory
+const (
+	NixStore  = "/nix/store"
+	GuixStore = "/gnu/store"
+)
+
+// ImpurePath is a reference an object makes to outside the pure store
+type ImpurePath struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"` // "interpreter", "rpath", "runpath" or "library"
+}
+
+// SetPureStore will resolve libraries the way they must be on Nix or Guix,
+// purely through DT_RPATH, DT_RUNPATH and LD_LIBRARY_PATH, with the system
+// directories, ld.so.conf and ld.so.cache all left out. The interpreter,
+// search paths and libraries used from outside dir (within the sysroot),
+// such as NixStore, are reported as impure references, as they only work
+// by chance on the machine they were found on. An empty dir turns this off.
+func (s *SymbolStore) SetPureStore(dir string) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	if dir != "" {
+		dir = filepath.Clean(dir)
+	}
+	s.pureStore = dir
+}
+
+// inPureStore determines whether the path, already within the sysroot, is
+// inside the pure store
+func (s *SymbolStore) inPureStore(path string) bool {
+	root := s.rooted(s.pureStore)
+	return path == root || strings.HasPrefix(path, root+"/")
+}
+
+// pureSearchPaths returns the only directories searched in a pure store
+func (s *SymbolStore) pureSearchPaths(rpaths, runpaths []string) []string {
+	var ret []string
+	ret = append(ret, rpaths...)
+	ret = append(ret, s.libraryPath...)
+	return append(ret, runpaths...)
+}
+
+// checkPurity will record every reference the entry makes outside the pure
+// store, if there is one
+func (s *SymbolStore) checkPurity(scope *processScope, entry *scopeEntry) {
+	if s.pureStore == "" {
+		return
+	}
+	result := entry.result
+	add := func(path, kind string) {
+		warning := &ImpurePathWarning{Importer: result.Path, Path: path, Kind: kind}
+		if s.ignored(warning) {
+			return
+		}
+		result.Impure = append(result.Impure, ImpurePath{Path: path, Kind: kind})
+		s.emit(warning)
+	}
+
+	if entry == scope.entries[0] && entry.lib.interp != "" && !s.inPureStore(s.rooted(entry.lib.interp)) {
+		add(entry.lib.interp, "interpreter")
+	}
+	for _, dir := range entry.lib.rpaths {
+		if !s.inPureStore(dir) {
+			add(dir, "rpath")
+		}
+	}
+	for _, dir := range entry.lib.runpaths {
+		if !s.inPureStore(dir) {
+			add(dir, "runpath")
+		}
+	}
+	for _, libs := range [][]LibraryResult{result.Filtees, result.Libraries} {
+		for _, lib := range libs {
+			if lib.Path != "" && lib.Path != vdsoPath && !s.inPureStore(s.realPath(lib.Path)) {
+				add(lib.Path, "library")
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"encoding/binary"
+)
+
+// rMIPSCopy is R_MIPS_COPY, which debug/elf doesn't define
+const rMIPSCopy = 126
+
+// copyRelocType returns the copy relocation of the machine, if it has one
+func copyRelocType(m elf.Machine) (uint32, bool) {
+	switch m {
+	case elf.EM_X86_64:
+		return uint32(elf.R_X86_64_COPY), true
+	case elf.EM_386:
+		return uint32(elf.R_386_COPY), true
+	case elf.EM_AARCH64:
+		return uint32(elf.R_AARCH64_COPY), true
+	case elf.EM_ARM:
+		return uint32(elf.R_ARM_COPY), true
+	case elf.EM_PPC:
+		return uint32(elf.R_PPC_COPY), true
+	case elf.EM_PPC64:
+		return uint32(elf.R_PPC64_COPY), true
+	case elf.EM_S390:
+		return uint32(elf.R_390_COPY), true
+	case elf.EM_SPARC, elf.EM_SPARC32PLUS, elf.EM_SPARCV9:
+		return uint32(elf.R_SPARC_COPY), true
+	case elf.EM_RISCV:
+		return uint32(elf.R_RISCV_COPY), true
+	case elf.EM_LOONGARCH:
+		return uint32(elf.R_LARCH_COPY), true
+	case elf.EM_MIPS:
+		return rMIPSCopy, true
+	case elf.EM_ALPHA, elf.EM_ALPHA_STD:
+		return uint32(elf.R_ALPHA_COPY), true
+	}
+	return 0, false
+}
+
+// copyRelocations returns the index within the dynamic symbol table of each
+// symbol with a copy relocation, found by reading every SHT_REL and SHT_RELA
+// section that refers to that table
+func copyRelocations(file *elf.File) (map[int]bool, error) {
+	want, ok := copyRelocType(file.Machine)
+	if !ok {
+		return nil, nil
+	}
+	dynsym := -1
+	for i, section := range file.Sections {
+		if section.Type == elf.SHT_DYNSYM {
+			dynsym = i
+			break
+		}
+	}
+	if dynsym < 0 {
+		return nil, nil
+	}
+
+	ret := make(map[int]bool)
+	is64 := file.Class == elf.ELFCLASS64
+	for _, section := range file.Sections {
+		if section.Type != elf.SHT_REL && section.Type != elf.SHT_RELA || int(section.Link) != dynsym {
+			continue
+		}
+		size := 8
+		if is64 {
+			size = 16
+		}
+		if section.Type == elf.SHT_RELA {
+			size += size / 2
+		}
+		data, err := section.Data()
+		if err != nil {
+			return nil, err
+		}
+		for off := 0; off+size <= len(data); off += size {
+			var sym, typ uint32
+			if is64 {
+				info := file.ByteOrder.Uint64(data[off+8:])
+				sym, typ = uint32(info>>32), uint32(info)
+				// MIPS keeps three types in the upper bytes, which is
+				// the other way around once little endian
+				if file.Machine == elf.EM_MIPS {
+					if file.ByteOrder == binary.LittleEndian {
+						sym, typ = uint32(info), uint32(info>>56)
+					} else {
+						typ &= 0xff
+					}
+				}
+			} else {
+				info := file.ByteOrder.Uint32(data[off+4:])
+				sym, typ = info>>8, info&0xff
+			}
+			if typ == want && sym != 0 {
+				ret[int(sym)] = true
+			}
+		}
+	}
+	return ret, nil
+}
+
+// copyMismatches finds every copy relocation of the root whose definition
+// later in the scope is sized differently, as ld.so would complain about
+// once the process is running
+func copyMismatches(scope *processScope, root *scopeEntry) []*CopyRelocationError {
+	var ret []*CopyRelocationError
+	exports := root.lib.loadedTables().Exports
+	for i := range exports {
+		sym := &exports[i]
+		if !sym.Copy {
+			continue
+		}
+		// Sizes aren't known for libraries described by a database
+		provider, def := copySource(scope, root, sym)
+		if def == nil || provider.lib.indexed || def.Size == sym.Size {
+			continue
+		}
+		ret = append(ret, &CopyRelocationError{
+			Importer:     root.path,
+			Symbol:       sym.Name,
+			Version:      sym.Version,
+			Size:         sym.Size,
+			Provider:     provider.path,
+			ProviderSize: def.Size,
+		})
+	}
+	return ret
+}
+
+// copySource returns the first object after the root defining the copied
+// symbol, which is where ld.so copies the data from
+func copySource(scope *processScope, root *scopeEntry, sym *ExportedSymbol) (*scopeEntry, *ExportedSymbol) {
+	for _, entry := range scope.entries {
+		if entry == root || entry.lib.loadedTables() == nil {
+			continue
+		}
+		exports := entry.lib.tables.Exports
+		for i := range exports {
+			def := &exports[i]
+			if def.Name != sym.Name || def.Copy {
+				continue
+			}
+			// Unversioned copies only bind the default version
+			if sym.Version != "" && def.Version != sym.Version || sym.Version == "" && def.Hidden {
+				continue
+			}
+			return entry, def
+		}
+	}
+	return nil, nil
+}
+
+// checkTextRel will flag the object when it needs its text relocated
+func (s *SymbolStore) checkTextRel(entry *scopeEntry) {
+	if !entry.lib.textrel {
+		return
+	}
+	warning := &TextRelWarning{Importer: entry.result.Path}
+	if !s.ignored(warning) {
+		entry.result.TextRel = true
+		s.emit(warning)
+	}
+}
@@ -0,0 +1,96 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"reflect"
+	"testing"
+)
+
+// copyScope returns the scope of an executable copying "data" from libdata,
+// which defines it with the given size, and also needing libother
+func copyScope(size uint64) (*processScope, *scopeEntry) {
+	exe := NewLibrary("a", "/bin/a")
+	exe.tables = &SymbolTables{Exports: []ExportedSymbol{{Name: "data", Version: "D_1", Copy: true, Size: 8}}}
+	data := NewLibrary("libdata.so.1", "/lib/libdata.so.1")
+	data.tables = &SymbolTables{Exports: []ExportedSymbol{
+		{Name: "data", Version: "D_0", Hidden: true, Size: 4},
+		{Name: "data", Version: "D_1", Size: size},
+	}}
+	other := NewLibrary("libother.so.1", "/lib/libother.so.1")
+	other.tables = &SymbolTables{}
+
+	root := &scopeEntry{lib: exe, path: exe.Path, result: &ObjectResult{
+		Path: exe.Path,
+		Libraries: []LibraryResult{
+			{Name: data.Name, Path: data.Path},
+			{Name: other.Name, Path: other.Path},
+		},
+	}}
+	scope := &processScope{entries: []*scopeEntry{
+		root,
+		{lib: data, path: data.Path},
+		{lib: other, path: other.Path},
+	}}
+	root.deps = []*scopeEntry{scope.entries[1], scope.entries[2]}
+	return scope, root
+}
+
+func TestCopyMismatches(t *testing.T) {
+	scope, root := copyScope(8)
+	if errs := copyMismatches(scope, root); len(errs) != 0 {
+		t.Errorf("matching sizes: got %v", errs)
+	}
+
+	scope, root = copyScope(16)
+	errs := copyMismatches(scope, root)
+	if len(errs) != 1 {
+		t.Fatalf("got %v, want one mismatch", errs)
+	}
+	want := CopyRelocationError{Importer: "/bin/a", Symbol: "data", Version: "D_1", Size: 8, Provider: "/lib/libdata.so.1", ProviderSize: 16}
+	if *errs[0] != want {
+		t.Errorf("got %+v, want %+v", *errs[0], want)
+	}
+
+	// Databases don't record sizes, so there's nothing to compare
+	scope, root = copyScope(0)
+	scope.entries[1].lib.indexed = true
+	if errs := copyMismatches(scope, root); len(errs) != 0 {
+		t.Errorf("indexed provider: got %v", errs)
+	}
+}
+
+func TestMarkUnusedCopy(t *testing.T) {
+	scope, root := copyScope(8)
+	NewSymbolStore().resolveEntry(scope, root)
+	want := SymbolResult{Name: "data", Version: "D_1", Provider: "libdata.so.1", ProviderPath: "/lib/libdata.so.1", Copy: true}
+	if syms := root.result.Symbols; len(syms) != 1 || !reflect.DeepEqual(syms[0], want) {
+		t.Fatalf("got symbols %+v, want %+v", syms, want)
+	}
+	markUnused(root)
+
+	libs := root.result.Libraries
+	if libs[0].Unused {
+		t.Errorf("%s is only used through a copy relocation, but marked unused", libs[0].Name)
+	}
+	if !libs[1].Unused {
+		t.Errorf("%s is not used, but not marked unused", libs[1].Name)
+	}
+	if got := root.result.UnusedLibraries(); len(got) != 1 || got[0] != "libother.so.1" {
+		t.Errorf("UnusedLibraries() = %v", got)
+	}
+}
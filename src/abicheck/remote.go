@@ -0,0 +1,108 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultDatabaseCacheDir returns the per-user directory remote databases are
+// downloaded into
+func DefaultDatabaseCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "runtime-abi-check", "databases"), nil
+}
+
+// IsRemoteDatabase determines whether the database location is a URL rather
+// than a local file
+func IsRemoteDatabase(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// FetchDatabase will download the index published at url into dir, unless
+// the copy already there is still current, returning the local path. As
+// each release of a distribution is published at its own URL, a cached copy
+// is used as is when the server can't be reached.
+func FetchDatabase(url, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 00755); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(url))
+	path := filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+	tagPath := path + ".etag"
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	_, statErr := os.Stat(path)
+	if statErr == nil {
+		if tag, err := os.ReadFile(tagPath); err == nil {
+			req.Header.Set("If-None-Match", string(tag))
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if statErr == nil {
+			return path, nil
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return path, nil
+	case http.StatusOK:
+	default:
+		return "", fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	// Only replace the cached copy once the download is complete
+	tmp, err := os.CreateTemp(dir, ".fetch-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("%s: %v", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	if tag := resp.Header.Get("ETag"); tag != "" {
+		os.WriteFile(tagPath, []byte(tag), 00644)
+	} else {
+		os.Remove(tagPath)
+	}
+	return path, nil
+}
@@ -0,0 +1,243 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Reporter receives the events of a scan as they happen, followed by the
+// results once checking is complete. Event is called concurrently when
+// checking with multiple jobs.
+type Reporter interface {
+	Event(ev Event)
+	Complete(results []*Result) error
+}
+
+// SetReporter will stream the events of every check to the reporter. The
+// caller passes the results to its Complete method once checking is done.
+func (c *Checker) SetReporter(r Reporter) {
+	c.Store.SetEventHandler(r.Event)
+}
+
+// objectsOf returns every object within the results, in scan order
+func objectsOf(results []*Result) []*ObjectResult {
+	var ret []*ObjectResult
+	for _, r := range results {
+		ret = append(ret, r.Objects...)
+	}
+	return ret
+}
+
+// progress writes each event that isn't an issue to w, if it's set. Issues
+// are left for the report proper, so only the policy decides what's shown.
+type progress struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// Event writes the event as a line of text
+func (p *progress) Event(ev Event) {
+	if p.w == nil {
+		return
+	}
+	if _, ok := ev.(Classified); ok {
+		return
+	}
+	p.mu.Lock()
+	fmt.Fprintln(p.w, ev)
+	p.mu.Unlock()
+}
+
+// TextReporter prints every issue the policy doesn't ignore, grouped by the
+// object it was found in with its severity and class lined up, followed by
+// a summary of the whole scan.
+type TextReporter struct {
+	progress
+	out      io.Writer
+	policy   Policy
+	color    bool // Set with SetColor
+	demangle bool
+}
+
+// ANSI escapes used by the TextReporter when colour is enabled
+const (
+	colorReset  = "\033[0m"
+	colorBold   = "\033[1m"
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorGreen  = "\033[32m"
+)
+
+// NewTextReporter returns a TextReporter writing issues to out. Progress is
+// written to the progress writer, which may be nil to keep quiet.
+func NewTextReporter(out, progressOut io.Writer, policy Policy) *TextReporter {
+	return &TextReporter{
+		progress: progress{w: progressOut},
+		out:      out,
+		policy:   policy,
+		demangle: true,
+	}
+}
+
+// SetColor will colour errors red, warnings yellow and a clean summary
+// green, as suits a terminal. It's off by default.
+func (t *TextReporter) SetColor(on bool) {
+	t.color = on
+}
+
+// SetDemangle controls whether C++ symbol names are demangled (with
+// c++filt, when it's installed), which they are by default
+func (t *TextReporter) SetDemangle(on bool) {
+	t.demangle = on
+}
+
+// paint wraps s in the colour, if colour is enabled
+func (t *TextReporter) paint(color, s string) string {
+	if !t.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// textIssue is one line of the text report
+type textIssue struct {
+	severity Severity
+	class    IssueClass
+	message  string
+}
+
+// textObject is an object of the text report, with the issues it hit
+type textObject struct {
+	path   string
+	issues []textIssue
+}
+
+// Complete prints the issues of every object, then the summary
+func (t *TextReporter) Complete(results []*Result) error {
+	var objects []textObject
+	var messages []string
+	width := 0
+	checked := 0
+	for _, result := range objectsOf(results) {
+		checked++
+		obj := textObject{path: result.Path}
+		for _, issue := range result.Issues() {
+			severity := t.policy.Severity(issue.Class)
+			if severity == SeverityIgnore {
+				continue
+			}
+			obj.issues = append(obj.issues, textIssue{severity, issue.Class, issue.Err.Error()})
+			messages = append(messages, issue.Err.Error())
+			if len(issue.Class) > width {
+				width = len(issue.Class)
+			}
+		}
+		if len(obj.issues) > 0 {
+			objects = append(objects, obj)
+		}
+	}
+	if t.demangle {
+		demangleMessages(messages)
+	}
+
+	errs, warnings, i := 0, 0, 0
+	for _, obj := range objects {
+		fmt.Fprintf(t.out, "%s:\n", t.paint(colorBold, obj.path))
+		for _, issue := range obj.issues {
+			label := t.paint(colorRed, "error  ")
+			if issue.severity == SeverityWarn {
+				label = t.paint(colorYellow, "warning")
+				warnings++
+			} else {
+				errs++
+			}
+			fmt.Fprintf(t.out, "    %s  %-*s  %s\n", label, width, issue.class, messages[i])
+			i++
+		}
+	}
+
+	switch {
+	case errs > 0:
+		fmt.Fprintln(t.out, t.paint(colorRed, fmt.Sprintf("%d error(s) and %d warning(s) in %d of %d object(s)", errs, warnings, len(objects), checked)))
+	case warnings > 0:
+		fmt.Fprintln(t.out, t.paint(colorYellow, fmt.Sprintf("%d warning(s) in %d of %d object(s)", warnings, len(objects), checked)))
+	default:
+		fmt.Fprintln(t.out, t.paint(colorGreen, fmt.Sprintf("%d object(s) checked, no issues", checked)))
+	}
+	return nil
+}
+
+// JSONReporter emits a structured document describing every object
+type JSONReporter struct {
+	progress
+	out io.Writer
+}
+
+// NewJSONReporter returns a JSONReporter writing the document to out, and
+// progress to the progress writer, which may be nil
+func NewJSONReporter(out, progressOut io.Writer) *JSONReporter {
+	return &JSONReporter{
+		progress: progress{w: progressOut},
+		out:      out,
+	}
+}
+
+// Complete writes the document
+func (j *JSONReporter) Complete(results []*Result) error {
+	enc := json.NewEncoder(j.out)
+	enc.SetIndent("", "    ")
+	return enc.Encode(&struct {
+		Files []*ObjectResult `json:"files"`
+	}{
+		Files: objectsOf(results),
+	})
+}
+
+// DotReporter writes the dependency graph of every object, see WriteDot
+type DotReporter struct {
+	progress
+	out io.Writer
+}
+
+// NewDotReporter returns a DotReporter writing the graph to out, and
+// progress to the progress writer, which may be nil
+func NewDotReporter(out, progressOut io.Writer) *DotReporter {
+	return &DotReporter{
+		progress: progress{w: progressOut},
+		out:      out,
+	}
+}
+
+// Complete writes the graph
+func (d *DotReporter) Complete(results []*Result) error {
+	return WriteDot(d.out, objectsOf(results))
+}
+
+// QuietReporter discards everything, for when only the outcome matters
+type QuietReporter struct{}
+
+// Event does nothing
+func (QuietReporter) Event(ev Event) {}
+
+// Complete does nothing
+func (QuietReporter) Complete(results []*Result) error {
+	return nil
+}
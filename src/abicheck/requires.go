@@ -0,0 +1,138 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"sort"
+	"strings"
+)
+
+// SonameDependency is a soname provided or needed by an object, optionally
+// qualified by a symbol version, as used for automatic package dependencies.
+type SonameDependency struct {
+	Soname  string `json:"soname"`
+	Version string `json:"version,omitempty"` // Symbol version, if any
+	Bits64  bool   `json:"64bit,omitempty"`
+}
+
+// RPM returns the dependency in the form RPM's elfdeps generates, i.e.
+// libc.so.6(GLIBC_2.14)(64bit)
+func (d SonameDependency) RPM() string {
+	s := d.Soname + "(" + d.Version + ")"
+	if d.Bits64 {
+		s += "(64bit)"
+	} else if d.Version == "" {
+		// 32-bit objects use the bare soname
+		s = d.Soname
+	}
+	return s
+}
+
+// ObjectDependencies are the sonames an object provides and requires
+type ObjectDependencies struct {
+	Path     string             `json:"path"`
+	Provides []SonameDependency `json:"provides,omitempty"`
+	Requires []SonameDependency `json:"requires,omitempty"`
+}
+
+// ReadDependencies returns what the object at path provides and requires.
+// Only shared libraries with a soname provide anything, as both the soname
+// and each version they define. Every DT_NEEDED entry is required, along with
+// each version needed from it.
+func ReadDependencies(path string) (*ObjectDependencies, error) {
+	file, err := openObject(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tables, err := readSymbolTables(file.File)
+	if err != nil {
+		return nil, err
+	}
+	needed, err := file.DynString(elf.DT_NEEDED)
+	if err != nil {
+		return nil, err
+	}
+
+	bits64 := file.Class == elf.ELFCLASS64
+	ret := &ObjectDependencies{Path: path}
+	if name := soname(file); name != "" && file.FileHeader.Type == elf.ET_DYN {
+		ret.Provides = append(ret.Provides, SonameDependency{Soname: name, Bits64: bits64})
+		for _, v := range tables.Versions {
+			ret.Provides = append(ret.Provides, SonameDependency{Soname: name, Version: v, Bits64: bits64})
+		}
+	}
+
+	for _, name := range needed {
+		ret.Requires = append(ret.Requires, SonameDependency{Soname: name, Bits64: bits64})
+	}
+	for _, need := range tables.VersionNeeds {
+		for _, v := range need.Versions {
+			ret.Requires = append(ret.Requires, SonameDependency{Soname: need.Library, Version: v, Bits64: bits64})
+		}
+	}
+	return ret, nil
+}
+
+// MergeDependencies combines the dependencies of several objects, such as
+// everything within a package build root, sorting and removing duplicates
+func MergeDependencies(objects []*ObjectDependencies) (provides, requires []SonameDependency) {
+	for _, obj := range objects {
+		provides = append(provides, obj.Provides...)
+		requires = append(requires, obj.Requires...)
+	}
+	return uniqueDependencies(provides), uniqueDependencies(requires)
+}
+
+// uniqueDependencies returns the sorted set of dependencies without repeats
+func uniqueDependencies(deps []SonameDependency) []SonameDependency {
+	seen := make(map[SonameDependency]bool)
+	var ret []SonameDependency
+	for _, dep := range deps {
+		if !seen[dep] {
+			seen[dep] = true
+			ret = append(ret, dep)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		if a.Soname != b.Soname {
+			return a.Soname < b.Soname
+		}
+		if a.Bits64 != b.Bits64 {
+			return !a.Bits64
+		}
+		return a.Version < b.Version
+	})
+	return ret
+}
+
+// ShlibsName splits a soname into the library name and version used by
+// Debian shlibs files, i.e. libfoo.so.1 is libfoo 1 and libfoo-2.0.so is
+// libfoo 2.0. A soname fitting neither form returns ok as false.
+func ShlibsName(soname string) (name, version string, ok bool) {
+	if name, version, ok = strings.Cut(soname, ".so."); ok && name != "" && version != "" {
+		return name, version, true
+	}
+	base, found := strings.CutSuffix(soname, ".so")
+	if idx := strings.LastIndexByte(base, '-'); found && idx > 0 && idx < len(base)-1 {
+		return base[:idx], base[idx+1:], true
+	}
+	return "", "", false
+}
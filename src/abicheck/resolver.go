@@ -0,0 +1,113 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"context"
+	"io"
+)
+
+// ResolveContext describes the object a library is being looked for on
+// behalf of, and where it asks for its dependencies to be searched.
+type ResolveContext struct {
+	// Context is that of the scan, so resolvers doing anything slow (such
+	// as fetching over the network) can give up when it is cancelled
+	Context context.Context
+
+	Importer string // Path of the object with the DT_NEEDED entry
+	Arch     Arch   // ABI the library must match
+
+	// Rpaths holds the DT_RPATH directories in effect, including those
+	// inherited from the loaders of the importer, and is empty when the
+	// importer has a DT_RUNPATH
+	Rpaths   []string
+	Runpaths []string
+
+	// Libc is that of the process, LibcGlibc, LibcMusl or LibcBionic,
+	// whose loaders each search other directories (see SetLibc)
+	Libc string
+}
+
+// Candidate is a possible match for a library. Reader is optional, and when
+// set the object is read from it rather than opened at Path, which is then
+// used only to identify the library.
+type Candidate struct {
+	Path   string
+	Reader io.ReaderAt
+}
+
+// LibraryResolver finds the candidates for a library, most preferred first.
+// Each is opened in turn and the first built for the right machine wins,
+// so resolvers needn't check that themselves. Returning no candidates
+// means the library is missing, whereas an error stops the scan.
+//
+// Resolvers are called concurrently when checking with multiple jobs.
+type LibraryResolver interface {
+	Resolve(name string, ctx *ResolveContext) ([]Candidate, error)
+}
+
+// filesystemResolver searches the filesystem (and any overlay) just as
+// ld.so would, following the configuration of the store
+type filesystemResolver struct {
+	store *SymbolStore
+}
+
+// Resolve returns every existing file the library may be loaded from
+func (f *filesystemResolver) Resolve(name string, ctx *ResolveContext) ([]Candidate, error) {
+	return pathCandidates(f.store.locateLibraryPaths(name, ctx.Arch, ctx.Rpaths, ctx.Runpaths, ctx.Libc)), nil
+}
+
+// FilesystemResolver returns the resolver used by default, which follows the
+// search rules of ld.so within the store's sysroot and overlays. Custom
+// resolvers can fall back to it for anything they don't handle.
+func (s *SymbolStore) FilesystemResolver() LibraryResolver {
+	return &filesystemResolver{store: s}
+}
+
+// SetResolver will replace how libraries are located. Libraries already
+// loaded by earlier scans are kept. A nil resolver restores the filesystem
+// one.
+func (s *SymbolStore) SetResolver(r LibraryResolver) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	if r == nil {
+		r = s.FilesystemResolver()
+	}
+	s.resolver = r
+}
+
+// pathCandidates returns a candidate for each of the paths
+func pathCandidates(paths []string) []Candidate {
+	ret := make([]Candidate, 0, len(paths))
+	for _, p := range paths {
+		ret = append(ret, Candidate{Path: p})
+	}
+	return ret
+}
+
+// openCandidate will open the ELF object of the candidate
+func (s *SymbolStore) openCandidate(c Candidate) (*elfObject, error) {
+	if c.Reader == nil {
+		return s.openFile(c.Path)
+	}
+	obj, err := newObject(c.Reader)
+	if err != nil {
+		return nil, err
+	}
+	obj.virtual = true
+	return obj, nil
+}
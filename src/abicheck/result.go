@@ -0,0 +1,298 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"encoding/json"
+)
+
+// LibraryResult records where a DT_NEEDED entry was satisfied from
+type LibraryResult struct {
+	Name string `json:"name"`
+	Path string `json:"path,omitempty"` // Empty when the library wasn't found
+
+	// Unused is set when the object imports no symbols from the library,
+	// meaning the DT_NEEDED entry could be dropped (like ldd -u)
+	Unused bool `json:"unused,omitempty"`
+
+	// Soname is only set when Name is the development symlink of the
+	// library found, being what should have been needed instead
+	Soname string `json:"soname,omitempty"`
+}
+
+// IncompatibleLibrary records a candidate for a DT_NEEDED entry that was
+// skipped because it was built for another machine
+type IncompatibleLibrary struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Machine string `json:"machine"`
+	Class   string `json:"class,omitempty"`
+	OS      string `json:"os,omitempty"`  // OSABI, when not that of the importer
+	ABI     string `json:"abi,omitempty"` // How its e_flags disagree, see abiMismatch
+}
+
+// UnreadableObject records an object that couldn't be parsed, and why
+type UnreadableObject struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// SymbolResult records how a single imported symbol was bound
+type SymbolResult struct {
+	Name     string `json:"name"`
+	Version  string `json:"version,omitempty"`
+	Weak     bool   `json:"weak,omitempty"`
+	Provider string `json:"provider,omitempty"` // Empty when unresolved
+
+	// ProviderPath is where the providing library was loaded from
+	ProviderPath string `json:"provider_path,omitempty"`
+
+	// Interposed lists the later objects in the process scope that also
+	// define the symbol, but lose out to Provider
+	Interposed []string `json:"interposed,omitempty"`
+
+	// Underlinked is set when none of the importer's own DT_NEEDED entries
+	// provide the symbol, and it only resolved through another library
+	Underlinked bool `json:"underlinked,omitempty"`
+
+	// Executable is set when the provider is an executable being checked
+	// alongside the object, expected to load it as a plugin
+	Executable bool `json:"executable,omitempty"`
+
+	// Copy is set when the reference is a copy relocation, where the
+	// executable holds its own copy of the provider's data
+	Copy bool `json:"copy,omitempty"`
+
+	// Private is set when the version is reserved for the internals of
+	// the providing library, such as GLIBC_PRIVATE
+	Private bool `json:"private,omitempty"`
+
+	// Source is only set for unresolved symbols, when debug info was found
+	// for the importer (see SetDebugInfo)
+	Source *SymbolSource `json:"source,omitempty"`
+}
+
+// DuplicateSymbol is a symbol defined by more than one object within the same
+// process scope. Only the first provider is ever bound against.
+type DuplicateSymbol struct {
+	Name      string   `json:"name"`
+	Version   string   `json:"version,omitempty"`
+	Providers []string `json:"providers"` // In scope order
+}
+
+// ObjectResult records how a single object within the process space was
+// resolved, whether it was a scan target or one of the libraries loaded
+// on its behalf.
+type ObjectResult struct {
+	Path        string          `json:"path"`
+	Target      bool            `json:"target"`
+	Machine     string          `json:"machine"`
+	Class       string          `json:"class"`
+	Soname      string          `json:"soname,omitempty"`
+	SearchPaths []string        `json:"search_paths"`
+	Libraries   []LibraryResult `json:"libraries"`
+	Symbols     []SymbolResult  `json:"symbols"`
+	Failures    []error         `json:"-"`
+
+	Incompatible []IncompatibleLibrary `json:"incompatible,omitempty"`
+
+	// Filtees are the objects this filter library defers to
+	Filtees []LibraryResult `json:"filtees,omitempty"`
+
+	// Dlopened is only set for targets, listing where each library it is
+	// expected to dlopen was found (see SetDlopenManifest)
+	Dlopened []LibraryResult `json:"dlopened,omitempty"`
+
+	// Preloaded is only set for targets, listing where each object from
+	// SetPreload or ld.so.preload was found
+	Preloaded []LibraryResult `json:"preloaded,omitempty"`
+
+	// Cycles lists each dependency cycle this object closes, by needing an
+	// object that loaded it, from that object back around to itself
+	Cycles [][]string `json:"cycles,omitempty"`
+
+	// Duplicates is only set for targets, when duplicate detection is
+	// enabled, and covers the target's whole process scope
+	Duplicates []DuplicateSymbol `json:"duplicates,omitempty"`
+
+	// DynamicLoading is only set for targets that load objects at runtime
+	DynamicLoading *DynamicLoading `json:"dynamic_loading,omitempty"`
+
+	// Stale is only set for the executable of a process checked with
+	// CheckProcess, listing each object it maps that has since been
+	// deleted or replaced on disk
+	Stale []MappedObject `json:"stale,omitempty"`
+
+	// Impure lists each reference to outside the pure store, when one is
+	// set with SetPureStore
+	Impure []ImpurePath `json:"impure,omitempty"`
+
+	// Host lists each library taken from the host that should have been
+	// bundled, when checking with SetSelfContained. Each is a failure too.
+	Host []LibraryResult `json:"host,omitempty"`
+
+	// Unreadable lists each object too malformed to parse, this one
+	// included when it's the target
+	Unreadable []UnreadableObject `json:"unreadable,omitempty"`
+
+	// Features are the CPU features the object is marked with, and
+	// FeatureMismatches is only set for targets, listing where their
+	// process scope disagrees. Both need SetReportFeatures.
+	Features          *CPUFeatures      `json:"features,omitempty"`
+	FeatureMismatches []FeatureMismatch `json:"feature_mismatches,omitempty"`
+
+	// Shadowed lists each library found in more than one place, when
+	// enabled with SetReportShadowed
+	Shadowed []ShadowedLibrary `json:"shadowed,omitempty"`
+
+	// TextRel is set when the object needs its text relocated
+	TextRel bool `json:"textrel,omitempty"`
+
+	// SonameProblem is set when the object is a shared library with a
+	// missing or misnamed DT_SONAME, explaining why
+	SonameProblem string `json:"soname_problem,omitempty"`
+
+	// Exports is only set for targets that are libraries, listing the name
+	// of each symbol they define for others to use
+	Exports []string `json:"-"`
+}
+
+// Unresolved returns each symbol which could not be bound to a provider
+func (o *ObjectResult) Unresolved() []SymbolResult {
+	var ret []SymbolResult
+	for _, sym := range o.Symbols {
+		if sym.Provider == "" {
+			ret = append(ret, sym)
+		}
+	}
+	return ret
+}
+
+// UnderlinkedSymbols returns each symbol that only resolved transitively,
+// through a library the object doesn't itself depend on.
+func (o *ObjectResult) UnderlinkedSymbols() []SymbolResult {
+	var ret []SymbolResult
+	for _, sym := range o.Symbols {
+		if sym.Underlinked {
+			ret = append(ret, sym)
+		}
+	}
+	return ret
+}
+
+// PrivateSymbols returns each symbol bound from a private version
+func (o *ObjectResult) PrivateSymbols() []SymbolResult {
+	var ret []SymbolResult
+	for _, sym := range o.Symbols {
+		if sym.Private {
+			ret = append(ret, sym)
+		}
+	}
+	return ret
+}
+
+// UnusedLibraries returns the name of each DT_NEEDED entry that the object
+// doesn't import any symbols from.
+func (o *ObjectResult) UnusedLibraries() []string {
+	var ret []string
+	for _, lib := range o.Libraries {
+		if lib.Unused {
+			ret = append(ret, lib.Name)
+		}
+	}
+	return ret
+}
+
+// Issues returns every problem found with the object, classified so that
+// a Policy can decide how each should be treated.
+func (o *ObjectResult) Issues() []Issue {
+	var ret []Issue
+	for _, err := range o.Failures {
+		ret = append(ret, Issue{Class: ClassOf(err), Err: err})
+	}
+	add := func(err Classified) {
+		ret = append(ret, Issue{Class: err.Class(), Err: err})
+	}
+	for _, lib := range o.Incompatible {
+		machine := lib.Machine
+		if lib.ABI != "" {
+			machine += " with " + lib.ABI
+		}
+		add(&ArchMismatchWarning{Importer: o.Path, Library: lib.Name, Path: lib.Path, Machine: machine})
+	}
+	for _, name := range o.UnusedLibraries() {
+		add(&UnusedLibraryWarning{Importer: o.Path, Library: name})
+	}
+	for _, sym := range o.UnderlinkedSymbols() {
+		add(&UnderlinkedSymbolWarning{Importer: o.Path, Symbol: sym.Name, Version: sym.Version, Provider: sym.Provider})
+	}
+	for _, sym := range o.PrivateSymbols() {
+		add(&PrivateSymbolWarning{Importer: o.Path, Symbol: sym.Name, Version: sym.Version, Provider: sym.Provider})
+	}
+	for _, cycle := range o.Cycles {
+		add(&DependencyCycleWarning{Importer: o.Path, Cycle: cycle})
+	}
+	if o.DynamicLoading != nil {
+		add(&DynamicLoadingWarning{Importer: o.Path, Loading: *o.DynamicLoading})
+	}
+	for _, obj := range o.Stale {
+		add(&StaleLibraryWarning{Importer: o.Path, Path: obj.Path, Replaced: obj.Replaced})
+	}
+	for _, ref := range o.Impure {
+		add(&ImpurePathWarning{Importer: o.Path, Path: ref.Path, Kind: ref.Kind})
+	}
+	for _, obj := range o.Unreadable {
+		add(&UnreadableObjectWarning{Importer: o.Path, Path: obj.Path, Reason: obj.Reason})
+	}
+	for _, m := range o.FeatureMismatches {
+		add(&CPUFeatureWarning{Importer: o.Path, Feature: m.Feature, Objects: m.Objects, CPU: m.CPU})
+	}
+	if o.TextRel {
+		add(&TextRelWarning{Importer: o.Path})
+	}
+	for _, lib := range o.Shadowed {
+		add(&ShadowedLibraryWarning{Importer: o.Path, Library: lib.Name, Path: lib.Path, Shadowed: lib.Shadowed})
+	}
+	if o.SonameProblem != "" {
+		add(&BadSonameWarning{Importer: o.Path, Soname: o.Soname, Problem: o.SonameProblem})
+	}
+	for _, lib := range o.Libraries {
+		if lib.Soname != "" {
+			add(&DevSymlinkWarning{Importer: o.Path, Library: lib.Name, Soname: lib.Soname})
+		}
+	}
+	for _, dup := range o.Duplicates {
+		add(&DuplicateSymbolWarning{Importer: o.Path, Symbol: dup.Name, Version: dup.Version, Providers: dup.Providers})
+	}
+	return ret
+}
+
+// MarshalJSON will emit the object with failures in their string form
+func (o *ObjectResult) MarshalJSON() ([]byte, error) {
+	type plainResult ObjectResult
+	failures := make([]string, 0, len(o.Failures))
+	for _, err := range o.Failures {
+		failures = append(failures, err.Error())
+	}
+	return json.Marshal(&struct {
+		*plainResult
+		Failures []string `json:"failures"`
+	}{
+		plainResult: (*plainResult)(o),
+		Failures:    failures,
+	})
+}
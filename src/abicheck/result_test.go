@@ -0,0 +1,88 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"testing"
+)
+
+// failures holds an issue of every class recorded as a failure
+var failures = []Classified{
+	&MissingLibraryError{Importer: "/bin/a", Library: "libx.so.1"},
+	&DependencyDepthError{Importer: "/bin/a", Limit: 64},
+	&UnresolvedSymbolError{Importer: "/bin/a", Symbol: "x"},
+	&MissingVersionError{Importer: "/bin/a", Library: "libx.so.1", Version: "X_1"},
+	&HostLibraryError{Importer: "/app/bin/a", Library: "libx.so.1", Path: "/lib/libx.so.1"},
+	&ModversionMismatchError{Importer: "a.ko", Symbol: "x", Provider: "vmlinux"},
+	&CopyRelocationError{Importer: "/bin/a", Symbol: "x", Size: 8, Provider: "/lib/libx.so.1", ProviderSize: 16},
+	&SymbolTypeError{Importer: "/bin/a", Symbol: "x", Type: "function", Provider: "/lib/libx.so.1", ProviderType: "data"},
+}
+
+func TestNumFailures(t *testing.T) {
+	for _, err := range failures {
+		result := &Result{Path: "/bin/a", Objects: []*ObjectResult{
+			{Path: "/bin/a", Failures: []error{err}},
+			{Path: "/lib/libx.so.1"},
+		}}
+		if n := result.NumFailures(); n != 1 || result.OK() {
+			t.Errorf("%s: NumFailures() = %d, OK() = %v", err.Class(), n, result.OK())
+		}
+		issues := result.Objects[0].Issues()
+		if len(issues) != 1 || issues[0].Class != err.Class() {
+			t.Errorf("%s: Issues() = %v", err.Class(), issues)
+		}
+	}
+}
+
+// Everything an error by default has to count against the result, or a scan
+// would pass with errors in its report
+func TestErrorClassesAreFailures(t *testing.T) {
+	recorded := make(map[IssueClass]bool)
+	for _, err := range failures {
+		recorded[err.Class()] = true
+	}
+	policy := DefaultPolicy()
+	for _, class := range IssueClasses {
+		if policy.Severity(class) == SeverityError && !recorded[class] {
+			t.Errorf("%s is an error by default but no failure of it is tested", class)
+		}
+	}
+}
+
+func TestWarningsAreNotFailures(t *testing.T) {
+	obj := &ObjectResult{
+		Path:       "/bin/a",
+		Libraries:  []LibraryResult{{Name: "libx.so.1", Path: "/lib/libx.so.1", Unused: true}},
+		Cycles:     [][]string{{"/lib/libx.so.1", "/bin/a"}},
+		TextRel:    true,
+		Duplicates: []DuplicateSymbol{{Name: "x", Providers: []string{"/lib/libx.so.1", "/lib/liby.so.1"}}},
+	}
+	result := &Result{Path: "/bin/a", Objects: []*ObjectResult{obj}}
+	if n := result.NumFailures(); n != 0 || !result.OK() {
+		t.Errorf("NumFailures() = %d, OK() = %v", n, result.OK())
+	}
+	want := []IssueClass{IssueUnusedLibrary, IssueDependencyCycle, IssueTextRel, IssueDuplicateSymbol}
+	issues := obj.Issues()
+	if len(issues) != len(want) {
+		t.Fatalf("Issues() = %v, want classes %v", issues, want)
+	}
+	for i, issue := range issues {
+		if issue.Class != want[i] {
+			t.Errorf("issue %d is %s, want %s", i, issue.Class, want[i])
+		}
+	}
+}
@@ -0,0 +1,71 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// OpenRootfs will unpack a tarball or cpio archive, either of which may be
+// compressed, into a temporary root filesystem in the same way as OpenImage.
+// This covers release tarballs, build artifacts and the like, which should
+// hold everything they need except what's given by the system they're for.
+// A cpio archive may be a series of them, as in an initramfs.
+func OpenRootfs(file string) (*Image, error) {
+	fi, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	root, err := ioutil.TempDir("", "abicheck-rootfs-")
+	if err != nil {
+		return nil, err
+	}
+	img := &Image{Root: root}
+	if err := img.applyRootfs(bufio.NewReader(fi)); err != nil {
+		img.Close()
+		return nil, fmt.Errorf("failed to unpack %s: %v", file, err)
+	}
+	return img, nil
+}
+
+// applyRootfs will unpack the archive over the root. cpio archives are
+// unpacked as an initramfs would be, anything else is taken to be a tarball.
+func (i *Image) applyRootfs(r *bufio.Reader) error {
+	if isCpio(r) {
+		return i.applyInitramfs(r, true)
+	}
+	dr, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(dr)
+	if isCpio(br) {
+		return i.applyInitramfs(br, false)
+	}
+	return i.applyTar(br)
+}
+
+// isCpio determines whether the stream starts with a newc cpio header
+func isCpio(r *bufio.Reader) bool {
+	magic, _ := r.Peek(len(cpioNewcMagic))
+	return string(magic) == cpioNewcMagic || string(magic) == cpioCrcMagic
+}
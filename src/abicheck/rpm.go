@@ -0,0 +1,228 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+const (
+	rpmLeadSize     = 96
+	rpmHeaderMagic  = 0x8eade801
+	cpioNewcMagic   = "070701"
+	cpioCrcMagic    = "070702"
+	cpioHeaderSize  = 110
+	cpioMaxName     = 4096 // PATH_MAX, including the NUL
+	cpioTrailerName = "TRAILER!!!"
+	cpioModeType    = 0170000
+	cpioModeDir     = 0040000
+	cpioModeRegular = 0100000
+	cpioModeSymlink = 0120000
+)
+
+// rpmLeadMagic begins every RPM file
+var rpmLeadMagic = []byte{0xed, 0xab, 0xee, 0xdb}
+
+// errTruncatedRpm is returned when the file ends within its headers
+var errTruncatedRpm = errors.New("truncated RPM header")
+
+// errTruncatedCpio is returned when an archive ends before its trailer
+var errTruncatedCpio = errors.New("truncated cpio archive")
+
+// readRpm will read the cpio payload from the RPM package at path
+func readRpm(path string) (*Overlay, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	br := bufio.NewReader(fi)
+	lead := make([]byte, rpmLeadSize)
+	if _, err := io.ReadFull(br, lead); err != nil || !bytes.HasPrefix(lead, rpmLeadMagic) {
+		return nil, errors.New("not an RPM file")
+	}
+
+	// The signature header is padded to 8 bytes, the main header isn't
+	size, err := skipRpmHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if pad := (8 - size%8) % 8; pad > 0 {
+		if _, err := io.CopyN(io.Discard, br, pad); err == io.EOF {
+			return nil, errTruncatedRpm
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := skipRpmHeader(br); err != nil {
+		return nil, err
+	}
+
+	payload, err := decompress(br)
+	if err != nil {
+		return nil, err
+	}
+	overlay := NewOverlay()
+	if err := readCpio(overlay, payload); err != nil {
+		return nil, err
+	}
+	return overlay, nil
+}
+
+// skipRpmHeader will skip over a header structure, returning its size
+func skipRpmHeader(r io.Reader) (int64, error) {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(r, intro); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, errTruncatedRpm
+	} else if err != nil {
+		return 0, err
+	}
+	if binary.BigEndian.Uint32(intro[0:]) != rpmHeaderMagic {
+		return 0, errors.New("invalid RPM header")
+	}
+	nindex := int64(binary.BigEndian.Uint32(intro[8:]))
+	hsize := int64(binary.BigEndian.Uint32(intro[12:]))
+	body := nindex*16 + hsize
+	if _, err := io.CopyN(io.Discard, r, body); err == io.EOF {
+		return 0, errTruncatedRpm
+	} else if err != nil {
+		return 0, err
+	}
+	return 16 + body, nil
+}
+
+// cpioEntry is a single member of a "newc" format cpio archive
+type cpioEntry struct {
+	name  string
+	ino   int64
+	mode  int64
+	nlink int64
+	mtime int64
+	size  int64
+}
+
+// walkCpio will call fn with each member of the "newc" format cpio archive
+// and its contents, stopping after the trailer so that anything following
+// the archive is left in br.
+func walkCpio(br *bufio.Reader, fn func(*cpioEntry, io.Reader) error) error {
+	header := make([]byte, cpioHeaderSize)
+	field := func(n int) (int64, error) {
+		// Fields are 8 hex digits following the 6 byte magic
+		off := 6 + n*8
+		return strconv.ParseInt(string(header[off:off+8]), 16, 64)
+	}
+	pad := func(n int64) int64 {
+		return (4 - n%4) % 4
+	}
+
+	// Running out of data anywhere before the trailer is an error
+	truncated := func(err error) error {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errTruncatedCpio
+		}
+		return err
+	}
+
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			return truncated(err)
+		}
+		magic := string(header[0:6])
+		if magic != cpioNewcMagic && magic != cpioCrcMagic {
+			return fmt.Errorf("unsupported cpio format: %q", magic)
+		}
+		var entry cpioEntry
+		for _, f := range []struct {
+			n   int
+			val *int64
+		}{{0, &entry.ino}, {1, &entry.mode}, {4, &entry.nlink}, {5, &entry.mtime}, {6, &entry.size}} {
+			v, err := field(f.n)
+			if err != nil {
+				return err
+			}
+			*f.val = v
+		}
+		namesize, err := field(11)
+		if err != nil {
+			return err
+		}
+		if namesize > cpioMaxName {
+			return fmt.Errorf("cpio member name of %d bytes is too long", namesize)
+		}
+
+		name := make([]byte, namesize)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return truncated(err)
+		}
+		// Whatever pads the trailer is left for the caller, as archives
+		// needn't be padded at the end of the stream
+		entry.name = string(bytes.TrimRight(name, "\x00"))
+		if entry.name == cpioTrailerName {
+			return nil
+		}
+		if _, err := io.CopyN(io.Discard, br, pad(cpioHeaderSize+namesize)); err != nil {
+			return truncated(err)
+		}
+
+		data := &io.LimitedReader{R: br, N: entry.size}
+		if err := fn(&entry, data); err != nil {
+			return truncated(err)
+		}
+		// Drain anything left over along with the padding
+		if _, err := io.Copy(io.Discard, data); err != nil {
+			return err
+		}
+		if data.N > 0 {
+			return errTruncatedCpio
+		}
+		if _, err := io.CopyN(io.Discard, br, pad(entry.size)); err != nil {
+			return truncated(err)
+		}
+	}
+}
+
+// readCpio will add the contents of a "newc" format cpio archive to the
+// overlay
+func readCpio(overlay *Overlay, r io.Reader) error {
+	return walkCpio(bufio.NewReader(r), func(entry *cpioEntry, data io.Reader) error {
+		switch entry.mode & cpioModeType {
+		case cpioModeRegular:
+			contents, err := readELF(data)
+			if err != nil {
+				return err
+			}
+			if contents != nil {
+				overlay.AddFile(entry.name, contents)
+			}
+		case cpioModeSymlink:
+			target, err := io.ReadAll(data)
+			if err != nil {
+				return err
+			}
+			overlay.AddLink(entry.name, string(target))
+		}
+		return nil
+	})
+}
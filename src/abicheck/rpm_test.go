@@ -0,0 +1,194 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// testELF passes for an ELF object when reading packages, which only look
+// at the magic
+const testELF = "\x7fELF\x02\x01\x01"
+
+// testCpioEntry is a member of the test cpio archives
+type testCpioEntry struct {
+	name  string
+	mode  int64
+	ino   int64
+	nlink int64
+	data  string
+}
+
+// testCpioMembers are a library, a link to it, a directory and a file
+// that isn't an object
+var testCpioMembers = []testCpioEntry{
+	{name: "./usr/lib", mode: cpioModeDir | 0755},
+	{name: "./usr/lib/libfoo.so.1", mode: cpioModeRegular | 0755, data: testELF},
+	{name: "./usr/lib/libfoo.so", mode: cpioModeSymlink | 0777, data: "libfoo.so.1"},
+	{name: "./usr/share/doc/README", mode: cpioModeRegular | 0644, data: "hello"},
+}
+
+// cpioArchive returns a "newc" archive of the entries, ending in the trailer
+func cpioArchive(entries []testCpioEntry) []byte {
+	var b bytes.Buffer
+	pad := func() {
+		for b.Len()%4 != 0 {
+			b.WriteByte(0)
+		}
+	}
+	for _, e := range append(entries, testCpioEntry{name: cpioTrailerName}) {
+		nlink := e.nlink
+		if nlink == 0 {
+			nlink = 1
+		}
+		fmt.Fprintf(&b, "%s%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X", cpioNewcMagic,
+			e.ino, e.mode, 0, 0, nlink, 0, len(e.data), 0, 0, 0, 0, len(e.name)+1, 0)
+		b.WriteString(e.name)
+		b.WriteByte(0)
+		pad()
+		b.WriteString(e.data)
+		pad()
+	}
+	return b.Bytes()
+}
+
+// gzipped returns the data compressed with gzip
+func gzipped(data []byte) []byte {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write(data)
+	zw.Close()
+	return b.Bytes()
+}
+
+// rpmHeader returns a header structure with the given number of index
+// entries and size of data, all zeroed
+func rpmHeader(nindex, hsize uint32) []byte {
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint32(data, rpmHeaderMagic)
+	binary.BigEndian.PutUint32(data[8:], nindex)
+	binary.BigEndian.PutUint32(data[12:], hsize)
+	return append(data, make([]byte, int(nindex)*16+int(hsize))...)
+}
+
+// rpmPackage returns a package with a signature header holding sigSize
+// bytes of data, padded as rpm does, then the main header and the payload
+func rpmPackage(sigSize uint32, payload []byte) []byte {
+	data := make([]byte, rpmLeadSize)
+	copy(data, rpmLeadMagic)
+	data = append(data, rpmHeader(1, sigSize)...)
+	for len(data)%8 != 0 {
+		data = append(data, 0)
+	}
+	data = append(data, rpmHeader(3, 21)...)
+	return append(data, payload...)
+}
+
+// testFile will write the data to a temporary file of the given name,
+// returning its path
+func testFile(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// overlayContents returns the files and links of the overlay
+func overlayContents(o *Overlay) ([]string, map[string]string) {
+	var files []string
+	for name := range o.files {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return files, o.links
+}
+
+func TestReadRpm(t *testing.T) {
+	archive := cpioArchive(testCpioMembers)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		// Signatures of 5 bytes need 3 of padding, those of 8 none
+		{"padded signature", rpmPackage(5, gzipped(archive))},
+		{"aligned signature", rpmPackage(8, gzipped(archive))},
+		{"uncompressed payload", rpmPackage(5, archive)},
+		{"empty signature", rpmPackage(0, gzipped(archive))},
+	}
+	wantFiles := []string{"/usr/lib/libfoo.so.1"}
+	wantLinks := map[string]string{"/usr/lib/libfoo.so": "libfoo.so.1"}
+	for _, test := range tests {
+		overlay, err := readRpm(testFile(t, "foo-1.0-1.x86_64.rpm", test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		files, links := overlayContents(overlay)
+		if !reflect.DeepEqual(files, wantFiles) || !reflect.DeepEqual(links, wantLinks) {
+			t.Errorf("%s: got files %v, links %v", test.name, files, links)
+		}
+	}
+}
+
+func TestReadRpmInvalid(t *testing.T) {
+	valid := rpmPackage(5, gzipped(cpioArchive(testCpioMembers)))
+	badMagic := append([]byte(nil), valid...)
+	badMagic[rpmLeadSize] = 0
+	mainHeader := rpmLeadSize + 16 + 16 + 5 + 3
+	badMain := append([]byte(nil), valid...)
+	badMain[mainHeader] = 0
+	hugeIndex := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint32(hugeIndex[rpmLeadSize+8:], 0xffffffff)
+	hugeData := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint32(hugeData[mainHeader+12:], 0xffffffff)
+	archive := cpioArchive(testCpioMembers)
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "not an RPM file"},
+		{"truncated lead", valid[:rpmLeadSize-1], "not an RPM file"},
+		{"not an rpm", bytes.Repeat([]byte("x"), rpmLeadSize*2), "not an RPM file"},
+		{"no signature", valid[:rpmLeadSize], "truncated RPM header"},
+		{"bad signature magic", badMagic, "invalid RPM header"},
+		{"truncated signature intro", valid[:rpmLeadSize+8], "truncated RPM header"},
+		{"truncated signature", valid[:rpmLeadSize+20], "truncated RPM header"},
+		{"truncated padding", valid[:mainHeader-1], "truncated RPM header"},
+		{"bad header magic", badMain, "invalid RPM header"},
+		{"truncated header", valid[:mainHeader+20], "truncated RPM header"},
+		{"huge index count", hugeIndex, "truncated RPM header"},
+		{"huge data size", hugeData, "truncated RPM header"},
+		{"truncated payload", rpmPackage(5, archive[:len(archive)-20]), "truncated cpio archive"},
+		{"payload without trailer", rpmPackage(5, cpioArchive(nil)[:cpioHeaderSize]), "truncated cpio archive"},
+	}
+	for _, test := range tests {
+		if _, err := readRpm(testFile(t, "foo.rpm", test.data)); err == nil || err.Error() != test.err {
+			t.Errorf("%s: got %v, want %s", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+)
+
+// sarifSchema is the published schema of the SARIF version we emit
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// issueDescriptions are the SARIF rule descriptions of each issue class
+var issueDescriptions = map[IssueClass]string{
+	IssueUnresolvedSymbol:  "A symbol reference is not defined by any object in the process",
+	IssueMissingLibrary:    "A needed library could not be found",
+	IssueMissingVersion:    "A needed symbol version is not defined by the library",
+	IssueArchMismatch:      "A candidate library was built for another machine",
+	IssueUnusedLibrary:     "A needed library provides none of the symbols used",
+	IssueUnderlinkedSymbol: "A symbol is only provided through another object's dependencies",
+	IssueDuplicateSymbol:   "A symbol is defined by more than one object in the process",
+	IssuePrivateSymbol:     "A symbol is used from a version reserved for the library's own internals",
+	IssueDependencyCycle:   "Objects depend on each other, so can't be initialised in order",
+	IssueStaleLibrary:      "A process maps an object since deleted or replaced on disk",
+	IssueDynamicLoading:    "An object loads libraries at runtime, which DT_NEEDED doesn't cover",
+	IssueImpurePath:        "An object refers to a path outside the pure Nix or Guix store",
+	IssueHostLibrary:       "A bundled object uses a library from the host it was expected to bundle",
+	IssueModversion:        "A kernel module was built against another version of a symbol",
+	IssueUnreadableObject:  "An ELF object is truncated or otherwise too malformed to read",
+	IssueBadSoname:         "A shared library has no DT_SONAME, or one not matching its file name",
+	IssueDevSymlink:        "A DT_NEEDED entry names the development symlink of a library",
+	IssueShadowedLibrary:   "A library is found in more than one directory of the search path",
+	IssueCPUFeature:        "A process loses CET or BTI protection, or needs a newer CPU than the one checked for",
+	IssueCopyRelocation:    "An executable copies library data into space sized for a different version of it",
+	IssueSymbolType:        "A reference is bound to a definition of another kind, such as a function that became a variable",
+	IssueTextRel:           "An object needs relocations applied to its read-only text",
+}
+
+// SARIF 2.1.0 document, cut down to the parts we fill in
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string       `json:"id"`
+	ShortDescription     sarifMessage `json:"shortDescription"`
+	DefaultConfiguration sarifConfig  `json:"defaultConfiguration"`
+}
+
+type sarifConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// sarifLevel maps a severity to the SARIF result level
+func sarifLevel(s Severity) string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarn:
+		return "warning"
+	default:
+		return "none"
+	}
+}
+
+// sarifURI returns the artifact URI for the path. Relative paths are kept
+// relative, so that code scanning can match them against the repository.
+func sarifURI(path string) string {
+	path = filepath.ToSlash(path)
+	if filepath.IsAbs(path) {
+		return (&url.URL{Scheme: "file", Path: path}).String()
+	}
+	return (&url.URL{Path: path}).String()
+}
+
+// SARIFReporter emits every issue the policy doesn't ignore as a SARIF 2.1.0
+// log, with the object it was found in as the artifact location
+type SARIFReporter struct {
+	progress
+	out    io.Writer
+	policy Policy
+}
+
+// NewSARIFReporter returns a SARIFReporter writing the log to out, and
+// progress to the progress writer, which may be nil
+func NewSARIFReporter(out, progressOut io.Writer, policy Policy) *SARIFReporter {
+	return &SARIFReporter{
+		progress: progress{w: progressOut},
+		out:      out,
+		policy:   policy,
+	}
+}
+
+// Complete writes the log
+func (r *SARIFReporter) Complete(results []*Result) error {
+	run := sarifRun{
+		Tool: sarifTool{
+			Driver: sarifDriver{Name: "runtime-abi-check"},
+		},
+		Results: []sarifResult{},
+	}
+	ruleIndex := make(map[IssueClass]int)
+	for i, class := range IssueClasses {
+		ruleIndex[class] = i
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:                   string(class),
+			ShortDescription:     sarifMessage{Text: issueDescriptions[class]},
+			DefaultConfiguration: sarifConfig{Level: sarifLevel(r.policy.Severity(class))},
+		})
+	}
+
+	for _, obj := range objectsOf(results) {
+		for _, issue := range obj.Issues() {
+			severity := r.policy.Severity(issue.Class)
+			if severity == SeverityIgnore {
+				continue
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    string(issue.Class),
+				RuleIndex: ruleIndex[issue.Class],
+				Level:     sarifLevel(severity),
+				Message:   sarifMessage{Text: issue.Err.Error()},
+				Locations: []sarifLocation{{
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{URI: sarifURI(obj.Path)},
+					},
+				}},
+			})
+		}
+	}
+
+	enc := json.NewEncoder(r.out)
+	enc.SetIndent("", "    ")
+	return enc.Encode(&sarifLog{
+		Version: "2.1.0",
+		Schema:  sarifSchema,
+		Runs:    []sarifRun{run},
+	})
+}
@@ -0,0 +1,1120 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"context"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// processScope is the global scope of a single simulated process. Objects
+// appear in the order ld.so would load them: the executable first, then
+// its DT_NEEDED entries in order, then theirs, breadth first. Symbol
+// references are bound to the first object in the scope that defines them.
+type processScope struct {
+	ctx     context.Context // Of the scan building the scope
+	entries []*scopeEntry
+	names   map[string]*scopeEntry // Every name an object is known by
+	paths   map[string]*scopeEntry // Real path of each object
+
+	// definers maps each symbol name to the entries defining it, in scope
+	// order, so binding doesn't have to ask every object in turn. It is
+	// only built by indexDefiners when that is worth it.
+	definers map[string][]*scopeEntry
+
+	// libc is that of the process, see SetLibc
+	libc string
+
+	// nativeDir is where an Android app's native libraries were found,
+	// when the target is one of them
+	nativeDir string
+
+	// lazy binds each reference to the first definition found, so that
+	// objects later in the scope need never be read (see SetLazy)
+	lazy bool
+}
+
+// indexCost is roughly how many library lookups indexing a single export
+// costs, as building the index means visiting every one of them
+const indexCost = 8
+
+// scopeEntry is a single object within a process scope
+type scopeEntry struct {
+	lib  *Library
+	path string // Path the object was found at
+
+	// inherited is the DT_RPATH of the chain of objects that loaded
+	// this one, nearest loader first
+	inherited []string
+
+	// deps holds the entry satisfying each DT_NEEDED, nil when missing
+	deps []*scopeEntry
+
+	// filtees are the loaded DT_FILTER and DT_AUXILIARY objects, which
+	// sit just before the filter in the scope
+	filtees []*scopeEntry
+
+	// result is nil when another scan has already reported the object
+	result *ObjectResult
+
+	// parent is the object that first needed this one, nil for the target
+	// and the objects every process has, and hops is how many DT_NEEDED
+	// links away from the target it is
+	parent *scopeEntry
+	hops   int
+}
+
+// maxNeededHops stops pathological dependency chains from growing the scope
+// without end. Real systems don't come anywhere near this.
+const maxNeededHops = 128
+
+// cycleTo returns the names along the dependency chain from dep down to the
+// entry, if dep is the entry itself or one of the objects that loaded it,
+// meaning that the entry needing dep closes a cycle.
+func (e *scopeEntry) cycleTo(dep *scopeEntry) []string {
+	var chain []string
+	for cur := e; cur != nil; cur = cur.parent {
+		chain = append(chain, cur.lib.Name)
+		if cur == dep {
+			// Walked upwards, so flip it around to read in load order
+			for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+				chain[i], chain[j] = chain[j], chain[i]
+			}
+			return append(chain, dep.lib.Name)
+		}
+	}
+	return nil
+}
+
+// newProcessScope will return an empty scope for the scan
+func newProcessScope(ctx context.Context) *processScope {
+	return &processScope{
+		ctx:   ctx,
+		names: make(map[string]*scopeEntry),
+		paths: make(map[string]*scopeEntry),
+	}
+}
+
+// add will append the object to the scope, known by the given names
+func (p *processScope) add(entry *scopeEntry, real string, names ...string) {
+	p.entries = append(p.entries, entry)
+	p.paths[real] = entry
+	p.definers = nil
+	for _, name := range names {
+		if _, ok := p.names[name]; name != "" && !ok {
+			p.names[name] = entry
+		}
+	}
+}
+
+// alias will make the entry known by another name too
+func (p *processScope) alias(entry *scopeEntry, name string) {
+	if _, ok := p.names[name]; !ok {
+		p.names[name] = entry
+	}
+}
+
+// searchRpaths returns the DT_RPATH directories searched for the entry's
+// dependencies. Like ld.so, the DT_RPATH of the object and its loaders is
+// only used when the object itself has no DT_RUNPATH.
+func (e *scopeEntry) searchRpaths() []string {
+	if len(e.lib.runpaths) > 0 {
+		return nil
+	}
+	return append(append([]string(nil), e.lib.rpaths...), e.inherited...)
+}
+
+// runpaths returns the DT_RUNPATH directories searched for the entry's
+// dependencies, followed by the directory of the native libraries of an
+// Android app, which find each other there
+func (p *processScope) runpaths(entry *scopeEntry) []string {
+	if p.nativeDir == "" {
+		return entry.lib.runpaths
+	}
+	return append(append([]string(nil), entry.lib.runpaths...), p.nativeDir)
+}
+
+// chain returns the DT_RPATH directories inherited by the entry's own
+// dependencies
+func (e *scopeEntry) chain() []string {
+	return append(append([]string(nil), e.lib.rpaths...), e.inherited...)
+}
+
+// loadedLibrary returns the library already loaded from the given path for
+// the machine, waiting for it to be ready, or nil if there isn't one.
+func (s *SymbolStore) loadedLibrary(path string, m elf.Machine) *Library {
+	real := s.realPath(path)
+	s.mu.RLock()
+	lib, ok := s.objects[m][real]
+	s.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	lib.wait()
+	return lib
+}
+
+// loadLibrary will load the object found at path into the store, unless it
+// was already loaded from the same real path. file is closed by the caller.
+func (s *SymbolStore) loadLibrary(path string, file *elfObject) (*Library, error) {
+	real := s.realPath(path)
+	m := file.FileHeader.Machine
+
+	s.mu.Lock()
+	bucket := s.objectBucket(m)
+	if lib, ok := bucket[real]; ok {
+		s.mu.Unlock()
+		lib.wait()
+		return lib, lib.err
+	}
+	lib := NewLibrary(filepath.Base(path), "")
+	bucket[real] = lib
+	s.mu.Unlock()
+
+	// Other scans may be waiting on us, so never leave them hanging
+	defer lib.markReady()
+	if err := s.populateLibrary(lib, path, file); err != nil {
+		lib.err = &malformedError{err: err}
+		return lib, lib.err
+	}
+	return lib, nil
+}
+
+// populateLibrary will fill in the library from the object at path
+func (s *SymbolStore) populateLibrary(lib *Library, path string, file *elfObject) error {
+	if err := checkSections(file.File); err != nil {
+		return err
+	}
+	var err error
+
+	lib.Soname = soname(file)
+	if lib.Soname != "" {
+		lib.Name = lib.Soname
+	}
+	lib.arch = file.arch
+	lib.shared = file.isSharedLibrary()
+	lib.features = readCPUFeatures(file)
+	lib.textrel = hasTextRel(file)
+	if lib.interp, err = interpreter(file.File); err != nil {
+		return err
+	}
+
+	// Figure out who we actually import
+	if lib.needed, err = file.ImportedLibraries(); err != nil {
+		return err
+	}
+	if lib.filters, err = filterNames(file, elf.DT_FILTER); err != nil {
+		return err
+	}
+	if lib.auxiliary, err = filterNames(file, elf.DT_AUXILIARY); err != nil {
+		return err
+	}
+
+	// Work out where our dependencies may be found. DT_RUNPATH presence
+	// means DT_RPATH is entirely ignored for this object.
+	if lib.runpaths, err = s.dynamicPaths(path, file, elf.DT_RUNPATH); err != nil {
+		return err
+	}
+	if len(lib.runpaths) == 0 {
+		if lib.rpaths, err = s.dynamicPaths(path, file, elf.DT_RPATH); err != nil {
+			return err
+		}
+	}
+
+	lib.Path = path
+
+	// Find out what we actually expose.. Lazy libraries are opened again
+	// when first asked, which can't be done for those only in memory.
+	if s.lazy && !file.virtual {
+		lib.load = func() {
+			file, err := s.openFile(path)
+			if err == nil {
+				lib.tables, err = s.symbolTables(path, file)
+				file.Close()
+			}
+			if err != nil {
+				s.emit(&ErrorEvent{Err: fmt.Errorf("failed to read symbols of %s: %v", path, err)})
+				lib.tables = &SymbolTables{}
+			}
+			s.storeSymbols(lib, lib.tables)
+		}
+		return nil
+	}
+	if lib.tables, err = s.symbolTables(path, file); err != nil {
+		return err
+	}
+	s.storeSymbols(lib, lib.tables)
+	return nil
+}
+
+// claimResult will create the result for the object at path, unless another
+// scan already reported the library. Targets are always reported.
+func (s *SymbolStore) claimResult(lib *Library, path string, target bool) *ObjectResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lib.reported && !target {
+		return nil
+	}
+	if s.lazy && !target {
+		return nil
+	}
+	lib.reported = true
+	result := &ObjectResult{
+		Path:    path,
+		Target:  target,
+		Machine: lib.arch.Machine.String(),
+		Class:   lib.arch.Class.String(),
+		Soname:  lib.Soname,
+	}
+	if target && (lib.shared || lib.Soname != "") {
+		result.Exports = exportNames(lib.loadedTables())
+	}
+	if s.reportFeatures {
+		result.Features = lib.features
+	}
+	s.results = append(s.results, result)
+	return result
+}
+
+// ScanPath will attempt to scan an input file and work out symbol resolution
+func (s *SymbolStore) ScanPath(path string) error {
+	return s.ScanPathContext(context.Background(), path)
+}
+
+// ScanPathContext is ScanPath, giving up with the context's error once it is
+// done, such as on a timeout
+func (s *SymbolStore) ScanPathContext(ctx context.Context, path string) error {
+	s.config.RLock()
+	defer s.config.RUnlock()
+	_, err := s.scanPath(ctx, path)
+	return err
+}
+
+// scanPath will build the process scope for the target at path and resolve
+// it, returning the results for the target and each object newly loaded
+// on its behalf, in load order. The caller must hold the config lock for
+// reading.
+func (s *SymbolStore) scanPath(ctx context.Context, path string) ([]*ObjectResult, error) {
+	return s.scanTarget(ctx, path, 0)
+}
+
+// scanTarget does the work of scanPath. Linker scripts aren't something
+// ld.so can load, so each of the objects they name is scanned instead.
+func (s *SymbolStore) scanTarget(ctx context.Context, path string, depth int) ([]*ObjectResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	file, err := s.openFile(path)
+	if err != nil {
+		inputs, ok := s.linkerScript(path)
+		if !ok || depth >= maxScriptDepth {
+			// Only failing to read the file at all is fatal: an explicit
+			// target that isn't ELF is reported and the rest still checked
+			var bad *malformedError
+			var failed *fs.PathError
+			switch {
+			case errors.As(err, &bad):
+				return s.unreadableTarget(path, err), nil
+			case !errors.As(err, &failed):
+				return s.unreadableTarget(path, errNotObject), nil
+			}
+			return nil, err
+		}
+		s.emit(&LinkerScriptEvent{Path: path})
+		var results []*ObjectResult
+		for _, p := range s.scriptPaths(path, inputs, Arch{}) {
+			objects, err := s.scanTarget(ctx, p, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, objects...)
+		}
+		return results, nil
+	}
+	dlopened := s.dlopenNames(path, file)
+	lib, err := s.loadLibrary(path, file)
+	if err != nil {
+		file.Close()
+		return s.unreadableTarget(path, err), nil
+	}
+	loading := dynamicLoading(lib, file)
+	file.Close()
+
+	scope := newProcessScope(ctx)
+	scope.libc = s.libcOf(lib)
+	scope.lazy = s.lazy
+	if scope.libc == LibcBionic && lib.interp == "" {
+		scope.nativeDir = filepath.Dir(path)
+	}
+	root := &scopeEntry{
+		lib:    lib,
+		path:   path,
+		result: s.claimResult(lib, path, true),
+	}
+	if loading != nil && root.result != nil {
+		if warning := (&DynamicLoadingWarning{Importer: path, Loading: *loading}); !s.ignored(warning) {
+			root.result.DynamicLoading = loading
+			s.emit(warning)
+		}
+	}
+	scope.add(root, s.realPath(path), lib.Soname, path)
+	if err := s.loadPreloaded(scope, root); err != nil {
+		return nil, err
+	}
+
+	// Breadth first, as entries are appended while we walk. Only the
+	// dynamic section of each object is needed to place it, so lazy
+	// libraries leave their symbols until a lookup reaches them.
+	i := 0
+	for ; i < len(scope.entries); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := s.loadNeeded(scope, scope.entries[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// ld.so is always part of the process, after everything else, and
+	// provides the likes of __tls_get_addr and _dl_argv itself
+	if err := s.loadInterpreter(scope, root); err != nil {
+		return nil, err
+	}
+	// Then whatever it dlopens once running, with their own dependencies
+	if err := s.loadDlopened(scope, root, dlopened); err != nil {
+		return nil, err
+	}
+	for ; i < len(scope.entries); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := s.loadNeeded(scope, scope.entries[i]); err != nil {
+			return nil, err
+		}
+	}
+	s.addVDSO(scope, root)
+
+	if s.reportDuplicates && root.result != nil {
+		root.result.Duplicates = scope.duplicates()
+		s.dropIgnored(root.result)
+		for _, dup := range root.result.Duplicates {
+			s.emit(&DuplicateSymbolWarning{Importer: path, Symbol: dup.Name, Version: dup.Version, Providers: dup.Providers})
+		}
+	}
+
+	if s.reportFeatures && root.result != nil {
+		for _, m := range s.featureMismatches(scope) {
+			warning := &CPUFeatureWarning{Importer: path, Feature: m.Feature, Objects: m.Objects, CPU: m.CPU}
+			if s.ignored(warning) {
+				continue
+			}
+			root.result.FeatureMismatches = append(root.result.FeatureMismatches, m)
+			s.emit(warning)
+		}
+	}
+
+	if root.result != nil {
+		for _, issue := range copyMismatches(scope, root) {
+			s.addFailure(root.result, issue)
+		}
+	}
+
+	references := 0
+	for _, entry := range scope.entries {
+		if entry.result != nil {
+			references += len(entry.lib.loadedTables().Imports)
+		}
+	}
+	if !scope.lazy {
+		scope.indexDefiners(references)
+	}
+
+	var results []*ObjectResult
+	for _, entry := range scope.entries {
+		if entry.result == nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		s.resolveEntry(scope, entry)
+		results = append(results, entry.result)
+	}
+	return results, nil
+}
+
+// unreadableTarget returns the result for a target that couldn't be read,
+// so that checking a whole tree carries on past it
+func (s *SymbolStore) unreadableTarget(path string, err error) []*ObjectResult {
+	result := &ObjectResult{
+		Path:   path,
+		Target: true,
+	}
+	s.mu.Lock()
+	s.results = append(s.results, result)
+	s.mu.Unlock()
+	s.addUnreadable(result, path, err)
+	return []*ObjectResult{result}
+}
+
+// addUnreadable will record that the object at path couldn't be read, on
+// behalf of the result, unless the ignore list covers it
+func (s *SymbolStore) addUnreadable(result *ObjectResult, path string, err error) {
+	warning := &UnreadableObjectWarning{Importer: result.Path, Path: path, Reason: err.Error()}
+	if s.ignored(warning) {
+		return
+	}
+	result.Unreadable = append(result.Unreadable, UnreadableObject{Path: path, Reason: warning.Reason})
+	s.emit(warning)
+}
+
+// addMissing will record why satisfy couldn't find the object, of the given
+// kind, on behalf of the result
+func (s *SymbolStore) addMissing(result *ObjectResult, err error, kind string) {
+	var unreadable *unreadableError
+	if errors.As(err, &unreadable) {
+		s.addUnreadable(result, unreadable.path, unreadable.err)
+		return
+	}
+	s.addFailure(result, missingLibrary(err, kind))
+}
+
+// loadNeeded will satisfy each DT_NEEDED entry of the object, appending any
+// newly loaded objects to the end of the scope.
+func (s *SymbolStore) loadNeeded(scope *processScope, entry *scopeEntry) error {
+	result := entry.result
+	if s.maxDepth > 0 && entry.hops >= s.maxDepth {
+		return nil
+	}
+	if entry.hops >= maxNeededHops && len(entry.lib.needed) > 0 {
+		if result != nil {
+			s.addFailure(result, &DependencyDepthError{Importer: entry.path, Limit: maxNeededHops})
+		}
+		return nil
+	}
+	for _, name := range entry.lib.needed {
+		dep, found, err := s.satisfy(scope, entry, name, 0)
+		if !found {
+			entry.deps = append(entry.deps, nil)
+			if result != nil {
+				result.Libraries = append(result.Libraries, LibraryResult{Name: name})
+				s.addMissing(result, err, "")
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		entry.deps = append(entry.deps, dep)
+		if result != nil {
+			result.Libraries = append(result.Libraries, LibraryResult{Name: name, Path: dep.path})
+		}
+	}
+	return nil
+}
+
+// loadInterpreter will add the PT_INTERP of the target to the end of the
+// scope, unless it's already been loaded as a dependency. The interpreter
+// path is absolute, so it's only ever looked for within the sysroot.
+//
+// Libraries with a DT_SONAME that can also be run, such as libc.so.6, are
+// normally loaded by another program, so the interpreter only has to exist
+// for real executables.
+func (s *SymbolStore) loadInterpreter(scope *processScope, root *scopeEntry) error {
+	if root.lib.interp == "" {
+		return nil
+	}
+	name := root.lib.interp
+	lib, file, path, err := s.fromCandidates(root.result, root.path, name, root.lib.arch, pathCandidates(s.interpreterPaths(name, root.lib.arch)))
+	if err != nil {
+		if root.result != nil && root.lib.Soname == "" {
+			s.addMissing(root.result, err, "interpreter")
+		}
+		return nil
+	}
+	if file != nil {
+		lib, err = s.loadLibrary(path, file)
+		file.Close()
+	} else if lib.err != nil {
+		err = lib.err
+	}
+	if err != nil {
+		if root.result != nil {
+			s.addUnreadable(root.result, path, err)
+		}
+		return nil
+	}
+
+	real := s.realPath(path)
+	if dep, ok := scope.paths[real]; ok {
+		scope.alias(dep, name)
+		return nil
+	}
+	scope.add(&scopeEntry{
+		lib:    lib,
+		path:   path,
+		result: s.claimResult(lib, path, false),
+	}, real, name, lib.Soname, path)
+	return nil
+}
+
+// checkCycle will record the dependency cycle closed by entry needing dep,
+// if there is one. ld.so copes with these fine, but they mean neither
+// object can be initialised first, so are worth knowing about.
+func (s *SymbolStore) checkCycle(entry, dep *scopeEntry) {
+	cycle := entry.cycleTo(dep)
+	if cycle == nil || entry.result == nil {
+		return
+	}
+	entry.result.Cycles = append(entry.result.Cycles, cycle)
+	if warning := (&DependencyCycleWarning{Importer: entry.path, Cycle: cycle}); !s.ignored(warning) {
+		s.emit(warning)
+	}
+}
+
+// unreadableError is what satisfy fails with when the object it found at
+// path couldn't be read
+type unreadableError struct {
+	path string
+	err  error
+}
+
+func (e *unreadableError) Error() string { return e.path + ": " + e.err.Error() }
+
+func (e *unreadableError) Unwrap() error { return e.err }
+
+// missingLibrary returns the *MissingLibraryError that satisfy failed with,
+// marked as being for the given kind of object
+func missingLibrary(err error, kind string) *MissingLibraryError {
+	var missing *MissingLibraryError
+	errors.As(err, &missing)
+	missing.Kind = kind
+	return missing
+}
+
+// maxFilterDepth stops filters naming each other from recursing forever
+const maxFilterDepth = 8
+
+// satisfy will find the object known as name on behalf of entry, adding it
+// to the scope if it isn't already there. found is false when the object
+// couldn't be located or read at all, with err saying why, otherwise err is
+// set when the search itself failed.
+func (s *SymbolStore) satisfy(scope *processScope, entry *scopeEntry, name string, depth int) (dep *scopeEntry, found bool, err error) {
+	// Objects are matched by any name they're already known by
+	if dep, ok := scope.names[name]; ok {
+		s.emit(&LibraryReusedEvent{Name: name})
+		s.checkCycle(entry, dep)
+		return dep, true, nil
+	}
+
+	// musl's libc is also its libpthread, libm and so on, and the loader
+	lookup := name
+	if scope.libc == LibcMusl && muslReserved(name) {
+		lookup = muslLoader(entry.lib.arch)
+	}
+	// ld.so is always loaded first, so libc finds it by name even when it
+	// isn't on any search path, as is the way in a pure store
+	if interp := scope.entries[0].lib.interp; s.pureStore != "" && interp != "" && name == filepath.Base(interp) {
+		lookup = interp
+	}
+
+	// Try and find the relevant guy. Basically, its an ELF and machine is matched
+	ctx := &ResolveContext{
+		Context:  scope.ctx,
+		Importer: entry.path,
+		Arch:     entry.lib.arch,
+		Rpaths:   entry.searchRpaths(),
+		Runpaths: scope.runpaths(entry),
+		Libc:     scope.libc,
+	}
+	lib, file, path, err := s.locateLibrary(entry.result, lookup, ctx)
+	if err != nil {
+		var missing *MissingLibraryError
+		return nil, !errors.As(err, &missing), err
+	}
+	if file != nil {
+		lib, err = s.loadLibrary(path, file)
+		file.Close()
+	} else if lib.err != nil {
+		err = lib.err
+	}
+	if err != nil {
+		return nil, false, &unreadableError{path: path, err: err}
+	}
+	if s.reportShadowed && entry.result != nil {
+		s.checkShadowed(entry.result, name, lookup, path, lib, ctx)
+	}
+
+	// The same file may already be in the scope under another name
+	real := s.realPath(path)
+	if dep, ok := scope.paths[real]; ok {
+		s.emit(&LibraryReusedEvent{Name: name, As: dep.lib.Name})
+		scope.alias(dep, name)
+		s.checkCycle(entry, dep)
+		return dep, true, nil
+	}
+	dep = &scopeEntry{
+		lib:       lib,
+		path:      path,
+		inherited: entry.chain(),
+		parent:    entry,
+		hops:      entry.hops + 1,
+	}
+	// Objects at the depth limit don't get their own dependencies loaded,
+	// so can't be checked
+	if s.maxDepth == 0 || dep.hops < s.maxDepth {
+		dep.result = s.claimResult(lib, path, false)
+	}
+
+	// ld.so places filtees in front of their filter, so that their
+	// definitions are the ones bound against. musl has no filters.
+	if depth < maxFilterDepth && scope.libc != LibcMusl {
+		if err := s.loadFiltees(scope, dep, depth+1); err != nil {
+			return nil, true, err
+		}
+	}
+	scope.add(dep, real, name, lib.Soname, path)
+	return dep, true, nil
+}
+
+// loadFiltees will add the DT_FILTER and DT_AUXILIARY objects of the entry
+// to the scope. A standard filter is useless without its filtee, so failing
+// to find one is an error, whereas an auxiliary filter just falls back to
+// its own definitions.
+func (s *SymbolStore) loadFiltees(scope *processScope, entry *scopeEntry, depth int) error {
+	for _, name := range entry.lib.filters {
+		filtee, found, err := s.satisfy(scope, entry, name, depth)
+		if !found {
+			if entry.result != nil {
+				s.addMissing(entry.result, err, "filtee")
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		entry.filtees = append(entry.filtees, filtee)
+		if entry.result != nil {
+			entry.result.Filtees = append(entry.result.Filtees, LibraryResult{Name: name, Path: filtee.path})
+		}
+	}
+	for _, name := range entry.lib.auxiliary {
+		filtee, found, err := s.satisfy(scope, entry, name, depth)
+		if !found {
+			s.emit(&MissingAuxiliaryEvent{Filter: entry.path, Filtee: name})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		entry.filtees = append(entry.filtees, filtee)
+		if entry.result != nil {
+			entry.result.Filtees = append(entry.result.Filtees, LibraryResult{Name: name, Path: filtee.path})
+		}
+	}
+	return nil
+}
+
+// resolveEntry will bind every reference of the object against the scope,
+// recording the outcome in its result.
+func (s *SymbolStore) resolveEntry(scope *processScope, entry *scopeEntry) {
+	result := entry.result
+	tables := entry.lib.loadedTables()
+	result.SearchPaths = s.searchPaths(entry.lib.arch, entry.searchRpaths(), scope.runpaths(entry), scope.libc)
+
+	// Make sure our dependencies define the versions we were linked against
+	s.checkVersionNeeds(scope, result, tables)
+
+	// At this point, we'd resolve all symbols, in scope order
+	for i := range tables.Imports {
+		sym := &tables.Imports[i]
+		provider, interposed := scope.resolve(sym)
+		if provider != nil {
+			s.emit(&SymbolResolvedEvent{Importer: result.Path, Symbol: sym.Name, Version: sym.Version, Provider: provider.Name})
+			result.Symbols = append(result.Symbols, SymbolResult{
+				Name:         sym.Name,
+				Version:      sym.Version,
+				Weak:         sym.Weak(),
+				Provider:     provider.Name,
+				ProviderPath: provider.Path,
+				Interposed:   interposed,
+			})
+			s.checkType(scope, result, sym, provider)
+			continue
+		}
+
+		// Libraries scanned on their own may be plugins of an executable
+		if scope.entries[0].lib.shared {
+			if host := s.hostProvider(sym, entry.lib.arch); host != nil {
+				s.emit(&SymbolResolvedEvent{Importer: result.Path, Symbol: sym.Name, Version: sym.Version, Provider: host.Name})
+				result.Symbols = append(result.Symbols, SymbolResult{
+					Name:         sym.Name,
+					Version:      sym.Version,
+					Weak:         sym.Weak(),
+					Provider:     host.Name,
+					ProviderPath: host.Path,
+					Executable:   true,
+				})
+				continue
+			}
+		}
+		result.Symbols = append(result.Symbols, SymbolResult{
+			Name:    sym.Name,
+			Version: sym.Version,
+			Weak:    sym.Weak(),
+		})
+		// Weak references are allowed to remain unresolved
+		if sym.Weak() && !s.strictWeak {
+			s.emit(&WeakUnresolvedEvent{Importer: result.Path, Symbol: sym.Name, Version: sym.Version})
+			continue
+		}
+		s.addFailure(result, &UnresolvedSymbolError{
+			Symbol:   sym.Name,
+			Version:  sym.Version,
+			Binding:  sym.Binding,
+			Importer: result.Path,
+		})
+	}
+
+	// Copy relocations bind the executable's own definition to the data of
+	// a library, which is as much a use of it as any import
+	for i := range tables.Exports {
+		sym := &tables.Exports[i]
+		if !sym.Copy {
+			continue
+		}
+		if src, _ := copySource(scope, entry, sym); src != nil {
+			s.emit(&SymbolResolvedEvent{Importer: result.Path, Symbol: sym.Name, Version: sym.Version, Provider: src.lib.Name})
+			result.Symbols = append(result.Symbols, SymbolResult{
+				Name:         sym.Name,
+				Version:      sym.Version,
+				Provider:     src.lib.Name,
+				ProviderPath: src.lib.Path,
+				Copy:         true,
+			})
+		}
+	}
+
+	s.addSourceContext(result)
+	s.checkPurity(scope, entry)
+	s.checkContained(entry)
+	s.checkSonames(entry)
+	s.checkTextRel(entry)
+	markUnused(entry)
+	if entry.lib.shared {
+		markUnderlinked(entry)
+	}
+	s.markPrivate(entry)
+	s.dropIgnored(result)
+	for _, name := range result.UnusedLibraries() {
+		s.emit(&UnusedLibraryWarning{Importer: result.Path, Library: name})
+	}
+	for _, sym := range result.UnderlinkedSymbols() {
+		s.emit(&UnderlinkedSymbolWarning{Importer: result.Path, Symbol: sym.Name, Version: sym.Version, Provider: sym.Provider})
+	}
+	for _, sym := range result.PrivateSymbols() {
+		s.emit(&PrivateSymbolWarning{Importer: result.Path, Symbol: sym.Name, Version: sym.Version, Provider: sym.Provider})
+	}
+}
+
+// resolve will find the first object in the scope that defines the symbol,
+// just as ld.so does. The names of any later objects also defining it are
+// returned too, as their definitions are interposed by the provider. A
+// filter deferring to the provider doesn't count as being interposed.
+func (p *processScope) resolve(sym *ImportedSymbol) (provider *Library, interposed []string) {
+	entries := p.entries
+	if p.definers != nil {
+		entries = p.definers[sym.Name]
+	}
+	// musl ignores versions, binding to the default definition of the name
+	version := sym.Version
+	if p.libc == LibcMusl {
+		version = ""
+	}
+	for _, entry := range entries {
+		if !entry.lib.Provides(sym.Name, version) {
+			continue
+		}
+		if provider == nil {
+			provider = entry.lib
+			if p.lazy {
+				break
+			}
+			continue
+		}
+		if !entry.filtered(sym.Name, sym.Version) && entry.path != vdsoPath {
+			interposed = append(interposed, entry.lib.Name)
+		}
+	}
+	return provider, interposed
+}
+
+// indexDefiners will index the definitions within the complete scope, if
+// binding the given number of references would otherwise cost more. Most
+// scopes are small, or only hold a few objects not already reported by an
+// earlier scan, so asking each object in turn is cheaper.
+func (p *processScope) indexDefiners(references int) {
+	exports := 0
+	for _, entry := range p.entries {
+		exports += len(entry.lib.symbols)
+	}
+	if references*len(p.entries) <= exports*indexCost {
+		return
+	}
+	p.definers = make(map[string][]*scopeEntry)
+	for _, entry := range p.entries {
+		for name := range entry.lib.symbols {
+			p.definers[name] = append(p.definers[name], entry)
+		}
+	}
+}
+
+// filtered returns true if one of the entry's filtees defines the symbol,
+// in which case the entry's own definition is never used
+func (e *scopeEntry) filtered(name, version string) bool {
+	for _, filtee := range e.filtees {
+		if filtee.lib.Provides(name, version) {
+			return true
+		}
+	}
+	return false
+}
+
+// exportNames returns the sorted, unique names of every symbol the tables
+// export, leaving out those the linker defines in every object
+func exportNames(tables *SymbolTables) []string {
+	if tables == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var ret []string
+	for _, sym := range tables.Exports {
+		if linkerSymbols[sym.Name] || seen[sym.Name] {
+			continue
+		}
+		seen[sym.Name] = true
+		ret = append(ret, sym.Name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// linkerSymbols are defined by the linker in every object, so clash by design
+var linkerSymbols = map[string]bool{
+	"_init":       true,
+	"_fini":       true,
+	"_edata":      true,
+	"_end":        true,
+	"__bss_start": true,
+}
+
+// duplicates returns every symbol with a default definition in more than one
+// object within the scope. Weak definitions are expected to be overridden,
+// copy relocations in the executable are meant to shadow the library's copy,
+// filters exist to be shadowed by their filtees, IFUNC symbols are commonly
+// defined by several objects and GNU unique symbols (C++ inline statics and
+// the like) are merged by ld.so on purpose, so none of these are reported.
+// glibc also defines a few compatibility symbols in more than one of its
+// libraries, so GLIBC_* versions are skipped too.
+func (p *processScope) duplicates() []DuplicateSymbol {
+	type key struct {
+		name, version string
+	}
+	var order []key
+	providers := make(map[key][]string)
+	expected := make(map[key]bool)
+
+	for _, entry := range p.entries {
+		// libc wrapping the vDSO is the whole point of it
+		if entry.path == vdsoPath {
+			continue
+		}
+		exports := entry.lib.loadedTables().Exports
+		for i := range exports {
+			sym := &exports[i]
+			if sym.Hidden || sym.Copy || linkerSymbols[sym.Name] || strings.HasPrefix(sym.Version, "GLIBC_") {
+				continue
+			}
+			if entry.filtered(sym.Name, sym.Version) {
+				continue
+			}
+			k := key{sym.Name, sym.Version}
+			if sym.IFunc || sym.Unique {
+				expected[k] = true
+			}
+			if sym.Weak {
+				continue
+			}
+			if _, ok := providers[k]; !ok {
+				order = append(order, k)
+			}
+			providers[k] = append(providers[k], entry.lib.Name)
+		}
+	}
+
+	var ret []DuplicateSymbol
+	for _, k := range order {
+		if len(providers[k]) < 2 || expected[k] {
+			continue
+		}
+		ret = append(ret, DuplicateSymbol{
+			Name:      k.name,
+			Version:   k.version,
+			Providers: providers[k],
+		})
+	}
+	return ret
+}
+
+// checkVersionNeeds will ensure every version the object requires from its
+// dependencies is actually defined by them, as ld.so does at startup. Any
+// missing versions are recorded as failures.
+func (s *SymbolStore) checkVersionNeeds(scope *processScope, result *ObjectResult, tables *SymbolTables) {
+	// musl doesn't look at them at all
+	if scope.libc == LibcMusl {
+		return
+	}
+	for _, need := range tables.VersionNeeds {
+		dep, ok := scope.names[need.Library]
+		if !ok || !dep.lib.Versioned() {
+			continue
+		}
+		for _, version := range need.Versions {
+			if !dep.lib.HasVersion(version) {
+				s.addFailure(result, &MissingVersionError{Version: version, Library: need.Library, Importer: result.Path})
+			}
+		}
+	}
+}
+
+// markUnused will flag each located DT_NEEDED library that none of the
+// object's references were bound to, like ldd -u.
+func markUnused(entry *scopeEntry) {
+	used := make(map[string]bool)
+	for _, sym := range entry.result.Symbols {
+		if sym.ProviderPath != "" {
+			used[sym.ProviderPath] = true
+		}
+	}
+	for i := range entry.result.Libraries {
+		needed := &entry.result.Libraries[i]
+		if needed.Path == "" {
+			continue
+		}
+		needed.Unused = !used[needed.Path]
+
+		// A filter is in use whenever its filtees are
+		if dep := entry.deps[i]; dep != nil {
+			for _, filtee := range dep.filtees {
+				if used[filtee.path] {
+					needed.Unused = false
+				}
+			}
+		}
+	}
+}
+
+// markUnderlinked will flag each resolved symbol that none of the object's
+// own DT_NEEDED libraries provide. Such references only work because some
+// other object happened to pull the provider into the process, and will
+// break when linking with --no-copy-dt-needed-entries.
+func markUnderlinked(entry *scopeEntry) {
+	for i := range entry.result.Symbols {
+		sym := &entry.result.Symbols[i]
+		if sym.Provider == "" || sym.Executable {
+			continue
+		}
+		found := false
+		for _, dep := range entry.deps {
+			if dep != nil && dep.lib.Provides(sym.Name, sym.Version) {
+				found = true
+				break
+			}
+		}
+		sym.Underlinked = !found
+	}
+}
+
+// markPrivate will flag every bound symbol using a private version
+func (s *SymbolStore) markPrivate(entry *scopeEntry) {
+	for i := range entry.result.Symbols {
+		sym := &entry.result.Symbols[i]
+		if sym.Provider != "" {
+			sym.Private = s.isPrivateVersion(sym.Version, entry.lib.loadedTables())
+		}
+	}
+}
+
+// hostExecutable will load the object at path, returning it only if it's an
+// executable with dynamic exports that the libraries it loads could use.
+// The caller must hold the config lock for reading.
+func (s *SymbolStore) hostExecutable(path string) *Library {
+	file, err := s.openFile(path)
+	if err != nil {
+		return nil
+	}
+	lib, err := s.loadLibrary(path, file)
+	file.Close()
+	if err != nil || lib.shared || len(lib.loadedTables().Exports) == 0 {
+		return nil
+	}
+	return lib
+}
+
+// AddHostExecutable will make the exports of the executable at path available
+// to libraries which can't otherwise resolve a symbol, as happens when they
+// are plugins loaded by it. Anything other than an executable is ignored.
+func (s *SymbolStore) AddHostExecutable(path string) {
+	s.config.RLock()
+	defer s.config.RUnlock()
+	s.addHosts([]*Library{s.hostExecutable(path)})
+}
+
+// addHosts will append each of the executables, skipping nil entries
+func (s *SymbolStore) addHosts(hosts []*Library) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, host := range hosts {
+		if host != nil {
+			s.hosts = append(s.hosts, host)
+		}
+	}
+}
+
+// hostProvider returns the first host executable for the machine that
+// defines the symbol. This is only a fallback for symbols missing from the
+// scope, so a library's own copy relocated objects will have been found
+// in the library long before now.
+func (s *SymbolStore) hostProvider(sym *ImportedSymbol, arch Arch) *Library {
+	if !s.executableExports {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, host := range s.hosts {
+		if host.arch.Machine == arch.Machine && host.Provides(sym.Name, sym.Version) {
+			return host
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// errNoSections is why an object stripped of its section headers, as sstrip
+// does, can't be checked. ld.so only needs PT_DYNAMIC, but debug/elf finds
+// the dynamic symbols by their section.
+var errNoSections = errors.New("no section headers to find the dynamic symbols with")
+
+// sectionData returns the contents of the section. debug/elf decompresses
+// SHF_COMPRESSED sections itself, zlib and zstd alike, and any failure names
+// the section so that it isn't mistaken for one reading the whole file.
+// SHT_NOBITS sections have nothing to read, however large they claim to be.
+func sectionData(sect *elf.Section) ([]byte, error) {
+	if sect.Type == elf.SHT_NOBITS {
+		return nil, nil
+	}
+	data, err := sect.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read section %s: %v", sect.Name, err)
+	}
+	return data, nil
+}
+
+// sectionReader returns a reader for the contents of the section, for when
+// only a few bytes are needed. Compressed sections can't be read at random
+// so have no ReaderAt of their own, and are decompressed in full instead.
+func sectionReader(sect *elf.Section) (io.ReaderAt, error) {
+	if sect.ReaderAt != nil && sect.Type != elf.SHT_NOBITS {
+		return sect, nil
+	}
+	data, err := sectionData(sect)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// debugSection returns the named .debug_ section of the file, also trying
+// the .zdebug_ name used by the older GNU compression, which is what
+// objcopy --compress-debug-sections=zlib-gnu still produces.
+func debugSection(file *elf.File, name string) *elf.Section {
+	if sect := file.Section(name); sect != nil {
+		return sect
+	}
+	if !strings.HasPrefix(name, ".debug_") {
+		return nil
+	}
+	return file.Section(".z" + name[1:])
+}
+
+// checkSections returns errNoSections when the object is dynamic, so has
+// symbols to be read, but no section headers to read them with
+func checkSections(file *elf.File) error {
+	if len(file.Sections) > 0 {
+		return nil
+	}
+	for _, prog := range file.Progs {
+		if prog.Type == elf.PT_DYNAMIC {
+			return errNoSections
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// IssueClass identifies the kind of problem found while resolving an object
+type IssueClass string
+
+// The classes of issue that may be reported
+const (
+	IssueUnresolvedSymbol  IssueClass = "unresolved-symbol"
+	IssueMissingLibrary    IssueClass = "missing-library"
+	IssueMissingVersion    IssueClass = "missing-version"
+	IssueArchMismatch      IssueClass = "arch-mismatch"
+	IssueUnusedLibrary     IssueClass = "unused-library"
+	IssueUnderlinkedSymbol IssueClass = "underlinked-symbol"
+	IssueDuplicateSymbol   IssueClass = "duplicate-symbol"
+	IssuePrivateSymbol     IssueClass = "private-symbol"
+	IssueDependencyCycle   IssueClass = "dependency-cycle"
+	IssueStaleLibrary      IssueClass = "stale-library"
+	IssueDynamicLoading    IssueClass = "dynamic-loading"
+	IssueImpurePath        IssueClass = "impure-path"
+	IssueHostLibrary       IssueClass = "host-library"
+	IssueModversion        IssueClass = "modversion-mismatch"
+	IssueUnreadableObject  IssueClass = "unreadable-object"
+	IssueBadSoname         IssueClass = "bad-soname"
+	IssueDevSymlink        IssueClass = "dev-symlink"
+	IssueShadowedLibrary   IssueClass = "shadowed-library"
+	IssueCPUFeature        IssueClass = "cpu-feature"
+	IssueCopyRelocation    IssueClass = "copy-relocation"
+	IssueSymbolType        IssueClass = "symbol-type"
+	IssueTextRel           IssueClass = "textrel"
+)
+
+// IssueClasses lists every known class, in order of importance
+var IssueClasses = []IssueClass{
+	IssueUnresolvedSymbol,
+	IssueMissingLibrary,
+	IssueMissingVersion,
+	IssueArchMismatch,
+	IssueUnusedLibrary,
+	IssueUnderlinkedSymbol,
+	IssueDuplicateSymbol,
+	IssuePrivateSymbol,
+	IssueDependencyCycle,
+	IssueStaleLibrary,
+	IssueDynamicLoading,
+	IssueImpurePath,
+	IssueHostLibrary,
+	IssueModversion,
+	IssueUnreadableObject,
+	IssueBadSoname,
+	IssueDevSymlink,
+	IssueShadowedLibrary,
+	IssueCPUFeature,
+	IssueCopyRelocation,
+	IssueSymbolType,
+	IssueTextRel,
+}
+
+// Severity controls how an issue is treated once found
+type Severity int
+
+// Severities in increasing order, so the highest one hit wins
+const (
+	SeverityIgnore Severity = iota
+	SeverityWarn
+	SeverityError
+)
+
+// String returns the name of the severity as used in configuration
+func (s Severity) String() string {
+	switch s {
+	case SeverityIgnore:
+		return "ignore"
+	case SeverityWarn:
+		return "warn"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// ParseSeverity will return the severity with the given name
+func ParseSeverity(name string) (Severity, error) {
+	switch strings.ToLower(name) {
+	case "ignore", "off", "none":
+		return SeverityIgnore, nil
+	case "warn", "warning":
+		return SeverityWarn, nil
+	case "error":
+		return SeverityError, nil
+	default:
+		return SeverityIgnore, fmt.Errorf("unknown severity: %s", name)
+	}
+}
+
+// Issue is a single classified problem found within an ObjectResult
+type Issue struct {
+	Class IssueClass
+	Err   error
+}
+
+// Policy maps each class of issue to the severity it should be treated with
+type Policy map[IssueClass]Severity
+
+// DefaultPolicy returns the policy used when nothing is configured. Problems
+// that stop the process from loading, or that corrupt it once loaded, are
+// errors. Anything that still works today is at most a warning, and the
+// purely informational classes are only reported on request.
+func DefaultPolicy() Policy {
+	return Policy{
+		IssueUnresolvedSymbol:  SeverityError,
+		IssueMissingLibrary:    SeverityError,
+		IssueMissingVersion:    SeverityError,
+		IssueArchMismatch:      SeverityIgnore, // Another candidate may still be found
+		IssueUnusedLibrary:     SeverityIgnore,
+		IssueUnderlinkedSymbol: SeverityIgnore,
+		IssueDuplicateSymbol:   SeverityIgnore,
+		IssuePrivateSymbol:     SeverityWarn,   // Breaks on the next update of the provider
+		IssueDependencyCycle:   SeverityWarn,   // Leaves initialisation order to chance
+		IssueStaleLibrary:      SeverityWarn,   // The process only needs restarting
+		IssueDynamicLoading:    SeverityIgnore, // Perfectly normal
+		IssueImpurePath:        SeverityWarn,
+		IssueHostLibrary:       SeverityError, // Won't load on the next machine
+		IssueModversion:        SeverityError,
+		IssueUnreadableObject:  SeverityWarn,   // One bad file shouldn't fail a whole tree
+		IssueBadSoname:         SeverityWarn,   // Still works where it was tested
+		IssueDevSymlink:        SeverityWarn,   // Still works where it was tested
+		IssueShadowedLibrary:   SeverityIgnore, // Often deliberate, i.e. /usr/local
+		IssueCPUFeature:        SeverityIgnore,
+		IssueCopyRelocation:    SeverityError, // Corrupts memory without failing to load
+		IssueSymbolType:        SeverityError, // Binds, then is used as the wrong thing
+		IssueTextRel:           SeverityWarn,  // Only refused by SELinux
+	}
+}
+
+// Severity returns the severity configured for the class
+func (p Policy) Severity(class IssueClass) Severity {
+	return p[class]
+}
+
+// Highest returns the highest severity hit by any of the issues
+func (p Policy) Highest(issues []Issue) Severity {
+	ret := SeverityIgnore
+	for _, issue := range issues {
+		if sev := p.Severity(issue.Class); sev > ret {
+			ret = sev
+		}
+	}
+	return ret
+}
+
+// SetClass will configure the severity of a single class by name
+func (p Policy) SetClass(class, severity string) error {
+	class = strings.TrimSpace(class)
+	known := false
+	for _, c := range IssueClasses {
+		if string(c) == class {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("unknown issue class: %s", class)
+	}
+	sev, err := ParseSeverity(strings.TrimSpace(severity))
+	if err != nil {
+		return err
+	}
+	p[IssueClass(class)] = sev
+	return nil
+}
+
+// Set will apply a comma separated list of class=severity mappings, such as
+// "unused-library=warn,arch-mismatch=error"
+func (p Policy) Set(spec string) error {
+	for _, field := range strings.Split(spec, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		splits := strings.SplitN(field, "=", 2)
+		if len(splits) != 2 {
+			return fmt.Errorf("invalid severity mapping: %s", field)
+		}
+		if err := p.SetClass(splits[0], splits[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadPolicy will apply the mappings found in the file at path. Each line
+// takes the form class = "severity", so that the file is also valid TOML,
+// and '#' starts a comment.
+func (p Policy) LoadPolicy(path string) error {
+	settings, err := ReadTOML(path)
+	if err != nil {
+		return err
+	}
+	for _, setting := range settings {
+		if setting.Table != "" || setting.Array || !setting.Strings {
+			return fmt.Errorf("%s:%d: expected class = \"severity\"", path, setting.Line)
+		}
+		if err := p.SetClass(setting.Key, setting.Values[0]); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, setting.Line, err)
+		}
+	}
+	return nil
+}
+
+// ClassOf returns the class of a failure recorded in an ObjectResult.
+// Unclassified errors are treated as unresolved symbols.
+func ClassOf(err error) IssueClass {
+	var c Classified
+	if errors.As(err, &c) {
+		return c.Class()
+	}
+	return IssueUnresolvedSymbol
+}
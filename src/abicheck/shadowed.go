@@ -0,0 +1,106 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+// ShadowedLibrary records a library found in more than one place on the
+// search path, so that only the first copy is ever loaded
+type ShadowedLibrary struct {
+	Name     string         `json:"name"`
+	Path     string         `json:"path"` // The copy that wins
+	Shadowed []ShadowedCopy `json:"shadowed"`
+}
+
+// ShadowedCopy is a later copy of a library that loses out to the first
+type ShadowedCopy struct {
+	Path string `json:"path"`
+
+	// Differs is set when the copy exports a different set of symbols,
+	// so the program would behave differently were it found first
+	Differs bool `json:"differs,omitempty"`
+}
+
+// SetReportShadowed controls whether each library is also looked for in the
+// rest of the search path, recording any other copies it shadows against
+// the object needing it. This is off by default, as it means reading every
+// copy of every library.
+func (s *SymbolStore) SetReportShadowed(report bool) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.reportShadowed = report
+}
+
+// checkShadowed will record every copy of the library, other than the one
+// loaded from path, that the resolver also found for the importer. Copies
+// for other machines are already reported as incompatible.
+func (s *SymbolStore) checkShadowed(result *ObjectResult, name, lookup, path string, lib *Library, ctx *ResolveContext) {
+	candidates, err := s.resolver.Resolve(lookup, ctx)
+	if err != nil {
+		return
+	}
+	seen := map[string]bool{s.realPath(path): true}
+	var copies []ShadowedCopy
+	for _, c := range candidates {
+		real := c.Path
+		if c.Reader == nil {
+			real = s.realPath(c.Path)
+		}
+		if seen[real] {
+			continue
+		}
+		seen[real] = true
+		file, err := s.openCandidate(c)
+		if err != nil {
+			continue
+		}
+		if file.FileHeader.Machine != lib.arch.Machine || file.FileHeader.Class != lib.arch.Class || abiMismatch(lib.arch, file.arch) != "" {
+			file.Close()
+			continue
+		}
+		tables, err := s.symbolTables(c.Path, file)
+		file.Close()
+		if err != nil {
+			continue
+		}
+		copies = append(copies, ShadowedCopy{Path: c.Path, Differs: !sameExports(lib.loadedTables(), tables)})
+	}
+	if len(copies) == 0 {
+		return
+	}
+	warning := &ShadowedLibraryWarning{Importer: result.Path, Library: name, Path: path, Shadowed: copies}
+	if s.ignored(warning) {
+		return
+	}
+	result.Shadowed = append(result.Shadowed, ShadowedLibrary{Name: name, Path: path, Shadowed: copies})
+	s.emit(warning)
+}
+
+// sameExports determines whether both tables define the same symbols
+func sameExports(a, b *SymbolTables) bool {
+	if len(a.Exports) != len(b.Exports) {
+		return false
+	}
+	set := make(map[string]bool, len(a.Exports))
+	for i := range a.Exports {
+		set[a.Exports[i].String()] = true
+	}
+	for i := range b.Exports {
+		if !set[b.Exports[i].String()] {
+			return false
+		}
+	}
+	return true
+}
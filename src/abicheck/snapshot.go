@@ -0,0 +1,357 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// snapshotFormat is bumped whenever the snapshot file changes incompatibly
+const snapshotFormat = 1
+
+// Snapshot is the exported ABI of a set of libraries at one point in time,
+// so that later builds can be compared against it with DiffSnapshots.
+type Snapshot struct {
+	Format    int               `json:"format"`
+	Libraries []LibrarySnapshot `json:"libraries"`
+}
+
+// LibrarySnapshot is the exported ABI of a single library
+type LibrarySnapshot struct {
+	Name     string           `json:"name"` // DT_SONAME, or the file name
+	Path     string           `json:"path"`
+	Versions []string         `json:"versions,omitempty"`
+	Symbols  []SymbolSnapshot `json:"symbols"`
+}
+
+// SymbolSnapshot is a single exported definition
+type SymbolSnapshot struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Hidden  bool   `json:"hidden,omitempty"` // Not the default version
+	Weak    bool   `json:"weak,omitempty"`
+	Unique  bool   `json:"unique,omitempty"` // STB_GNU_UNIQUE
+	Type    string `json:"type"`
+	Size    uint64 `json:"size,omitempty"` // Only kept for data objects
+}
+
+// String returns the conventional name@version form of the symbol
+func (s *SymbolSnapshot) String() string {
+	return symbolString(s.Name, s.Version)
+}
+
+// symbolTypes are the names used for symbol types within snapshots
+var symbolTypes = map[elf.SymType]string{
+	elf.STT_NOTYPE:    "notype",
+	elf.STT_OBJECT:    "object",
+	elf.STT_FUNC:      "func",
+	elf.STT_TLS:       "tls",
+	elf.STT_COMMON:    "common",
+	elf.STT_GNU_IFUNC: "ifunc",
+}
+
+// hasSize determines whether the size of a symbol type is part of its ABI.
+// Functions can change size freely, but data can't without breaking the
+// copy relocations of programs using it.
+func hasSize(t elf.SymType) bool {
+	return t == elf.STT_OBJECT || t == elf.STT_TLS || t == elf.STT_COMMON
+}
+
+// SnapshotLibrary returns the exported ABI of the object at path
+func SnapshotLibrary(path string) (*LibrarySnapshot, error) {
+	file, err := openObject(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tables, err := readSymbolTables(file.File)
+	if err != nil {
+		return nil, err
+	}
+
+	lib := &LibrarySnapshot{
+		Name:     soname(file),
+		Path:     path,
+		Versions: tables.Versions,
+		Symbols:  []SymbolSnapshot{},
+	}
+	if lib.Name == "" {
+		lib.Name = filepath.Base(path)
+	}
+	for _, exp := range tables.Exports {
+		if linkerSymbols[exp.Name] {
+			continue
+		}
+		sym := SymbolSnapshot{
+			Name:    exp.Name,
+			Version: exp.Version,
+			Hidden:  exp.Hidden,
+			Weak:    exp.Weak,
+			Unique:  exp.Unique,
+			Type:    symbolTypes[exp.Type],
+		}
+		if sym.Type == "" {
+			sym.Type = exp.Type.String()
+		}
+		if hasSize(exp.Type) {
+			sym.Size = exp.Size
+		}
+		lib.Symbols = append(lib.Symbols, sym)
+	}
+	sort.Slice(lib.Symbols, func(i, j int) bool {
+		a, b := &lib.Symbols[i], &lib.Symbols[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+	return lib, nil
+}
+
+// TakeSnapshot returns the exported ABI of every object at the given paths,
+// ordered by library name. Directories are walked for shared libraries,
+// skipping executables, whereas files are always included.
+func TakeSnapshot(paths []string) (*Snapshot, error) {
+	snap := &Snapshot{Format: snapshotFormat}
+	add := func(path string) error {
+		lib, err := SnapshotLibrary(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		snap.Libraries = append(snap.Libraries, *lib)
+		return nil
+	}
+	for _, path := range paths {
+		st, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !st.IsDir() {
+			if err := add(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = WalkELF(path, func(p string) error {
+			if !isSnapshotLibrary(p) {
+				return nil
+			}
+			return add(p)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(snap.Libraries, func(i, j int) bool {
+		return snap.Libraries[i].Name < snap.Libraries[j].Name
+	})
+	return snap, nil
+}
+
+// isSnapshotLibrary determines whether the file at path is a library worth
+// snapshotting. Unlike isSharedLibrary, anything with a soname counts.
+func isSnapshotLibrary(path string) bool {
+	file, err := openObject(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	return file.providesSymbols()
+}
+
+// ReadSnapshot will parse a snapshot stored by Write
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	snap := &Snapshot{}
+	if err := json.NewDecoder(r).Decode(snap); err != nil {
+		return nil, err
+	}
+	if snap.Format != snapshotFormat {
+		return nil, fmt.Errorf("unsupported snapshot format: %d", snap.Format)
+	}
+	return snap, nil
+}
+
+// Write will store the snapshot as JSON
+func (s *Snapshot) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(s)
+}
+
+// ChangeKind describes how the ABI of a library changed between snapshots
+type ChangeKind string
+
+// The kinds of change found by DiffSnapshots. Only additions are compatible.
+const (
+	ChangeRemovedLibrary ChangeKind = "removed-library"
+	ChangeRemovedSymbol  ChangeKind = "removed-symbol"
+	ChangeRemovedVersion ChangeKind = "removed-version"
+	ChangeChangedSymbol  ChangeKind = "changed-symbol"
+	ChangeAddedLibrary   ChangeKind = "added-library"
+	ChangeAddedSymbol    ChangeKind = "added-symbol"
+)
+
+// Breaking determines whether a change of this kind can break programs built
+// against the old library
+func (k ChangeKind) Breaking() bool {
+	return k != ChangeAddedLibrary && k != ChangeAddedSymbol
+}
+
+// ABIChange is a single difference between two snapshots
+type ABIChange struct {
+	Library string     `json:"library"`
+	Kind    ChangeKind `json:"kind"`
+	Symbol  string     `json:"symbol,omitempty"` // In name@version form
+	Detail  string     `json:"detail,omitempty"`
+}
+
+// String returns a human readable form of the change
+func (c *ABIChange) String() string {
+	s := fmt.Sprintf("%s: %s", c.Library, c.Kind)
+	if c.Symbol != "" {
+		s += " " + c.Symbol
+	}
+	if c.Detail != "" {
+		s += " (" + c.Detail + ")"
+	}
+	return s
+}
+
+// DiffSnapshots returns every change from old to new, with libraries matched
+// by name. Changes are ordered by library, then symbol.
+func DiffSnapshots(old, new *Snapshot) []ABIChange {
+	var ret []ABIChange
+
+	newLibs := make(map[string]*LibrarySnapshot)
+	for i := range new.Libraries {
+		newLibs[new.Libraries[i].Name] = &new.Libraries[i]
+	}
+	oldLibs := make(map[string]bool)
+
+	for i := range old.Libraries {
+		o := &old.Libraries[i]
+		oldLibs[o.Name] = true
+		n, ok := newLibs[o.Name]
+		if !ok {
+			ret = append(ret, ABIChange{Library: o.Name, Kind: ChangeRemovedLibrary})
+			continue
+		}
+		ret = append(ret, diffLibrary(o, n)...)
+	}
+	for i := range new.Libraries {
+		if n := &new.Libraries[i]; !oldLibs[n.Name] {
+			ret = append(ret, ABIChange{Library: n.Name, Kind: ChangeAddedLibrary})
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Library != ret[j].Library {
+			return ret[i].Library < ret[j].Library
+		}
+		return ret[i].Symbol < ret[j].Symbol
+	})
+	return ret
+}
+
+// DiffLibraries returns every change from the old library to the new one,
+// ordered by symbol. Unlike DiffSnapshots they needn't share a name, though a
+// changed soname is reported as the old library being removed.
+func DiffLibraries(old, new *LibrarySnapshot) []ABIChange {
+	var ret []ABIChange
+	if old.Name != new.Name {
+		ret = append(ret,
+			ABIChange{Library: old.Name, Kind: ChangeRemovedLibrary, Detail: "now " + new.Name},
+			ABIChange{Library: new.Name, Kind: ChangeAddedLibrary})
+	}
+	changes := diffLibrary(old, new)
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Symbol < changes[j].Symbol })
+	return append(ret, changes...)
+}
+
+// codeType folds IFUNC symbols into plain functions, as callers can't tell
+// the difference and libraries switch between the two freely
+func codeType(t string) string {
+	if t == symbolTypes[elf.STT_GNU_IFUNC] {
+		return symbolTypes[elf.STT_FUNC]
+	}
+	return t
+}
+
+// diffLibrary returns the changes between two snapshots of the same library
+func diffLibrary(old, new *LibrarySnapshot) []ABIChange {
+	var ret []ABIChange
+	change := func(kind ChangeKind, sym *SymbolSnapshot, detail string) {
+		c := ABIChange{Library: old.Name, Kind: kind, Detail: detail}
+		if sym != nil {
+			c.Symbol = sym.String()
+		}
+		ret = append(ret, c)
+	}
+
+	versions := make(map[string]bool)
+	for _, v := range new.Versions {
+		versions[v] = true
+	}
+	for _, v := range old.Versions {
+		if !versions[v] {
+			change(ChangeRemovedVersion, nil, v)
+		}
+	}
+
+	type key struct {
+		name, version string
+	}
+	newSyms := make(map[key]*SymbolSnapshot)
+	for i := range new.Symbols {
+		sym := &new.Symbols[i]
+		newSyms[key{sym.Name, sym.Version}] = sym
+	}
+	seen := make(map[key]bool)
+
+	for i := range old.Symbols {
+		o := &old.Symbols[i]
+		k := key{o.Name, o.Version}
+		seen[k] = true
+		n, ok := newSyms[k]
+		if !ok {
+			change(ChangeRemovedSymbol, o, "")
+			continue
+		}
+		switch {
+		case codeType(o.Type) != codeType(n.Type):
+			change(ChangeChangedSymbol, o, fmt.Sprintf("type %s -> %s", o.Type, n.Type))
+		case o.Size != n.Size:
+			change(ChangeChangedSymbol, o, fmt.Sprintf("size %d -> %d", o.Size, n.Size))
+		case !o.Hidden && n.Hidden:
+			change(ChangeChangedSymbol, o, "no longer the default version")
+		}
+	}
+	for i := range new.Symbols {
+		n := &new.Symbols[i]
+		if !seen[key{n.Name, n.Version}] {
+			change(ChangeAddedSymbol, n, "")
+		}
+	}
+	return ret
+}
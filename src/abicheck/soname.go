@@ -0,0 +1,88 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// sonameProblem returns what is wrong with the DT_SONAME of the shared
+// library named file, or an empty string when the file is named for the
+// library its soname names (libfoo.so.1.2 or libfoo-1.2.so for libfoo.so.1).
+// Plugins aren't loaded by soname and needn't follow any of this, but
+// anything versioned is clearly meant to be linked against.
+func sonameProblem(soname, file string) string {
+	if !isVersioned(soname) && !isVersioned(file) {
+		return ""
+	}
+	stem, _, _ := strings.Cut(soname, ".so")
+	switch {
+	case soname == "":
+		return "no DT_SONAME"
+	case strings.Contains(soname, "/"):
+		return "DT_SONAME is a path"
+	case !strings.HasPrefix(file, stem):
+		return "doesn't match the file name " + file
+	}
+	return ""
+}
+
+// isVersioned determines whether the library name carries a version after
+// the .so, such as libfoo.so.1
+func isVersioned(name string) bool {
+	_, version, ok := strings.Cut(name, ".so.")
+	return ok && version != ""
+}
+
+// isDevSymlink determines whether the DT_NEEDED name is the unversioned
+// development symlink (libfoo.so) of the library found with the soname,
+// which is only installed alongside the headers
+func isDevSymlink(name, soname string) bool {
+	return strings.HasSuffix(name, ".so") && soname != "" && soname != name
+}
+
+// checkSonames will record the entry having a bad DT_SONAME, if it is a
+// shared library, and each DT_NEEDED entry naming a development symlink
+func (s *SymbolStore) checkSonames(entry *scopeEntry) {
+	result := entry.result
+	if entry.lib.shared && entry.path != vdsoPath {
+		file := filepath.Base(s.realPath(entry.path))
+		if problem := sonameProblem(entry.lib.Soname, file); problem != "" {
+			warning := &BadSonameWarning{Importer: result.Path, Soname: entry.lib.Soname, Problem: problem}
+			if !s.ignored(warning) {
+				result.SonameProblem = problem
+				s.emit(warning)
+			}
+		}
+	}
+	for i := range result.Libraries {
+		lib := &result.Libraries[i]
+		if i >= len(entry.deps) || entry.deps[i] == nil {
+			continue
+		}
+		dep := entry.deps[i]
+		if !isDevSymlink(lib.Name, dep.lib.Soname) {
+			continue
+		}
+		warning := &DevSymlinkWarning{Importer: result.Path, Library: lib.Name, Soname: dep.lib.Soname}
+		if !s.ignored(warning) {
+			lib.Soname = dep.lib.Soname
+			s.emit(warning)
+		}
+	}
+}
@@ -0,0 +1,937 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SymbolStore is used to create a global mapping so that we can resolve symbols
+// within a process space. It is safe to use from many goroutines at once,
+// scanning and reconfiguring alike.
+type SymbolStore struct {
+	// mu protects objects, results and Library.reported, permitting
+	// concurrent scans
+	mu sync.RWMutex
+
+	// config protects everything set up by the Set and Add methods. Scans
+	// hold it for reading throughout, so reconfiguring the store waits for
+	// any in progress to finish and those starting after see the change.
+	config sync.RWMutex
+
+	// objects map Machine -> real path -> library. Libraries are shared
+	// between every process scope, so that each file is only ever loaded
+	// once no matter how many names it is requested by.
+	objects map[elf.Machine]map[string]*Library
+
+	// Directories defined by ld.so.conf, searched before the system
+	// library directories
+	configLibraries []string
+
+	// Parsed ld.so.cache, used in place of configLibraries when available
+	ldCache *LdCache
+
+	// Simulated LD_LIBRARY_PATH, searched after DT_RPATH
+	libraryPath []string
+
+	// Synthetic vDSO library per machine, and any extra exports it has
+	vdso      map[elf.Machine]*Library
+	vdsoExtra []ExportedSymbol
+
+	// Executables exporting symbols, which libraries lacking a definition
+	// may rely on when loaded as plugins. Only used if executableExports.
+	hosts             []*Library
+	executableExports bool
+
+	// Finds the candidates for each library, the filesystem by default
+	resolver LibraryResolver
+
+	// Receives events as the scan goes, and any error loading the host's
+	// linker configuration before there was a handler to give it to
+	events    EventHandler
+	configErr error
+
+	// Whether unresolved weak references are treated as failures
+	strictWeak bool
+
+	// Whether only targets are checked, reading the symbols of libraries
+	// as lookups reach them
+	lazy bool
+
+	// Whether to find symbols defined more than once in a process scope
+	reportDuplicates bool
+
+	// Whether to look for the other copies of each library loaded
+	reportShadowed bool
+
+	// Whether to report the CPU features of each object
+	reportFeatures bool
+
+	// Patterns matching the versions reserved for library internals
+	privateVersions []string
+
+	// Issues that should never be reported, if set
+	ignore *IgnoreList
+
+	// How many DT_NEEDED links are followed from each target, 0 for all
+	maxDepth int
+
+	// Libraries each target is expected to dlopen, if set, and whether
+	// to guess more from the strings within it
+	dlopenManifest *DlopenManifest
+	dlopenStrings  bool
+
+	// CPU level whose glibc-hwcaps subdirectories are searched, if set
+	hwcaps string
+
+	// Objects loaded into every scope after the target, from LD_PRELOAD
+	// and then ld.so.preload
+	preload       []string
+	systemPreload []string
+
+	// C library every process is treated as using, empty to tell them
+	// apart, and the one the sysroot itself uses
+	libc       string
+	systemLibc string
+
+	// musl path file directories of each architecture, and the APEX
+	// modules of Android systems
+	muslPaths   map[string][]string
+	apexModules []string
+
+	// Directories of each BSD hints file, by path
+	hints map[string][]string
+
+	// Nix or Guix style store that everything must come from, if set
+	pureStore string
+
+	// Whether to look up debug info for unresolved symbols, and where from
+	debugInfo       bool
+	debuginfod      []string
+	debuginfodCache string
+
+	// Self-contained bundle and the libraries it may take from the host
+	bundle        string
+	hostLibraries []string
+
+	// Target root filesystem that all system paths are relative to
+	sysroot string
+
+	// Directories mounted within the sysroot, longest mount point first
+	mounts []Mount
+
+	// Persistent cache of symbol tables, if enabled
+	cache *SymbolCache
+
+	// Libraries of the system being checked against when it isn't on
+	// disk, see SetDatabase
+	database *libraryDatabase
+
+	// Names read from every object, held only once
+	names *stringPool
+
+	// Files laid over the filesystem, i.e. uninstalled package contents
+	overlay *Overlay
+
+	// results records every object scanned, in the order they were seen
+	results []*ObjectResult
+}
+
+// NewSymbolStore will return a newly setup symbol store..
+func NewSymbolStore() *SymbolStore {
+	ret := &SymbolStore{
+		objects: make(map[elf.Machine]map[string]*Library),
+		vdso:    make(map[elf.Machine]*Library),
+		names:   newStringPool(),
+
+		executableExports: true,
+		privateVersions:   DefaultPrivateVersions,
+	}
+	ret.resolver = ret.FilesystemResolver()
+
+	// Pick up the host's linker configuration if it exists. There's no
+	// handler to tell yet, so hang onto any error until there is.
+	ret.configErr = ret.loadSystemConfig()
+
+	return ret
+}
+
+// Fork returns a new store set up just as this one is, sharing its linker
+// configuration, database and cache, but with none of the libraries or
+// results of earlier scans, nor the overlay or event handler. Each fork can
+// then be used by a concurrent scan of its own without loading the host
+// configuration again.
+func (s *SymbolStore) Fork() *SymbolStore {
+	s.config.RLock()
+	defer s.config.RUnlock()
+
+	ret := &SymbolStore{
+		objects: make(map[elf.Machine]map[string]*Library),
+		vdso:    make(map[elf.Machine]*Library),
+		names:   newStringPool(),
+
+		configLibraries:   append([]string(nil), s.configLibraries...),
+		ldCache:           s.ldCache,
+		libraryPath:       s.libraryPath,
+		vdsoExtra:         append([]ExportedSymbol(nil), s.vdsoExtra...),
+		executableExports: s.executableExports,
+		configErr:         s.configErr,
+		strictWeak:        s.strictWeak,
+		lazy:              s.lazy,
+		reportDuplicates:  s.reportDuplicates,
+		reportShadowed:    s.reportShadowed,
+		reportFeatures:    s.reportFeatures,
+		privateVersions:   s.privateVersions,
+		ignore:            s.ignore,
+		maxDepth:          s.maxDepth,
+		dlopenManifest:    s.dlopenManifest,
+		dlopenStrings:     s.dlopenStrings,
+		hwcaps:            s.hwcaps,
+		preload:           s.preload,
+		systemPreload:     s.systemPreload,
+		libc:              s.libc,
+		systemLibc:        s.systemLibc,
+		muslPaths:         s.muslPaths,
+		apexModules:       s.apexModules,
+		hints:             s.hints,
+		pureStore:         s.pureStore,
+		debugInfo:         s.debugInfo,
+		debuginfod:        s.debuginfod,
+		debuginfodCache:   s.debuginfodCache,
+		bundle:            s.bundle,
+		hostLibraries:     s.hostLibraries,
+		sysroot:           s.sysroot,
+		mounts:            append([]Mount(nil), s.mounts...),
+		cache:             s.cache,
+	}
+	// Libraries found in the database belong to the store looking them up
+	if s.database != nil {
+		ret.database = &libraryDatabase{db: s.database.db, named: make(map[string][]*Library)}
+	}
+	switch s.resolver.(type) {
+	case *filesystemResolver:
+		ret.resolver = ret.FilesystemResolver()
+	case *databaseResolver:
+		ret.resolver = &databaseResolver{store: ret}
+	default:
+		ret.resolver = s.resolver
+	}
+	return ret
+}
+
+// loadSystemConfig will load ld.so.preload, ld.so.conf, ld.so.cache and the
+// configuration of other libcs from the sysroot, if they exist.
+func (s *SymbolStore) loadSystemConfig() error {
+	s.configLibraries = nil
+	s.ldCache = nil
+	s.systemPreload = nil
+
+	preload, err := ParseLdPreload(s.rooted(LdPreloadPath))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to parse %s: %v", s.rooted(LdPreloadPath), err)
+	}
+	s.systemPreload = preload
+
+	if err := s.loadLdConfig(LdConfigPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to parse %s: %v", s.rooted(LdConfigPath), err)
+	}
+
+	// Only trust the cache when it is newer than the configuration
+	if !ldCacheStale(s.rooted(LdCachePath), s.rooted(LdConfigPath)) {
+		if err := s.loadLdCache(LdCachePath); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", s.rooted(LdCachePath), err)
+		}
+	}
+	return s.loadLibcConfig()
+}
+
+// rooted will return the path relative to the sysroot, if one is set, or
+// within the directory mounted over it
+func (s *SymbolStore) rooted(path string) string {
+	for _, m := range s.mounts {
+		if path == m.At || strings.HasPrefix(path, m.At+"/") {
+			return filepath.Join(m.Dir, strings.TrimPrefix(path, m.At))
+		}
+	}
+	if s.sysroot == "" {
+		return path
+	}
+	return filepath.Join(s.sysroot, path)
+}
+
+// SetSysroot will cause all system library paths, along with ld.so.conf and
+// ld.so.cache, to be looked up relative to the given target root filesystem.
+// This permits checking cross-compiled binaries against the target's own
+// libraries.
+func (s *SymbolStore) SetSysroot(root string) error {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.sysroot = root
+	return s.loadSystemConfig()
+}
+
+// Mount is a directory bound over a path of the sysroot, such as the app
+// and runtime of a Flatpak
+type Mount struct {
+	At  string // Absolute path within the sysroot
+	Dir string // Directory on disk
+}
+
+// SetMounts will look within each directory for everything under its mount
+// point, rather than within the sysroot, and reload the linker configuration
+// through them
+func (s *SymbolStore) SetMounts(mounts []Mount) error {
+	s.config.Lock()
+	defer s.config.Unlock()
+	return s.setMounts(mounts)
+}
+
+// setMounts does the work of SetMounts without taking the lock
+func (s *SymbolStore) setMounts(mounts []Mount) error {
+	s.mounts = make([]Mount, 0, len(mounts))
+	for _, m := range mounts {
+		s.mounts = append(s.mounts, Mount{At: filepath.Clean(m.At), Dir: m.Dir})
+	}
+	sort.SliceStable(s.mounts, func(i, j int) bool {
+		return len(s.mounts[i].At) > len(s.mounts[j].At)
+	})
+	return s.loadSystemConfig()
+}
+
+// LoadLdConfig will replace the configured library directories with those
+// found in the given ld.so.conf file. These are searched before the default
+// system library directories. The path is relative to the sysroot.
+func (s *SymbolStore) LoadLdConfig(path string) error {
+	s.config.Lock()
+	defer s.config.Unlock()
+	return s.loadLdConfig(path)
+}
+
+// loadLdConfig does the work of LoadLdConfig without taking the lock
+func (s *SymbolStore) loadLdConfig(path string) error {
+	dirs, err := ParseLdConfig(s.sysroot, path)
+	if err != nil {
+		return err
+	}
+	s.configLibraries = dirs
+	return nil
+}
+
+// LoadLdCache will load the given ld.so.cache file, which will then be used
+// to look up libraries instead of searching the ld.so.conf directories. The
+// path is relative to the sysroot.
+func (s *SymbolStore) LoadLdCache(path string) error {
+	s.config.Lock()
+	defer s.config.Unlock()
+	return s.loadLdCache(path)
+}
+
+// loadLdCache does the work of LoadLdCache without taking the lock
+func (s *SymbolStore) loadLdCache(path string) error {
+	cache, err := ParseLdCache(s.rooted(path))
+	if err != nil {
+		return err
+	}
+	s.ldCache = cache
+	return nil
+}
+
+// SetLibraryPath will set the directories searched as though they were
+// provided in LD_LIBRARY_PATH. These take priority over DT_RUNPATH and
+// the system library directories, but not DT_RPATH.
+func (s *SymbolStore) SetLibraryPath(paths []string) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.libraryPath = paths
+}
+
+// addFailure will record a resolution failure against the object, and
+// pass it on to the event handler, unless the ignore list covers it
+func (s *SymbolStore) addFailure(result *ObjectResult, err Classified) {
+	if s.ignored(err) {
+		return
+	}
+	result.Failures = append(result.Failures, err)
+	s.emit(err)
+}
+
+// Results returns the result of every object scanned so far, in the order
+// they were encountered.
+func (s *SymbolStore) Results() []*ObjectResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*ObjectResult(nil), s.results...)
+}
+
+// NumFailures returns the total number of resolution failures recorded
+func (s *SymbolStore) NumFailures() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	for _, result := range s.results {
+		n += len(result.Failures)
+	}
+	return n
+}
+
+// SetCache will enable the use of a persistent symbol cache, so that
+// libraries are only parsed again once they change.
+func (s *SymbolStore) SetCache(cache *SymbolCache) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.cache = cache
+}
+
+// SetStrictWeak controls whether unresolved weak references (such as
+// __gmon_start__) are treated as failures. By default they're resolved
+// opportunistically, as the dynamic linker would leave them NULL.
+func (s *SymbolStore) SetStrictWeak(strict bool) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.strictWeak = strict
+}
+
+// SetLazy controls whether libraries only have their symbols read once a
+// lookup reaches them, rather than as soon as they're loaded. Only targets
+// are then checked, not the libraries they load, and each reference stops
+// at the first definition, so interposition isn't reported. This is far
+// quicker for objects with large dependency closures where most symbols
+// come from the first few libraries, such as libc.
+func (s *SymbolStore) SetLazy(lazy bool) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.lazy = lazy
+}
+
+// SetExecutableExports controls whether the dynamic exports of executables
+// added with AddHostExecutable are used to resolve the symbols libraries
+// can't find elsewhere. This is on by default, as plugins commonly expect
+// the program loading them to provide part of their API.
+func (s *SymbolStore) SetExecutableExports(enabled bool) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.executableExports = enabled
+}
+
+// SetReportDuplicates controls whether each target's result lists symbols
+// defined by more than one object in its process scope. This is off by
+// default as it means looking at every export of every object.
+func (s *SymbolStore) SetReportDuplicates(report bool) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.reportDuplicates = report
+}
+
+// SetMaxDepth limits how many DT_NEEDED links are followed from each target,
+// where 1 only loads its direct dependencies. Objects at the limit are used
+// to resolve the symbols of those that loaded them, but aren't checked
+// themselves. Symbols only provided by the objects left out will show as
+// unresolved. 0, the default, follows every link.
+func (s *SymbolStore) SetMaxDepth(depth int) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.maxDepth = depth
+}
+
+// DefaultPrivateVersions match the versions libraries reserve for their own
+// internal use, GLIBC_PRIVATE being the best known
+var DefaultPrivateVersions = []string{"*_PRIVATE"}
+
+// SetPrivateVersions replaces the patterns (as in path.Match) of versions
+// considered private. Objects using such a version are flagged, unless they
+// define versions in the same namespace and so are part of the provider,
+// as glibc's own libraries are. An empty list disables the check.
+func (s *SymbolStore) SetPrivateVersions(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid private version pattern %q: %v", pattern, err)
+		}
+	}
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.privateVersions = patterns
+	return nil
+}
+
+// isPrivateVersion determines whether the version is reserved for the
+// internals of the namespace, i.e. GLIBC_PRIVATE, for the given object
+func (s *SymbolStore) isPrivateVersion(version string, tables *SymbolTables) bool {
+	if version == "" {
+		return false
+	}
+	matched := false
+	for _, pattern := range s.privateVersions {
+		if ok, _ := path.Match(pattern, version); ok {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	idx := strings.LastIndexByte(version, '_')
+	if idx < 1 {
+		return true
+	}
+	namespace := version[:idx+1]
+	for _, v := range tables.Versions {
+		if strings.HasPrefix(v, namespace) {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultLibraries returns the trusted system directories for the ABI,
+// starting with any multiarch directories, then the typical set of paths
+// known by linux distributions for the ELF class.
+func (s *SymbolStore) defaultLibraries(arch Arch) []string {
+	ret := multiarchDirs(arch)
+	for _, name := range libDirNames(arch) {
+		ret = append(ret, "/usr/"+name)
+	}
+	return ret
+}
+
+// configDirs returns the ld.so.conf directories which may hold libraries
+// for the ABI. Directories plainly meant for another class or multiarch
+// tuple are left out, rather than opening every candidate in them only
+// to find the wrong machine.
+func (s *SymbolStore) configDirs(arch Arch) []string {
+	var ret []string
+	for _, p := range s.configLibraries {
+		if !wrongABIDir(p, arch) {
+			ret = append(ret, s.rooted(p))
+		}
+	}
+	return ret
+}
+
+// dynamicPaths will return the expanded search directories stored in the
+// given dynamic tag (DT_RPATH or DT_RUNPATH) of the input file. Each entry
+// may contain multiple colon separated directories.
+func (s *SymbolStore) dynamicPaths(path string, inputFile *elfObject, tag elf.DynTag) ([]string, error) {
+	var ret []string
+
+	entries, err := inputFile.DynString(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		for _, dir := range strings.Split(entry, ":") {
+			// Empty entries are ignored rather than meaning "cwd"
+			if dir == "" {
+				continue
+			}
+			// $ORIGIN expands to where we found the object, which is
+			// already within the sysroot
+			relative := strings.HasPrefix(dir, "$ORIGIN") || strings.HasPrefix(dir, "${ORIGIN}")
+			for _, expanded := range s.expandTokens(dir, path, inputFile) {
+				if !relative {
+					expanded = s.rooted(expanded)
+				}
+				ret = append(ret, expanded)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// searchPaths returns the ordered set of directories searched for the
+// dependencies of an object. When ld.so.cache is in use, its path is given
+// in place of the ld.so.conf directories.
+func (s *SymbolStore) searchPaths(arch Arch, rpaths, runpaths []string, libc string) []string {
+	if s.pureStore != "" {
+		return s.withHWCaps(s.pureSearchPaths(rpaths, runpaths), arch)
+	}
+	if ret := s.libcSearchPaths(libc, arch, rpaths, runpaths); ret != nil {
+		return ret
+	}
+	var ret []string
+
+	ret = append(ret, s.withHWCaps(rpaths, arch)...)
+	ret = append(ret, s.withHWCaps(s.libraryPath, arch)...)
+	ret = append(ret, s.withHWCaps(runpaths, arch)...)
+	if s.ldCache != nil {
+		ret = append(ret, s.rooted(LdCachePath))
+	} else {
+		ret = append(ret, s.withHWCaps(s.configDirs(arch), arch)...)
+	}
+	var defaults []string
+	for _, p := range s.defaultLibraries(arch) {
+		defaults = append(defaults, s.rooted(p))
+	}
+	return append(ret, s.withHWCaps(defaults, arch)...)
+}
+
+// locateLibrary is a private method to determine where a library might actually
+// be found on the system
+func (s *SymbolStore) locateLibraryPaths(library string, arch Arch, rpaths, runpaths []string, libc string) []string {
+	var ret []string
+	var searchPath []string
+
+	// Explicit paths in DT_NEEDED are loaded directly without any searching
+	if strings.Contains(library, "/") {
+		if filepath.IsAbs(library) {
+			library = s.rooted(library)
+		}
+		return s.appendIfRegular(ret, library)
+	}
+	if s.pureStore != "" {
+		for _, p := range s.withHWCaps(s.pureSearchPaths(rpaths, runpaths), arch) {
+			ret = s.appendIfRegular(ret, filepath.Join(p, library))
+		}
+		return ret
+	}
+	if dirs := s.libcSearchPaths(libc, arch, rpaths, runpaths); dirs != nil {
+		for _, p := range dirs {
+			if libc == LibcOpenBSD {
+				if best := s.openbsdCandidate(p, library); best != "" {
+					ret = append(ret, best)
+					continue
+				}
+			}
+			ret = s.appendIfRegular(ret, filepath.Join(p, library))
+		}
+		return ret
+	}
+
+	// Search order is DT_RPATH (own + inherited), LD_LIBRARY_PATH, DT_RUNPATH,
+	// ld.so.cache (or ld.so.conf directories) and then the system library
+	// directories.
+	searchPath = append(searchPath, rpaths...)
+	searchPath = append(searchPath, s.libraryPath...)
+	searchPath = append(searchPath, runpaths...)
+
+	var cached []string
+	if s.ldCache != nil {
+		cached = s.cachedHWCaps(s.ldCache.Lookup(library, arch), arch)
+	} else {
+		searchPath = append(searchPath, s.configDirs(arch)...)
+	}
+
+	for _, p := range s.withHWCaps(searchPath, arch) {
+		ret = s.appendIfRegular(ret, filepath.Join(p, library))
+	}
+	for _, p := range cached {
+		ret = s.appendIfRegular(ret, s.rooted(p))
+	}
+	var defaults []string
+	for _, p := range s.defaultLibraries(arch) {
+		defaults = append(defaults, s.rooted(p))
+	}
+	for _, p := range s.withHWCaps(defaults, arch) {
+		ret = s.appendIfRegular(ret, filepath.Join(p, library))
+	}
+	return ret
+}
+
+// appendIfRegular will append the path to the list only if it exists and is
+// a regular file (or a symlink to one), either in the overlay or on disk
+func (s *SymbolStore) appendIfRegular(paths []string, fullPath string) []string {
+	if s.overlay != nil {
+		r, resolved := s.overlay.lookup(fullPath)
+		if r != nil {
+			return append(paths, fullPath)
+		}
+		fullPath = resolved
+	}
+	// Using stat not lstat..
+	st, err := os.Stat(fullPath)
+	if err != nil || !st.Mode().IsRegular() {
+		return paths
+	}
+	return append(paths, fullPath)
+}
+
+// locateLibrary will attempt to find the right architecture library using
+// the store's resolver. The returned path is where it was found, and file
+// is only set when the library has yet to be loaded into the store.
+// Candidates built for other machines are recorded in result, which may be
+// nil. A *MissingLibraryError is returned if no candidate was suitable.
+func (s *SymbolStore) locateLibrary(result *ObjectResult, library string, ctx *ResolveContext) (*Library, *elfObject, string, error) {
+	candidates, err := s.resolver.Resolve(library, ctx)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return s.fromCandidates(result, ctx.Importer, library, ctx.Arch, candidates)
+}
+
+// fromCandidates is the common end of locating a library, returning the
+// first suitable candidate, with those for other machines recorded in result
+// (if set). When nothing is suitable the *MissingLibraryError says what was
+// found instead.
+func (s *SymbolStore) fromCandidates(result *ObjectResult, importer, library string, arch Arch, candidates []Candidate) (*Library, *elfObject, string, error) {
+	var rejected []IncompatibleLibrary
+	lib, file, path, ok := s.tryCandidates(importer, library, arch, candidates, 0, &rejected)
+	if result != nil {
+		result.Incompatible = append(result.Incompatible, rejected...)
+	}
+	if ok {
+		return lib, file, path, nil
+	}
+	return nil, nil, "", &MissingLibraryError{
+		Importer: importer,
+		Library:  library,
+		Machine:  arch.Machine.String(),
+		ELFClass: arch.Class.String(),
+		Rejected: rejected,
+	}
+}
+
+// tryCandidates returns the first of the possible candidates holding an
+// object for the right machine. A linker script installed in place of a
+// library has the objects it names tried in its place, so that the real
+// library is found rather than giving up on the script. Candidates for the
+// wrong machine or class are appended to rejected.
+func (s *SymbolStore) tryCandidates(importer, library string, arch Arch, possibles []Candidate, depth int, rejected *[]IncompatibleLibrary) (*Library, *elfObject, string, bool) {
+	for _, c := range possibles {
+		p := c.Path
+
+		// Already loaded for this machine, no need to look at it again,
+		// unless it was found for another OS and has to be turned down
+		if lib := s.loadedLibrary(p, arch.Machine); lib != nil && abiMismatch(arch, lib.arch) == "" && !otherBrand(arch, lib.arch) {
+			return lib, nil, p, true
+		}
+		test, err := s.openCandidate(c)
+		if err != nil {
+			if c.Reader != nil {
+				continue
+			}
+			inputs, ok := s.linkerScript(p)
+			if !ok || depth >= maxScriptDepth {
+				continue
+			}
+			s.emit(&LinkerScriptEvent{Path: p})
+			if lib, file, path, ok := s.tryCandidates(importer, library, arch, pathCandidates(s.scriptPaths(p, inputs, arch)), depth+1, rejected); ok {
+				return lib, file, path, true
+			}
+			continue
+		}
+		// Objects branded for another operating system won't do either
+		var brand string
+		if osBrand(test.arch.OSABI) != osBrand(arch.OSABI) {
+			brand = test.arch.OSABI.String()
+		}
+		abi := abiMismatch(arch, test.arch)
+		if test.FileHeader.Machine != arch.Machine || test.FileHeader.Class != arch.Class || brand != "" || abi != "" {
+			machine := archName(test.FileHeader.Machine.String(), test.FileHeader.Class.String(), arch.Class.String())
+			if brand != "" {
+				machine += " for " + brand
+			}
+			if abi != "" {
+				machine += " with " + abi
+			}
+			s.emit(&ArchMismatchWarning{
+				Importer: importer,
+				Library:  library,
+				Path:     p,
+				Machine:  machine,
+			})
+			*rejected = append(*rejected, IncompatibleLibrary{
+				Name:    library,
+				Path:    p,
+				Machine: test.FileHeader.Machine.String(),
+				Class:   test.FileHeader.Class.String(),
+				OS:      brand,
+				ABI:     abi,
+			})
+			test.Close()
+			continue
+		}
+		s.emit(&LibraryFoundEvent{Name: library, Path: p})
+		return nil, test, p, true
+	}
+	return nil, nil, "", false
+}
+
+// AddOverlay will lay the files of the overlay over the sysroot, so that
+// they're found in preference to anything on disk. It returns the paths of
+// the ELF objects within the overlay as they are now seen by the store,
+// ready to be checked. Libraries already loaded by earlier scans are kept,
+// so this is best done before scanning begins.
+func (s *SymbolStore) AddOverlay(overlay *Overlay) []string {
+	s.config.Lock()
+	defer s.config.Unlock()
+	if s.overlay == nil {
+		s.overlay = NewOverlay()
+	}
+	s.overlay.merge(overlay, s.rooted)
+
+	objects := overlay.Objects()
+	for i := range objects {
+		objects[i] = s.rooted(objects[i])
+	}
+	return objects
+}
+
+// inOverlay determines whether the path refers to a file within the overlay
+func (s *SymbolStore) inOverlay(path string) bool {
+	if s.overlay == nil {
+		return false
+	}
+	r, _ := s.overlay.lookup(path)
+	return r != nil
+}
+
+// openFile will open the ELF object at path, from the overlay if present
+func (s *SymbolStore) openFile(path string) (*elfObject, error) {
+	if s.overlay != nil {
+		r, resolved := s.overlay.lookup(path)
+		if r != nil {
+			obj, err := newObject(r)
+			if err != nil {
+				return nil, err
+			}
+			obj.virtual = true
+			return obj, nil
+		}
+		path = resolved
+	}
+	return openObject(path)
+}
+
+// objectBucket returns the real path mapping for the machine, creating it
+// if needed. The caller must hold the write lock.
+func (s *SymbolStore) objectBucket(m elf.Machine) map[string]*Library {
+	bucket, ok := s.objects[m]
+	if !ok {
+		bucket = make(map[string]*Library)
+		s.objects[m] = bucket
+	}
+	return bucket
+}
+
+// realPath returns the path with any symlinks resolved, which for files
+// within the overlay means following the overlay's own links
+func (s *SymbolStore) realPath(path string) string {
+	if s.overlay != nil {
+		if r, resolved := s.overlay.lookup(path); r != nil {
+			return resolved
+		}
+	}
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// soname returns the DT_SONAME of the object, or an empty string
+func soname(file *elfObject) string {
+	names, err := file.DynString(elf.DT_SONAME)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
+
+// filterNames returns the DT_FILTER or DT_AUXILIARY entries of the object.
+// debug/elf refuses to hand these out as strings, so they're looked up in
+// the dynamic string table by hand.
+func filterNames(file *elfObject, tag elf.DynTag) ([]string, error) {
+	offsets, err := file.DynValue(tag)
+	if err != nil || len(offsets) == 0 {
+		return nil, err
+	}
+	dynstr := file.Section(".dynstr")
+	if dynstr == nil {
+		return nil, fmt.Errorf("%v present without .dynstr", tag)
+	}
+	data, err := sectionData(dynstr)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, off := range offsets {
+		if off >= uint64(len(data)) {
+			return nil, fmt.Errorf("%v offset %d out of range", tag, off)
+		}
+		name := data[off:]
+		if end := bytes.IndexByte(name, 0); end >= 0 {
+			name = name[:end]
+		}
+		names = append(names, string(name))
+	}
+	return names, nil
+}
+
+// storeSymbols will populate the library with the exports and version
+// definitions found in the tables.
+func (s *SymbolStore) storeSymbols(lib *Library, tables *SymbolTables) {
+	for _, v := range tables.Versions {
+		lib.AddVersion(v)
+	}
+	for i := range tables.Exports {
+		sym := &tables.Exports[i]
+		s.emit(&SymbolExportedEvent{Library: lib.Name, Symbol: sym.Name, Version: sym.Version})
+		lib.addSymbol(sym.Name, sym.Version, sym.Hidden, kindOf(sym.Type))
+	}
+}
+
+// symbolTables will return the dynamic symbol tables of the object, with
+// every name interned
+func (s *SymbolStore) symbolTables(path string, file *elfObject) (*SymbolTables, error) {
+	tables, err := s.readTables(path, file)
+	if err != nil {
+		return nil, err
+	}
+	s.names.internTables(tables)
+	return tables, nil
+}
+
+// readTables will read the dynamic symbol tables of the object, using the
+// persistent cache when one is configured.
+func (s *SymbolStore) readTables(path string, file *elfObject) (*SymbolTables, error) {
+	if s.cache == nil {
+		return readSymbolTables(file.File)
+	}
+
+	// Overlay files have no stable identity on disk, nor do those from a
+	// resolver's reader, so only cache them when they have a build-id
+	var key string
+	if file.virtual {
+		key = buildIDKey(file.File)
+	} else {
+		key = s.cache.Key(path, file.File)
+	}
+	if key == "" {
+		return readSymbolTables(file.File)
+	}
+	if tables, ok := s.cache.Get(key); ok {
+		return tables, nil
+	}
+	tables, err := readSymbolTables(file.File)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cache.Put(key, tables); err != nil {
+		s.emit(&ErrorEvent{Err: fmt.Errorf("failed to cache symbols for %s: %v", path, err)})
+	}
+	return tables, nil
+}
@@ -0,0 +1,71 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFork(t *testing.T) {
+	s := NewSymbolStore()
+	s.SetLibraryPath([]string{"/opt/lib"})
+	s.SetMaxDepth(2)
+	s.AddVDSOSymbol("__vdso_extra", "")
+	lib := NewLibrary("libc.so.6", "/lib/libc.so.6")
+	s.objectBucket(elf.EM_X86_64)[lib.Path] = lib
+	s.results = append(s.results, &ObjectResult{Path: lib.Path})
+
+	f := s.Fork()
+	if !reflect.DeepEqual(f.libraryPath, []string{"/opt/lib"}) || f.maxDepth != 2 {
+		t.Errorf("configuration not kept: %v, depth %d", f.libraryPath, f.maxDepth)
+	}
+	if len(f.objects) != 0 || len(f.results) != 0 {
+		t.Errorf("fork shares earlier scans: %v, %v", f.objects, f.results)
+	}
+	if r, ok := f.resolver.(*filesystemResolver); !ok || r.store != f {
+		t.Errorf("resolver still bound to the original store")
+	}
+
+	// Neither side sees what the other adds afterwards
+	f.AddVDSOSymbol("__vdso_fork", "")
+	if len(s.vdsoExtra) != 1 || len(f.vdsoExtra) != 2 {
+		t.Errorf("vDSO symbols shared: %v, %v", s.vdsoExtra, f.vdsoExtra)
+	}
+}
+
+func TestCheckNotObject(t *testing.T) {
+	c := NewChecker()
+	for _, data := range [][]byte{nil, []byte("#!/bin/sh\n")} {
+		path := testFile(t, "target", data)
+		result, err := c.Check(path)
+		if err != nil {
+			t.Fatalf("check of %q gave up: %v", data, err)
+		}
+		want := []UnreadableObject{{Path: path, Reason: errNotObject.Error()}}
+		if len(result.Objects) != 1 || !reflect.DeepEqual(result.Objects[0].Unreadable, want) {
+			t.Errorf("%q not reported as unreadable: %+v", data, result.Objects)
+		}
+	}
+
+	// Whereas not being able to read the file at all is still an error
+	if _, err := c.Check(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("missing target was not an error")
+	}
+}
@@ -0,0 +1,122 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// SymbolDatabase answers the questions asked of an index, whether it is an
+// Index held in memory or a DiskDatabase read as each query needs, so that
+// the index of a whole distribution needn't fit in memory. Methods are safe
+// to call from many goroutines at once.
+type SymbolDatabase interface {
+	// Providers returns every library exporting the symbol, sorted by
+	// path. An empty version matches definitions of any version.
+	Providers(symbol, version string) ([]Provider, error)
+
+	// UsersOf returns the paths of every object importing the symbol,
+	// sorted. An empty version matches references to any version.
+	UsersOf(symbol, version string) ([]string, error)
+
+	// NeededBy returns the paths of every object needing the library,
+	// sorted, including those that only need it through other libraries
+	// when transitive is set.
+	NeededBy(library string, transitive bool) ([]string, error)
+
+	// Named returns the shared libraries known by the soname or file
+	// name, in index order, or the one at the path when name has a '/'
+	Named(name string) ([]IndexedObject, error)
+
+	// Close releases whatever the database holds open
+	Close() error
+}
+
+// indexDatabase is the SymbolDatabase of an Index held in memory
+type indexDatabase struct {
+	ix *Index
+}
+
+// Database returns the index as a SymbolDatabase
+func (ix *Index) Database() SymbolDatabase {
+	return &indexDatabase{ix: ix}
+}
+
+func (d *indexDatabase) Providers(symbol, version string) ([]Provider, error) {
+	return d.ix.Providers(symbol, version), nil
+}
+
+func (d *indexDatabase) UsersOf(symbol, version string) ([]string, error) {
+	return d.ix.UsersOf(symbol, version), nil
+}
+
+func (d *indexDatabase) NeededBy(library string, transitive bool) ([]string, error) {
+	return d.ix.NeededBy(library, transitive), nil
+}
+
+func (d *indexDatabase) Named(name string) ([]IndexedObject, error) {
+	return d.ix.Named(name), nil
+}
+
+func (d *indexDatabase) Close() error {
+	return nil
+}
+
+// Named returns the shared libraries of the index known by the soname or
+// file name, in index order, or the one at the path when name has a '/'.
+// This is safe to call from many goroutines at once.
+func (ix *Index) Named(name string) []IndexedObject {
+	ix.namesOnce.Do(func() {
+		ix.names = make(map[string][]int)
+		for i := range ix.Objects {
+			for _, n := range ix.Objects[i].knownAs() {
+				ix.names[n] = append(ix.names[n], i)
+			}
+		}
+	})
+	var ret []IndexedObject
+	for _, i := range ix.names[name] {
+		if obj := &ix.Objects[i]; obj.library() {
+			ret = append(ret, *obj)
+		}
+	}
+	return ret
+}
+
+// OpenSymbolDatabase will open the database at path, which may be a JSON
+// index written by Index.Write or a file written by a DatabaseWriter. An
+// index is read into memory, while a database is only read as needed.
+func OpenSymbolDatabase(path string) (SymbolDatabase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+	if magic, _ := r.Peek(len(databaseMagic)); bytes.Equal(magic, []byte(databaseMagic)) {
+		f.Close()
+		return OpenDatabase(path)
+	}
+	defer f.Close()
+	ix, err := ReadIndex(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return ix.Database(), nil
+}
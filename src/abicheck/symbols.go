@@ -0,0 +1,216 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+)
+
+// ImportedSymbol is a reference to a symbol that must be satisfied by
+// another object at runtime. Unlike elf.ImportedSymbol this also carries
+// the binding, so that weak references can be told apart.
+type ImportedSymbol struct {
+	Name    string
+	Version string
+	Library string // Library named by the version requirement, if any
+	Binding elf.SymBind
+	Type    elf.SymType // What the object expects to find, often STT_NOTYPE
+}
+
+// Weak determines whether the dynamic linker will tolerate this reference
+// going unresolved, leaving it as a NULL address.
+func (i *ImportedSymbol) Weak() bool {
+	return i.Binding == elf.STB_WEAK
+}
+
+// String returns the conventional name@version form of the symbol
+func (i *ImportedSymbol) String() string {
+	return symbolString(i.Name, i.Version)
+}
+
+// ExportedSymbol is a symbol definition that the dynamic linker may bind
+// references from other objects against.
+type ExportedSymbol struct {
+	Name    string
+	Version string
+	Hidden  bool // Only visible to exact versioned references (sym@VER)
+	Weak    bool // STB_WEAK definition
+	IFunc   bool // STT_GNU_IFUNC, resolved at runtime by a selector
+	Unique  bool // STB_GNU_UNIQUE, one definition shared by the whole process
+	Copy    bool // Target of a copy relocation within an executable
+	Type    elf.SymType
+	Size    uint64
+}
+
+// String returns the conventional name@version form of the symbol
+func (e *ExportedSymbol) String() string {
+	return symbolString(e.Name, e.Version)
+}
+
+// VersionNeed is the set of versions an object requires from a library,
+// as found in the SHT_GNU_verneed section.
+type VersionNeed struct {
+	Library  string
+	Versions []string
+}
+
+// SymbolTables holds everything we need from the dynamic symbol table and
+// the GNU versioning sections of an object. These are the expensive parts
+// of an object to parse, so are what SymbolCache stores.
+type SymbolTables struct {
+	Versions     []string // Versions defined by the object
+	VersionNeeds []VersionNeed
+	Exports      []ExportedSymbol
+	Imports      []ImportedSymbol
+}
+
+// symbolString returns the conventional name@version form of a symbol
+func symbolString(name, version string) string {
+	if version == "" {
+		return name
+	}
+	return name + "@" + version
+}
+
+// readSymbolTables will parse the dynamic symbol tables of the file
+func readSymbolTables(file *elf.File) (*SymbolTables, error) {
+	tables := &SymbolTables{}
+
+	// Static executables have no dynamic symbols at all, so nothing to
+	// import or export
+	syms, err := file.DynamicSymbols()
+	if err == elf.ErrNoSymbols {
+		return tables, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Only executables have copy relocations, pointing at their own
+	// definitions of the data
+	var copies map[int]bool
+	if hasInterp(file) {
+		if copies, err = copyRelocations(file); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range syms {
+		sym := &syms[i]
+		if sym.Section == elf.SHN_UNDEF {
+			if imp, ok := importedSymbol(sym); ok {
+				tables.Imports = append(tables.Imports, imp)
+			}
+			continue
+		}
+		if exp, ok := exportedSymbol(sym); ok {
+			// DynamicSymbols skips the null symbol at index 0
+			exp.Copy = copies[i+1]
+			tables.Exports = append(tables.Exports, exp)
+		}
+	}
+
+	if file.SectionByType(elf.SHT_GNU_VERDEF) != nil {
+		versions, err := file.DynamicVersions()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range versions {
+			// The base definition names the library itself, not a real version
+			if v.Flags&elf.VER_FLG_BASE != 0 {
+				continue
+			}
+			tables.Versions = append(tables.Versions, v.Name)
+		}
+	}
+
+	if file.SectionByType(elf.SHT_GNU_VERNEED) != nil {
+		needs, err := file.DynamicVersionNeeds()
+		if err != nil {
+			return nil, err
+		}
+		for _, need := range needs {
+			vn := VersionNeed{Library: need.Name}
+			for _, dep := range need.Needs {
+				vn.Versions = append(vn.Versions, dep.Dep)
+			}
+			tables.VersionNeeds = append(tables.VersionNeeds, vn)
+		}
+	}
+
+	return tables, nil
+}
+
+// importedSymbol will return the reference for an undefined global or weak
+// symbol in the dynamic symbol table.
+func importedSymbol(sym *elf.Symbol) (ImportedSymbol, bool) {
+	if sym.Name == "" {
+		return ImportedSymbol{}, false
+	}
+	bind := elf.ST_BIND(sym.Info)
+	if bind != elf.STB_GLOBAL && bind != elf.STB_WEAK {
+		return ImportedSymbol{}, false
+	}
+	return ImportedSymbol{
+		Name:    sym.Name,
+		Version: sym.Version,
+		Library: sym.Library,
+		Binding: bind,
+		Type:    elf.ST_TYPE(sym.Info),
+	}, true
+}
+
+// stbGNUUnique is STB_GNU_UNIQUE, which debug/elf doesn't know about
+const stbGNUUnique elf.SymBind = 10
+
+// exportedSymbol will filter symbols that we don't actually care about for
+// linking, returning the definition if it can be bound by other objects.
+// ld.so only binds global and weak definitions with default or protected
+// visibility, anything else is only there for the object's own use.
+func exportedSymbol(sym *elf.Symbol) (ExportedSymbol, bool) {
+	if sym.Name == "" || sym.Section == elf.SHN_UNDEF {
+		return ExportedSymbol{}, false
+	}
+	if elf.ST_BIND(sym.Info) == elf.STB_LOCAL {
+		return ExportedSymbol{}, false
+	}
+	switch elf.ST_VISIBILITY(sym.Other) {
+	case elf.STV_HIDDEN, elf.STV_INTERNAL:
+		return ExportedSymbol{}, false
+	}
+	switch elf.ST_TYPE(sym.Info) {
+	case elf.STT_SECTION, elf.STT_FILE:
+		return ExportedSymbol{}, false
+	}
+	// Local version index means this isn't visible outside the object
+	if sym.HasVersion && sym.VersionIndex.Index() == 0 {
+		return ExportedSymbol{}, false
+	}
+	// Each version definition has an absolute symbol of the same name
+	if sym.Section == elf.SHN_ABS && sym.Name == sym.Version {
+		return ExportedSymbol{}, false
+	}
+	return ExportedSymbol{
+		Name:    sym.Name,
+		Version: sym.Version,
+		Hidden:  sym.HasVersion && sym.VersionIndex.IsHidden(),
+		Weak:    elf.ST_BIND(sym.Info) == elf.STB_WEAK,
+		IFunc:   elf.ST_TYPE(sym.Info) == elf.STT_GNU_IFUNC,
+		Unique:  elf.ST_BIND(sym.Info) == stbGNUUnique,
+		Type:    elf.ST_TYPE(sym.Info),
+		Size:    sym.Size,
+	}, true
+}
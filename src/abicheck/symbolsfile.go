@@ -0,0 +1,489 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SymbolsFile is a Debian symbols file, as used by dpkg-gensymbols and
+// dpkg-shlibdeps to track when each symbol of a library first appeared.
+type SymbolsFile struct {
+	Libraries []SymbolsLibrary
+}
+
+// SymbolsLibrary is the section of a symbols file for a single soname
+type SymbolsLibrary struct {
+	Soname  string
+	Package string // Package providing the soname, i.e. libfoo1
+	MinVer  string // Normally #MINVER#, substituted by dpkg
+	Symbols []SymbolsEntry
+	Extra   []string // Fields such as "* Build-Depends-Package:", kept as is
+}
+
+// SymbolsEntry is a single symbol line within a symbols file
+type SymbolsEntry struct {
+	Symbol    string // name@version, with unversioned symbols as name@Base
+	FirstSeen string // Package version the symbol appeared in
+	Missing   string // Package version the symbol vanished in, if it has
+
+	// Tags are those given in parentheses before the symbol, such as
+	// optional or arch=amd64 i386, in order
+	Tags   []string
+	Quoted bool // Whether the symbol was written in quotes
+
+	pattern *regexp.Regexp // Compiled form of a (regex) entry
+}
+
+// HasTag determines whether the entry has the tag, with or without a value
+func (e *SymbolsEntry) HasTag(name string) bool {
+	_, ok := e.tag(name)
+	return ok
+}
+
+// tag returns the value given for the named tag, i.e. amd64 for arch=amd64
+func (e *SymbolsEntry) tag(name string) (string, bool) {
+	for _, t := range e.Tags {
+		key, value, _ := strings.Cut(t, "=")
+		if key == name {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// isPattern determines whether the entry matches symbols by pattern, rather
+// than naming a single one
+func (e *SymbolsEntry) isPattern() bool {
+	return e.HasTag("symver") || e.HasTag("regex")
+}
+
+// matches determines whether the pattern entry covers the symbol, given as
+// name@version along with the version alone
+func (e *SymbolsEntry) matches(spec, version string) bool {
+	if e.HasTag("symver") {
+		return e.Symbol == version
+	}
+	if e.pattern == nil {
+		re, err := regexp.Compile(e.Symbol)
+		if err != nil {
+			return false
+		}
+		e.pattern = re
+	}
+	return e.pattern.MatchString(spec)
+}
+
+// appliesTo determines whether the entry's arch, arch-bits and arch-endian
+// tags allow for the Debian arch. Every entry applies to an unknown arch.
+func (e *SymbolsEntry) appliesTo(arch string) bool {
+	info, ok := debianArches[arch]
+	if !ok {
+		return true
+	}
+	if bits, ok := e.tag("arch-bits"); ok && bits != strconv.Itoa(info.bits) {
+		return false
+	}
+	if endian, ok := e.tag("arch-endian"); ok && endian != info.endian {
+		return false
+	}
+	spec, ok := e.tag("arch")
+	if !ok {
+		return true
+	}
+	// Either every arch is negated, or only those listed are wanted
+	fields := strings.Fields(spec)
+	negated := len(fields) > 0 && strings.HasPrefix(fields[0], "!")
+	for _, f := range fields {
+		if archMatches(strings.TrimPrefix(f, "!"), arch, info.cpu) {
+			return !negated
+		}
+	}
+	return negated
+}
+
+// debianArch describes a Debian architecture, which is always Linux here
+type debianArch struct {
+	cpu    string
+	bits   int
+	endian string
+}
+
+// debianArches are the Debian architectures arch tags are matched against
+var debianArches = map[string]debianArch{
+	"alpha":    {"alpha", 64, "little"},
+	"amd64":    {"amd64", 64, "little"},
+	"arm64":    {"arm64", 64, "little"},
+	"armel":    {"arm", 32, "little"},
+	"armhf":    {"arm", 32, "little"},
+	"hppa":     {"hppa", 32, "big"},
+	"i386":     {"i386", 32, "little"},
+	"ia64":     {"ia64", 64, "little"},
+	"loong64":  {"loong64", 64, "little"},
+	"m68k":     {"m68k", 32, "big"},
+	"mips64el": {"mips64el", 64, "little"},
+	"mipsel":   {"mipsel", 32, "little"},
+	"powerpc":  {"powerpc", 32, "big"},
+	"ppc64":    {"ppc64", 64, "big"},
+	"ppc64el":  {"ppc64el", 64, "little"},
+	"riscv64":  {"riscv64", 64, "little"},
+	"s390x":    {"s390x", 64, "big"},
+	"sh4":      {"sh4", 32, "little"},
+	"sparc64":  {"sparc64", 64, "big"},
+	"x32":      {"amd64", 32, "little"},
+}
+
+// archMatches determines whether the arch name or wildcard, such as
+// linux-any or any-arm, covers the Debian arch
+func archMatches(spec, arch, cpu string) bool {
+	switch spec {
+	case arch, "any", "linux-" + arch, "linux-any", "any-" + cpu, "linux-" + cpu:
+		return true
+	}
+	return false
+}
+
+// DebianArch returns the Debian architecture of the running system, i.e.
+// amd64, or "" when it isn't known
+func DebianArch() string {
+	switch runtime.GOARCH {
+	case "386":
+		return "i386"
+	case "arm":
+		return "armhf"
+	case "ppc64le":
+		return "ppc64el"
+	case "mips64le":
+		return "mips64el"
+	case "mipsle":
+		return "mipsel"
+	}
+	if _, ok := debianArches[runtime.GOARCH]; ok {
+		return runtime.GOARCH
+	}
+	return ""
+}
+
+// minVer is the placeholder dpkg replaces with the minimum version needed
+const minVer = "#MINVER#"
+
+// PackageName returns the Debian policy name for the package shipping the
+// soname, i.e. libfoo.so.1 is libfoo1 and libfoo-2.0.so.0 is libfoo-2.0-0.
+func PackageName(soname string) string {
+	name, version, found := strings.Cut(soname, ".so")
+	version = strings.TrimPrefix(version, ".")
+	if !found || version == "" {
+		return debianName(name)
+	}
+	if name != "" && unicode.IsDigit(rune(name[len(name)-1])) {
+		name += "-"
+	}
+	return debianName(name + version)
+}
+
+// debianName makes the name valid for a Debian package
+func debianName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "-", -1))
+}
+
+// GenerateSymbols builds the symbols file for the snapshot, as of package
+// version, with an entry for each symbol and each version node (VER@VER) as
+// dpkg-gensymbols writes them. Symbols already known to the previous symbols
+// file, if any, keep their first-seen version and tags, and those since
+// removed are marked #MISSING#. Previous entries tagged for other than the
+// Debian arch, i.e. amd64, are kept as they were.
+func GenerateSymbols(snap *Snapshot, pkg, version, arch string, previous *SymbolsFile) *SymbolsFile {
+	known := make(map[string]*SymbolsLibrary)
+	if previous != nil {
+		for i := range previous.Libraries {
+			known[previous.Libraries[i].Soname] = &previous.Libraries[i]
+		}
+	}
+
+	ret := &SymbolsFile{}
+	for i := range snap.Libraries {
+		lib := &snap.Libraries[i]
+		out := SymbolsLibrary{
+			Soname:  lib.Name,
+			Package: pkg,
+			MinVer:  minVer,
+		}
+		if out.Package == "" {
+			out.Package = PackageName(lib.Name)
+		}
+		prev, ok := known[lib.Name]
+		if ok {
+			out.Package = prev.Package
+			out.MinVer = prev.MinVer
+			out.Extra = prev.Extra
+			if pkg != "" {
+				out.Package = pkg
+			}
+		} else {
+			prev = &SymbolsLibrary{}
+		}
+		out.Symbols = matchSymbols(lib, prev.Symbols, version, arch)
+		sort.Slice(out.Symbols, func(i, j int) bool {
+			return out.Symbols[i].Symbol < out.Symbols[j].Symbol
+		})
+		ret.Libraries = append(ret.Libraries, out)
+	}
+	return ret
+}
+
+// matchSymbols returns the entries for each symbol and version node of the
+// library, carrying over those of the previous entries that match them
+func matchSymbols(lib *LibrarySnapshot, previous []SymbolsEntry, version, arch string) []SymbolsEntry {
+	var specs, names []string
+	for _, v := range lib.Versions {
+		specs = append(specs, v+"@"+v)
+		names = append(names, v)
+	}
+	for j := range lib.Symbols {
+		specs = append(specs, debianSymbol(&lib.Symbols[j]))
+		names = append(names, lib.Symbols[j].Name)
+	}
+
+	// Entries are looked up by name, or by their C++ form when tagged so
+	var ret []SymbolsEntry
+	exact := make(map[string]int)
+	cpp := make(map[string]int)
+	var patterns []int
+	for j := range previous {
+		entry := &previous[j]
+		if !entry.appliesTo(arch) {
+			ret = append(ret, *entry)
+			continue
+		}
+		switch {
+		case entry.isPattern():
+			patterns = append(patterns, j)
+		case entry.HasTag("c++"):
+			cpp[entry.Symbol] = j
+		default:
+			exact[entry.Symbol] = j
+		}
+	}
+	var demangled map[string]string
+	if len(cpp) > 0 || len(patterns) > 0 {
+		demangled = Demangle(names)
+	}
+
+	matched := make(map[int]bool)
+	for j, spec := range specs {
+		_, ver, _ := strings.Cut(spec, "@")
+		cppSpec := spec
+		if d, ok := demangled[names[j]]; ok {
+			cppSpec = d + "@" + ver
+		}
+		idx, ok := exact[spec]
+		if !ok {
+			idx, ok = cpp[cppSpec]
+		}
+		if ok {
+			entry := previous[idx]
+			entry.Missing = ""
+			ret = append(ret, entry)
+			matched[idx] = true
+			continue
+		}
+
+		// Symbols covered by a pattern aren't listed themselves
+		covered := false
+		for _, idx := range patterns {
+			entry := &previous[idx]
+			s := spec
+			if entry.HasTag("c++") {
+				s = cppSpec
+			}
+			if entry.matches(s, ver) {
+				matched[idx] = true
+				covered = true
+			}
+		}
+		if !covered {
+			ret = append(ret, SymbolsEntry{Symbol: spec, FirstSeen: version})
+		}
+	}
+
+	for j := range previous {
+		entry := previous[j]
+		if !entry.appliesTo(arch) || matched[j] && !entry.isPattern() {
+			continue
+		}
+		if matched[j] {
+			entry.Missing = ""
+		} else if entry.Missing == "" {
+			entry.Missing = version
+		}
+		ret = append(ret, entry)
+	}
+	return ret
+}
+
+// debianSymbol returns the symbol in the name@version form used by symbols
+// files, where unversioned symbols belong to the Base version.
+func debianSymbol(sym *SymbolSnapshot) string {
+	if sym.Version == "" {
+		return sym.Name + "@Base"
+	}
+	return sym.Name + "@" + sym.Version
+}
+
+// ReadSymbolsFile will parse a symbols file, including tagged entries such
+// as (optional), (arch=amd64) and (c++). Include directives aren't
+// followed.
+func ReadSymbolsFile(r io.Reader) (*SymbolsFile, error) {
+	ret := &SymbolsFile{}
+	var lib *SymbolsLibrary
+
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "#MISSING:"):
+			// Symbol line, dpkg writes these at the start of the line
+		case strings.TrimSpace(line) == "", strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "|"), strings.HasPrefix(line, "*"):
+			if lib == nil {
+				return nil, fmt.Errorf("line %d: field outside of a library", n)
+			}
+			lib.Extra = append(lib.Extra, line)
+			continue
+		case line[0] != ' ' && line[0] != '\t':
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("line %d: expected soname and package", n)
+			}
+			ret.Libraries = append(ret.Libraries, SymbolsLibrary{
+				Soname:  fields[0],
+				Package: fields[1],
+				MinVer:  strings.Join(fields[2:], " "),
+			})
+			lib = &ret.Libraries[len(ret.Libraries)-1]
+			continue
+		}
+
+		if lib == nil {
+			return nil, fmt.Errorf("line %d: symbol outside of a library", n)
+		}
+		entry, err := parseSymbolsEntry(strings.TrimSpace(line))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		lib.Symbols = append(lib.Symbols, entry)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// parseSymbolsEntry will parse a single " (tags)name@version first-seen"
+// line, which may be prefixed with "#MISSING: version#". The tags and quotes
+// around the symbol are optional.
+func parseSymbolsEntry(line string) (SymbolsEntry, error) {
+	var entry SymbolsEntry
+	if rest, ok := strings.CutPrefix(line, "#MISSING:"); ok {
+		missing, rest, ok := strings.Cut(rest, "#")
+		if !ok {
+			return entry, fmt.Errorf("unterminated #MISSING# marker")
+		}
+		entry.Missing = strings.TrimSpace(missing)
+		line = strings.TrimSpace(rest)
+	}
+	if rest, ok := strings.CutPrefix(line, "("); ok {
+		tags, rest, ok := strings.Cut(rest, ")")
+		if !ok {
+			return entry, fmt.Errorf("unterminated tags: %s", line)
+		}
+		for _, tag := range strings.Split(tags, "|") {
+			entry.Tags = append(entry.Tags, strings.TrimSpace(tag))
+		}
+		line = rest
+	}
+
+	// C++ names have spaces, so are often quoted
+	var fields []string
+	if rest, ok := strings.CutPrefix(line, "\""); ok {
+		symbol, rest, ok := strings.Cut(rest, "\"")
+		if !ok {
+			return entry, fmt.Errorf("unterminated quotes: %s", line)
+		}
+		entry.Symbol, entry.Quoted = symbol, true
+		fields = strings.Fields(rest)
+	} else if fields = strings.Fields(line); len(fields) > 0 {
+		entry.Symbol, fields = fields[0], fields[1:]
+	}
+	if entry.Symbol == "" || len(fields) < 1 {
+		return entry, fmt.Errorf("expected a symbol and version: %s", line)
+	}
+	entry.FirstSeen = fields[0]
+	if entry.HasTag("regex") {
+		re, err := regexp.Compile(entry.Symbol)
+		if err != nil {
+			return entry, fmt.Errorf("invalid regex: %v", err)
+		}
+		entry.pattern = re
+	}
+	return entry, nil
+}
+
+// String returns the entry as written in a symbols file, without the
+// #MISSING# marker
+func (e *SymbolsEntry) String() string {
+	symbol := e.Symbol
+	if e.Quoted {
+		symbol = "\"" + symbol + "\""
+	}
+	if len(e.Tags) > 0 {
+		symbol = "(" + strings.Join(e.Tags, "|") + ")" + symbol
+	}
+	return symbol + " " + e.FirstSeen
+}
+
+// Write will store the symbols file in the format expected by dpkg
+func (s *SymbolsFile) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, lib := range s.Libraries {
+		header := lib.Soname + " " + lib.Package
+		if lib.MinVer != "" {
+			header += " " + lib.MinVer
+		}
+		fmt.Fprintln(bw, header)
+		for _, extra := range lib.Extra {
+			fmt.Fprintln(bw, extra)
+		}
+		for _, sym := range lib.Symbols {
+			if sym.Missing != "" {
+				fmt.Fprintf(bw, "#MISSING: %s# %s\n", sym.Missing, sym.String())
+			} else {
+				fmt.Fprintf(bw, " %s\n", sym.String())
+			}
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,199 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSymbolsEntry(t *testing.T) {
+	tests := []struct {
+		line string
+		want SymbolsEntry
+		err  string
+	}{
+		{line: "foo@Base 1.0", want: SymbolsEntry{Symbol: "foo@Base", FirstSeen: "1.0"}},
+		{line: "foo@Base 1.0 1", want: SymbolsEntry{Symbol: "foo@Base", FirstSeen: "1.0"}},
+		{line: "#MISSING: 2.0# foo@V_1 1.0", want: SymbolsEntry{Symbol: "foo@V_1", FirstSeen: "1.0", Missing: "2.0"}},
+		{line: "(optional)foo@Base 1.0", want: SymbolsEntry{Symbol: "foo@Base", FirstSeen: "1.0", Tags: []string{"optional"}}},
+		{line: "(arch=!armel !armhf|optional)foo@Base 1.0", want: SymbolsEntry{Symbol: "foo@Base", FirstSeen: "1.0", Tags: []string{"arch=!armel !armhf", "optional"}}},
+		{line: `(c++)"foo::bar(int, char)@Base" 1.0`, want: SymbolsEntry{Symbol: "foo::bar(int, char)@Base", FirstSeen: "1.0", Tags: []string{"c++"}, Quoted: true}},
+		{line: "#MISSING: 2.0# (symver)V_1 1.0", want: SymbolsEntry{Symbol: "V_1", FirstSeen: "1.0", Missing: "2.0", Tags: []string{"symver"}}},
+		{line: "foo@Base", err: "expected a symbol and version: foo@Base"},
+		{line: "(optional foo@Base 1.0", err: "unterminated tags: (optional foo@Base 1.0"},
+		{line: `(c++)"foo(int)@Base 1.0`, err: `unterminated quotes: "foo(int)@Base 1.0`},
+		{line: "(regex)^foo(@Base 1.0", err: "invalid regex: error parsing regexp: missing closing ): `^foo(@Base`"},
+		{line: "#MISSING: 2.0 foo@Base 1.0", err: "unterminated #MISSING# marker"},
+	}
+	for _, tt := range tests {
+		got, err := parseSymbolsEntry(tt.line)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("parseSymbolsEntry(%q): got error %v, want %q", tt.line, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSymbolsEntry(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSymbolsEntry(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestAppliesTo(t *testing.T) {
+	tests := []struct {
+		tags []string
+		arch string
+		want bool
+	}{
+		{nil, "amd64", true},
+		{[]string{"optional"}, "armhf", true},
+		{[]string{"arch=amd64 i386"}, "i386", true},
+		{[]string{"arch=amd64 i386"}, "arm64", false},
+		{[]string{"arch=!armel !armhf"}, "armhf", false},
+		{[]string{"arch=!armel !armhf"}, "amd64", true},
+		{[]string{"arch=any-arm"}, "armel", true},
+		{[]string{"arch=any-amd64"}, "x32", true},
+		{[]string{"arch=linux-any"}, "s390x", true},
+		{[]string{"arch=kfreebsd-amd64"}, "amd64", false},
+		{[]string{"arch-bits=32"}, "amd64", false},
+		{[]string{"arch-bits=64", "arch-endian=big"}, "s390x", true},
+		{[]string{"arch-endian=big"}, "ppc64el", false},
+		{[]string{"arch=amd64"}, "", true},
+	}
+	for _, tt := range tests {
+		entry := SymbolsEntry{Symbol: "foo@Base", Tags: tt.tags}
+		if got := entry.appliesTo(tt.arch); got != tt.want {
+			t.Errorf("%v on %q: got %v, want %v", tt.tags, tt.arch, got, tt.want)
+		}
+	}
+}
+
+// generate returns the symbols file generated for the library as version 2,
+// given the previous file
+func generate(t *testing.T, lib LibrarySnapshot, arch, previous string) string {
+	t.Helper()
+	prev, err := ReadSymbolsFile(strings.NewReader(previous))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := GenerateSymbols(&Snapshot{Libraries: []LibrarySnapshot{lib}}, "", "2", arch, prev)
+	var buf bytes.Buffer
+	if err := out.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestGenerateSymbols(t *testing.T) {
+	lib := LibrarySnapshot{
+		Name:     "libfoo.so.1",
+		Versions: []string{"FOO_1", "FOO_2"},
+		Symbols: []SymbolSnapshot{
+			{Name: "a", Version: "FOO_1"},
+			{Name: "b", Version: "FOO_2"},
+			{Name: "c"},
+			{Name: "new"},
+		},
+	}
+	got := generate(t, lib, "amd64", `libfoo.so.1 libfoo1 #MINVER#
+* Build-Depends-Package: libfoo-dev
+ FOO_1@FOO_1 1
+ (optional)a@FOO_1 1
+ (arch=amd64)b@FOO_2 1
+ (arch=i386)i386only@Base 1
+ (optional)gone@Base 1
+ c@Base 1
+`)
+	want := `libfoo.so.1 libfoo1 #MINVER#
+* Build-Depends-Package: libfoo-dev
+ FOO_1@FOO_1 1
+ FOO_2@FOO_2 2
+ (optional)a@FOO_1 1
+ (arch=amd64)b@FOO_2 1
+ c@Base 1
+#MISSING: 2# (optional)gone@Base 1
+ (arch=i386)i386only@Base 1
+ new@Base 2
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The same entry tagged for another arch is left alone
+	got = generate(t, lib, "i386", "libfoo.so.1 libfoo1 #MINVER#\n (arch=amd64)gone@Base 1\n")
+	if !strings.Contains(got, "\n (arch=amd64)gone@Base 1\n") {
+		t.Errorf("entry for another arch was changed:\n%s", got)
+	}
+}
+
+func TestGenerateSymbolsPatterns(t *testing.T) {
+	lib := LibrarySnapshot{
+		Name:     "libfoo.so.1",
+		Versions: []string{"FOO_1"},
+		Symbols: []SymbolSnapshot{
+			{Name: "a", Version: "FOO_1"},
+			{Name: "b", Version: "FOO_1"},
+			{Name: "priv_x"},
+			{Name: "priv_y"},
+			{Name: "pub"},
+		},
+	}
+	got := generate(t, lib, "amd64", `libfoo.so.1 libfoo1 #MINVER#
+ (symver)FOO_1 1
+ (symver)FOO_0 1
+ (regex)"^priv_.*@Base$" 1
+`)
+	want := `libfoo.so.1 libfoo1 #MINVER#
+#MISSING: 2# (symver)FOO_0 1
+ (symver)FOO_1 1
+ (regex)"^priv_.*@Base$" 1
+ pub@Base 2
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGenerateSymbolsCPlusPlus(t *testing.T) {
+	if _, err := exec.LookPath("c++filt"); err != nil {
+		t.Skip("c++filt is needed to demangle")
+	}
+	lib := LibrarySnapshot{
+		Name:    "libfoo.so.1",
+		Symbols: []SymbolSnapshot{{Name: "_ZN3foo3barEic"}, {Name: "_ZN3foo3bazEv"}},
+	}
+	got := generate(t, lib, "amd64", `libfoo.so.1 libfoo1 #MINVER#
+ (c++)"foo::bar(int, char)@Base" 1
+ (c++)"foo::gone()@Base" 1
+`)
+	want := `libfoo.so.1 libfoo1 #MINVER#
+ _ZN3foo3bazEv@Base 2
+ (c++)"foo::bar(int, char)@Base" 1
+#MISSING: 2# (c++)"foo::gone()@Base" 1
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
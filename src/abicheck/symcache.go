@@ -0,0 +1,135 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"crypto/sha1"
+	"debug/elf"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// symbolCacheVersion must be bumped whenever SymbolTables, or the rules used
+// to build them, change. Entries from other versions are ignored.
+const symbolCacheVersion = 7
+
+// SymbolCache persists the parsed symbol tables of objects on disk, keyed by
+// their GNU build-id where possible, so that repeated runs over the same
+// system libraries needn't parse them again.
+type SymbolCache struct {
+	dir string
+}
+
+// symbolCacheEntry is the on-disk form of a cached object
+type symbolCacheEntry struct {
+	Version int
+	Tables  *SymbolTables
+}
+
+// DefaultSymbolCacheDir returns the per-user cache directory
+func DefaultSymbolCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "runtime-abi-check", "symbols"), nil
+}
+
+// NewSymbolCache will return a cache storing its entries within dir, which
+// is created if needed.
+func NewSymbolCache(dir string) (*SymbolCache, error) {
+	if err := os.MkdirAll(dir, 00755); err != nil {
+		return nil, err
+	}
+	return &SymbolCache{dir: dir}, nil
+}
+
+// Key returns the cache key for the object. The build-id is preferred as it
+// identifies the content itself. Objects without one fall back to their
+// path, modification time and size.
+func (c *SymbolCache) Key(path string, file *elf.File) string {
+	if key := buildIDKey(file); key != "" {
+		return key
+	}
+	var stamp string
+	if st, err := os.Stat(path); err == nil {
+		stamp = fmt.Sprintf("%s:%d:%d", path, st.ModTime().UnixNano(), st.Size())
+	} else {
+		stamp = path
+	}
+	sum := sha1.Sum([]byte(stamp))
+	return "path-" + hex.EncodeToString(sum[:])
+}
+
+// buildIDKey returns the cache key derived from the file's build-id, or an
+// empty string if it doesn't have one
+func buildIDKey(file *elf.File) string {
+	if id := BuildID(file); id != "" {
+		return "id-" + id
+	}
+	return ""
+}
+
+// entryPath returns where the entry for key lives on disk
+func (c *SymbolCache) entryPath(key string) string {
+	return filepath.Join(c.dir, key+".gob")
+}
+
+// Get will return the cached tables for the key, if present and valid
+func (c *SymbolCache) Get(key string) (*SymbolTables, bool) {
+	fi, err := os.Open(c.entryPath(key))
+	if err != nil {
+		return nil, false
+	}
+	defer fi.Close()
+
+	var entry symbolCacheEntry
+	if err := gob.NewDecoder(fi).Decode(&entry); err != nil {
+		return nil, false
+	}
+	if entry.Version != symbolCacheVersion || entry.Tables == nil {
+		return nil, false
+	}
+	return entry.Tables, true
+}
+
+// Put will store the tables under the given key, replacing the previous
+// entry atomically so that concurrent readers never see partial writes.
+func (c *SymbolCache) Put(key string, tables *SymbolTables) error {
+	tmp, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	entry := &symbolCacheEntry{
+		Version: symbolCacheVersion,
+		Tables:  tables,
+	}
+	if err = gob.NewEncoder(tmp).Encode(entry); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.entryPath(key))
+}
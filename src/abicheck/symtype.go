@@ -0,0 +1,90 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+)
+
+// symKind is the broad kind of a symbol, as far as binding against it goes
+type symKind uint8
+
+// Kinds of symbol. Only these are told apart, anything else is unknown.
+const (
+	kindUnknown symKind = iota
+	kindFunction
+	kindObject
+	kindTLS
+)
+
+// String returns the name used for the kind in reports
+func (k symKind) String() string {
+	switch k {
+	case kindFunction:
+		return "function"
+	case kindObject:
+		return "object"
+	case kindTLS:
+		return "tls"
+	}
+	return "unknown"
+}
+
+// kindOf returns the kind of symbol of the given type. IFUNCs are called
+// like any other function, and common symbols are just uninitialised data.
+func kindOf(typ elf.SymType) symKind {
+	switch typ {
+	case elf.STT_FUNC, elf.STT_GNU_IFUNC:
+		return kindFunction
+	case elf.STT_OBJECT, elf.STT_COMMON:
+		return kindObject
+	case elf.STT_TLS:
+		return kindTLS
+	}
+	return kindUnknown
+}
+
+// symbolKind returns the kind of the definition a reference to the symbol
+// binds against, which is unknown when the library doesn't provide it
+func (l *Library) symbolKind(name, version string) symKind {
+	l.loadTables()
+	for _, v := range l.symbols[name] {
+		if version == "" && v.visible || version != "" && (v.version == version || !l.Versioned()) {
+			return v.kind
+		}
+	}
+	return kindUnknown
+}
+
+// checkType will record the reference as a failure when the kind it
+// expects differs to that of the definition it was bound to
+func (s *SymbolStore) checkType(scope *processScope, result *ObjectResult, sym *ImportedSymbol, provider *Library) {
+	want := kindOf(sym.Type)
+	if want == kindUnknown {
+		return
+	}
+	version := sym.Version
+	if scope.libc == LibcMusl {
+		version = ""
+	}
+	have := provider.symbolKind(sym.Name, version)
+	if have == kindUnknown || have == want {
+		return
+	}
+	issue := &SymbolTypeError{Importer: result.Path, Symbol: sym.Name, Version: sym.Version, Type: want.String(), Provider: provider.Path, ProviderType: have.String()}
+	s.addFailure(result, issue)
+}
@@ -0,0 +1,131 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+	"path/filepath"
+	"strings"
+)
+
+// platformNames maps a machine to the value ld.so uses for $PLATFORM, which
+// is normally the AT_PLATFORM auxv entry passed by the kernel.
+var platformNames = map[elf.Machine][]string{
+	elf.EM_X86_64:  {"x86_64"},
+	elf.EM_386:     {"i686", "i586", "i386"},
+	elf.EM_AARCH64: {"aarch64"},
+	elf.EM_ARM:     {"v7l", "v6l", "v5l"},
+	elf.EM_PPC64:   {"power9", "power8"},
+	elf.EM_PPC:     {"ppc"},
+	elf.EM_S390:    {"z13", "z196"},
+	elf.EM_RISCV:   {"riscv64"},
+	elf.EM_MIPS:    {"mips"},
+}
+
+// tokenValues will return all candidate expansions for a single dynamic
+// string token, relative to the object found at basepath.
+func (s *SymbolStore) tokenValues(token, basepath string, file *elfObject) ([]string, bool) {
+	switch token {
+	case "ORIGIN":
+		// $ORIGIN is always the absolute directory of the object itself
+		basedir := filepath.Dir(basepath)
+		if abs, err := filepath.Abs(basedir); err == nil {
+			basedir = abs
+		}
+		return []string{basedir}, true
+	case "LIB":
+		var ret []string
+		for _, triplet := range MultiarchTriplets(file.arch) {
+			ret = append(ret, "lib/"+triplet)
+		}
+		return append(ret, libDirNames(file.arch)...), true
+	case "PLATFORM":
+		if platforms, ok := platformNames[file.FileHeader.Machine]; ok {
+			return platforms, true
+		}
+		return nil, true
+	default:
+		return nil, false
+	}
+}
+
+// expandTokens will perform $ORIGIN, $LIB and $PLATFORM expansion of an
+// rpath entry (in both the $TOKEN and ${TOKEN} forms) to ensure we expand all
+// possible searches. As $LIB and $PLATFORM may have multiple meanings on the
+// host this can return more than one path.
+//
+// Unknown tokens are left untouched, much the same as ld.so does.
+func (s *SymbolStore) expandTokens(rpath, basepath string, file *elfObject) []string {
+	ret := []string{""}
+
+	for len(rpath) > 0 {
+		idx := strings.IndexByte(rpath, '$')
+		if idx < 0 {
+			ret = appendAll(ret, []string{rpath})
+			break
+		}
+
+		// Carry the literal portion
+		ret = appendAll(ret, []string{rpath[:idx]})
+		rpath = rpath[idx+1:]
+
+		var token, literal string
+		if strings.HasPrefix(rpath, "{") {
+			end := strings.IndexByte(rpath, '}')
+			if end < 0 {
+				// Unterminated, treat the rest as a literal
+				ret = appendAll(ret, []string{"$" + rpath})
+				break
+			}
+			token, literal = rpath[1:end], "$"+rpath[:end+1]
+			rpath = rpath[end+1:]
+		} else {
+			end := 0
+			for end < len(rpath) && isTokenChar(rpath[end]) {
+				end++
+			}
+			token, literal = rpath[:end], "$"+rpath[:end]
+			rpath = rpath[end:]
+		}
+
+		values, known := s.tokenValues(token, basepath, file)
+		if !known {
+			ret = appendAll(ret, []string{literal})
+			continue
+		}
+		ret = appendAll(ret, values)
+	}
+
+	return ret
+}
+
+// appendAll returns the cross product of prefixes and suffixes
+func appendAll(prefixes, suffixes []string) []string {
+	ret := make([]string, 0, len(prefixes)*len(suffixes))
+	for _, p := range prefixes {
+		for _, s := range suffixes {
+			ret = append(ret, p+s)
+		}
+	}
+	return ret
+}
+
+// isTokenChar determines whether the character may be part of an unbraced
+// dynamic string token name
+func isTokenChar(c byte) bool {
+	return c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+}
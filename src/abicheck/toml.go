@@ -0,0 +1,224 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TOMLSetting is a single key read by ReadTOML, with each element of its
+// value when that's an array
+type TOMLSetting struct {
+	Table   string // Name of the enclosing [table], or "" at the top level
+	Key     string
+	Values  []string
+	Array   bool
+	Strings bool // Whether every value was a string
+	Line    int
+}
+
+// unterminatedError is returned for a string or array still open at the end
+// of the value, which for arrays means reading on into the next line
+type unterminatedError string
+
+func (e unterminatedError) Error() string {
+	return "unterminated " + string(e)
+}
+
+// ReadTOML will parse the file at path. Only the parts of TOML a flat set of
+// options needs are understood: tables, strings, integers, booleans and
+// arrays of those. Arrays may span several lines and '#' starts a comment.
+// Errors give the file and line.
+func ReadTOML(path string) ([]TOMLSetting, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	var ret []TOMLSetting
+	seen := make(map[string]bool)
+	table := ""
+	sc := bufio.NewScanner(fi)
+	lineno := 0
+	for sc.Scan() {
+		lineno++
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("%s:%d: expected [table]", path, lineno)
+			}
+			table = strings.TrimSpace(line[1 : len(line)-1])
+			if seen["["+table] {
+				return nil, fmt.Errorf("%s:%d: table %s defined twice", path, lineno, table)
+			}
+			seen["["+table] = true
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, lineno)
+		}
+		switch key[0] {
+		case '"':
+			if key, err = strconv.Unquote(key); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid key %s", path, lineno, key)
+			}
+		case '\'':
+			key = strings.Trim(key, "'")
+		}
+		value = strings.TrimSpace(value)
+		start := lineno
+		// Arrays may carry on over the following lines
+		for strings.HasPrefix(value, "[") && !arrayClosed(value) && sc.Scan() {
+			lineno++
+			value += " " + strings.TrimSpace(stripComment(sc.Text()))
+		}
+		setting, err := parseValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s: %v", path, start, key, err)
+		}
+		if seen[table+"."+key] {
+			return nil, fmt.Errorf("%s:%d: %s set twice", path, start, key)
+		}
+		seen[table+"."+key] = true
+		setting.Table, setting.Key, setting.Line = table, key, start
+		ret = append(ret, setting)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// stripComment removes any # comment from the line, leaving those within
+// strings alone
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// arrayClosed determines whether the array value is complete
+func arrayClosed(value string) bool {
+	var open unterminatedError
+	_, err := parseValue(value)
+	return !errors.As(err, &open)
+}
+
+// parseValue returns each value of a scalar or array, in string form
+func parseValue(value string) (TOMLSetting, error) {
+	ret := TOMLSetting{Strings: true}
+	if !strings.HasPrefix(value, "[") {
+		v, quoted, rest, err := parseScalar(value)
+		if err != nil {
+			return ret, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return ret, fmt.Errorf("unexpected %q after value", rest)
+		}
+		ret.Values, ret.Strings = []string{v}, quoted
+		return ret, nil
+	}
+
+	ret.Array = true
+	rest := strings.TrimSpace(value[1:])
+	for {
+		if rest == "" {
+			return ret, unterminatedError("array")
+		}
+		if rest[0] == ']' {
+			if strings.TrimSpace(rest[1:]) != "" {
+				return ret, fmt.Errorf("unexpected %q after array", rest[1:])
+			}
+			return ret, nil
+		}
+		v, quoted, after, err := parseScalar(rest)
+		if err != nil {
+			return ret, err
+		}
+		ret.Values = append(ret.Values, v)
+		ret.Strings = ret.Strings && quoted
+		rest = strings.TrimSpace(after)
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if !strings.HasPrefix(rest, "]") && rest != "" {
+			return ret, fmt.Errorf("expected , between array values")
+		}
+	}
+}
+
+// parseScalar parses the string, integer or boolean at the start of s,
+// returning it along with whatever follows
+func parseScalar(s string) (value string, quoted bool, rest string, err error) {
+	if s == "" {
+		return "", false, "", fmt.Errorf("expected a value")
+	}
+	switch s[0] {
+	case '"':
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+				continue
+			}
+			if s[i] == '"' {
+				v, err := strconv.Unquote(s[:i+1])
+				return v, true, s[i+1:], err
+			}
+		}
+		return "", false, "", unterminatedError("string")
+	case '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", false, "", unterminatedError("string")
+		}
+		return s[1 : end+1], true, s[end+2:], nil
+	}
+	end := strings.IndexAny(s, ",] \t")
+	if end < 0 {
+		end = len(s)
+	}
+	word := s[:end]
+	if word == "true" || word == "false" {
+		return word, false, s[end:], nil
+	}
+	if _, err := strconv.Atoi(strings.ReplaceAll(word, "_", "")); err == nil {
+		return strings.ReplaceAll(word, "_", ""), false, s[end:], nil
+	}
+	return "", false, "", fmt.Errorf("unsupported value %q", word)
+}
@@ -0,0 +1,159 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseScalar(t *testing.T) {
+	tests := []struct {
+		in     string
+		value  string
+		quoted bool
+		rest   string
+		err    string
+	}{
+		{in: "", err: "expected a value"},
+		{in: `"a b" # c`, value: "a b", quoted: true, rest: " # c"},
+		{in: `"tab\there", x`, value: "tab\there", quoted: true, rest: ", x"},
+		{in: `"say \"hi\""`, value: `say "hi"`, quoted: true},
+		{in: `'C:\path'`, value: `C:\path`, quoted: true},
+		{in: `"open`, err: "unterminated string"},
+		{in: `'open`, err: "unterminated string"},
+		{in: "true]", value: "true", rest: "]"},
+		{in: "false", value: "false"},
+		{in: "1_024, 2", value: "1024", rest: ", 2"},
+		{in: "-3", value: "-3"},
+		{in: "yes", err: `unsupported value "yes"`},
+	}
+	for _, tt := range tests {
+		value, quoted, rest, err := parseScalar(tt.in)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("parseScalar(%q): got error %v, want %q", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseScalar(%q): %v", tt.in, err)
+			continue
+		}
+		if value != tt.value || quoted != tt.quoted || rest != tt.rest {
+			t.Errorf("parseScalar(%q) = %q, %v, %q; want %q, %v, %q", tt.in, value, quoted, rest, tt.value, tt.quoted, tt.rest)
+		}
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		in      string
+		values  []string
+		array   bool
+		strings bool
+		err     string
+	}{
+		{in: `"x"`, values: []string{"x"}, strings: true},
+		{in: "8", values: []string{"8"}},
+		{in: `"x" y`, err: `unexpected " y" after value`},
+		{in: "[]", array: true, strings: true},
+		{in: `["a", 'b',]`, values: []string{"a", "b"}, array: true, strings: true},
+		{in: `["a", 2]`, values: []string{"a", "2"}, array: true},
+		{in: `["a" "b"]`, err: "expected , between array values"},
+		{in: `["a"] x`, err: `unexpected " x" after array`},
+		{in: `["a",`, err: "unterminated array"},
+		{in: `[,]`, err: `unsupported value ""`},
+	}
+	for _, tt := range tests {
+		got, err := parseValue(tt.in)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("parseValue(%q): got error %v, want %q", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseValue(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Values, tt.values) || got.Array != tt.array || got.Strings != tt.strings {
+			t.Errorf("parseValue(%q) = %+v", tt.in, got)
+		}
+	}
+}
+
+func TestReadTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []TOMLSetting
+		err  string
+	}{
+		{
+			name: "tables",
+			in: `jobs = 4 # trailing
+"quoted key" = "a # not a comment"
+
+[profile.ci]
+'literal' = [
+	"x", # first
+	"y",
+]
+`,
+			want: []TOMLSetting{
+				{Key: "jobs", Values: []string{"4"}, Line: 1},
+				{Key: "quoted key", Values: []string{"a # not a comment"}, Strings: true, Line: 2},
+				{Table: "profile.ci", Key: "literal", Values: []string{"x", "y"}, Array: true, Strings: true, Line: 5},
+			},
+		},
+		{name: "empty value", in: "a =\n", err: "t.toml:1: a: expected a value"},
+		{name: "no equals", in: "\n\na\n", err: "t.toml:3: expected key = value"},
+		{name: "bad table", in: "[[x]]\n", err: "t.toml:1: expected [table]"},
+		{name: "duplicate key", in: "a = 1\na = 2\n", err: "t.toml:2: a set twice"},
+		{name: "duplicate table", in: "[x]\n[y]\n[x]\n", err: "t.toml:3: table x defined twice"},
+		{name: "same key in tables", in: "a = 1\n[x]\na = 2\n", want: []TOMLSetting{
+			{Key: "a", Values: []string{"1"}, Line: 1},
+			{Table: "x", Key: "a", Values: []string{"2"}, Line: 3},
+		}},
+		{name: "unterminated array", in: "a = [\n\"x\",\n", err: "t.toml:1: a: unterminated array"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, "t.toml")
+		if err := os.WriteFile(path, []byte(tt.in), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadTOML(path)
+		if tt.err != "" {
+			if err == nil || strings.TrimPrefix(err.Error(), dir+"/") != tt.err {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
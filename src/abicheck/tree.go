@@ -0,0 +1,102 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteTree will write the dependency tree of each target within the objects
+// much like ldd or lddtree would, but without running anything. Each
+// DT_NEEDED entry shows where it was found and how many symbols failed to
+// resolve within that object. Objects already shown within a tree aren't
+// expanded again, so cycles end there.
+func WriteTree(w io.Writer, objects []*ObjectResult) error {
+	bw := bufio.NewWriter(w)
+
+	// Libraries only have a result in the first target that loaded them
+	byPath := make(map[string]*ObjectResult)
+	for _, obj := range objects {
+		if _, ok := byPath[obj.Path]; !ok {
+			byPath[obj.Path] = obj
+		}
+	}
+
+	var walk func(obj *ObjectResult, indent int, shown map[string]bool)
+	walk = func(obj *ObjectResult, indent int, shown map[string]bool) {
+		prefix := strings.Repeat("    ", indent)
+		node := func(kind string, lib LibraryResult) {
+			label := lib.Name
+			if kind != "" {
+				label = kind + " " + label
+			}
+			if lib.Path == "" {
+				fmt.Fprintf(bw, "%s%s => not found\n", prefix, label)
+				return
+			}
+			dep := byPath[lib.Path]
+			fmt.Fprintf(bw, "%s%s => %s%s\n", prefix, label, lib.Path, treeNotes(dep))
+			if dep == nil || shown[lib.Path] {
+				return
+			}
+			shown[lib.Path] = true
+			walk(dep, indent+1, shown)
+		}
+		for _, lib := range obj.Preloaded {
+			node("preload", lib)
+		}
+		for _, lib := range obj.Filtees {
+			node("filtee", lib)
+		}
+		for _, lib := range obj.Libraries {
+			node("", lib)
+		}
+		for _, lib := range obj.Dlopened {
+			node("dlopen", lib)
+		}
+	}
+
+	for _, obj := range objects {
+		if !obj.Target {
+			continue
+		}
+		fmt.Fprintf(bw, "%s%s\n", obj.Path, treeNotes(obj))
+		walk(obj, 1, map[string]bool{obj.Path: true})
+	}
+	return bw.Flush()
+}
+
+// treeNotes returns the annotations for the object in the tree, describing
+// how many of its symbols failed to resolve
+func treeNotes(obj *ObjectResult) string {
+	if obj == nil {
+		return ""
+	}
+	unresolved := 0
+	for _, err := range obj.Failures {
+		if ClassOf(err) == IssueUnresolvedSymbol {
+			unresolved++
+		}
+	}
+	if unresolved == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d unresolved)", unresolved)
+}
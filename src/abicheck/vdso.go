@@ -0,0 +1,208 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"debug/elf"
+)
+
+// vdsoImage describes the symbols exported by the kernel's vDSO for a single
+// architecture. The vDSO is mapped into every process by the kernel itself,
+// so there's no file on disk to load it from.
+type vdsoImage struct {
+	name    string // The soname the kernel gives it
+	version string
+	symbols []string
+}
+
+// vdsoImages is the set of vDSO exports known per machine, taken from the
+// linker scripts within the kernel tree. Exports only present in newer
+// kernels are included, just in case.
+var vdsoImages = map[elf.Machine]vdsoImage{
+	elf.EM_X86_64: {
+		name:    "linux-vdso.so.1",
+		version: "LINUX_2.6",
+		symbols: []string{
+			"clock_gettime", "__vdso_clock_gettime",
+			"gettimeofday", "__vdso_gettimeofday",
+			"getcpu", "__vdso_getcpu",
+			"time", "__vdso_time",
+			"clock_getres", "__vdso_clock_getres",
+			"__vdso_sgx_enter_enclave",
+			"getrandom", "__vdso_getrandom",
+		},
+	},
+	elf.EM_386: {
+		name:    "linux-gate.so.1",
+		version: "LINUX_2.6",
+		symbols: []string{
+			"__vdso_clock_gettime",
+			"__vdso_gettimeofday",
+			"__vdso_time",
+			"__vdso_clock_getres",
+			"__vdso_clock_gettime64",
+			"__vdso_clock_getres_time64",
+			"__vdso_getcpu",
+		},
+	},
+	elf.EM_AARCH64: {
+		name:    "linux-vdso.so.1",
+		version: "LINUX_2.6.39",
+		symbols: []string{
+			"__kernel_rt_sigreturn",
+			"__kernel_gettimeofday",
+			"__kernel_clock_gettime",
+			"__kernel_clock_getres",
+			"__kernel_getrandom",
+		},
+	},
+	elf.EM_ARM: {
+		name:    "linux-vdso.so.1",
+		version: "LINUX_2.6",
+		symbols: []string{
+			"__vdso_gettimeofday",
+			"__vdso_clock_gettime",
+			"__vdso_clock_gettime64",
+			"__vdso_clock_getres",
+		},
+	},
+	elf.EM_PPC64: {
+		name:    "linux-vdso64.so.1",
+		version: "LINUX_2.6.15",
+		symbols: []string{
+			"__kernel_get_syscall_map",
+			"__kernel_gettimeofday",
+			"__kernel_clock_gettime",
+			"__kernel_clock_getres",
+			"__kernel_get_tbfreq",
+			"__kernel_sync_dicache",
+			"__kernel_sigtramp_rt64",
+			"__kernel_getcpu",
+			"__kernel_time",
+			"__kernel_getrandom",
+		},
+	},
+	elf.EM_RISCV: {
+		name:    "linux-vdso.so.1",
+		version: "LINUX_4.15",
+		symbols: []string{
+			"__vdso_rt_sigreturn",
+			"__vdso_gettimeofday",
+			"__vdso_clock_gettime",
+			"__vdso_clock_getres",
+			"__vdso_getcpu",
+			"__vdso_flush_icache",
+			"__vdso_riscv_hwprobe",
+			"__vdso_getrandom",
+		},
+	},
+	elf.EM_S390: {
+		name:    "linux-vdso64.so.1",
+		version: "LINUX_2.6.29",
+		symbols: []string{
+			"__kernel_gettimeofday",
+			"__kernel_clock_gettime",
+			"__kernel_clock_getres",
+			"__kernel_getcpu",
+			"__kernel_restart_syscall",
+			"__kernel_rt_sigreturn",
+			"__kernel_sigreturn",
+			"__kernel_getrandom",
+		},
+	},
+}
+
+// vdsoPath stands in for the path of the vDSO, which has no file
+const vdsoPath = "[vdso]"
+
+// AddVDSOSymbol will add an extra export to the vDSO of every architecture,
+// for kernels providing more than we know about. An empty version uses
+// the architecture's usual vDSO version.
+func (s *SymbolStore) AddVDSOSymbol(name, version string) {
+	s.config.Lock()
+	defer s.config.Unlock()
+	s.vdsoExtra = append(s.vdsoExtra, ExportedSymbol{Name: name, Version: version})
+
+	// Later scans need to see it in a fresh vDSO
+	s.mu.Lock()
+	s.vdso = make(map[elf.Machine]*Library)
+	s.mu.Unlock()
+}
+
+// vdsoLibrary returns the synthetic library representing the vDSO for the
+// machine, or nil if we know nothing about it.
+func (s *SymbolStore) vdsoLibrary(arch Arch) *Library {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lib, ok := s.vdso[arch.Machine]; ok {
+		return lib
+	}
+
+	image, known := vdsoImages[arch.Machine]
+	if !known && len(s.vdsoExtra) == 0 {
+		s.vdso[arch.Machine] = nil
+		return nil
+	}
+	if image.name == "" {
+		image.name = "linux-vdso.so.1"
+	}
+
+	tables := &SymbolTables{}
+	if image.version != "" {
+		tables.Versions = append(tables.Versions, image.version)
+	}
+	for _, name := range image.symbols {
+		tables.Exports = append(tables.Exports, ExportedSymbol{Name: name, Version: image.version})
+	}
+	for _, sym := range s.vdsoExtra {
+		if sym.Version == "" {
+			sym.Version = image.version
+		}
+		if sym.Version != "" && !hasString(tables.Versions, sym.Version) {
+			tables.Versions = append(tables.Versions, sym.Version)
+		}
+		tables.Exports = append(tables.Exports, sym)
+	}
+
+	lib := NewLibrary(image.name, vdsoPath)
+	lib.Soname = image.name
+	lib.arch = arch
+	lib.shared = true
+	lib.tables = tables
+	lib.reported = true
+	s.storeSymbols(lib, tables)
+	lib.markReady()
+	s.vdso[arch.Machine] = lib
+	return lib
+}
+
+// addVDSO will append the vDSO to the end of the scope, as Linux maps it
+// into every process. Libraries are always loaded into one, so they get
+// it too.
+func (s *SymbolStore) addVDSO(scope *processScope, root *scopeEntry) {
+	if !isLinuxLibc(scope.libc) {
+		return
+	}
+	lib := s.vdsoLibrary(root.lib.arch)
+	if lib == nil {
+		return
+	}
+	scope.add(&scopeEntry{
+		lib:  lib,
+		path: vdsoPath,
+	}, vdsoPath, lib.Name)
+}
@@ -0,0 +1,134 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VersionRequirement is the newest version an object requires from a single
+// version namespace, such as GLIBC or GLIBCXX.
+type VersionRequirement struct {
+	Namespace string   `json:"namespace"`
+	Version   string   `json:"version"`           // Full version name, i.e. GLIBC_2.34
+	Library   string   `json:"library,omitempty"` // Library the version was needed from
+	Symbols   []string `json:"symbols,omitempty"` // Imports requiring exactly this version
+}
+
+// SplitVersion will split a version name such as GLIBCXX_3.4.29 into its
+// namespace and numeric components. Names without a numeric suffix, like
+// GLIBC_PRIVATE, are not ordered and return ok as false.
+func SplitVersion(version string) (namespace string, parts []int, ok bool) {
+	idx := strings.LastIndexByte(version, '_')
+	if idx < 1 || idx == len(version)-1 {
+		return "", nil, false
+	}
+	for _, field := range strings.Split(version[idx+1:], ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return "", nil, false
+		}
+		parts = append(parts, n)
+	}
+	return version[:idx], parts, true
+}
+
+// compareVersionParts returns -1, 0 or 1 depending on whether a is older,
+// the same as or newer than b. Missing components count as zero.
+func compareVersionParts(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// RequiredVersions will return the newest version needed from each version
+// namespace by the object at path, sorted by namespace. This tells you
+// the oldest runtime (i.e. distro glibc) that the object can load with.
+func RequiredVersions(path string) ([]VersionRequirement, error) {
+	file, err := openObject(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tables, err := readSymbolTables(file.File)
+	if err != nil {
+		return nil, err
+	}
+	return requiredVersions(tables), nil
+}
+
+// requiredVersions computes the newest version per namespace from tables
+func requiredVersions(tables *SymbolTables) []VersionRequirement {
+	type newest struct {
+		req   VersionRequirement
+		parts []int
+	}
+	found := make(map[string]*newest)
+
+	for _, need := range tables.VersionNeeds {
+		for _, version := range need.Versions {
+			ns, parts, ok := SplitVersion(version)
+			if !ok {
+				continue
+			}
+			cur, ok := found[ns]
+			if ok && compareVersionParts(parts, cur.parts) <= 0 {
+				continue
+			}
+			found[ns] = &newest{
+				req: VersionRequirement{
+					Namespace: ns,
+					Version:   version,
+					Library:   need.Library,
+				},
+				parts: parts,
+			}
+		}
+	}
+
+	ret := make([]VersionRequirement, 0, len(found))
+	for _, n := range found {
+		req := n.req
+		for _, sym := range tables.Imports {
+			if sym.Version == req.Version {
+				req.Symbols = append(req.Symbols, sym.Name)
+			}
+		}
+		sort.Strings(req.Symbols)
+		ret = append(ret, req)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Namespace < ret[j].Namespace
+	})
+	return ret
+}
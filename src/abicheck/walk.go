@@ -0,0 +1,71 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"bytes"
+	"debug/elf"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// IsDynamicELF determines whether the file at path is an ELF executable or
+// shared library, by checking the magic rather than trusting the filename.
+func IsDynamicELF(path string) bool {
+	fi, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer fi.Close()
+
+	magic := make([]byte, len(elf.ELFMAG))
+	if _, err := io.ReadFull(fi, magic); err != nil {
+		return false
+	}
+	if !bytes.Equal(magic, []byte(elf.ELFMAG)) {
+		return false
+	}
+
+	file, err := elf.NewFile(fi)
+	if err != nil {
+		// Still an ELF file, let the scan report why it can't be read
+		return true
+	}
+	switch file.FileHeader.Type {
+	case elf.ET_EXEC, elf.ET_DYN:
+		return true
+	default:
+		// Relocatable objects and core files can't be resolved
+		return false
+	}
+}
+
+// WalkELF will walk the directory tree at root, calling fn for every ELF
+// executable or shared library found. Symlinks aren't followed so that
+// each object is only seen once.
+func WalkELF(root string, fn func(path string) error) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || !IsDynamicELF(path) {
+			return nil
+		}
+		return fn(path)
+	})
+}
@@ -0,0 +1,116 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abicheck
+
+import (
+	"path/filepath"
+)
+
+// DependencyLink is a single DT_NEEDED edge along a DependencyChain
+type DependencyLink struct {
+	Importer string   // Name of the object needing the library
+	Library  string   // DT_NEEDED entry
+	Path     string   // Where the library was found
+	Symbols  []string // Imports of the importer bound to the library
+}
+
+// DependencyChain is one way for a target to end up loading a library,
+// starting from the target's own DT_NEEDED entries
+type DependencyChain []DependencyLink
+
+// maxChains stops WhyLoaded from listing every one of the exponentially many
+// routes through a densely linked closure
+const maxChains = 1000
+
+// WhyLoaded returns every chain of DT_NEEDED entries leading from the target
+// to the library, given the objects from checking the target. The library
+// is matched by its DT_NEEDED name, soname or file name. complete is false
+// if there were too many chains to list them all.
+func WhyLoaded(objects []*ObjectResult, target, library string) (chains []DependencyChain, complete bool) {
+	byPath := make(map[string]*ObjectResult)
+	var root *ObjectResult
+	for _, obj := range objects {
+		if _, ok := byPath[obj.Path]; !ok {
+			byPath[obj.Path] = obj
+		}
+		if obj.Target && obj.Path == target && root == nil {
+			root = obj
+		}
+	}
+	if root == nil {
+		return nil, true
+	}
+
+	matches := func(lib LibraryResult) bool {
+		if lib.Name == library || (lib.Path != "" && filepath.Base(lib.Path) == library) {
+			return true
+		}
+		obj := byPath[lib.Path]
+		return obj != nil && obj.Soname == library
+	}
+
+	complete = true
+	onPath := map[string]bool{root.Path: true}
+	var chain DependencyChain
+	var walk func(obj *ObjectResult)
+	walk = func(obj *ObjectResult) {
+		for _, lib := range obj.Libraries {
+			if len(chains) >= maxChains {
+				complete = false
+				return
+			}
+			if lib.Path == "" || onPath[lib.Path] {
+				continue
+			}
+			chain = append(chain, DependencyLink{
+				Importer: objectName(obj),
+				Library:  lib.Name,
+				Path:     lib.Path,
+				Symbols:  symbolsFrom(obj, lib.Path),
+			})
+			if matches(lib) {
+				chains = append(chains, append(DependencyChain(nil), chain...))
+			} else if dep := byPath[lib.Path]; dep != nil {
+				onPath[lib.Path] = true
+				walk(dep)
+				delete(onPath, lib.Path)
+			}
+			chain = chain[:len(chain)-1]
+		}
+	}
+	walk(root)
+	return chains, complete
+}
+
+// objectName returns the name the object is best known by
+func objectName(obj *ObjectResult) string {
+	if obj.Soname != "" {
+		return obj.Soname
+	}
+	return filepath.Base(obj.Path)
+}
+
+// symbolsFrom returns the imports of the object bound to the library at path
+func symbolsFrom(obj *ObjectResult, path string) []string {
+	var ret []string
+	for _, sym := range obj.Symbols {
+		if sym.ProviderPath == path {
+			ret = append(ret, symbolString(sym.Name, sym.Version))
+		}
+	}
+	return ret
+}
@@ -0,0 +1,87 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Command is a single subcommand of runtime-abi-check
+type Command struct {
+	Name  string        // Name used on the command line
+	Usage string        // Argument summary, i.e. "[flags] [path...]"
+	Short string        // One line description for the help
+	Flags *flag.FlagSet // Command specific flags
+
+	// Run will be invoked with the remaining positional arguments
+	Run func(cmd *Command, args []string) error
+}
+
+// commands is the set of all registered subcommands
+var commands = make(map[string]*Command)
+
+// defaultCommand is used when the first argument isn't a known command,
+// preserving the original "runtime-abi-check [path...]" behaviour.
+const defaultCommand = "scan"
+
+// registerCommand will make the command available to the command line,
+// creating its FlagSet if needed.
+func registerCommand(cmd *Command) {
+	setupCommand(cmd)
+	commands[cmd.Name] = cmd
+}
+
+// setupCommand prepares the flags and usage of the command without making
+// it available at the top level, as with the subcommands of store
+func setupCommand(cmd *Command) {
+	if cmd.Flags == nil {
+		cmd.Flags = flag.NewFlagSet(cmd.Name, flag.ExitOnError)
+	}
+	addConfigFlags(cmd.Flags)
+	cmd.Flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s %s %s\n\n%s\n\n", os.Args[0], cmd.Name, cmd.Usage, cmd.Short)
+		cmd.Flags.PrintDefaults()
+	}
+}
+
+// usage will print the command line help for runtime-abi-check
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [command] [flags] [args...]\n\nCommands:\n", os.Args[0])
+
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "    %-12s %s\n", name, commands[name].Short)
+	}
+	fmt.Fprintf(os.Stderr, "\nWith no command, %s is assumed.\n", defaultCommand)
+}
+
+// runCommand will apply the project configuration and parse the flags for
+// the command, then execute it
+func runCommand(cmd *Command, args []string) error {
+	if err := loadConfig(cmd, args); err != nil {
+		return err
+	}
+	cmd.Flags.Parse(args)
+	return cmd.Run(cmd, cmd.Flags.Args())
+}
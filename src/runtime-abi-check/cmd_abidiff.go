@@ -0,0 +1,79 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"fmt"
+	"os"
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "abidiff",
+		Usage: "[flags] <old library> <new library>",
+		Short: "Report exported ABI changes between two builds of a library",
+		Run:   abidiffCommand,
+	}
+	registerCommand(cmd)
+	cmd.Flags.StringVar(&outputFormat, "format", "text", "Output format (text, json)")
+}
+
+// additionsError is returned when the new library only adds to the old one,
+// which existing users won't notice
+type additionsError int
+
+func (a additionsError) Error() string {
+	return fmt.Sprintf("%d compatible ABI addition(s)", int(a))
+}
+
+// abidiffCommand will compare two libraries directly, failing with
+// exitError if anything was broken or exitWarning if anything was added
+func abidiffCommand(cmd *Command, args []string) error {
+	if len(args) != 2 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+
+	switch outputFormat {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown output format: %s", outputFormat)
+	}
+
+	old, err := abicheck.SnapshotLibrary(args[0])
+	if err != nil {
+		return fmt.Errorf("%s: %v", args[0], err)
+	}
+	new, err := abicheck.SnapshotLibrary(args[1])
+	if err != nil {
+		return fmt.Errorf("%s: %v", args[1], err)
+	}
+
+	changes := abicheck.DiffLibraries(old, new)
+	breaking, err := printChanges(changes)
+	if err != nil {
+		return err
+	}
+	if breaking > 0 {
+		return breakingError(breaking)
+	}
+	if len(changes) > 0 {
+		return additionsError(len(changes))
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"fmt"
+	"os"
+)
+
+var (
+	// hostLibs are extra patterns of libraries expected from the host
+	hostLibs stringList
+
+	// noDefaultHostLibs drops abicheck.DefaultHostLibraries from the list
+	noDefaultHostLibs bool
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "appimage",
+		Usage: "[flags] <AppImage or AppDir>",
+		Short: "Check that an AppImage only uses the host libraries it is expected to",
+		Run:   appImageCommand,
+	}
+	registerCommand(cmd)
+	addStoreFlags(cmd.Flags)
+	addReportFlags(cmd.Flags)
+	cmd.Flags.Var(&hostLibs, "host-lib", "Library (glob pattern) the AppImage may take from the host (may be repeated)")
+	cmd.Flags.BoolVar(&noDefaultHostLibs, "no-default-host-libs", false, "Don't expect glibc and libGL from the host")
+}
+
+// appImageCommand will extract the AppImage and check all of its ELF files,
+// searching its bundled library directories as AppRun does, and report any
+// library that comes from the host without being expected to.
+func appImageCommand(cmd *Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	if sysroot != "" {
+		return fmt.Errorf("-sysroot cannot be used with AppImages, they run on the host")
+	}
+
+	if err := checkFormat(); err != nil {
+		return err
+	}
+	policy, err := newPolicy()
+	if err != nil {
+		return err
+	}
+
+	app, err := abicheck.OpenAppImage(args[0])
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	libraryPaths = append(app.LibraryDirs(), libraryPaths...)
+	checker, err := newChecker()
+	if err != nil {
+		return err
+	}
+	allowed := append([]string{}, hostLibs...)
+	if !noDefaultHostLibs {
+		allowed = append(allowed, abicheck.DefaultHostLibraries...)
+	}
+	checker.Store.SetSelfContained(app.Root, allowed)
+	checker.Store.SetReportDuplicates(policy.Severity(abicheck.IssueDuplicateSymbol) != abicheck.SeverityIgnore)
+	checker.Store.SetReportShadowed(policy.Severity(abicheck.IssueShadowedLibrary) != abicheck.SeverityIgnore)
+	checker.Store.SetReportFeatures(policy.Severity(abicheck.IssueCPUFeature) != abicheck.SeverityIgnore)
+	reporter := newReporter(policy)
+	checker.SetReporter(reporter)
+	ctx, cancel := scanContext()
+	defer cancel()
+	results, err := checker.CheckTreeContext(ctx, app.Root, jobs)
+	if err != nil {
+		return scanError(err)
+	}
+	app.Rebase(results)
+	return report(results, policy, reporter)
+}
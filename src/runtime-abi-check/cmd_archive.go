@@ -0,0 +1,120 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// archiveFormat is the output format of the archive command
+var archiveFormat string
+
+func init() {
+	cmd := &Command{
+		Name:  "archive",
+		Usage: "[flags] <lib.a>...",
+		Short: "Print the shared libraries a static archive drags into the link",
+		Run:   archiveCommand,
+	}
+	registerCommand(cmd)
+	cmd.Flags.StringVar(&archiveFormat, "format", "text", "Output format: text or json")
+	cmd.Flags.StringVar(&indexPath, "index", "", "Find providers within this index instead of the system libraries")
+	cmd.Flags.StringVar(&sysroot, "sysroot", "", "Find providers within this target root filesystem")
+	cmd.Flags.IntVar(&jobs, "jobs", runtime.NumCPU(), "Number of files to read in parallel")
+}
+
+// systemIndex returns the index or database given with -index, or otherwise
+// indexes the system libraries (of the -sysroot)
+func systemIndex() (abicheck.SymbolDatabase, error) {
+	if indexPath != "" {
+		return loadIndex(nil)
+	}
+	store := abicheck.NewSymbolStore()
+	if sysroot != "" {
+		if err := store.SetSysroot(sysroot); err != nil {
+			return nil, err
+		}
+	}
+	libs, err := store.SystemLibraries()
+	if err != nil {
+		return nil, err
+	}
+	index, err := abicheck.BuildIndex(libs, jobs)
+	if err != nil {
+		return nil, err
+	}
+	return index.Database(), nil
+}
+
+// archiveCommand will print the external symbols of each archive by the
+// library providing them, along with any that nothing provides
+func archiveCommand(cmd *Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	if archiveFormat != "text" && archiveFormat != "json" {
+		return fmt.Errorf("unknown output format: %s", archiveFormat)
+	}
+
+	var archives []*abicheck.Archive
+	for _, path := range args {
+		arc, err := abicheck.ReadArchive(path)
+		if err != nil {
+			return err
+		}
+		archives = append(archives, arc)
+	}
+	db, err := systemIndex()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var reqs []*abicheck.ArchiveRequirements
+	for _, arc := range archives {
+		req, err := arc.Requirements(db)
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, req)
+	}
+	if archiveFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(reqs)
+	}
+	for _, req := range reqs {
+		fmt.Printf("%s:\n", req.Path)
+		for _, lib := range req.Libraries {
+			fmt.Printf("    %s (%s): %s\n", lib.Library, lib.Path, strings.Join(lib.Symbols, " "))
+		}
+		if len(req.Unresolved) > 0 {
+			var names []string
+			for _, sym := range req.Unresolved {
+				names = append(names, sym.Name)
+			}
+			fmt.Printf("    not found: %s\n", strings.Join(names, " "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "compare",
+		Usage: "[flags] <rootA> <rootB>",
+		Short: "Report objects of one tree that would break against the libraries of another",
+		Run:   compareCommand,
+	}
+	registerCommand(cmd)
+	cmd.Flags.StringVar(&outputFormat, "format", "text", "Output format (text, json)")
+	cmd.Flags.IntVar(&jobs, "jobs", runtime.NumCPU(), "Number of files to read in parallel")
+}
+
+// regressionError is returned when objects of the first tree would stop
+// resolving within the second
+type regressionError int
+
+func (r regressionError) Error() string {
+	return fmt.Sprintf("%d object(s) would no longer resolve", int(r))
+}
+
+// compareIndex will index the tree at path, or read it if path is an index
+// written by the index command
+func compareIndex(path string) (*abicheck.Index, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		index, err := abicheck.BuildIndex([]string{path}, jobs)
+		if err != nil {
+			return nil, err
+		}
+		index.TrimRoot(path)
+		return index, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	index, err := abicheck.ReadIndex(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return index, nil
+}
+
+// compareCommand will check every object of the first tree against the
+// libraries of the second, failing if any would regress
+func compareCommand(cmd *Command, args []string) error {
+	if len(args) != 2 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+
+	switch outputFormat {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown output format: %s", outputFormat)
+	}
+
+	a, err := compareIndex(args[0])
+	if err != nil {
+		return err
+	}
+	b, err := compareIndex(args[1])
+	if err != nil {
+		return err
+	}
+	regressions := a.Compare(b)
+
+	if outputFormat == "json" {
+		if regressions == nil {
+			regressions = []abicheck.Regression{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(regressions); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range regressions {
+			name := r.Path
+			if r.Package != "" {
+				name += " (" + r.Package + ")"
+			}
+			fmt.Println(name)
+			if len(r.Libraries) > 0 {
+				fmt.Printf("    missing libraries: %s\n", strings.Join(r.Libraries, ", "))
+			}
+			if len(r.Symbols) > 0 {
+				fmt.Printf("    missing symbols: %s\n", strings.Join(r.Symbols, ", "))
+			}
+		}
+	}
+
+	if len(regressions) > 0 {
+		return regressionError(len(regressions))
+	}
+	return nil
+}
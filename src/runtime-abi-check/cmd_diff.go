@@ -0,0 +1,124 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "diff",
+		Usage: "[flags] old.json new.json",
+		Short: "Report ABI changes between two snapshots of the same libraries",
+		Run:   diffCommand,
+	}
+	registerCommand(cmd)
+	cmd.Flags.StringVar(&outputFormat, "format", "text", "Output format (text, json)")
+}
+
+// breakingError is returned when the snapshots differ in a way that breaks
+// existing users of the old libraries
+type breakingError int
+
+func (b breakingError) Error() string {
+	return fmt.Sprintf("%d breaking ABI change(s)", int(b))
+}
+
+// readSnapshot will load the snapshot stored at path
+func readSnapshot(path string) (*abicheck.Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	snap, err := abicheck.ReadSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return snap, nil
+}
+
+// diffCommand will compare two snapshots, failing if anything was broken
+func diffCommand(cmd *Command, args []string) error {
+	if len(args) != 2 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+
+	switch outputFormat {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown output format: %s", outputFormat)
+	}
+
+	old, err := readSnapshot(args[0])
+	if err != nil {
+		return err
+	}
+	new, err := readSnapshot(args[1])
+	if err != nil {
+		return err
+	}
+
+	changes := abicheck.DiffSnapshots(old, new)
+	breaking, err := printChanges(changes)
+	if err != nil {
+		return err
+	}
+	if breaking > 0 {
+		return breakingError(breaking)
+	}
+	return nil
+}
+
+// printChanges will write the changes in the output format, returning how
+// many of them were breaking
+func printChanges(changes []abicheck.ABIChange) (int, error) {
+	breaking := 0
+	for i := range changes {
+		if changes[i].Kind.Breaking() {
+			breaking++
+		}
+	}
+
+	if outputFormat == "json" {
+		if changes == nil {
+			changes = []abicheck.ABIChange{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		err := enc.Encode(&struct {
+			Changes  []abicheck.ABIChange `json:"changes"`
+			Breaking int                  `json:"breaking"`
+		}{
+			Changes:  changes,
+			Breaking: breaking,
+		})
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		for i := range changes {
+			fmt.Println(changes[i].String())
+		}
+	}
+	return breaking, nil
+}
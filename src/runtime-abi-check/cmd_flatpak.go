@@ -0,0 +1,89 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"fmt"
+	"os"
+)
+
+// installations overrides the flatpak installations searched
+var installations pathList
+
+func init() {
+	cmd := &Command{
+		Name:  "flatpak",
+		Usage: "[flags] <app ref>",
+		Short: "Check that a Flatpak app resolves within its runtime and extensions",
+		Run:   flatpakCommand,
+	}
+	registerCommand(cmd)
+	addStoreFlags(cmd.Flags)
+	addReportFlags(cmd.Flags)
+	cmd.Flags.Var(&installations, "installation", "Flatpak installation directory to search (may be repeated)")
+}
+
+// flatpakCommand will check all of the app's ELF files as the sandbox sees
+// them, so any library only the host provides is reported missing.
+func flatpakCommand(cmd *Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	if sysroot != "" {
+		return fmt.Errorf("-sysroot cannot be used with flatpaks, the runtime is the root")
+	}
+
+	if err := checkFormat(); err != nil {
+		return err
+	}
+	policy, err := newPolicy()
+	if err != nil {
+		return err
+	}
+
+	dirs := []string(installations)
+	if len(dirs) == 0 {
+		dirs = abicheck.FlatpakInstallations()
+	}
+	app, err := abicheck.FindFlatpak(args[0], dirs)
+	if err != nil {
+		return err
+	}
+
+	checker, err := newChecker()
+	if err != nil {
+		return err
+	}
+	if err := checker.Store.SetFlatpak(app); err != nil {
+		return err
+	}
+	checker.Store.SetReportDuplicates(policy.Severity(abicheck.IssueDuplicateSymbol) != abicheck.SeverityIgnore)
+	checker.Store.SetReportShadowed(policy.Severity(abicheck.IssueShadowedLibrary) != abicheck.SeverityIgnore)
+	checker.Store.SetReportFeatures(policy.Severity(abicheck.IssueCPUFeature) != abicheck.SeverityIgnore)
+	reporter := newReporter(policy)
+	checker.SetReporter(reporter)
+	ctx, cancel := scanContext()
+	defer cancel()
+	results, err := checker.CheckTreeContext(ctx, app.Files, jobs)
+	if err != nil {
+		return scanError(err)
+	}
+	app.Rebase(results)
+	return report(results, policy, reporter)
+}
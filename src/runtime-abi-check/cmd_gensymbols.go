@@ -0,0 +1,105 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"fmt"
+	"os"
+)
+
+var (
+	symbolsPackage  string // Package name to use instead of the soname derived one
+	symbolsVersion  string // Package version new symbols are first seen in
+	symbolsPrevious string // Existing symbols file to carry versions over from
+	symbolsArch     string // Debian arch that arch= tags are matched against
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "gensymbols",
+		Usage: "[flags] -version version [path...]",
+		Short: "Generate a Debian symbols file tracking when each symbol appeared",
+		Run:   gensymbolsCommand,
+	}
+	registerCommand(cmd)
+	cmd.Flags.StringVar(&symbolsPackage, "package", "", "Package name for every library (default derived from the soname)")
+	cmd.Flags.StringVar(&symbolsVersion, "version", "", "Package version that new symbols first appeared in")
+	cmd.Flags.StringVar(&symbolsPrevious, "previous", "", "Previous symbols file to keep first-seen versions from")
+	cmd.Flags.StringVar(&symbolsArch, "arch", abicheck.DebianArch(), "Debian architecture the libraries are built for, which arch tags of the previous symbols file are matched against")
+	cmd.Flags.StringVar(&snapshotOutput, "o", "", "Write the symbols file to this file instead of stdout")
+	cmd.Flags.BoolVar(&recursive, "r", false, "Recursively include all shared libraries within directories")
+	addInputFlags(cmd.Flags)
+}
+
+// readSymbolsFile will load the symbols file stored at path
+func readSymbolsFile(path string) (*abicheck.SymbolsFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	symbols, err := abicheck.ReadSymbolsFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return symbols, nil
+}
+
+// gensymbolsCommand will write the symbols file for each library
+func gensymbolsCommand(cmd *Command, args []string) error {
+	args, err := inputArguments(args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 || symbolsVersion == "" {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+
+	for _, path := range args {
+		if st, err := os.Stat(path); err == nil && st.IsDir() && !recursive {
+			return fmt.Errorf("%s is a directory, use -r to include it", path)
+		}
+	}
+
+	var previous *abicheck.SymbolsFile
+	if symbolsPrevious != "" {
+		if previous, err = readSymbolsFile(symbolsPrevious); err != nil {
+			return err
+		}
+	}
+
+	snap, err := abicheck.TakeSnapshot(args)
+	if err != nil {
+		return err
+	}
+	symbols := abicheck.GenerateSymbols(snap, symbolsPackage, symbolsVersion, symbolsArch, previous)
+
+	if snapshotOutput == "" {
+		return symbols.Write(os.Stdout)
+	}
+	f, err := os.Create(snapshotOutput)
+	if err != nil {
+		return err
+	}
+	if err := symbols.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
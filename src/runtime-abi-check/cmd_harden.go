@@ -0,0 +1,104 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "harden",
+		Usage: "[flags] [path...]",
+		Short: "Report RELRO, BIND_NOW, PIE, stack and TEXTREL hardening of each file",
+		Run:   hardenCommand,
+	}
+	registerCommand(cmd)
+	cmd.Flags.StringVar(&outputFormat, "format", "text", "Output format (text, json)")
+	cmd.Flags.BoolVar(&recursive, "r", false, "Recursively check all ELF files within directories")
+	addInputFlags(cmd.Flags)
+}
+
+// fileHardening is the hardening report for a single file
+type fileHardening struct {
+	Path string `json:"path"`
+	*abicheck.Hardening
+}
+
+// yesNo returns the text form of a boolean in the report
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// hardenCommand will print the hardening of each file
+func hardenCommand(cmd *Command, args []string) error {
+	args, err := inputArguments(args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+
+	switch outputFormat {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown output format: %s", outputFormat)
+	}
+
+	paths, err := expandArguments(nil, args)
+	if err != nil {
+		return err
+	}
+
+	var files []fileHardening
+	for _, path := range paths {
+		h, err := abicheck.CheckHardening(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		files = append(files, fileHardening{Path: path, Hardening: h})
+	}
+
+	if outputFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(&struct {
+			Files []fileHardening `json:"files"`
+		}{
+			Files: files,
+		})
+	}
+
+	for _, file := range files {
+		fmt.Printf("%s:\n", file.Path)
+		fmt.Printf("    %-16s %s\n", "RELRO", file.RELRO)
+		fmt.Printf("    %-16s %s\n", "BIND_NOW", yesNo(file.BindNow))
+		fmt.Printf("    %-16s %s\n", "PIE", file.PIE)
+		fmt.Printf("    %-16s %s\n", "Executable stack", yesNo(file.ExecStack))
+		fmt.Printf("    %-16s %s\n", "TEXTREL", yesNo(file.TextRel))
+		fmt.Printf("    %-16s %s\n", "Stack protector", yesNo(file.StackProtector))
+	}
+	return nil
+}
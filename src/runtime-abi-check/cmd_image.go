@@ -0,0 +1,80 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"fmt"
+	"os"
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "image",
+		Usage: "[flags] <image ref or tarball>",
+		Short: "Check that every ELF file within a container image resolves within it",
+		Run:   imageCommand,
+	}
+	registerCommand(cmd)
+	addStoreFlags(cmd.Flags)
+	addReportFlags(cmd.Flags)
+}
+
+// imageCommand will unpack the image and check all of its ELF files using
+// only the image's own libraries and linker configuration.
+func imageCommand(cmd *Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	if sysroot != "" {
+		return fmt.Errorf("-sysroot cannot be used with images, the image is the root")
+	}
+
+	if err := checkFormat(); err != nil {
+		return err
+	}
+	policy, err := newPolicy()
+	if err != nil {
+		return err
+	}
+
+	img, err := abicheck.OpenImage(args[0])
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+
+	sysroot = img.Root
+	checker, err := newChecker()
+	if err != nil {
+		return err
+	}
+	checker.Store.SetReportDuplicates(policy.Severity(abicheck.IssueDuplicateSymbol) != abicheck.SeverityIgnore)
+	checker.Store.SetReportShadowed(policy.Severity(abicheck.IssueShadowedLibrary) != abicheck.SeverityIgnore)
+	checker.Store.SetReportFeatures(policy.Severity(abicheck.IssueCPUFeature) != abicheck.SeverityIgnore)
+	reporter := newReporter(policy)
+	checker.SetReporter(reporter)
+	ctx, cancel := scanContext()
+	defer cancel()
+	results, err := checker.CheckTreeContext(ctx, img.Root, jobs)
+	if err != nil {
+		return scanError(err)
+	}
+	img.Rebase(results)
+	return report(results, policy, reporter)
+}
@@ -0,0 +1,150 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+var (
+	// indexOutput is where the index is written, or stdout if empty
+	indexOutput string
+
+	// indexFormat is how the index is written: json, or db for a database
+	// queried on disk
+	indexFormat string
+
+	// packageRoot is the installed system whose dpkg database names the
+	// package owning each indexed file
+	packageRoot string
+
+	// providesFormat is the output format of the provides command
+	providesFormat string
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "index",
+		Usage: "[flags] <path...>",
+		Short: "Record what every file and package in a tree needs and provides",
+		Run:   indexCommand,
+	}
+	registerCommand(cmd)
+	cmd.Flags.StringVar(&indexOutput, "o", "", "Write the index to this file instead of stdout")
+	cmd.Flags.StringVar(&indexFormat, "format", "json", "Output format: json, or db for a database searched in place rather than read into memory")
+	cmd.Flags.StringVar(&packageRoot, "root", "/", "Root filesystem being indexed, whose dpkg database names the packages and that paths are recorded relative to")
+	cmd.Flags.BoolVar(&recursive, "r", false, "Recursively include all ELF files and packages within directories")
+	cmd.Flags.IntVar(&jobs, "jobs", runtime.NumCPU(), "Number of files to read in parallel")
+	addInputFlags(cmd.Flags)
+
+	cmd = &Command{
+		Name:  "provides",
+		Usage: "[flags] <symbol[@version]> [path...]",
+		Short: "List every library that exports the symbol, and its package",
+		Run:   providesCommand,
+	}
+	registerCommand(cmd)
+	addIndexFlags(cmd.Flags)
+	cmd.Flags.StringVar(&providesFormat, "format", "text", "Output format: text or json")
+}
+
+// indexCommand will write the index of each path
+func indexCommand(cmd *Command, args []string) error {
+	args, err := inputArguments(args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	write := (*abicheck.Index).Write
+	switch indexFormat {
+	case "json":
+	case "db":
+		write = (*abicheck.Index).WriteDatabase
+	default:
+		return fmt.Errorf("unknown output format: %s", indexFormat)
+	}
+	index, err := buildIndex(args)
+	if err != nil {
+		return err
+	}
+	owners, err := abicheck.ReadDpkgOwners(packageRoot)
+	if err != nil {
+		return err
+	}
+	index.SetPackages(packageRoot, owners)
+	index.TrimRoot(packageRoot)
+
+	if indexOutput == "" {
+		return write(index, os.Stdout)
+	}
+	f, err := os.Create(indexOutput)
+	if err != nil {
+		return err
+	}
+	if err := write(index, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// providesCommand will print each library exporting the symbol
+func providesCommand(cmd *Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	if providesFormat != "text" && providesFormat != "json" {
+		return fmt.Errorf("unknown output format: %s", providesFormat)
+	}
+	db, err := loadIndex(args[1:])
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	name, version, _ := strings.Cut(args[0], "@")
+	providers, err := db.Providers(name, version)
+	if err != nil {
+		return err
+	}
+
+	if providesFormat == "json" {
+		if providers == nil {
+			providers = []abicheck.Provider{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(providers)
+	}
+	for _, p := range providers {
+		sym := abicheck.IndexedSymbol{Name: name, Version: p.Version}
+		line := fmt.Sprintf("%s %s %s", sym.String(), p.Library, p.Path)
+		if p.Package != "" {
+			line += " (" + p.Package + ")"
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// symvers lists the Module.symvers, vmlinux or extra modules to take the
+// kernel's exports from
+var symvers pathList
+
+func init() {
+	cmd := &Command{
+		Name:  "modules",
+		Usage: "[flags] <module or directory>...",
+		Short: "Check that kernel modules resolve against the kernel and each other",
+		Run:   modulesCommand,
+	}
+	registerCommand(cmd)
+	addStoreFlags(cmd.Flags)
+	addReportFlags(cmd.Flags)
+	cmd.Flags.Var(&symvers, "symvers", "Module.symvers, vmlinux or module providing exports (default Module.symvers of the running kernel)")
+	cmd.Flags.BoolVar(&recursive, "r", false, "Recursively include all modules within directories")
+}
+
+// defaultSymvers returns the Module.symvers of the running kernel's build
+// tree, if it is installed
+func defaultSymvers() (string, error) {
+	release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join("/lib/modules", strings.TrimSpace(string(release)), "build", "Module.symvers")
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// modulesCommand will resolve the undefined symbols of every module against
+// the kernel's exports and those of the other modules, comparing CRCs when
+// they were built with MODVERSIONS.
+func modulesCommand(cmd *Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	if err := checkFormat(); err != nil {
+		return err
+	}
+	policy, err := newPolicy()
+	if err != nil {
+		return err
+	}
+
+	files := []string(symvers)
+	if len(files) == 0 {
+		path, err := defaultSymvers()
+		if err != nil {
+			return fmt.Errorf("no Module.symvers for the running kernel, give one with -symvers: %v", err)
+		}
+		files = []string{path}
+	}
+	symbols := abicheck.NewKernelSymbols()
+	for _, path := range files {
+		if err := symbols.Load(path); err != nil {
+			return err
+		}
+	}
+
+	var paths []string
+	for _, path := range args {
+		st, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !st.IsDir() {
+			paths = append(paths, path)
+			continue
+		}
+		if !recursive {
+			return fmt.Errorf("%s is a directory, use -r to scan it", path)
+		}
+		if err := abicheck.WalkModules(path, func(p string) error {
+			paths = append(paths, p)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	checker, err := newChecker()
+	if err != nil {
+		return err
+	}
+	reporter := newReporter(policy)
+	checker.SetReporter(reporter)
+	ctx, cancel := scanContext()
+	defer cancel()
+	results, err := checker.CheckModules(ctx, paths, symbols)
+	if err != nil {
+		return scanError(err)
+	}
+	return report(results, policy, reporter)
+}
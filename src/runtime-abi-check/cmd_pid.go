@@ -0,0 +1,125 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "pid",
+		Usage: "[flags] <pid...>",
+		Short: "Check running processes against the libraries now on disk",
+		Run:   pidCommand,
+	}
+	registerCommand(cmd)
+	addStoreFlags(cmd.Flags)
+	addReportFlags(cmd.Flags)
+
+	cmd = &Command{
+		Name:  "core",
+		Usage: "[flags] <core file...>",
+		Short: "Check what crashed processes had loaded against the libraries now on disk",
+		Run:   coreCommand,
+	}
+	registerCommand(cmd)
+	addStoreFlags(cmd.Flags)
+	addReportFlags(cmd.Flags)
+}
+
+// pidCommand will check each process from what it has mapped, using its
+// own LD_LIBRARY_PATH unless one was given
+func pidCommand(cmd *Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	var procs []*abicheck.Process
+	for _, arg := range args {
+		pid, err := strconv.Atoi(arg)
+		if err != nil || pid < 1 {
+			return fmt.Errorf("invalid pid: %s", arg)
+		}
+		proc, err := abicheck.ReadProcess(pid)
+		if err != nil {
+			return err
+		}
+		procs = append(procs, proc)
+	}
+	return checkProcesses(procs)
+}
+
+// coreCommand will check the objects mapped by each process as it dumped
+// core
+func coreCommand(cmd *Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	var procs []*abicheck.Process
+	for _, arg := range args {
+		proc, err := abicheck.ReadCore(arg)
+		if err != nil {
+			return err
+		}
+		procs = append(procs, proc)
+	}
+	return checkProcesses(procs)
+}
+
+// checkProcesses will check and report on each of the processes
+func checkProcesses(procs []*abicheck.Process) error {
+	if err := checkFormat(); err != nil {
+		return err
+	}
+	policy, err := newPolicy()
+	if err != nil {
+		return err
+	}
+	reporter := newReporter(policy)
+	ctx, cancel := scanContext()
+	defer cancel()
+
+	var results []*abicheck.Result
+	for _, proc := range procs {
+		// Each process has its own environment, so gets its own store
+		checker, err := newChecker()
+		if err != nil {
+			return err
+		}
+		if len(libraryPaths) == 0 && !useLdLibraryPath {
+			checker.Store.SetLibraryPath(proc.LibraryPath)
+		}
+		if len(preloads) == 0 && !useLdPreload {
+			checker.Store.SetPreload(proc.Preload)
+		}
+		checker.Store.SetReportDuplicates(policy.Severity(abicheck.IssueDuplicateSymbol) != abicheck.SeverityIgnore)
+		checker.Store.SetReportShadowed(policy.Severity(abicheck.IssueShadowedLibrary) != abicheck.SeverityIgnore)
+		checker.Store.SetReportFeatures(policy.Severity(abicheck.IssueCPUFeature) != abicheck.SeverityIgnore)
+		checker.SetReporter(reporter)
+		res, err := checker.CheckProcess(ctx, proc)
+		if err != nil {
+			return scanError(err)
+		}
+		results = append(results, res...)
+	}
+	return report(results, policy, reporter)
+}
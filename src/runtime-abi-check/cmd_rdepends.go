@@ -0,0 +1,139 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+var (
+	// transitive includes objects only needing a library indirectly
+	transitive bool
+
+	// indexPath is an index written by the index command to search instead
+	indexPath string
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "rdepends",
+		Usage: "[flags] <library> [path...]",
+		Short: "List every file within the paths that needs the library",
+		Run:   rdependsCommand,
+	}
+	registerCommand(cmd)
+	addIndexFlags(cmd.Flags)
+	cmd.Flags.BoolVar(&transitive, "t", false, "Include files only needing the library through other libraries")
+
+	cmd = &Command{
+		Name:  "rdepends-symbol",
+		Usage: "[flags] <symbol[@version]> [path...]",
+		Short: "List every file within the paths that uses the symbol",
+		Run:   rdependsSymbolCommand,
+	}
+	registerCommand(cmd)
+	addIndexFlags(cmd.Flags)
+}
+
+// addIndexFlags will add the flags controlling which index is searched
+func addIndexFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&recursive, "r", false, "Recursively include all ELF files within directories")
+	fs.IntVar(&jobs, "jobs", runtime.NumCPU(), "Number of files to read in parallel")
+	fs.StringVar(&indexPath, "index", "", "Search this index instead of walking paths")
+	addInputFlags(fs)
+}
+
+// loadIndex will open the index or database given with -index, or otherwise
+// index the paths given on the command line
+func loadIndex(args []string) (abicheck.SymbolDatabase, error) {
+	args, err := inputArguments(args)
+	if err != nil {
+		return nil, err
+	}
+	if indexPath != "" {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("paths cannot be searched along with -index")
+		}
+		return abicheck.OpenSymbolDatabase(indexPath)
+	}
+	if len(args) < 1 {
+		return nil, fmt.Errorf("no paths given to search")
+	}
+	index, err := buildIndex(args)
+	if err != nil {
+		return nil, err
+	}
+	return index.Database(), nil
+}
+
+// buildIndex will index the paths, refusing directories unless -r is given
+func buildIndex(args []string) (*abicheck.Index, error) {
+	for _, path := range args {
+		if st, err := os.Stat(path); err == nil && st.IsDir() && !recursive {
+			return nil, fmt.Errorf("%s is a directory, use -r to search it", path)
+		}
+	}
+	return abicheck.BuildIndex(args, jobs)
+}
+
+// rdependsCommand will print each file needing the library
+func rdependsCommand(cmd *Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	db, err := loadIndex(args[1:])
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	paths, err := db.NeededBy(args[0], transitive)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+	return nil
+}
+
+// rdependsSymbolCommand will print each file using the symbol
+func rdependsSymbolCommand(cmd *Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	db, err := loadIndex(args[1:])
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	name, version, _ := strings.Cut(args[0], "@")
+	paths, err := db.UsersOf(name, version)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	showProvides   bool   // Print what the files provide rather than require
+	requiresFormat string // Unlike the other commands, this defaults to rpm
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "requires",
+		Usage: "[flags] [path...]",
+		Short: "Print the soname dependencies of files for RPM or dpkg packaging",
+		Run:   requiresCommand,
+	}
+	registerCommand(cmd)
+	cmd.Flags.StringVar(&requiresFormat, "format", "rpm", "Output format (rpm, dpkg, json)")
+	cmd.Flags.BoolVar(&showProvides, "provides", false, "Print what the files provide instead")
+	cmd.Flags.StringVar(&symbolsPackage, "package", "", "Package name for dpkg shlibs lines (default derived from the soname)")
+	cmd.Flags.BoolVar(&recursive, "r", false, "Recursively include all ELF files within directories")
+	addInputFlags(cmd.Flags)
+}
+
+// requiresCommand will print the merged dependencies of every file, much
+// like rpm's find-requires/find-provides or dpkg-shlibdeps would
+func requiresCommand(cmd *Command, args []string) error {
+	args, err := inputArguments(args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+
+	switch requiresFormat {
+	case "rpm", "dpkg", "json":
+	default:
+		return fmt.Errorf("unknown output format: %s", requiresFormat)
+	}
+
+	paths, err := expandArguments(nil, args)
+	if err != nil {
+		return err
+	}
+	var objects []*abicheck.ObjectDependencies
+	for _, path := range paths {
+		deps, err := abicheck.ReadDependencies(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		objects = append(objects, deps)
+	}
+	provides, requires := abicheck.MergeDependencies(objects)
+
+	switch requiresFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(&struct {
+			Provides []abicheck.SonameDependency `json:"provides"`
+			Requires []abicheck.SonameDependency `json:"requires"`
+		}{
+			Provides: provides,
+			Requires: requires,
+		})
+	case "dpkg":
+		if showProvides {
+			printShlibs(provides)
+		} else {
+			printShlibsDepends(provides, requires)
+		}
+	default:
+		deps := requires
+		if showProvides {
+			deps = provides
+		}
+		for _, dep := range deps {
+			fmt.Println(dep.RPM())
+		}
+	}
+	return nil
+}
+
+// printShlibs prints a Debian shlibs file line for each provided soname
+func printShlibs(provides []abicheck.SonameDependency) {
+	seen := make(map[string]bool)
+	for _, dep := range provides {
+		if dep.Version != "" || seen[dep.Soname] {
+			continue
+		}
+		seen[dep.Soname] = true
+		name, version, ok := abicheck.ShlibsName(dep.Soname)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Skipping %s, no version in the soname\n", dep.Soname)
+			continue
+		}
+		pkg := symbolsPackage
+		if pkg == "" {
+			pkg = abicheck.PackageName(dep.Soname)
+		}
+		fmt.Printf("%s %s %s\n", name, version, pkg)
+	}
+}
+
+// printShlibsDepends prints the shlibs:Depends substvar for every soname
+// required, leaving out those the files provide themselves
+func printShlibsDepends(provides, requires []abicheck.SonameDependency) {
+	own := make(map[string]bool)
+	for _, dep := range provides {
+		own[dep.Soname] = true
+	}
+	seen := make(map[string]bool)
+	var pkgs []string
+	for _, dep := range requires {
+		if own[dep.Soname] {
+			continue
+		}
+		pkg := abicheck.PackageName(dep.Soname)
+		if !seen[pkg] {
+			seen[pkg] = true
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Strings(pkgs)
+	fmt.Printf("shlibs:Depends=%s\n", strings.Join(pkgs, ", "))
+}
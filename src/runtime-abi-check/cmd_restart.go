@@ -0,0 +1,170 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+var (
+	// attributeUnits names the systemd unit of each stale process
+	attributeUnits bool
+
+	// restartFormat is the output format of the needs-restarting command
+	restartFormat string
+)
+
+// staleProcess is a process still running with objects that changed on disk
+type staleProcess struct {
+	PID   int                     `json:"pid"`
+	Exe   string                  `json:"exe"`
+	Unit  string                  `json:"unit,omitempty"`
+	Stale []abicheck.MappedObject `json:"stale"`
+
+	// Failures are the errors checking it against the libraries on disk
+	// now gives, meaning the update changed the ABI it relies on
+	Failures []string `json:"failures"`
+}
+
+func init() {
+	cmd := &Command{
+		Name:  "needs-restarting",
+		Usage: "[flags]",
+		Short: "List running processes still using deleted or replaced libraries",
+		Run:   needsRestartingCommand,
+	}
+	registerCommand(cmd)
+	addStoreFlags(cmd.Flags)
+	cmd.Flags.BoolVar(&attributeUnits, "units", false, "Name the systemd unit each process belongs to")
+	cmd.Flags.StringVar(&restartFormat, "format", "text", "Output format: text or json")
+}
+
+// needsRestartingCommand will check every process mapping stale objects
+// against what's installed now
+func needsRestartingCommand(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	if restartFormat != "text" && restartFormat != "json" {
+		return fmt.Errorf("unknown output format: %s", restartFormat)
+	}
+	pids, err := abicheck.Processes()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := scanContext()
+	defer cancel()
+
+	self := os.Getpid()
+	procs := []staleProcess{}
+	unreadable, broken := 0, 0
+	for _, pid := range pids {
+		if pid == self {
+			continue
+		}
+		proc, err := abicheck.ReadProcess(pid)
+		if err != nil {
+			// Kernel threads have no executable, and others may have exited
+			if os.IsPermission(err) {
+				unreadable++
+			}
+			continue
+		}
+		stale := proc.Stale()
+		if len(stale) == 0 {
+			continue
+		}
+
+		entry := staleProcess{PID: pid, Exe: proc.Exe, Stale: stale, Failures: []string{}}
+		if attributeUnits {
+			entry.Unit = abicheck.SystemdUnit(pid)
+		}
+		checker, err := newChecker()
+		if err != nil {
+			return err
+		}
+		if len(libraryPaths) == 0 && !useLdLibraryPath {
+			checker.Store.SetLibraryPath(proc.LibraryPath)
+		}
+		if len(preloads) == 0 && !useLdPreload {
+			checker.Store.SetPreload(proc.Preload)
+		}
+		results, err := checker.CheckProcess(ctx, proc)
+		if err != nil {
+			return scanError(err)
+		}
+		policy := abicheck.DefaultPolicy()
+		for _, result := range results {
+			for _, obj := range result.Objects {
+				for _, issue := range obj.Issues() {
+					if policy.Severity(issue.Class) == abicheck.SeverityError {
+						entry.Failures = append(entry.Failures, fmt.Sprintf("%s: %v", obj.Path, issue.Err))
+					}
+				}
+			}
+		}
+		if len(entry.Failures) > 0 {
+			broken++
+		}
+		procs = append(procs, entry)
+	}
+	if unreadable > 0 {
+		hint := ""
+		if os.Geteuid() != 0 {
+			hint = ", run as root to see every process"
+		}
+		fmt.Fprintf(os.Stderr, "Skipped %d process(es) that couldn't be read%s\n", unreadable, hint)
+	}
+
+	if restartFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(procs); err != nil {
+			return err
+		}
+	} else {
+		for _, proc := range procs {
+			line := fmt.Sprintf("%d %s", proc.PID, proc.Exe)
+			if proc.Unit != "" {
+				line += " (" + proc.Unit + ")"
+			}
+			fmt.Println(line)
+			for _, obj := range proc.Stale {
+				if obj.Replaced {
+					fmt.Printf("    replaced: %s\n", obj.Path)
+				} else {
+					fmt.Printf("    deleted: %s\n", obj.Path)
+				}
+			}
+			for _, failure := range proc.Failures {
+				fmt.Printf("    %s\n", failure)
+			}
+		}
+	}
+
+	if broken > 0 {
+		return fmt.Errorf("%d process(es) no longer resolve against the installed libraries", broken)
+	}
+	if len(procs) > 0 {
+		return warningsError(len(procs))
+	}
+	return nil
+}
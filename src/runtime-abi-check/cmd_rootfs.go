@@ -0,0 +1,80 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"fmt"
+	"os"
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "rootfs",
+		Usage: "[flags] <tarball or cpio archive>",
+		Short: "Check that every ELF file within an archive resolves within it",
+		Run:   rootfsCommand,
+	}
+	registerCommand(cmd)
+	addStoreFlags(cmd.Flags)
+	addReportFlags(cmd.Flags)
+}
+
+// rootfsCommand will unpack the archive and check all of its ELF files using
+// only its own libraries, as though it were the root filesystem.
+func rootfsCommand(cmd *Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	if sysroot != "" {
+		return fmt.Errorf("-sysroot cannot be used with an archive, it is the root")
+	}
+
+	if err := checkFormat(); err != nil {
+		return err
+	}
+	policy, err := newPolicy()
+	if err != nil {
+		return err
+	}
+
+	img, err := abicheck.OpenRootfs(args[0])
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+
+	sysroot = img.Root
+	checker, err := newChecker()
+	if err != nil {
+		return err
+	}
+	checker.Store.SetReportDuplicates(policy.Severity(abicheck.IssueDuplicateSymbol) != abicheck.SeverityIgnore)
+	checker.Store.SetReportShadowed(policy.Severity(abicheck.IssueShadowedLibrary) != abicheck.SeverityIgnore)
+	checker.Store.SetReportFeatures(policy.Severity(abicheck.IssueCPUFeature) != abicheck.SeverityIgnore)
+	reporter := newReporter(policy)
+	checker.SetReporter(reporter)
+	ctx, cancel := scanContext()
+	defer cancel()
+	results, err := checker.CheckTreeContext(ctx, img.Root, jobs)
+	if err != nil {
+		return scanError(err)
+	}
+	img.Rebase(results)
+	return report(results, policy, reporter)
+}
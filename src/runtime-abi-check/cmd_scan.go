@@ -0,0 +1,689 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// libraryPaths are injected as though they were set in LD_LIBRARY_PATH
+	libraryPaths pathList
+
+	// useLdLibraryPath will also honour the real LD_LIBRARY_PATH
+	useLdLibraryPath bool
+
+	// preloads are loaded into every process as though set in LD_PRELOAD,
+	// and useLdPreload will also honour the real LD_PRELOAD
+	preloads     pathList
+	useLdPreload bool
+
+	// strictWeak will report unresolved weak symbols as failures
+	strictWeak bool
+
+	// lazy only checks the targets, reading libraries as lookups reach them
+	lazy bool
+
+	// sysroot is the target root filesystem for cross-compiled binaries
+	sysroot string
+
+	// symbolDatabase is an index (file, URL or imported store) of the
+	// system to check against in place of the host
+	symbolDatabase string
+
+	// openedDatabase is the -symbol-db once opened, shared by every checker
+	openedDatabase     abicheck.SymbolDatabase
+	openedDatabaseErr  error
+	openedDatabaseOnce sync.Once
+
+	// cacheDir is where parsed symbol tables are persisted
+	cacheDir string
+
+	// noCache disables the persistent symbol cache
+	noCache bool
+
+	// noExecutableExports stops executables providing symbols to plugins
+	noExecutableExports bool
+
+	// vdsoSymbols are extra name[@version] exports of the kernel vDSO
+	vdsoSymbols []string
+
+	// outputFormat controls how results are written (text, json, ...)
+	outputFormat string
+
+	// outputFormats are the valid values for outputFormat
+	outputFormats = []string{"text", "json", "dot", "sarif", "abireport", "markdown", "jsonl", "quiet"}
+
+	// recursive will walk any directory arguments for ELF files
+	recursive bool
+
+	// jobs is the number of files to scan in parallel
+	jobs int
+
+	// timeout gives up on the whole scan after this long, if set
+	timeout time.Duration
+
+	// reportUnused will list DT_NEEDED entries that aren't actually used
+	reportUnused bool
+
+	// reportUnderlinked will list symbols that only resolve transitively
+	reportUnderlinked bool
+
+	// reportDuplicates will list symbols defined more than once per process
+	reportDuplicates bool
+
+	// reportShadowed will list libraries found more than once on the path
+	reportShadowed bool
+
+	// reportFeatures will list CPU features and where processes mix them
+	reportFeatures bool
+
+	// failOnParseError makes objects too malformed to read errors
+	failOnParseError bool
+
+	// severities are the class=severity mappings given on the command line
+	severities []string
+
+	// severityFile is a file of class = severity mappings
+	severityFile string
+
+	// maxDepth limits how many DT_NEEDED links are followed, and noRecurse
+	// is the same as a limit of 1
+	maxDepth  int
+	noRecurse bool
+
+	// ignoreFile lists the issues that should never be reported
+	ignoreFile string
+
+	// dlopenManifest lists the libraries each file is expected to dlopen
+	dlopenManifest string
+
+	// dlopenStrings guesses those from the strings within each file too
+	dlopenStrings bool
+
+	// libc is the C library processes are treated as using
+	libc string
+
+	// pureStore is the Nix or Guix store everything must resolve within
+	pureStore string
+
+	// debugInfo looks up where unresolved symbols came from, and
+	// useDebuginfod lets it download debug files from $DEBUGINFOD_URLS
+	debugInfo     bool
+	useDebuginfod bool
+
+	// hwcaps is the CPU level whose glibc-hwcaps subdirectories are searched
+	hwcaps string
+
+	// privateVersions replace the default private version patterns
+	privateVersions []string
+
+	// reportDir and reportPrefix control where abireport files are written
+	reportDir    string
+	reportPrefix string
+
+	// verbose raises the log level once for each -v, and quietLog drops
+	// it to errors only
+	verbose  verbosity
+	quietLog bool
+
+	// logFormat is how log lines are written (text, json)
+	logFormat string
+
+	// colorMode is whether the text report is coloured (auto, always,
+	// never), and noDemangle leaves C++ names mangled
+	colorMode  string
+	noDemangle bool
+
+	// printStats prints the totals of the run once it's reported
+	printStats bool
+
+	// maxUnresolved and maxMissingLibs are how many unresolved symbol and
+	// missing library errors are allowed before the run fails
+	maxUnresolved  int
+	maxMissingLibs int
+
+	// noProgress hides the progress bar shown when stderr is a terminal
+	noProgress bool
+
+	// progressOut is where the progress of a scan is written
+	progressOut io.Writer = os.Stderr
+)
+
+// Exit codes derived from the highest severity hit, a clean run exits 0
+const (
+	exitError   = 1
+	exitWarning = 2
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "scan",
+		Usage: "[flags] [path...]",
+		Short: "Check that every symbol used by the given files resolves",
+		Run:   scanCommand,
+	}
+	registerCommand(cmd)
+	addStoreFlags(cmd.Flags)
+	addReportFlags(cmd.Flags)
+	addInputFlags(cmd.Flags)
+	cmd.Flags.BoolVar(&recursive, "r", false, "Recursively scan all ELF files within directories")
+	cmd.Flags.BoolVar(&noProgress, "no-progress", false, "Don't show a progress bar and timings, even on a terminal")
+}
+
+// addReportFlags will add the flags controlling how results are reported
+// to the given command.
+func addReportFlags(fs *flag.FlagSet) {
+	fs.StringVar(&outputFormat, "format", "text", "Output format (text, json, jsonl, dot, sarif, abireport, markdown, quiet)")
+	fs.IntVar(&jobs, "jobs", runtime.NumCPU(), "Number of files to scan in parallel")
+	fs.DurationVar(&timeout, "timeout", 0, "Give up if scanning takes longer than this, i.e. 10m (default no limit)")
+	fs.BoolVar(&reportUnused, "unused", false, "Report DT_NEEDED libraries that no symbols are used from (same as -severity unused-library=warn)")
+	fs.BoolVar(&reportUnderlinked, "underlinked", false, "Report symbols of shared libraries not provided by their own DT_NEEDED entries (same as -severity underlinked-symbol=warn)")
+	fs.BoolVar(&reportDuplicates, "duplicates", false, "Report symbols defined by more than one library in a process (same as -severity duplicate-symbol=warn)")
+	fs.BoolVar(&reportShadowed, "shadowed", false, "Report libraries shadowing another copy later in the search path (same as -severity shadowed-library=warn)")
+	fs.BoolVar(&reportFeatures, "cpu-features", false, "Report the CPU features of each object and where a process disagrees on them (same as -severity cpu-feature=warn)")
+	fs.BoolVar(&failOnParseError, "fail-on-parse-error", false, "Fail on ELF files too malformed to read, rather than warn (same as -severity unreadable-object=error)")
+	fs.Var((*stringList)(&severities), "severity", "Map issue classes to error, warn or ignore, i.e. unused-library=warn (repeatable)")
+	fs.StringVar(&severityFile, "severity-file", "", "Read class = severity mappings from this file")
+	fs.StringVar(&reportDir, "report-dir", ".", "Directory to write the abireport files into")
+	fs.StringVar(&reportPrefix, "report-prefix", "", "Prefix for the abireport file names, i.e. abi_")
+	fs.Var(&verbose, "v", "Log more of the scan: libraries found with one, every symbol with two (repeatable)")
+	fs.BoolVar(&quietLog, "q", false, "Only log errors, not each file checked")
+	fs.StringVar(&logFormat, "log-format", "text", "Log format (text, json)")
+	fs.BoolVar(&printStats, "stats", false, "Print the totals of the run (files, libraries, symbols, time and peak memory) to stderr")
+	fs.IntVar(&maxUnresolved, "max-unresolved", 0, "Only fail once more than this many symbols are unresolved")
+	fs.IntVar(&maxMissingLibs, "max-missing-libs", 0, "Only fail once more than this many libraries are missing")
+	fs.StringVar(&colorMode, "color", "auto", "Colour the text report: auto (on a terminal, unless NO_COLOR is set), always or never")
+	fs.BoolVar(&noDemangle, "no-demangle", false, "Show C++ symbol names mangled, as they are in the objects")
+}
+
+// addStoreFlags will add the flags controlling library resolution to the
+// given command.
+func addStoreFlags(fs *flag.FlagSet) {
+	fs.Var(&libraryPaths, "library-path", "Search this directory as though it were in LD_LIBRARY_PATH (repeatable)")
+	fs.BoolVar(&useLdLibraryPath, "use-ld-library-path", false, "Honour the LD_LIBRARY_PATH environment variable")
+	fs.Var(&preloads, "preload", "Load this object ahead of every file's dependencies as though it were in LD_PRELOAD (repeatable)")
+	fs.BoolVar(&useLdPreload, "use-ld-preload", false, "Honour the LD_PRELOAD environment variable")
+	fs.BoolVar(&strictWeak, "strict-weak", false, "Treat unresolved weak symbols as failures")
+	fs.BoolVar(&lazy, "lazy", false, "Only check the files given, reading the symbols of libraries when a lookup first reaches them")
+	fs.StringVar(&sysroot, "sysroot", "", "Resolve system libraries within this target root filesystem")
+	fs.StringVar(&symbolDatabase, "symbol-db", "", "Resolve system libraries from this index (file, http(s) URL or imported store name) instead of the host")
+	fs.StringVar(&cacheDir, "cache-dir", "", "Directory for the persistent symbol cache (default: user cache directory)")
+	fs.BoolVar(&noCache, "no-cache", false, "Don't use the persistent symbol cache")
+	fs.BoolVar(&noExecutableExports, "no-executable-exports", false, "Don't resolve symbols of libraries against the executables being checked with them")
+	fs.Var((*stringList)(&vdsoSymbols), "vdso-symbol", "Treat name[@version] as provided by the kernel vDSO (repeatable)")
+	fs.IntVar(&maxDepth, "max-depth", 0, "Only follow this many levels of DT_NEEDED from each file (default all)")
+	fs.BoolVar(&noRecurse, "no-recurse", false, "Only load and check the direct dependencies of each file (same as -max-depth 1)")
+	fs.StringVar(&ignoreFile, "ignore-file", "", "Never report issues with the libraries, symbols, versions or objects listed in this file")
+	fs.StringVar(&dlopenManifest, "dlopen-manifest", "", "Also check the libraries this file lists as dlopened by each file")
+	fs.BoolVar(&dlopenStrings, "dlopen-strings", false, "Also check libraries named by strings within each file, as it may dlopen them")
+	fs.StringVar(&libc, "libc", abicheck.LibcAuto, "Treat processes as using this libc: glibc, musl, bionic (Android), freebsd, openbsd or auto to tell from each file")
+	fs.StringVar(&pureStore, "pure-store", "", "Resolve only through RUNPATH as on Nix or Guix, flagging references outside this store (nix, guix or a directory)")
+	fs.StringVar(&hwcaps, "hwcaps", "", "Search the glibc-hwcaps (and legacy hwcap) subdirectories for this CPU level, such as x86-64-v3, or host")
+	fs.BoolVar(&debugInfo, "debug-info", false, "Report where unresolved symbols are declared and used, from debug info or separate debug files")
+	fs.BoolVar(&useDebuginfod, "debuginfod", false, "Download missing debug files from the servers in DEBUGINFOD_URLS (implies -debug-info)")
+	fs.Var((*stringList)(&privateVersions), "private-version", "Flag symbols using versions matching this pattern, replacing the default *_PRIVATE (repeatable)")
+}
+
+// newChecker will return a Checker configured from the command line
+func newChecker() (*abicheck.Checker, error) {
+	checker := abicheck.NewChecker()
+	if sysroot != "" {
+		if err := checker.Store.SetSysroot(sysroot); err != nil {
+			return nil, err
+		}
+	}
+	if symbolDatabase != "" {
+		if sysroot != "" {
+			return nil, fmt.Errorf("-symbol-db cannot be used with -sysroot")
+		}
+		openedDatabaseOnce.Do(func() {
+			openedDatabase, openedDatabaseErr = loadSymbolDatabase(symbolDatabase)
+		})
+		if openedDatabaseErr != nil {
+			return nil, openedDatabaseErr
+		}
+		checker.Store.SetSymbolDatabase(openedDatabase)
+	}
+
+	// Copied, so that appending never changes the flag values
+	searchPaths := append(pathList(nil), libraryPaths...)
+	if useLdLibraryPath {
+		searchPaths.Set(os.Getenv("LD_LIBRARY_PATH"))
+	}
+	checker.Store.SetLibraryPath(searchPaths)
+	preloaded := append(pathList(nil), preloads...)
+	if useLdPreload {
+		preloaded = append(preloaded, abicheck.SplitPreload(os.Getenv("LD_PRELOAD"))...)
+	}
+	checker.Store.SetPreload(preloaded)
+	checker.Store.SetStrictWeak(strictWeak)
+	checker.Store.SetLazy(lazy)
+	checker.Store.SetExecutableExports(!noExecutableExports)
+	depth := maxDepth
+	if noRecurse {
+		depth = 1
+	}
+	if depth < 0 {
+		return nil, fmt.Errorf("invalid -max-depth: %d", depth)
+	}
+	checker.Store.SetMaxDepth(depth)
+	if ignoreFile != "" {
+		list, err := abicheck.LoadIgnoreList(ignoreFile)
+		if err != nil {
+			return nil, err
+		}
+		checker.Store.SetIgnoreList(list)
+	}
+	if dlopenManifest != "" {
+		manifest, err := abicheck.LoadDlopenManifest(dlopenManifest)
+		if err != nil {
+			return nil, err
+		}
+		checker.Store.SetDlopenManifest(manifest)
+	}
+	checker.Store.SetDlopenStrings(dlopenStrings)
+	checker.Store.SetHWCaps(hwcaps)
+	if err := checker.Store.SetLibc(libc); err != nil {
+		return nil, err
+	}
+	switch pureStore {
+	case "nix":
+		checker.Store.SetPureStore(abicheck.NixStore)
+	case "guix":
+		checker.Store.SetPureStore(abicheck.GuixStore)
+	default:
+		checker.Store.SetPureStore(pureStore)
+	}
+	if debugInfo || useDebuginfod {
+		var servers []string
+		var cache string
+		if useDebuginfod {
+			servers = abicheck.DebuginfodServers()
+			if len(servers) == 0 {
+				return nil, fmt.Errorf("-debuginfod needs servers listed in DEBUGINFOD_URLS")
+			}
+			dir, err := abicheck.DefaultDebuginfodCacheDir()
+			if err != nil {
+				return nil, err
+			}
+			cache = dir
+		}
+		checker.Store.SetDebugInfo(true, servers, cache)
+	}
+	if privateVersions != nil {
+		if err := checker.Store.SetPrivateVersions(privateVersions); err != nil {
+			return nil, err
+		}
+	}
+	for _, sym := range vdsoSymbols {
+		name, version, _ := strings.Cut(sym, "@")
+		checker.Store.AddVDSOSymbol(name, version)
+	}
+
+	if !noCache {
+		dir := cacheDir
+		if dir == "" {
+			var err error
+			if dir, err = abicheck.DefaultSymbolCacheDir(); err != nil {
+				return nil, err
+			}
+		}
+		cache, err := abicheck.NewSymbolCache(dir)
+		if err != nil {
+			return nil, err
+		}
+		checker.Store.SetCache(cache)
+	}
+	return checker, nil
+}
+
+// loadSymbolDatabase will open the index or database at location, downloading
+// it first (or using the copy already downloaded) when it is a URL
+func loadSymbolDatabase(location string) (abicheck.SymbolDatabase, error) {
+	path := location
+	if abicheck.IsRemoteDatabase(location) {
+		dir, err := abicheck.DefaultDatabaseCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		if path, err = abicheck.FetchDatabase(location, dir); err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(location); os.IsNotExist(err) {
+		if imported, ok := importedStore(location); ok {
+			path = imported
+		}
+	}
+	return abicheck.OpenSymbolDatabase(path)
+}
+
+// newReporter returns the reporter for the requested output format. Progress
+// is logged to stderr, except in quiet mode.
+func newReporter(policy abicheck.Policy) abicheck.Reporter {
+	var reporter abicheck.Reporter
+	switch outputFormat {
+	case "json":
+		reporter = abicheck.NewJSONReporter(os.Stdout, nil)
+	case "dot":
+		reporter = abicheck.NewDotReporter(os.Stdout, nil)
+	case "sarif":
+		reporter = abicheck.NewSARIFReporter(os.Stdout, nil, policy)
+	case "abireport":
+		reporter = abicheck.NewABIReportReporter(reportDir, reportPrefix, nil)
+	case "jsonl":
+		reporter = abicheck.NewJSONLReporter(os.Stdout, nil, policy)
+	case "markdown":
+		reporter = abicheck.NewMarkdownReporter(os.Stdout, nil, policy)
+	case "quiet":
+		return abicheck.QuietReporter{}
+	default:
+		text := abicheck.NewTextReporter(os.Stderr, nil, policy)
+		text.SetColor(useColor(os.Stderr))
+		text.SetDemangle(!noDemangle)
+		reporter = text
+	}
+	return &logReporter{Reporter: reporter, log: newLogger()}
+}
+
+// useColor determines whether the text report written to f should be
+// coloured, following -color and the NO_COLOR convention
+func useColor(f *os.File) bool {
+	switch colorMode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	return os.Getenv("NO_COLOR") == "" && isTerminal(f)
+}
+
+// newLogger returns the logger for the progress of a scan, at the level
+// picked by -v and -q
+func newLogger() *abicheck.Logger {
+	level := abicheck.LogInfo + abicheck.LogLevel(verbose)
+	if level > abicheck.LogTrace {
+		level = abicheck.LogTrace
+	}
+	if quietLog {
+		level = abicheck.LogError
+	}
+	return abicheck.NewLogger(progressOut, level, logFormat == "json")
+}
+
+// logReporter logs each event of a scan before passing it on
+type logReporter struct {
+	abicheck.Reporter
+	log *abicheck.Logger
+}
+
+// Event logs the event
+func (r *logReporter) Event(ev abicheck.Event) {
+	r.log.Event(ev)
+	r.Reporter.Event(ev)
+}
+
+// checkFormat will ensure the requested output format is supported
+func checkFormat() error {
+	if logFormat != "text" && logFormat != "json" {
+		return fmt.Errorf("unknown log format: %s", logFormat)
+	}
+	switch colorMode {
+	case "auto", "always", "never":
+	default:
+		return fmt.Errorf("unknown -color mode: %s", colorMode)
+	}
+	if maxUnresolved < 0 || maxMissingLibs < 0 {
+		return fmt.Errorf("-max-unresolved and -max-missing-libs cannot be negative")
+	}
+	if quietLog && verbose > 0 {
+		return fmt.Errorf("-q cannot be used with -v")
+	}
+	for _, format := range outputFormats {
+		if format == outputFormat {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format: %s", outputFormat)
+}
+
+// newPolicy will build the severity policy from the command line. Explicit
+// mappings override the file, which overrides the shorthand flags.
+func newPolicy() (abicheck.Policy, error) {
+	policy := abicheck.DefaultPolicy()
+	if reportUnused {
+		policy[abicheck.IssueUnusedLibrary] = abicheck.SeverityWarn
+	}
+	if reportUnderlinked {
+		policy[abicheck.IssueUnderlinkedSymbol] = abicheck.SeverityWarn
+	}
+	if reportDuplicates {
+		policy[abicheck.IssueDuplicateSymbol] = abicheck.SeverityWarn
+	}
+	if reportShadowed {
+		policy[abicheck.IssueShadowedLibrary] = abicheck.SeverityWarn
+	}
+	if reportFeatures {
+		policy[abicheck.IssueCPUFeature] = abicheck.SeverityWarn
+	}
+	if failOnParseError {
+		policy[abicheck.IssueUnreadableObject] = abicheck.SeverityError
+	}
+	if severityFile != "" {
+		if err := policy.LoadPolicy(severityFile); err != nil {
+			return nil, err
+		}
+	}
+	for _, spec := range severities {
+		if err := policy.Set(spec); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// scanCommand will handle setting up the store and scanning a set of paths
+// to begin resolution..
+func scanCommand(cmd *Command, args []string) error {
+	args, err := inputArguments(args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+
+	if err := checkFormat(); err != nil {
+		return err
+	}
+	policy, err := newPolicy()
+	if err != nil {
+		return err
+	}
+
+	checker, err := newChecker()
+	if err != nil {
+		return err
+	}
+	checker.Store.SetReportDuplicates(policy.Severity(abicheck.IssueDuplicateSymbol) != abicheck.SeverityIgnore)
+	checker.Store.SetReportShadowed(policy.Severity(abicheck.IssueShadowedLibrary) != abicheck.SeverityIgnore)
+	checker.Store.SetReportFeatures(policy.Severity(abicheck.IssueCPUFeature) != abicheck.SeverityIgnore)
+
+	// Nobody is watching a quiet scan
+	var bar *progressBar
+	if !noProgress && outputFormat != "quiet" {
+		bar = newProgressBar(os.Stderr)
+	}
+	if bar != nil {
+		progressOut = bar
+	}
+	reporter := newReporter(policy)
+	checker.SetReporter(&progressReporter{Reporter: reporter, bar: bar})
+
+	bar.Phase("walk", 0)
+	paths, err := expandArguments(checker, args)
+	if err != nil {
+		bar.Finish()
+		return err
+	}
+	ctx, cancel := scanContext()
+	defer cancel()
+	bar.Phase("scan", len(paths))
+	results, err := checker.CheckAllContext(ctx, paths, jobs)
+	bar.Finish()
+	if err != nil {
+		return scanError(err)
+	}
+	return report(results, policy, reporter)
+}
+
+// scanContext returns the context for a scan, cancelled on an interrupt or
+// once the -timeout passes
+func scanContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	if timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// scanError explains why a scan stopped short, if it was cancelled
+func scanError(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("scan timed out after %v", timeout)
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("scan interrupted")
+	}
+	return err
+}
+
+// report will complete the reporter with the results, returning an error if
+// any issues were hit at error severity, or warningsError if there were
+// only warnings. Unresolved symbols and missing libraries within the
+// -max-unresolved and -max-missing-libs allowances don't count.
+func report(results []*abicheck.Result, policy abicheck.Policy, reporter abicheck.Reporter) error {
+	if err := reporter.Complete(results); err != nil {
+		return err
+	}
+
+	stats := countStats(results, policy)
+	if printStats {
+		stats.write(os.Stderr)
+	}
+	errs, warnings := countIssues(results, policy)
+	if stats.unresolvedErrors <= maxUnresolved {
+		errs -= stats.unresolvedErrors
+	}
+	if stats.missingErrors <= maxMissingLibs {
+		errs -= stats.missingErrors
+	}
+	if errs > 0 {
+		return fmt.Errorf("%d resolution failure(s)", errs)
+	}
+	if warnings > 0 {
+		return warningsError(warnings)
+	}
+	return nil
+}
+
+// countIssues returns how many issues within the results are at error and
+// warning severity
+func countIssues(results []*abicheck.Result, policy abicheck.Policy) (errs, warnings int) {
+	for _, result := range objects(results) {
+		for _, issue := range result.Issues() {
+			switch policy.Severity(issue.Class) {
+			case abicheck.SeverityError:
+				errs++
+			case abicheck.SeverityWarn:
+				warnings++
+			}
+		}
+	}
+	return errs, warnings
+}
+
+// warningsError is returned when the only issues hit were warnings, so
+// that the process may exit with exitWarning.
+type warningsError int
+
+// Error returns the number of warnings hit
+func (w warningsError) Error() string {
+	return fmt.Sprintf("%d warning(s)", int(w))
+}
+
+// expandArguments will turn the command line arguments into the set of files
+// to scan, walking directories for ELF files when recursion is enabled.
+// Package files are laid over the checker's store so that their contents
+// are checked together, as though they were installed.
+func expandArguments(checker *abicheck.Checker, args []string) ([]string, error) {
+	var paths []string
+	for _, path := range args {
+		st, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if checker != nil && !st.IsDir() && abicheck.IsPackage(path) {
+			overlay, err := abicheck.ReadPackage(path)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, checker.Store.AddOverlay(overlay)...)
+			continue
+		}
+		if !st.IsDir() {
+			paths = append(paths, path)
+			continue
+		}
+		if !recursive {
+			return nil, fmt.Errorf("%s is a directory, use -r to scan it", path)
+		}
+		err = abicheck.WalkELF(path, func(p string) error {
+			paths = append(paths, p)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// objects returns every object within the results, in scan order
+func objects(results []*abicheck.Result) []*abicheck.ObjectResult {
+	var ret []*abicheck.ObjectResult
+	for _, r := range results {
+		ret = append(ret, r.Objects...)
+	}
+	return ret
+}
@@ -0,0 +1,361 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// listenAddress is where the serve command accepts requests
+	listenAddress string
+
+	// maxUpload is the largest binary accepted by the serve command
+	maxUpload int64
+
+	// allowedPaths are the directories whose files may be checked by
+	// ?path=, which is refused when there are none
+	allowedPaths pathList
+)
+
+// errNotObject is all a client is told about a file it can't have checked,
+// so that nothing of the file itself leaks back in the error
+const errNotObject = "not an ELF executable or shared library"
+
+func init() {
+	cmd := &Command{
+		Name:  "serve",
+		Usage: "[flags]",
+		Short: "Check binaries submitted over HTTP, returning JSON reports",
+		Run:   serveCommand,
+	}
+	registerCommand(cmd)
+	addStoreFlags(cmd.Flags)
+	cmd.Flags.StringVar(&listenAddress, "listen", "localhost:8080", "Address to serve the HTTP API on")
+	cmd.Flags.Int64Var(&maxUpload, "max-upload", 256<<20, "Largest binary accepted, in bytes")
+	cmd.Flags.Var(&allowedPaths, "allow-path", "Permit ?path= to check files within this directory (repeatable)")
+	cmd.Flags.StringVar(&indexPath, "index", "", "Answer /resolve queries from this index, written by the index command")
+	cmd.Flags.BoolVar(&reportUnused, "unused", false, "Report DT_NEEDED libraries that no symbols are used from (same as -severity unused-library=warn)")
+	cmd.Flags.BoolVar(&reportUnderlinked, "underlinked", false, "Report symbols of shared libraries not provided by their own DT_NEEDED entries (same as -severity underlinked-symbol=warn)")
+	cmd.Flags.BoolVar(&reportDuplicates, "duplicates", false, "Report symbols defined by more than one library in a process (same as -severity duplicate-symbol=warn)")
+	cmd.Flags.BoolVar(&reportShadowed, "shadowed", false, "Report libraries shadowing another copy later in the search path (same as -severity shadowed-library=warn)")
+	cmd.Flags.BoolVar(&reportFeatures, "cpu-features", false, "Report the CPU features of each object and where a process disagrees on them (same as -severity cpu-feature=warn)")
+	cmd.Flags.Var((*stringList)(&severities), "severity", "Map issue classes to error, warn or ignore, i.e. unused-library=warn (repeatable)")
+	cmd.Flags.StringVar(&severityFile, "severity-file", "", "Read class = severity mappings from this file")
+}
+
+// serveCommand will answer check requests until killed. The checker is set
+// up once, and every request gets a fork of its store, so reports are always
+// complete while the linker configuration and symbol cache stay warm between
+// them.
+func serveCommand(cmd *Command, args []string) error {
+	if len(args) > 0 {
+		cmd.Flags.Usage()
+		return fmt.Errorf("serve takes no arguments")
+	}
+	policy, err := newPolicy()
+	if err != nil {
+		return err
+	}
+	checker, err := newChecker()
+	if err != nil {
+		return err
+	}
+	checker.Store.SetReportDuplicates(policy.Severity(abicheck.IssueDuplicateSymbol) != abicheck.SeverityIgnore)
+	checker.Store.SetReportShadowed(policy.Severity(abicheck.IssueShadowedLibrary) != abicheck.SeverityIgnore)
+	checker.Store.SetReportFeatures(policy.Severity(abicheck.IssueCPUFeature) != abicheck.SeverityIgnore)
+	roots, err := allowedRoots(allowedPaths)
+	if err != nil {
+		return err
+	}
+	var db abicheck.SymbolDatabase
+	if indexPath != "" {
+		if db, err = loadIndex(nil); err != nil {
+			return err
+		}
+		defer db.Close()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/check", func(w http.ResponseWriter, r *http.Request) {
+		serveCheck(w, r, checker, roots, policy)
+	})
+	mux.HandleFunc("/check/stream", func(w http.ResponseWriter, r *http.Request) {
+		serveCheckStream(w, r, checker, roots, policy)
+	})
+	if db != nil {
+		mux.HandleFunc("/resolve", func(w http.ResponseWriter, r *http.Request) {
+			serveResolve(w, r, db)
+		})
+	}
+	mux.Handle(grpcPrefix, &grpcServer{checker: checker, db: db, policy: policy})
+
+	// gRPC clients speak HTTP/2 without TLS, on the same address
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	server := &http.Server{Addr: listenAddress, Handler: mux, Protocols: &protocols}
+	fmt.Fprintf(os.Stderr, "Serving on http://%s\n", listenAddress)
+	return server.ListenAndServe()
+}
+
+// serveCheck will check the binary named by the path parameter, or else the
+// one uploaded as the request body, writing the JSON report. The number of
+// issues at each severity is given in the X-Abi-Errors and X-Abi-Warnings
+// headers.
+func serveCheck(w http.ResponseWriter, r *http.Request, base *abicheck.Checker, roots []string, policy abicheck.Policy) {
+	checker, target, ok := serveTarget(w, r, base, roots)
+	if !ok {
+		return
+	}
+	result, err := checker.CheckContext(r.Context(), target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to check %s: %v\n", target, err)
+		http.Error(w, errNotObject, http.StatusUnprocessableEntity)
+		return
+	}
+	results := []*abicheck.Result{result}
+	errs, warnings := countIssues(results, policy)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Abi-Errors", strconv.Itoa(errs))
+	w.Header().Set("X-Abi-Warnings", strconv.Itoa(warnings))
+	if err := abicheck.NewJSONReporter(w, nil).Complete(results); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write report for %s: %v\n", target, err)
+	}
+}
+
+// streamEvent is a line of a /check/stream response, written as the check
+// finds each library, or for each issue of an object once the binary is
+// checked
+type streamEvent struct {
+	Event    string              `json:"event"` // library, issue or error
+	Path     string              `json:"path,omitempty"`
+	Class    abicheck.IssueClass `json:"class,omitempty"`
+	Severity string              `json:"severity,omitempty"`
+	Message  string              `json:"message"`
+}
+
+// streamComplete is the last line of a /check/stream response
+type streamComplete struct {
+	Event    string `json:"event"` // Always complete
+	Target   string `json:"target"`
+	Errors   int    `json:"errors"`
+	Warnings int    `json:"warnings"`
+}
+
+// serveCheckStream will check the binary as serveCheck does, streaming each
+// library found as a line of JSON while the check runs, then each issue the
+// policy doesn't ignore. The last line carries the issue counts, which
+// aren't known when the headers are sent.
+func serveCheckStream(w http.ResponseWriter, r *http.Request, base *abicheck.Checker, roots []string, policy abicheck.Policy) {
+	checker, target, ok := serveTarget(w, r, base, roots)
+	if !ok {
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	var mu sync.Mutex
+	write := func(line interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(line)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	streamEvents(checker.Store, policy, func(ev *streamEvent) { write(ev) })
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	result, err := checker.CheckContext(r.Context(), target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to check %s: %v\n", target, err)
+		write(&streamEvent{Event: "error", Message: errNotObject})
+		return
+	}
+	errs, warnings := countIssues([]*abicheck.Result{result}, policy)
+	write(&streamComplete{Event: "complete", Target: target, Errors: errs, Warnings: warnings})
+}
+
+// streamEvents will pass each library found by scans of the store to send,
+// along with any errors, then the issues of each object the policy doesn't
+// ignore as each scan completes
+func streamEvents(store *abicheck.SymbolStore, policy abicheck.Policy, send func(*streamEvent)) {
+	store.SetEventHandler(func(ev abicheck.Event) {
+		switch ev := ev.(type) {
+		case *abicheck.LibraryFoundEvent:
+			send(&streamEvent{Event: "library", Path: ev.Path, Message: ev.String()})
+		case *abicheck.ErrorEvent:
+			send(&streamEvent{Event: "error", Message: ev.String()})
+		case *abicheck.ScanCompleteEvent:
+			for _, obj := range ev.Result.Objects {
+				for _, issue := range obj.Issues() {
+					if severity := policy.Severity(issue.Class); severity != abicheck.SeverityIgnore {
+						send(&streamEvent{Event: "issue", Path: obj.Path, Class: issue.Class, Severity: severity.String(), Message: issue.Err.Error()})
+					}
+				}
+			}
+		}
+	})
+}
+
+// serveTarget returns a fork of the checker for the request, along with the
+// path of the binary to check: the path parameter, if within one of the
+// roots, or else the upload laid over the host. The error is already
+// answered when false is returned.
+func serveTarget(w http.ResponseWriter, r *http.Request, base *abicheck.Checker, roots []string) (*abicheck.Checker, string, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "POST a binary, or ?path= one on this host", http.StatusMethodNotAllowed)
+		return nil, "", false
+	}
+
+	checker := base.Fork()
+	target := r.URL.Query().Get("path")
+	if target != "" {
+		if len(roots) == 0 {
+			http.Error(w, "checking files on this host needs serve -allow-path", http.StatusForbidden)
+			return nil, "", false
+		}
+		resolved, ok := allowedPath(target, roots)
+		if !ok {
+			http.Error(w, "path not within an allowed directory", http.StatusForbidden)
+			return nil, "", false
+		}
+		target = resolved
+	} else {
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUpload))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return nil, "", false
+		}
+		upload, ok := uploadTarget(checker, r.URL.Query().Get("name"), data)
+		if !ok {
+			http.Error(w, errNotObject, http.StatusBadRequest)
+			return nil, "", false
+		}
+		target = upload
+	}
+	return checker, target, true
+}
+
+// uploadTarget will lay the uploaded binary over the host in the checker's
+// store, returning the path to check it at, or false if it isn't a single
+// dynamic ELF object
+func uploadTarget(checker *abicheck.Checker, name string, data []byte) (string, bool) {
+	// Uploads are laid over the host under their own name, so $ORIGIN
+	// still means something
+	name = path.Base("/" + name)
+	if name == "/" || name == "." {
+		name = "upload"
+	}
+	overlay := abicheck.NewOverlay()
+	overlay.AddFile("/upload/"+name, data)
+	paths := checker.Store.AddOverlay(overlay)
+	if len(paths) != 1 {
+		return "", false
+	}
+	return paths[0], true
+}
+
+// allowedRoots returns each of the directories with symlinks resolved, so
+// that paths can be compared against them
+func allowedRoots(dirs []string) ([]string, error) {
+	var ret []string
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		resolved, err := filepath.EvalSymlinks(abs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -allow-path: %v", err)
+		}
+		ret = append(ret, resolved)
+	}
+	return ret, nil
+}
+
+// allowedPath returns the real path of the file, and whether it lies within
+// one of the roots. Symlinks are resolved first so none can lead out of them.
+func allowedPath(p string, roots []string) (string, bool) {
+	if !filepath.IsAbs(p) {
+		return "", false
+	}
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", false
+	}
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return resolved, true
+		}
+	}
+	return "", false
+}
+
+// serveResolve will answer which libraries in the index provide the symbol
+// and version parameters, optionally only those for the machine parameter
+// (i.e. EM_X86_64, or just x86_64).
+func serveResolve(w http.ResponseWriter, r *http.Request, db abicheck.SymbolDatabase) {
+	query := r.URL.Query()
+	symbol := query.Get("symbol")
+	if symbol == "" {
+		http.Error(w, "no symbol given", http.StatusBadRequest)
+		return
+	}
+	providers, err := resolveProviders(db, symbol, query.Get("version"), query.Get("machine"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(providers); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write providers of %s: %v\n", symbol, err)
+	}
+}
+
+// resolveProviders returns the libraries in the database providing the
+// symbol, of any version if empty, for the machine if one is given
+func resolveProviders(db abicheck.SymbolDatabase, symbol, version, machine string) ([]abicheck.Provider, error) {
+	found, err := db.Providers(symbol, version)
+	if err != nil {
+		return nil, err
+	}
+	providers := []abicheck.Provider{}
+	for _, p := range found {
+		if machine == "" || strings.EqualFold(p.Machine, machine) || strings.EqualFold(p.Machine, "EM_"+machine) {
+			providers = append(providers, p)
+		}
+	}
+	return providers, nil
+}
@@ -0,0 +1,75 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"fmt"
+	"os"
+)
+
+// snapshotOutput is where the snapshot is written, or stdout if empty
+var snapshotOutput string
+
+func init() {
+	cmd := &Command{
+		Name:  "snapshot",
+		Usage: "[flags] [path...]",
+		Short: "Record the exported symbols of libraries as a baseline for diff",
+		Run:   snapshotCommand,
+	}
+	registerCommand(cmd)
+	cmd.Flags.StringVar(&snapshotOutput, "o", "", "Write the snapshot to this file instead of stdout")
+	cmd.Flags.BoolVar(&recursive, "r", false, "Recursively snapshot all shared libraries within directories")
+	addInputFlags(cmd.Flags)
+}
+
+// snapshotCommand will write the exported ABI of each library
+func snapshotCommand(cmd *Command, args []string) error {
+	args, err := inputArguments(args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+
+	for _, path := range args {
+		if st, err := os.Stat(path); err == nil && st.IsDir() && !recursive {
+			return fmt.Errorf("%s is a directory, use -r to snapshot it", path)
+		}
+	}
+
+	snap, err := abicheck.TakeSnapshot(args)
+	if err != nil {
+		return err
+	}
+
+	if snapshotOutput == "" {
+		return snap.Write(os.Stdout)
+	}
+	f, err := os.Create(snapshotOutput)
+	if err != nil {
+		return err
+	}
+	if err := snap.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
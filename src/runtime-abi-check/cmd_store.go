@@ -0,0 +1,218 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+var (
+	// exportImage is a container image to export instead of the sysroot
+	exportImage string
+
+	// importName is what an imported store is known as to -symbol-db
+	importName string
+
+	// storeCommands are the subcommands of store, by name
+	storeCommands = make(map[string]*Command)
+)
+
+// storeExtension is given to stores saved within the database cache
+const storeExtension = ".abidb"
+
+func init() {
+	registerCommand(&Command{
+		Name:  "store",
+		Usage: "<export|import> [flags] <file>",
+		Short: "Save the system libraries as a symbol store, or import one for -symbol-db",
+		Run:   storeCommand,
+	})
+
+	cmd := &Command{
+		Name:  "store export",
+		Usage: "[flags] <file>",
+		Short: "Save every system library of the host, sysroot or image to the file",
+		Run:   storeExportCommand,
+	}
+	setupCommand(cmd)
+	storeCommands["export"] = cmd
+	cmd.Flags.StringVar(&sysroot, "sysroot", "", "Export the libraries within this target root filesystem")
+	cmd.Flags.StringVar(&exportImage, "image", "", "Export the libraries within this container image")
+	cmd.Flags.IntVar(&jobs, "jobs", runtime.NumCPU(), "Number of files to read in parallel")
+
+	cmd = &Command{
+		Name:  "store import",
+		Usage: "[flags] <file>",
+		Short: "Keep an exported store so that -symbol-db can use it by name",
+		Run:   storeImportCommand,
+	}
+	setupCommand(cmd)
+	storeCommands["import"] = cmd
+	cmd.Flags.StringVar(&importName, "name", "", "Name to import the store as, instead of its file name")
+}
+
+// storeCommand will run the store subcommand
+func storeCommand(cmd *Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	sub, ok := storeCommands[args[0]]
+	if !ok {
+		var names []string
+		for name := range storeCommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown store command %s, expected one of: %s", args[0], strings.Join(names, ", "))
+	}
+	return runCommand(sub, args[1:])
+}
+
+// storeExportCommand will index every system library into the file
+func storeExportCommand(cmd *Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	if sysroot != "" && exportImage != "" {
+		return fmt.Errorf("-sysroot cannot be used with -image, the image is the root")
+	}
+
+	root := sysroot
+	if exportImage != "" {
+		img, err := abicheck.OpenImage(exportImage)
+		if err != nil {
+			return err
+		}
+		defer img.Close()
+		root = img.Root
+	}
+
+	store := abicheck.NewSymbolStore()
+	if root != "" {
+		if err := store.SetSysroot(root); err != nil {
+			return err
+		}
+	} else {
+		root = "/"
+	}
+	libs, err := store.SystemLibraries()
+	if err != nil {
+		return err
+	}
+	index, err := abicheck.BuildIndex(libs, jobs)
+	if err != nil {
+		return err
+	}
+	owners, err := abicheck.ReadDpkgOwners(root)
+	if err != nil {
+		return err
+	}
+	index.SetPackages(root, owners)
+	index.TrimRoot(root)
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	if err := index.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d libraries to %s\n", len(index.Objects), args[0])
+	return nil
+}
+
+// storeImportCommand will copy the store into the database cache, once it
+// is known to be readable
+func storeImportCommand(cmd *Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+	name := importName
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+	}
+	if name == "" || strings.ContainsRune(name, '/') || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid store name: %q", name)
+	}
+
+	db, err := abicheck.OpenSymbolDatabase(args[0])
+	if err != nil {
+		return err
+	}
+	db.Close()
+	in, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	dir, err := abicheck.DefaultDatabaseCacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	out, err := os.CreateTemp(dir, ".import-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(out.Name(), filepath.Join(dir, name+storeExtension)); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Imported %s, check against it with -symbol-db %s\n", args[0], name)
+	return nil
+}
+
+// importedStore returns where the store imported under name is kept, if
+// there is one
+func importedStore(name string) (string, bool) {
+	if strings.ContainsRune(name, '/') {
+		return "", false
+	}
+	dir, err := abicheck.DefaultDatabaseCacheDir()
+	if err != nil {
+		return "", false
+	}
+	path := filepath.Join(dir, name+storeExtension)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
@@ -0,0 +1,65 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"os"
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "tree",
+		Usage: "[flags] [path...]",
+		Short: "Print the resolved dependency tree of each file, like ldd but without running it",
+		Run:   treeCommand,
+	}
+	registerCommand(cmd)
+	addStoreFlags(cmd.Flags)
+	addInputFlags(cmd.Flags)
+	cmd.Flags.BoolVar(&recursive, "r", false, "Recursively include all ELF files within directories")
+}
+
+// treeCommand will check each file and then print its dependency tree,
+// exiting as scan would for the issues found along the way
+func treeCommand(cmd *Command, args []string) error {
+	args, err := inputArguments(args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+
+	checker, err := newChecker()
+	if err != nil {
+		return err
+	}
+	paths, err := expandArguments(checker, args)
+	if err != nil {
+		return err
+	}
+	results, err := checker.CheckAll(paths, 1)
+	if err != nil {
+		return err
+	}
+	if err := abicheck.WriteTree(os.Stdout, objects(results)); err != nil {
+		return err
+	}
+	return report(results, abicheck.DefaultPolicy(), abicheck.QuietReporter{})
+}
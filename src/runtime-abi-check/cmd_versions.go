@@ -0,0 +1,98 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "versions",
+		Usage: "[flags] [path...]",
+		Short: "Report the newest symbol version required per namespace (GLIBC, GLIBCXX, ...)",
+		Run:   versionsCommand,
+	}
+	registerCommand(cmd)
+	cmd.Flags.StringVar(&outputFormat, "format", "text", "Output format (text, json)")
+	cmd.Flags.BoolVar(&recursive, "r", false, "Recursively scan all ELF files within directories")
+	addInputFlags(cmd.Flags)
+}
+
+// fileVersions is the versions report for a single file
+type fileVersions struct {
+	Path     string                        `json:"path"`
+	Versions []abicheck.VersionRequirement `json:"versions"`
+}
+
+// versionsCommand will print the minimum version requirements of each file
+func versionsCommand(cmd *Command, args []string) error {
+	args, err := inputArguments(args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+
+	switch outputFormat {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown output format: %s", outputFormat)
+	}
+
+	paths, err := expandArguments(nil, args)
+	if err != nil {
+		return err
+	}
+
+	var files []fileVersions
+	for _, path := range paths {
+		versions, err := abicheck.RequiredVersions(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		files = append(files, fileVersions{Path: path, Versions: versions})
+	}
+
+	if outputFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(&struct {
+			Files []fileVersions `json:"files"`
+		}{
+			Files: files,
+		})
+	}
+
+	for _, file := range files {
+		fmt.Printf("%s:\n", file.Path)
+		for _, req := range file.Versions {
+			fmt.Printf("    %-12s %s", req.Namespace, req.Version)
+			if len(req.Symbols) > 0 {
+				fmt.Printf(" (%s)", strings.Join(req.Symbols, ", "))
+			}
+			fmt.Println()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func init() {
+	cmd := &Command{
+		Name:  "why",
+		Usage: "[flags] <file> <library>",
+		Short: "Explain why a file ends up loading a library, and what it uses from it",
+		Run:   whyCommand,
+	}
+	registerCommand(cmd)
+	addStoreFlags(cmd.Flags)
+}
+
+// whyCommand will print every dependency chain from the file to the library
+func whyCommand(cmd *Command, args []string) error {
+	if len(args) != 2 {
+		cmd.Flags.Usage()
+		os.Exit(1)
+	}
+
+	checker, err := newChecker()
+	if err != nil {
+		return err
+	}
+	result, err := checker.Check(args[0])
+	if err != nil {
+		return err
+	}
+
+	chains, complete := abicheck.WhyLoaded(result.Objects, args[0], args[1])
+	if len(chains) == 0 {
+		return fmt.Errorf("%s doesn't load %s", args[0], args[1])
+	}
+	for i, chain := range chains {
+		if i > 0 {
+			fmt.Println()
+		}
+		names := []string{chain[0].Importer}
+		for _, link := range chain {
+			names = append(names, link.Library)
+		}
+		fmt.Println(strings.Join(names, " -> "))
+		for _, link := range chain {
+			used := "nothing"
+			if len(link.Symbols) > 0 {
+				used = strings.Join(link.Symbols, ", ")
+			}
+			fmt.Printf("    %s uses from %s: %s\n", link.Importer, link.Library, used)
+		}
+	}
+	if !complete {
+		fmt.Fprintf(os.Stderr, "Only showing the first %d chains\n", len(chains))
+	}
+	return nil
+}
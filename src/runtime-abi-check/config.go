@@ -0,0 +1,248 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// configName is the per-project configuration, found by looking in the
+// working directory and then each of its parents, as git does
+const configName = ".abicheck.toml"
+
+var (
+	// profile picks the [profile.NAME] table of the configuration
+	profile string
+
+	// noConfig skips looking for the configuration altogether
+	noConfig bool
+)
+
+// configPathFlags take paths, which are relative to the configuration file
+// rather than wherever the command happens to be run from
+var configPathFlags = map[string]bool{
+	"library-path":    true,
+	"preload":         true,
+	"sysroot":         true,
+	"cache-dir":       true,
+	"ignore-file":     true,
+	"severity-file":   true,
+	"dlopen-manifest": true,
+	"report-dir":      true,
+}
+
+// projectConfig is what was read from the configuration file, by table.
+// Top level keys are in the "" table.
+type projectConfig struct {
+	path   string
+	tables map[string][]abicheck.TOMLSetting
+}
+
+// addConfigFlags will add the flags selecting the configuration to the
+// given command
+func addConfigFlags(fs *flag.FlagSet) {
+	fs.StringVar(&profile, "profile", "", "Also apply the [profile.NAME] table of "+configName)
+	fs.BoolVar(&noConfig, "no-config", false, "Don't read "+configName+" from the working directory or its parents")
+}
+
+// findConfig returns the path of the nearest configuration file, if any
+func findConfig() (string, bool) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", false
+	}
+	for {
+		path := filepath.Join(dir, configName)
+		if st, err := os.Stat(path); err == nil && st.Mode().IsRegular() {
+			return path, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// readConfig will parse the configuration file at path, see
+// abicheck.ReadTOML for the subset of TOML understood
+func readConfig(path string) (*projectConfig, error) {
+	settings, err := abicheck.ReadTOML(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &projectConfig{path: path, tables: make(map[string][]abicheck.TOMLSetting)}
+	for _, setting := range settings {
+		cfg.tables[setting.Table] = append(cfg.tables[setting.Table], setting)
+	}
+	return cfg, nil
+}
+
+// knownFlag determines whether any command has the flag, so that settings
+// for other commands can be shared within the one file
+func knownFlag(name string) bool {
+	for _, cmd := range commands {
+		if cmd.Flags.Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// apply will set the command's flags from the top level of the
+// configuration, its [severity] table and then those of the profile. It's
+// done before the command line is parsed, so that anything given there
+// wins, and repeatable flags get the command line values last.
+func (c *projectConfig) apply(fs *flag.FlagSet, profile string) error {
+	tables := []string{"", "severity"}
+	if profile != "" {
+		name := "profile." + profile
+		if _, ok := c.tables[name]; !ok {
+			if _, ok := c.tables[name+".severity"]; !ok {
+				return fmt.Errorf("%s: no such profile: %s (has %s)", c.path, profile, strings.Join(c.profileNames(), ", "))
+			}
+		}
+		tables = append(tables, name, name+".severity")
+	}
+	for _, table := range tables {
+		for _, setting := range c.tables[table] {
+			if err := c.set(fs, table, setting); err != nil {
+				return fmt.Errorf("%s:%d: %v", c.path, setting.Line, err)
+			}
+		}
+	}
+	// Tables nobody reads are almost certainly typos
+	for table := range c.tables {
+		if table != "" && table != "severity" && !strings.HasPrefix(table, "profile.") {
+			return fmt.Errorf("%s: unknown table [%s]", c.path, table)
+		}
+	}
+	return nil
+}
+
+// set will apply a single setting to the flags
+func (c *projectConfig) set(fs *flag.FlagSet, table string, setting abicheck.TOMLSetting) error {
+	name := setting.Key
+	if table == "severity" || strings.HasSuffix(table, ".severity") {
+		if fs.Lookup("severity") == nil {
+			return nil
+		}
+		for _, v := range setting.Values {
+			if err := fs.Set("severity", name+"="+v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if fs.Lookup(name) == nil {
+		if knownFlag(name) {
+			return nil
+		}
+		return fmt.Errorf("unknown setting: %s", name)
+	}
+	dir := filepath.Dir(c.path)
+	for _, v := range setting.Values {
+		if configPathFlags[name] && v != "" && !filepath.IsAbs(v) {
+			v = filepath.Join(dir, v)
+		}
+		if err := fs.Set(name, v); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// boolFlag is implemented by flags that don't take a separate value
+type boolFlag interface {
+	IsBoolFlag() bool
+}
+
+// configArgs finds -profile and -no-config on the command line ahead of it
+// being parsed, as the configuration has to be applied first. The values of
+// the other flags are skipped over just as the flag package would.
+func configArgs(fs *flag.FlagSet, args []string) (profile string, skip bool) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-" || arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		switch name {
+		case "profile":
+			if !hasValue && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			profile = value
+		case "no-config":
+			skip = !hasValue || value == "true"
+		default:
+			f := fs.Lookup(name)
+			if f == nil || hasValue {
+				continue
+			}
+			if b, ok := f.Value.(boolFlag); ok && b.IsBoolFlag() {
+				continue
+			}
+			i++
+		}
+	}
+	return profile, skip
+}
+
+// loadConfig will apply the nearest configuration to the command's flags,
+// unless -no-config was given
+func loadConfig(cmd *Command, args []string) error {
+	profile, skip := configArgs(cmd.Flags, args)
+	if skip {
+		return nil
+	}
+	path, ok := findConfig()
+	if !ok {
+		if profile != "" {
+			return fmt.Errorf("-profile %s needs a %s", profile, configName)
+		}
+		return nil
+	}
+	cfg, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+	return cfg.apply(cmd.Flags, profile)
+}
+
+// profileNames returns the profiles defined by the configuration, sorted
+func (c *projectConfig) profileNames() []string {
+	seen := make(map[string]bool)
+	for table := range c.tables {
+		if rest, ok := strings.CutPrefix(table, "profile."); ok {
+			seen[strings.TrimSuffix(rest, ".severity")] = true
+		}
+	}
+	var ret []string
+	for name := range seen {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
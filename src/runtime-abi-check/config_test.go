@@ -0,0 +1,64 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestConfigArgs(t *testing.T) {
+	tests := []struct {
+		args    string
+		profile string
+		skip    bool
+	}{
+		{args: "", profile: ""},
+		{args: "-profile ci /bin/ls", profile: "ci"},
+		{args: "--profile=ci", profile: "ci"},
+		{args: "-jobs 2 -profile ci x", profile: "ci"},
+		{args: "-v -profile=ci", profile: "ci"},
+		{args: "-v=true -no-config", skip: true},
+		{args: "-no-config=false", skip: false},
+		{args: "-no-config=true", skip: true},
+		// The values of other flags aren't mistaken for these
+		{args: "-format -no-config", skip: false},
+		{args: "-format -profile -profile ci", profile: "ci"},
+		{args: "-format=json -no-config", skip: true},
+		// Flags end at the first argument, or - and --
+		{args: "/bin/ls -profile ci", profile: ""},
+		{args: "-- -profile ci", profile: ""},
+		{args: "- -no-config", skip: false},
+		// Unknown flags are left for the flag package to complain about
+		{args: "-bogus -profile ci", profile: "ci"},
+		{args: "-profile", profile: ""},
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("jobs", 1, "")
+	fs.Bool("v", false, "")
+	fs.String("format", "text", "")
+	fs.String("profile", "", "")
+	fs.Bool("no-config", false, "")
+
+	for _, tt := range tests {
+		profile, skip := configArgs(fs, strings.Fields(tt.args))
+		if profile != tt.profile || skip != tt.skip {
+			t.Errorf("configArgs(%q) = %q, %v; want %q, %v", tt.args, profile, skip, tt.profile, tt.skip)
+		}
+	}
+}
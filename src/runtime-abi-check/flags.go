@@ -0,0 +1,80 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// pathList is a repeatable command line flag which also accepts colon
+// separated lists of directories, much like LD_LIBRARY_PATH
+type pathList []string
+
+// String returns the flag value in LD_LIBRARY_PATH form
+func (p *pathList) String() string {
+	return strings.Join(*p, ":")
+}
+
+// Set will append the (possibly colon separated) value to the list
+func (p *pathList) Set(value string) error {
+	for _, dir := range strings.Split(value, ":") {
+		if dir == "" {
+			continue
+		}
+		*p = append(*p, dir)
+	}
+	return nil
+}
+
+// stringList is a repeatable command line flag collecting each value
+type stringList []string
+
+// String returns the values separated by commas
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set will append the value to the list
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// verbosity is a boolean flag counting how many times it was given, so that
+// -v -v is more verbose than -v
+type verbosity int
+
+// String returns the count
+func (v *verbosity) String() string {
+	return strconv.Itoa(int(*v))
+}
+
+// Set will count the flag once more, unless explicitly set to false
+func (v *verbosity) Set(value string) error {
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	if on {
+		*v++
+	}
+	return nil
+}
+
+// IsBoolFlag allows the flag to be given without a value
+func (v *verbosity) IsBoolFlag() bool { return true }
@@ -0,0 +1,351 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// grpcPrefix is where the methods of the SymbolService in abicheck.proto
+// are found. The messages are few and small enough that they're encoded by
+// hand here, rather than pulling in the gRPC and protobuf modules.
+const grpcPrefix = "/abicheck.v1.SymbolService/"
+
+// grpcMaxMessage is the largest message accepted, as with gRPC's default
+const grpcMaxMessage = 4 << 20
+
+// Status codes of the gRPC protocol that the service answers with
+const (
+	grpcOK                 = 0
+	grpcInvalidArgument    = 3
+	grpcResourceExhausted  = 8
+	grpcFailedPrecondition = 9
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+)
+
+// grpcStatus is an error ending the call with a status other than internal
+type grpcStatus struct {
+	Code    int
+	Message string
+}
+
+// Error returns the message sent to the client
+func (g *grpcStatus) Error() string {
+	return g.Message
+}
+
+// grpcServer answers the SymbolService over HTTP/2, checking binaries with
+// forks of the checker as the HTTP API does
+type grpcServer struct {
+	checker *abicheck.Checker
+	db      abicheck.SymbolDatabase // nil without -index
+	policy  abicheck.Policy
+}
+
+// ServeHTTP will answer a call to one of the service's methods, ending it
+// with the grpc-status and grpc-message trailers
+func (g *grpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC calls need HTTP/2 and application/grpc", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+
+	var err error
+	switch strings.TrimPrefix(r.URL.Path, grpcPrefix) {
+	case "Resolve":
+		err = g.resolve(w, r)
+	case "CheckBinary":
+		err = g.checkBinary(w, r)
+	default:
+		err = &grpcStatus{grpcUnimplemented, "unknown method " + r.URL.Path}
+	}
+
+	status := &grpcStatus{Code: grpcOK}
+	if err != nil && !errors.As(err, &status) {
+		status = &grpcStatus{grpcInternal, err.Error()}
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(status.Code))
+	if status.Message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", grpcEscape(status.Message))
+	}
+}
+
+// resolve will answer a ResolveRequest with the providers of the symbol,
+// as serveResolve does
+func (g *grpcServer) resolve(w http.ResponseWriter, r *http.Request) error {
+	if g.db == nil {
+		return &grpcStatus{grpcFailedPrecondition, "serve was started without -index"}
+	}
+	msg, err := readGRPCMessage(r.Body)
+	if err == io.EOF {
+		return &grpcStatus{grpcInvalidArgument, "no request sent"}
+	} else if err != nil {
+		return err
+	}
+	var symbol, version, machine string
+	err = protoFields(msg, func(field int, value []byte) {
+		switch field {
+		case 1:
+			symbol = string(value)
+		case 2:
+			version = string(value)
+		case 3:
+			machine = string(value)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if symbol == "" {
+		return &grpcStatus{grpcInvalidArgument, "no symbol given"}
+	}
+
+	providers, err := resolveProviders(g.db, symbol, version, machine)
+	if err != nil {
+		return err
+	}
+	var resp protoMessage
+	for _, p := range providers {
+		var provider protoMessage
+		provider.string(1, p.Library)
+		provider.string(2, p.Path)
+		provider.string(3, p.Package)
+		provider.string(4, p.Machine)
+		provider.string(5, p.Version)
+		resp.message(1, provider)
+	}
+	return writeGRPCMessage(w, resp)
+}
+
+// checkBinary will read the chunks of a binary, then check it against the
+// host, sending an event for everything serveCheckStream has a line for
+func (g *grpcServer) checkBinary(w http.ResponseWriter, r *http.Request) error {
+	var name string
+	var data []byte
+	for first := true; ; first = false {
+		msg, err := readGRPCMessage(r.Body)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		err = protoFields(msg, func(field int, value []byte) {
+			switch {
+			case field == 1 && first:
+				name = string(value)
+			case field == 2:
+				data = append(data, value...)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) > maxUpload {
+			return &grpcStatus{grpcResourceExhausted, "binary is larger than -max-upload"}
+		}
+	}
+
+	checker := g.checker.Fork()
+	target, ok := uploadTarget(checker, name, data)
+	if !ok {
+		return &grpcStatus{grpcInvalidArgument, errNotObject}
+	}
+	var mu sync.Mutex
+	var sendErr error
+	send := func(ev protoMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		if sendErr == nil {
+			sendErr = writeGRPCMessage(w, ev)
+		}
+	}
+	streamEvents(checker.Store, g.policy, func(ev *streamEvent) { send(grpcEvent(ev)) })
+
+	result, err := checker.CheckContext(r.Context(), target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to check %s: %v\n", target, err)
+		return &grpcStatus{grpcInvalidArgument, errNotObject}
+	}
+	errs, warnings := countIssues([]*abicheck.Result{result}, g.policy)
+	var complete, ev protoMessage
+	complete.string(1, target)
+	complete.int(2, errs)
+	complete.int(3, warnings)
+	ev.message(3, complete)
+	send(ev)
+	return sendErr
+}
+
+// grpcEvent returns the CheckBinaryEvent for the line serveCheckStream
+// would write
+func grpcEvent(ev *streamEvent) protoMessage {
+	var ret, m protoMessage
+	switch ev.Event {
+	case "library":
+		m.string(1, ev.Path)
+		m.string(2, ev.Message)
+		ret.message(1, m)
+	case "issue":
+		m.string(1, ev.Path)
+		m.string(2, string(ev.Class))
+		m.string(3, ev.Severity)
+		m.string(4, ev.Message)
+		ret.message(2, m)
+	default:
+		ret.string(4, ev.Message)
+	}
+	return ret
+}
+
+// readGRPCMessage returns the next length prefixed message of the call,
+// or io.EOF once the client has sent them all
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err == io.ErrUnexpectedEOF {
+		return nil, &grpcStatus{grpcInvalidArgument, "truncated message"}
+	} else if err != nil {
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, &grpcStatus{grpcUnimplemented, "compressed messages are not supported"}
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > grpcMaxMessage {
+		return nil, &grpcStatus{grpcResourceExhausted, fmt.Sprintf("message of %d bytes is larger than %d", size, grpcMaxMessage)}
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, &grpcStatus{grpcInvalidArgument, "truncated message"}
+	} else if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeGRPCMessage will send the message to the client straight away
+func writeGRPCMessage(w http.ResponseWriter, msg protoMessage) error {
+	prefix := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	if _, err := w.Write(append(prefix, msg...)); err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// grpcEscape will percent encode the message for the grpc-message trailer
+func grpcEscape(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// protoMessage is a protobuf message being encoded. Fields holding their
+// zero value are left out, as proto3 does.
+type protoMessage []byte
+
+// key appends the tag of the field
+func (m *protoMessage) key(field, wireType int) {
+	*m = binary.AppendUvarint(*m, uint64(field)<<3|uint64(wireType))
+}
+
+// string appends a string field
+func (m *protoMessage) string(field int, value string) {
+	if value == "" {
+		return
+	}
+	m.key(field, 2)
+	*m = binary.AppendUvarint(*m, uint64(len(value)))
+	*m = append(*m, value...)
+}
+
+// int appends an int32 field
+func (m *protoMessage) int(field int, value int) {
+	if value == 0 {
+		return
+	}
+	m.key(field, 0)
+	*m = binary.AppendUvarint(*m, uint64(int64(value)))
+}
+
+// message appends an embedded message, even an empty one, so that it
+// can be set as a member of a oneof
+func (m *protoMessage) message(field int, value protoMessage) {
+	m.key(field, 2)
+	*m = binary.AppendUvarint(*m, uint64(len(value)))
+	*m = append(*m, value...)
+}
+
+// errBadMessage is returned for a message that isn't valid protobuf
+var errBadMessage = &grpcStatus{grpcInvalidArgument, "malformed protobuf message"}
+
+// protoFields will call fn with the value of each string, bytes or message
+// field of the message, skipping fields of any other type
+func protoFields(msg []byte, fn func(field int, value []byte)) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 || key>>3 == 0 {
+			return errBadMessage
+		}
+		msg = msg[n:]
+		switch key & 7 {
+		case 0:
+			if _, n = binary.Uvarint(msg); n <= 0 {
+				return errBadMessage
+			}
+			msg = msg[n:]
+		case 1, 5:
+			size := 8
+			if key&7 == 5 {
+				size = 4
+			}
+			if len(msg) < size {
+				return errBadMessage
+			}
+			msg = msg[size:]
+		case 2:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || size > uint64(len(msg)-n) {
+				return errBadMessage
+			}
+			fn(int(key>>3), msg[n:n+int(size)])
+			msg = msg[n+int(size):]
+		default:
+			return errBadMessage
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// grpcFrame returns the message with its length prefix
+func grpcFrame(msg protoMessage) []byte {
+	prefix := make([]byte, 5)
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	return append(prefix, msg...)
+}
+
+func TestProtoFields(t *testing.T) {
+	var m protoMessage
+	m.string(1, "deflate")
+	m.int(2, 300)
+	m.string(3, "")
+	var inner protoMessage
+	inner.string(1, "x")
+	m.message(4, inner)
+	m.message(5, nil)
+
+	type field struct {
+		Field int
+		Value string
+	}
+	var got []field
+	if err := protoFields(m, func(f int, v []byte) { got = append(got, field{f, string(v)}) }); err != nil {
+		t.Fatal(err)
+	}
+	want := []field{{1, "deflate"}, {4, "\x0a\x01x"}, {5, ""}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	bad := []struct {
+		name string
+		msg  string
+	}{
+		{"field zero", "\x02\x00"},
+		{"truncated key", "\x80"},
+		{"truncated varint", "\x08\x80"},
+		{"truncated fixed64", "\x09\x00\x00"},
+		{"truncated fixed32", "\x0d\x00"},
+		{"length past the end", "\x0a\x05abc"},
+		{"huge length", "\x0a\xff\xff\xff\xff\xff\xff\xff\xff\x7f"},
+		{"group", "\x0b"},
+	}
+	for _, test := range bad {
+		if err := protoFields([]byte(test.msg), func(int, []byte) {}); err != errBadMessage {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+	}
+}
+
+func TestReadGRPCMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		msg  string
+		code int // -1 for io.EOF
+	}{
+		{name: "message", data: grpcFrame(protoMessage("abc")), msg: "abc"},
+		{name: "empty message", data: grpcFrame(nil), msg: ""},
+		{name: "none left", data: nil, code: -1},
+		{name: "truncated prefix", data: []byte{0, 0}, code: grpcInvalidArgument},
+		{name: "truncated message", data: []byte{0, 0, 0, 0, 4, 'a'}, code: grpcInvalidArgument},
+		{name: "no message after prefix", data: []byte{0, 0, 0, 0, 4}, code: grpcInvalidArgument},
+		{name: "compressed", data: []byte{1, 0, 0, 0, 0}, code: grpcUnimplemented},
+		{name: "too large", data: []byte{0, 0xff, 0xff, 0xff, 0xff}, code: grpcResourceExhausted},
+	}
+	for _, test := range tests {
+		msg, err := readGRPCMessage(bytes.NewReader(test.data))
+		switch status, _ := err.(*grpcStatus); {
+		case test.code == -1:
+			if err != io.EOF {
+				t.Errorf("%s: got %v, want EOF", test.name, err)
+			}
+		case test.code != 0:
+			if status == nil || status.Code != test.code {
+				t.Errorf("%s: got %v, want status %d", test.name, err, test.code)
+			}
+		case err != nil || string(msg) != test.msg:
+			t.Errorf("%s: got %q, %v", test.name, msg, err)
+		}
+	}
+}
+
+// grpcCall returns the messages and status of the call over h2c
+func grpcCall(t *testing.T, url, method string, msgs ...protoMessage) ([][]byte, string, string) {
+	var body []byte
+	for _, msg := range msgs {
+		body = append(body, grpcFrame(msg)...)
+	}
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+	req, _ := http.NewRequest(http.MethodPost, url+grpcPrefix+method, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/grpc")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var ret [][]byte
+	for {
+		msg, err := readGRPCMessage(resp.Body)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		ret = append(ret, msg)
+	}
+	return ret, resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+}
+
+func TestGRPCResolve(t *testing.T) {
+	ix := &abicheck.Index{Objects: []abicheck.IndexedObject{
+		{Path: "/lib/libz.so.1", Soname: "libz.so.1", Machine: "EM_X86_64", Exports: []abicheck.IndexedSymbol{{Name: "deflate", Version: "ZLIB_1"}}},
+		{Path: "/lib32/libz.so.1", Soname: "libz.so.1", Machine: "EM_386", Exports: []abicheck.IndexedSymbol{{Name: "deflate", Version: "ZLIB_1"}}},
+	}}
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	ts := httptest.NewUnstartedServer(&grpcServer{db: ix.Database()})
+	ts.Config.Protocols = &protocols
+	ts.Start()
+	defer ts.Close()
+
+	var req protoMessage
+	req.string(1, "deflate")
+	req.string(3, "x86_64")
+	msgs, status, message := grpcCall(t, ts.URL, "Resolve", req)
+	if status != "0" || len(msgs) != 1 {
+		t.Fatalf("got %d messages, status %s %q", len(msgs), status, message)
+	}
+	var provider, want protoMessage
+	want.string(1, "libz.so.1")
+	want.string(2, "/lib/libz.so.1")
+	want.string(4, "EM_X86_64")
+	want.string(5, "ZLIB_1")
+	protoFields(msgs[0], func(field int, value []byte) {
+		if field == 1 {
+			provider = append(protoMessage(nil), value...)
+		}
+	})
+	if !bytes.Equal(provider, want) {
+		t.Errorf("got provider %q, want %q", provider, want)
+	}
+
+	if _, status, message = grpcCall(t, ts.URL, "Resolve", nil); status != "3" || message != "no symbol given" {
+		t.Errorf("no symbol: status %s %q", status, message)
+	}
+	if _, status, _ = grpcCall(t, ts.URL, "Missing", req); status != "12" {
+		t.Errorf("unknown method: status %s", status)
+	}
+}
+
+func TestGRPCCheckBinaryInvalid(t *testing.T) {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	ts := httptest.NewUnstartedServer(&grpcServer{checker: abicheck.NewChecker()})
+	ts.Config.Protocols = &protocols
+	ts.Start()
+	defer ts.Close()
+
+	var first, second protoMessage
+	first.string(1, "upload")
+	first.string(2, "root:")
+	second.string(2, "x:0:0")
+	msgs, status, message := grpcCall(t, ts.URL, "CheckBinary", first, second)
+	if len(msgs) != 0 || status != "3" || message != errNotObject {
+		t.Errorf("got %d messages, status %s %q", len(msgs), status, message)
+	}
+}
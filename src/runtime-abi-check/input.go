@@ -0,0 +1,119 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"strings"
+)
+
+// filesFrom are files listing further paths to check, "-" being stdin
+var filesFrom []string
+
+// addInputFlags will add the flags for reading paths from files to the
+// given command
+func addInputFlags(fs *flag.FlagSet) {
+	fs.Var((*stringList)(&filesFrom), "files-from", "Also check the paths listed in this file, one per line, or - for stdin (repeatable)")
+}
+
+// inputArguments will return the paths given on the command line along with
+// those read from -files-from lists. A lone "-" argument also reads paths
+// from stdin, so that the output of find can be piped straight in. stdin is
+// only ever read once.
+//
+// Lists are often every file of a tree, so any regular file in them that
+// isn't an ELF object or package is quietly skipped.
+func inputArguments(args []string) ([]string, error) {
+	var ret []string
+	stdinRead := false
+
+	readList := func(name string) error {
+		var data []byte
+		var err error
+		if name == "-" {
+			if stdinRead {
+				return nil
+			}
+			stdinRead = true
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return err
+		}
+		for _, path := range splitList(data) {
+			if wanted(path) {
+				ret = append(ret, path)
+			}
+		}
+		return nil
+	}
+
+	for _, arg := range args {
+		if arg != "-" {
+			ret = append(ret, arg)
+			continue
+		}
+		if err := readList(arg); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range filesFrom {
+		if err := readList(name); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// wanted determines whether a path read from a list should be checked.
+// Paths that can't be looked at are kept so that they're reported, while
+// directories and the like are dropped, as find lists those too.
+func wanted(path string) bool {
+	st, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	if !st.Mode().IsRegular() {
+		return false
+	}
+	return abicheck.IsPackage(path) || abicheck.IsDynamicELF(path)
+}
+
+// splitList will split a list of paths on newlines, or on NUL characters
+// when given the output of find -print0. Empty entries are dropped.
+func splitList(data []byte) []string {
+	sep := "\n"
+	if bytes.IndexByte(data, 0) >= 0 {
+		sep = "\x00"
+	}
+	var ret []string
+	for _, line := range strings.Split(string(data), sep) {
+		if sep == "\n" {
+			line = strings.TrimRight(line, "\r")
+		}
+		if line != "" {
+			ret = append(ret, line)
+		}
+	}
+	return ret
+}
@@ -21,21 +21,45 @@ import (
 	"os"
 )
 
-// mainRoutine will handle setting up the store and scanning a set of paths
-// to begin resolution..
-func mainRoutine(paths []string) error {
-	store := NewSymbolStore()
-	for _, p := range paths {
-		if err := store.ScanPath(p); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func main() {
-	if err := mainRoutine([]string{"/usr/bin/gedit"}); err != nil {
-		fmt.Fprintf(os.Stderr, "Cannot recover from error: %v\n", err)
+	if len(os.Args) < 2 {
+		usage()
 		os.Exit(1)
 	}
+
+	args := os.Args[1:]
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage()
+		return
+	}
+
+	cmd, ok := commands[args[0]]
+	if ok {
+		args = args[1:]
+	} else {
+		cmd = commands[defaultCommand]
+	}
+
+	err := runCommand(cmd, args)
+	if w, ok := err.(warningsError); ok {
+		fmt.Fprintf(os.Stderr, "%v\n", w)
+		os.Exit(exitWarning)
+	}
+	if b, ok := err.(breakingError); ok {
+		fmt.Fprintf(os.Stderr, "%v\n", b)
+		os.Exit(exitError)
+	}
+	if a, ok := err.(additionsError); ok {
+		fmt.Fprintf(os.Stderr, "%v\n", a)
+		os.Exit(exitWarning)
+	}
+	if r, ok := err.(regressionError); ok {
+		fmt.Fprintf(os.Stderr, "%v\n", r)
+		os.Exit(exitError)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot recover from error: %v\n", err)
+		os.Exit(exitError)
+	}
 }
@@ -0,0 +1,179 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressWidth is how many cells the bar itself takes up
+const progressWidth = 30
+
+// progressInterval limits how often the bar is redrawn as targets complete
+const progressInterval = 100 * time.Millisecond
+
+// phaseTime is how long one phase of a scan took
+type phaseTime struct {
+	name string
+	took time.Duration
+}
+
+// progressBar draws how far through its targets a scan is on the last line
+// of a terminal, keeping it below everything else written through it. A nil
+// bar draws nothing, so callers needn't care whether it's enabled.
+type progressBar struct {
+	out *os.File
+	mu  sync.Mutex
+
+	phase       string
+	done, total int
+	started     time.Time // Of the current phase
+	drawn       time.Time // Zero when the bar isn't on screen
+	times       []phaseTime
+}
+
+// newProgressBar returns a bar drawn on out, or nil when out isn't a
+// terminal (i.e. piped or redirected to a file) as nobody would see it
+func newProgressBar(out *os.File) *progressBar {
+	if !isTerminal(out) {
+		return nil
+	}
+	return &progressBar{out: out}
+}
+
+// isTerminal determines whether f is a terminal able to take escape codes
+func isTerminal(f *os.File) bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// Phase ends the current phase, timing it, and starts the named one. total
+// is how many steps it takes, or 0 when that isn't known.
+func (p *progressBar) Phase(name string, total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.endPhase()
+	p.phase, p.done, p.total = name, 0, total
+	p.started = time.Now()
+	p.draw()
+}
+
+// Step marks one more step of the phase as done
+func (p *progressBar) Step() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if p.done == p.total || time.Since(p.drawn) >= progressInterval {
+		p.draw()
+	}
+}
+
+// Write will write b above the bar, so that the progress of a scan can be
+// written through it
+func (p *progressBar) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	n, err := p.out.Write(b)
+	p.draw()
+	return n, err
+}
+
+// Finish ends the last phase, removes the bar and prints how long each
+// phase took
+func (p *progressBar) Finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.endPhase()
+	p.clear()
+	p.phase = ""
+	parts := make([]string, 0, len(p.times))
+	for _, t := range p.times {
+		parts = append(parts, fmt.Sprintf("%s %v", t.name, t.took.Round(time.Millisecond)))
+	}
+	if len(parts) > 0 {
+		fmt.Fprintf(p.out, "Took %s\n", strings.Join(parts, ", "))
+	}
+}
+
+// endPhase records how long the current phase took
+func (p *progressBar) endPhase() {
+	if p.phase != "" {
+		p.times = append(p.times, phaseTime{p.phase, time.Since(p.started)})
+	}
+}
+
+// clear removes the bar from the screen, if it's there
+func (p *progressBar) clear() {
+	if !p.drawn.IsZero() {
+		io.WriteString(p.out, "\r\033[K")
+		p.drawn = time.Time{}
+	}
+}
+
+// draw replaces the bar on screen with the current progress
+func (p *progressBar) draw() {
+	if p.phase == "" {
+		return
+	}
+	elapsed := time.Since(p.started)
+	line := fmt.Sprintf("%s %v", p.phase, elapsed.Round(time.Second))
+	if p.total > 0 {
+		filled := progressWidth * p.done / p.total
+		bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+		line = fmt.Sprintf("%s [%s] %3d%% %d/%d", p.phase, bar, 100*p.done/p.total, p.done, p.total)
+		if p.done > 0 && p.done < p.total {
+			eta := elapsed / time.Duration(p.done) * time.Duration(p.total-p.done)
+			line += fmt.Sprintf(" ETA %v", eta.Round(time.Second))
+		}
+	}
+	fmt.Fprintf(p.out, "\r\033[K%s", line)
+	p.drawn = time.Now()
+}
+
+// progressReporter steps the bar as each target is checked, passing
+// everything on to the real reporter
+type progressReporter struct {
+	abicheck.Reporter
+	bar *progressBar
+}
+
+// Event steps the bar once a target is complete
+func (r *progressReporter) Event(ev abicheck.Event) {
+	if _, ok := ev.(*abicheck.ScanCompleteEvent); ok {
+		r.bar.Step()
+	}
+	r.Reporter.Event(ev)
+}
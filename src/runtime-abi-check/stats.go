@@ -0,0 +1,100 @@
+//
+// Copyright © 2017 Ikey Doherty
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"abicheck"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+)
+
+// startTime is when the run began, for the -stats total
+var startTime = time.Now()
+
+// scanStats are the totals printed at the end of a run with -stats
+type scanStats struct {
+	files      int // Targets checked
+	libraries  int // Other objects loaded for them
+	resolved   int
+	unresolved int // Unresolved symbols the policy doesn't ignore
+	missing    int
+
+	// Those of the above at error severity, which are what -max-unresolved
+	// and -max-missing-libs allow for
+	unresolvedErrors int
+	missingErrors    int
+}
+
+// countStats totals up the results
+func countStats(results []*abicheck.Result, policy abicheck.Policy) scanStats {
+	stats := scanStats{files: len(results)}
+	for _, result := range results {
+		for _, obj := range result.Objects {
+			if !obj.Target {
+				stats.libraries++
+			}
+			for _, sym := range obj.Symbols {
+				if sym.Provider != "" {
+					stats.resolved++
+				}
+			}
+			for _, issue := range obj.Issues() {
+				severity := policy.Severity(issue.Class)
+				if severity == abicheck.SeverityIgnore {
+					continue
+				}
+				isError := severity == abicheck.SeverityError
+				switch issue.Class {
+				case abicheck.IssueUnresolvedSymbol:
+					stats.unresolved++
+					if isError {
+						stats.unresolvedErrors++
+					}
+				case abicheck.IssueMissingLibrary:
+					stats.missing++
+					if isError {
+						stats.missingErrors++
+					}
+				}
+			}
+		}
+	}
+	return stats
+}
+
+// peakMemory returns the most memory the process has had resident, in bytes
+func peakMemory() uint64 {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+	// Linux reports kilobytes
+	return uint64(usage.Maxrss) * 1024
+}
+
+// write prints the totals as an aligned block
+func (s *scanStats) write(w io.Writer) {
+	fmt.Fprintf(w, "Files scanned:       %d\n", s.files)
+	fmt.Fprintf(w, "Libraries loaded:    %d\n", s.libraries)
+	fmt.Fprintf(w, "Symbols resolved:    %d\n", s.resolved)
+	fmt.Fprintf(w, "Symbols unresolved:  %d\n", s.unresolved)
+	fmt.Fprintf(w, "Missing libraries:   %d\n", s.missing)
+	fmt.Fprintf(w, "Time:                %v\n", time.Since(startTime).Round(time.Millisecond))
+	fmt.Fprintf(w, "Peak memory:         %.1f MiB\n", float64(peakMemory())/(1<<20))
+}